@@ -1,22 +1,44 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/docker/go-units"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
+	"github.com/Affell/swarm-manager/backend/pkg/alerts"
+	"github.com/Affell/swarm-manager/backend/pkg/audit"
+	"github.com/Affell/swarm-manager/backend/pkg/auth"
+	"github.com/Affell/swarm-manager/backend/pkg/events"
+	"github.com/Affell/swarm-manager/backend/pkg/history"
 	"github.com/Affell/swarm-manager/backend/pkg/infra"
+	"github.com/Affell/swarm-manager/backend/pkg/logs"
+	"github.com/Affell/swarm-manager/backend/pkg/metrics"
+	"github.com/Affell/swarm-manager/backend/pkg/prune"
+	"github.com/Affell/swarm-manager/backend/pkg/stats"
 	"github.com/Affell/swarm-manager/backend/pkg/transport"
 )
 
+// Délai laissé aux requêtes en cours à l'arrêt
+const shutdownTimeout = 10 * time.Second
+
 // CustomRecoverConfig définit la configuration pour le middleware de récupération personnalisé
 type CustomRecoverConfig struct {
 	// StackSize est le nombre maximum d'entrées de pile à récupérer
@@ -30,17 +52,78 @@ type CustomRecoverConfig struct {
 func main() {
 
 	debug := flag.Bool("debug", false, "Enable debug mode")
+	hashPassword := flag.Bool("hash-password", false, "Read a password on stdin and print its bcrypt hash for the auth config")
+	pruneNode := flag.String("prune-node", "", "Prune the local daemon (images, containers, volumes, networks or system), print a JSON report and exit; used by swarm-wide prune jobs")
+	pruneAll := flag.Bool("prune-all", false, "With -prune-node system, also prune images and volumes")
+	statsAgent := flag.String("stats-agent", "", "Serve the container stats of the local daemon on this address (e.g. :9324) for the backend; run as a global service")
 	flag.Parse()
 
+	if *hashPassword {
+		printPasswordHash()
+		return
+	}
+	if *pruneNode != "" {
+		runNodePrune(*pruneNode, *pruneAll)
+		return
+	}
+	if *statsAgent != "" {
+		runStatsAgent(*statsAgent)
+		return
+	}
+
+	// Authentification : obligatoire, sauf désactivation explicite par
+	// AUTH_DISABLED=true (toutes les requêtes ont alors le rôle admin)
+	var authConfig *auth.Config
+	if path := os.Getenv("AUTH_CONFIG"); path != "" {
+		cfg, err := auth.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("failed to load auth config: %v", err)
+		}
+		authConfig = cfg
+	} else if os.Getenv("AUTH_DISABLED") == "true" {
+		log.Println("WARNING: AUTH_DISABLED=true, every request has the admin role: anyone reaching the API can prune, remove nodes and deploy stacks")
+	} else {
+		log.Fatal("AUTH_CONFIG is not set: configure authentication, or set AUTH_DISABLED=true to run the API without it")
+	}
+	authenticator, err := auth.New(authConfig)
+	if err != nil {
+		log.Fatalf("failed to initialize authentication: %v", err)
+	}
+
+	// Les tâches de fond s'arrêtent à SIGINT ou SIGTERM, ce qui laisse
+	// l'historique se sauvegarder avant la sortie
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Journal d'audit des actions modifiant le swarm
+	auditPath := os.Getenv("AUDIT_LOG")
+	if auditPath == "" {
+		auditPath = "data/audit.jsonl"
+	}
+	auditStore, err := audit.Open(auditPath)
+	if err != nil {
+		log.Fatalf("failed to open audit log: %v", err)
+	}
+	defer auditStore.Close()
+
 	// Initialize Docker client
 	dockerClient, err := infra.NewDockerClient()
 	if err != nil {
 		log.Fatalf("failed to create docker client: %v", err)
 	}
 
+	// Conservation des logs sur disque : désactivée si LOG_STORE_DIR n'est pas défini
+	logStore := openLogStore(ctx, dockerClient)
+	if logStore != nil {
+		defer logStore.Close()
+	}
+
 	// Start Echo
 	e := echo.New()
 	e.HideBanner = true
+	// Adresse des clients pour le ralentissement des connexions et le journal
+	// d'audit : X-Forwarded-For n'est lu que derrière TRUSTED_PROXIES
+	e.IPExtractor = clientIPExtractor()
 
 	// Middleware de récupération de panique amélioré
 	e.Use(customRecover())
@@ -55,7 +138,7 @@ func main() {
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: allowedOrigins,
 		AllowMethods: []string{echo.GET, echo.POST, echo.PUT, echo.DELETE, echo.OPTIONS},
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "Upgrade", "Connection", "Sec-WebSocket-Key", "Sec-WebSocket-Version", "Sec-WebSocket-Protocol"},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, "Upgrade", "Connection", "Sec-WebSocket-Key", "Sec-WebSocket-Version", "Sec-WebSocket-Protocol", "X-Registry-Auth"},
 	}))
 
 	// Middleware pour gérer les headers de reverse proxy (pour WSS)
@@ -69,9 +152,14 @@ func main() {
 		}
 	})
 
+	// Latence des requêtes pour /metrics
+	registry := metrics.New(dockerClient)
+	e.Use(registry.Middleware())
+
 	// Structured request logging
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "[${time_rfc3339}] ${method} ${uri} ${status} ${latency_human}\n",
+		// ${path} plutôt que ${uri} : la query peut contenir ?access_token=
+		Format: "[${time_rfc3339}] ${method} ${path} ${status} ${latency_human}\n",
 	}))
 
 	// Global HTTP error handler: log and return structured JSON
@@ -85,8 +173,8 @@ func main() {
 				msg = m
 			}
 		}
-		// Log error with request details
-		c.Logger().Errorf("Request %s %s -> error: %s", c.Request().Method, c.Request().URL, msg)
+		// Log error with request details (sans la query, qui peut contenir ?access_token=)
+		c.Logger().Errorf("Request %s %s -> error: %s", c.Request().Method, c.Request().URL.Path, msg)
 		// Send JSON error response
 		if !c.Response().Committed {
 			c.JSON(code, map[string]string{"error": msg})
@@ -95,36 +183,136 @@ func main() {
 
 	// Handlers
 	h := transport.NewHandler(dockerClient)
+	h.SetAllowedOrigins(allowedOrigins)
+	h.SetMetrics(registry)
+	statsSource := openStatsSource(dockerClient)
+	h.SetStatsSource(statsSource)
+	if image := os.Getenv("PRUNE_JOB_IMAGE"); image != "" {
+		h.SetPruneJobImage(image)
+	}
+	if v := os.Getenv("STACK_BIND_ALLOWLIST"); v != "" {
+		var paths []string
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				if !path.IsAbs(p) || path.Clean(p) == "/" {
+					log.Fatalf("invalid STACK_BIND_ALLOWLIST path %q", p)
+				}
+				paths = append(paths, p)
+			}
+		}
+		h.SetAllowedBindSources(paths)
+	}
+	if v := os.Getenv("LOG_BUFFER_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			log.Fatalf("invalid LOG_BUFFER_SIZE %q", v)
+		}
+		h.SetLogBufferSize(size)
+	}
+
+	// Historique des réplicas, de l'état des nodes et de la consommation
+	historyStore, historySaved := startHistory(ctx, dockerClient, statsSource)
+
+	// Règles d'alerte évaluées en continu
+	alertEngine := startAlerts(ctx, dockerClient, statsSource)
+
+	// Un seul abonnement aux événements Docker, partagé par tous les clients
+	historySize := 0
+	if v := os.Getenv("EVENTS_HISTORY_SIZE"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			log.Fatalf("invalid EVENTS_HISTORY_SIZE %q", v)
+		}
+		historySize = size
+	}
+	watcher := events.NewWatcher(dockerClient, historySize)
+	go watcher.Run(ctx)
+	h.SetEventWatcher(watcher)
+
+	// Le rôle est vérifié avant le journal d'audit, qui ne voit donc que les
+	// requêtes autorisées
+	viewer := audit.Require(auditStore, h.AuditTargets, auth.RoleViewer)
+	operator := audit.Require(auditStore, h.AuditTargets, auth.RoleOperator)
+	admin := audit.Require(auditStore, h.AuditTargets, auth.RoleAdmin)
 
 	// Routes
 	g := e.Group("/api")
-	g.GET("/nodes", h.ListNodes)
-	g.GET("/nodes/:id/services", h.GetNodeServices)
-	g.GET("/stacks", h.ListStacks)
-	g.GET("/stacks/:name", h.GetStack)
-	g.POST("/stacks/:name/stop", h.StopStack)
-	g.POST("/stacks/:name/start", h.StartStack)
-	g.GET("/images", h.ListImages)
-	g.POST("/images/:id/remove", h.RemoveImage)
-	g.POST("/services/:id/stop", h.StopService)
-	g.POST("/services/:id/restart", h.RestartService)
-	g.GET("/services/:id", h.GetService)
-	g.GET("/services/:id/logs", h.ServiceLogs)
-	g.GET("/swarm/logs", h.SwarmLogs) // Endpoint WebSocket pour les logs globaux du swarm
-	g.POST("/nodes/:id/drain", h.DrainNode)
-	g.POST("/nodes/:id/activate", h.ActivateNode)
-	g.GET("/version", h.GetVersion)
+	g.POST("/auth/login", authenticator.Login)
+
+	// Toutes les autres routes exigent un rôle ; les WebSockets acceptent ?access_token=
+	g.Use(authenticator.Middleware())
+	g.GET("/auth/me", authenticator.Me, viewer)
+	g.GET("/nodes", h.ListNodes, viewer)
+	g.GET("/nodes/:id", h.GetNode, viewer)
+	g.GET("/nodes/:id/services", h.GetNodeServices, viewer)
+	g.GET("/stacks", h.ListStacks, viewer)
+	g.GET("/stacks/:name", h.GetStack, viewer)
+	g.GET("/stacks/:name/logs/download", h.DownloadStackLogs, viewer)
+	g.POST("/stacks", h.DeployStack, operator)
+	g.PUT("/stacks/:name", h.UpdateStack, operator)
+	g.DELETE("/stacks/:name", h.RemoveStack, admin)
+	g.POST("/stacks/:name/stop", h.StopStack, operator)
+	g.POST("/stacks/:name/start", h.StartStack, operator)
+	g.POST("/stacks/:name/scale", h.ScaleStack, operator)
+	g.GET("/images", h.ListImages, viewer)
+	g.POST("/images/:id/remove", h.RemoveImage, admin)
+	g.POST("/services/:id/stop", h.StopService, operator)
+	g.POST("/services/:id/start", h.StartService, operator)
+	g.POST("/services/:id/restart", h.RestartService, operator)
+	g.POST("/services/:id/scale", h.ScaleService, operator)
+	g.PUT("/services/:id/image", h.UpdateServiceImage, operator)
+	g.POST("/services/:id/rollback", h.RollbackService, operator)
+	g.GET("/services/:id/update-status", h.GetServiceUpdateStatus, viewer)
+	g.GET("/services/:id", h.GetService, viewer)
+	g.GET("/services/:id/tasks", h.ListServiceTasks, viewer)
+	g.GET("/tasks/:id", h.GetTask, viewer)
+	g.GET("/health/services", h.ServicesHealth, viewer)
+	g.GET("/services/:id/logs", h.ServiceLogs, viewer)
+	g.GET("/services/:id/logs/download", h.DownloadServiceLogs, viewer)
+	g.GET("/services/:id/stats", h.ServiceStats, viewer) // WebSocket
+	g.GET("/swarm/logs", h.SwarmLogs, viewer)            // Endpoint WebSocket pour les logs globaux du swarm
+	g.GET("/logs/search", logStore.Search, viewer)
+	g.GET("/events", h.Events, viewer) // WebSocket ou Server-Sent Events
+	g.GET("/events/history", h.EventHistory, viewer)
+	g.GET("/history/services/:id", historyStore.ServiceHistory, viewer)
+	g.GET("/history/nodes/:id", historyStore.NodeHistory, viewer)
+	g.GET("/alerts", alertEngine.ListAlerts, viewer)
+	g.GET("/alerts/rules", alertEngine.ListRules, viewer)
+	g.POST("/alerts/rules", alertEngine.CreateRule, admin)
+	g.PUT("/alerts/rules/:id", alertEngine.UpdateRule, admin)
+	g.DELETE("/alerts/rules/:id", alertEngine.DeleteRule, admin)
+	g.GET("/alerts/notifiers", alertEngine.ListNotifiers, admin)
+	g.POST("/alerts/notifiers", alertEngine.CreateNotifier, admin)
+	g.PUT("/alerts/notifiers/:id", alertEngine.UpdateNotifier, admin)
+	g.DELETE("/alerts/notifiers/:id", alertEngine.DeleteNotifier, admin)
+	g.POST("/alerts/notifiers/:id/test", alertEngine.TestNotifier, admin)
+	g.GET("/alerts/silences", alertEngine.ListSilences, viewer)
+	g.POST("/alerts/silences", alertEngine.CreateSilence, operator)
+	g.DELETE("/alerts/silences/:id", alertEngine.DeleteSilence, operator)
+	g.POST("/nodes/:id/drain", h.DrainNode, admin)
+	g.POST("/nodes/:id/activate", h.ActivateNode, admin)
+	g.POST("/nodes/:id/pause", h.PauseNode, admin)
+	g.POST("/nodes/:id/labels", h.UpdateNodeLabels, admin)
+	g.POST("/nodes/:id/promote", h.PromoteNode, admin)
+	g.POST("/nodes/:id/demote", h.DemoteNode, admin)
+	g.DELETE("/nodes/:id", h.RemoveNode, admin)
+	g.GET("/version", h.GetVersion, viewer)
+	g.GET("/audit", auditStore.List, admin)
 
 	// Nouvelles routes pour les fonctionnalités de prune
-	g.POST("/prune/images", h.PruneImages)
-	g.POST("/prune/containers", h.PruneContainers)
-	g.POST("/prune/volumes", h.PruneVolumes)
-	g.POST("/prune/networks", h.PruneNetworks)
-	g.POST("/prune/system", h.PruneSystem)
+	g.POST("/prune/images", h.PruneImages, admin)
+	g.POST("/prune/containers", h.PruneContainers, admin)
+	g.POST("/prune/volumes", h.PruneVolumes, admin)
+	g.POST("/prune/networks", h.PruneNetworks, admin)
+	g.POST("/prune/system", h.PruneSystem, admin)
 
 	// Routes pour les estimations de cleanup et informations système
-	g.GET("/cleanup/estimate", h.GetCleanupEstimate)
-	g.GET("/system/info", h.GetSystemInfo)
+	g.GET("/cleanup/estimate", h.GetCleanupEstimate, viewer)
+	g.GET("/system/info", h.GetSystemInfo, viewer)
+
+	// Métriques Prometheus, hors de /api mais avec la même authentification
+	// (jeton d'API de rôle viewer pour le scraper)
+	e.GET("/metrics", registry.Handler, authenticator.Middleware(), viewer)
 
 	// Configuration améliorée pour servir une application React/Vite
 
@@ -148,7 +336,225 @@ func main() {
 	if port == "" {
 		port = "5000"
 	}
-	e.Logger.Fatal(e.Start("0.0.0.0:" + port))
+	go func() {
+		if err := e.Start("0.0.0.0:" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to stop the server: %v", err)
+	}
+	<-historySaved
+}
+
+// openLogStore ouvre le stockage des logs et démarre le collecteur qui
+// l'alimente, selon LOG_STORE_DIR, LOG_RETENTION_SIZE, LOG_RETENTION_AGE,
+// LOG_COLLECT_STACKS et LOG_COLLECT_SERVICES
+func openLogStore(ctx context.Context, dockerClient infra.DockerAPI) *logs.Store {
+	dir := os.Getenv("LOG_STORE_DIR")
+	if dir == "" {
+		return nil
+	}
+
+	opts := logs.StoreOptions{MaxBytes: 1 << 30, MaxAge: 7 * 24 * time.Hour}
+	if v := os.Getenv("LOG_RETENTION_SIZE"); v != "" {
+		size, err := units.RAMInBytes(v)
+		if err != nil || size <= 0 {
+			log.Fatalf("invalid LOG_RETENTION_SIZE %q", v)
+		}
+		opts.MaxBytes = size
+	}
+	if v := os.Getenv("LOG_RETENTION_AGE"); v != "" {
+		age, err := time.ParseDuration(v)
+		if err != nil || age <= 0 {
+			log.Fatalf("invalid LOG_RETENTION_AGE %q", v)
+		}
+		opts.MaxAge = age
+	}
+	store, err := logs.OpenStore(dir, opts)
+	if err != nil {
+		log.Fatalf("failed to open log store: %v", err)
+	}
+
+	collector := logs.NewCollector(dockerClient, store, logs.CollectorOptions{
+		Stacks:   splitEnvList("LOG_COLLECT_STACKS"),
+		Services: splitEnvList("LOG_COLLECT_SERVICES"),
+	})
+	go collector.Run(ctx)
+	return store
+}
+
+// clientIPExtractor renvoie l'adresse de la connexion, ou le dernier saut de
+// X-Forwarded-For qui ne vient pas d'un des proxys de TRUSTED_PROXIES
+// (adresses ou plages CIDR séparées par des virgules)
+func clientIPExtractor() echo.IPExtractor {
+	proxies := splitEnvList("TRUSTED_PROXIES")
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, ipRange, err := net.ParseCIDR(p)
+		if err != nil {
+			log.Fatalf("invalid TRUSTED_PROXIES entry %q", p)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// splitEnvList lit une variable d'environnement contenant une liste séparée par des virgules
+func splitEnvList(name string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// printPasswordHash lit un mot de passe sur l'entrée standard et affiche son hash bcrypt
+func printPasswordHash() {
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		log.Fatalf("failed to read password: %v", err)
+	}
+	hash, err := auth.HashPassword(strings.TrimRight(password, "\r\n"))
+	if err != nil {
+		log.Fatalf("failed to hash password: %v", err)
+	}
+	fmt.Println(hash)
+}
+
+// runNodePrune nettoie le daemon local et écrit le rapport JSON sur la sortie
+// standard, où le job de nettoyage du swarm le récupère via les logs du service
+func runNodePrune(kind string, all bool) {
+	dockerClient, err := infra.NewDockerClient()
+	if err != nil {
+		log.Fatalf("failed to create docker client: %v", err)
+	}
+	report, err := prune.Local(context.Background(), dockerClient, kind, all)
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if encodeErr := json.NewEncoder(os.Stdout).Encode(report); encodeErr != nil {
+		log.Fatalf("failed to write prune report: %v", encodeErr)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// openStatsSource crée la source des stats de conteneurs, avec les agents
+// déclarés par STATS_AGENT_SERVICE pour les tâches des autres nodes
+func openStatsSource(dockerClient infra.DockerAPI) *stats.Source {
+	var agent stats.AgentOptions
+	if service := os.Getenv("STATS_AGENT_SERVICE"); service != "" {
+		agent = stats.AgentOptions{Service: service, Token: os.Getenv("STATS_AGENT_TOKEN")}
+		if agent.Token == "" {
+			log.Fatal("STATS_AGENT_TOKEN is not set: it is required with STATS_AGENT_SERVICE")
+		}
+		if v := os.Getenv("STATS_AGENT_PORT"); v != "" {
+			port, err := strconv.Atoi(v)
+			if err != nil || port <= 0 {
+				log.Fatalf("invalid STATS_AGENT_PORT %q", v)
+			}
+			agent.Port = port
+		}
+	}
+	return stats.NewSource(dockerClient, agent)
+}
+
+// startHistory ouvre l'historique (HISTORY_FILE) et démarre l'échantillonnage
+// toutes les HISTORY_INTERVAL ; HISTORY_STATS=false désactive la mesure des
+// conteneurs. Le canal renvoyé est fermé une fois l'historique sauvegardé,
+// après l'annulation de ctx.
+func startHistory(ctx context.Context, dockerClient infra.DockerAPI, statsSource *stats.Source) (*history.Store, <-chan struct{}) {
+	path := os.Getenv("HISTORY_FILE")
+	if path == "" {
+		path = "data/history.json"
+	}
+	store, err := history.NewStore(path, nil)
+	if err != nil {
+		log.Fatalf("failed to open history: %v", err)
+	}
+
+	opts := history.SamplerOptions{Stats: statsSource}
+	if v := os.Getenv("HISTORY_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < time.Second {
+			log.Fatalf("invalid HISTORY_INTERVAL %q", v)
+		}
+		opts.Interval = interval
+	}
+	if v := os.Getenv("HISTORY_STATS"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("invalid HISTORY_STATS %q", v)
+		}
+		if !enabled {
+			opts.Stats = nil
+		}
+	}
+	saved := make(chan struct{})
+	sampler := history.NewSampler(dockerClient, store, opts)
+	go func() {
+		defer close(saved)
+		sampler.Run(ctx)
+	}()
+	return store, saved
+}
+
+// startAlerts charge les règles d'alerte (ALERTS_FILE) et démarre leur
+// évaluation toutes les ALERTS_INTERVAL
+func startAlerts(ctx context.Context, dockerClient infra.DockerAPI, statsSource *stats.Source) *alerts.Engine {
+	opts := alerts.Options{Path: os.Getenv("ALERTS_FILE"), Stats: statsSource}
+	if opts.Path == "" {
+		opts.Path = "data/alerts.json"
+	}
+	if v := os.Getenv("ALERTS_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval < time.Second {
+			log.Fatalf("invalid ALERTS_INTERVAL %q", v)
+		}
+		opts.Interval = interval
+	}
+	engine, err := alerts.NewEngine(dockerClient, opts)
+	if err != nil {
+		log.Fatalf("failed to load alerts: %v", err)
+	}
+	go engine.Run(ctx)
+	return engine
+}
+
+// runStatsAgent sert les stats des conteneurs du daemon local au backend
+// (mode -stats-agent), protégées par STATS_AGENT_TOKEN
+func runStatsAgent(addr string) {
+	dockerClient, err := infra.NewDockerClient()
+	if err != nil {
+		log.Fatalf("failed to create docker client: %v", err)
+	}
+	// L'agent relaie le daemon de sa node : il n'est jamais ouvert sans jeton
+	token := os.Getenv("STATS_AGENT_TOKEN")
+	if token == "" {
+		log.Fatal("STATS_AGENT_TOKEN is not set: the stats agent requires a token shared with the backend")
+	}
+	log.Printf("stats agent listening on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, stats.NewAgent(dockerClient, token)))
 }
 
 // customRecover retourne un middleware qui récupère les paniques avec un format de log amélioré
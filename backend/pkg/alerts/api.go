@@ -0,0 +1,394 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/auth"
+)
+
+var (
+	errNotFound = errors.New("not found")
+	errDisabled = errors.New("alerting is disabled")
+)
+
+// conflictError signale une modification incompatible avec la configuration
+type conflictError struct{ msg string }
+
+func (e conflictError) Error() string { return e.msg }
+
+// respond traduit les erreurs des modifications de configuration en réponse
+func respond(c echo.Context, err error, status int, body interface{}) error {
+	var conflict conflictError
+	switch {
+	case err == nil:
+		if body == nil {
+			return c.NoContent(status)
+		}
+		return c.JSON(status, body)
+	case errors.Is(err, errNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.As(err, &conflict):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+func disabled(c echo.Context) error {
+	return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": errDisabled.Error()})
+}
+
+// update applique fn à une copie de la configuration puis l'enregistre ; la
+// configuration n'est pas modifiée si fn ou la sauvegarde échoue
+func (e *Engine) update(fn func(cfg *config) error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cfg := config{
+		Rules:     append([]Rule(nil), e.cfg.Rules...),
+		Notifiers: append([]Notifier(nil), e.cfg.Notifiers...),
+		Silences:  append([]Silence(nil), e.cfg.Silences...),
+	}
+	if err := fn(&cfg); err != nil {
+		return err
+	}
+	old := e.cfg
+	e.cfg = cfg
+	if err := e.save(); err != nil {
+		e.cfg = old
+		return fmt.Errorf("failed to save alerts configuration: %w", err)
+	}
+	return nil
+}
+
+// ListAlerts sert GET /api/alerts, filtrable par state (pending, firing, resolved)
+func (e *Engine) ListAlerts(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	state := c.QueryParam("state")
+	if state != "" && state != StatePending && state != StateFiring && state != StateResolved {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid state (pending, firing, resolved)"})
+	}
+	alerts := e.Alerts()
+	result := make([]Alert, 0, len(alerts))
+	for _, a := range alerts {
+		if state == "" || a.State == state {
+			result = append(result, a)
+		}
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// ListRules sert GET /api/alerts/rules
+func (e *Engine) ListRules(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return c.JSON(http.StatusOK, append([]Rule{}, e.cfg.Rules...))
+}
+
+// CreateRule sert POST /api/alerts/rules ; une règle est active par défaut
+func (e *Engine) CreateRule(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	rule := Rule{Enabled: true}
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if err := rule.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	rule.ID = newID()
+	err := e.update(func(cfg *config) error {
+		if err := cfg.checkNotifiers(rule); err != nil {
+			return err
+		}
+		cfg.Rules = append(cfg.Rules, rule)
+		return nil
+	})
+	return respond(c, err, http.StatusCreated, rule)
+}
+
+// UpdateRule sert PUT /api/alerts/rules/:id et remplace la règle
+func (e *Engine) UpdateRule(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	rule := Rule{Enabled: true}
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if err := rule.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	rule.ID = c.Param("id")
+	err := e.update(func(cfg *config) error {
+		if err := cfg.checkNotifiers(rule); err != nil {
+			return err
+		}
+		for i := range cfg.Rules {
+			if cfg.Rules[i].ID == rule.ID {
+				cfg.Rules[i] = rule
+				return nil
+			}
+		}
+		return fmt.Errorf("rule %s %w", rule.ID, errNotFound)
+	})
+	return respond(c, err, http.StatusOK, rule)
+}
+
+// DeleteRule sert DELETE /api/alerts/rules/:id ; ses alertes actives sont
+// retirées à l'évaluation suivante, sans notification
+func (e *Engine) DeleteRule(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	id := c.Param("id")
+	err := e.update(func(cfg *config) error {
+		for i := range cfg.Rules {
+			if cfg.Rules[i].ID == id {
+				cfg.Rules = append(cfg.Rules[:i], cfg.Rules[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("rule %s %w", id, errNotFound)
+	})
+	return respond(c, err, http.StatusNoContent, nil)
+}
+
+// checkNotifiers vérifie que les destinataires de la règle existent
+func (cfg *config) checkNotifiers(r Rule) error {
+	for _, id := range r.Notifiers {
+		found := false
+		for _, n := range cfg.Notifiers {
+			found = found || n.ID == id
+		}
+		if !found {
+			return conflictError{fmt.Sprintf("notifier %s does not exist", id)}
+		}
+	}
+	return nil
+}
+
+// ListNotifiers sert GET /api/alerts/notifiers ; les secrets sont masqués
+func (e *Engine) ListNotifiers(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result := make([]Notifier, 0, len(e.cfg.Notifiers))
+	for _, n := range e.cfg.Notifiers {
+		result = append(result, n.redacted())
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// CreateNotifier sert POST /api/alerts/notifiers
+func (e *Engine) CreateNotifier(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	var n Notifier
+	if err := c.Bind(&n); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if err := n.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	n.ID = newID()
+	err := e.update(func(cfg *config) error {
+		cfg.Notifiers = append(cfg.Notifiers, n)
+		return nil
+	})
+	return respond(c, err, http.StatusCreated, n.redacted())
+}
+
+// UpdateNotifier sert PUT /api/alerts/notifiers/:id. Les secrets renvoyés
+// masqués tels que lus par GET sont conservés.
+func (e *Engine) UpdateNotifier(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	var n Notifier
+	if err := c.Bind(&n); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if err := n.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	n.ID = c.Param("id")
+	err := e.update(func(cfg *config) error {
+		for i, old := range cfg.Notifiers {
+			if old.ID != n.ID {
+				continue
+			}
+			if n.Password == redactedPassword {
+				n.Password = old.Password
+			}
+			for k, v := range n.Headers {
+				if v != redactedPassword {
+					continue
+				}
+				for oldKey, oldValue := range old.Headers {
+					if strings.EqualFold(k, oldKey) {
+						n.Headers[k] = oldValue
+					}
+				}
+			}
+			cfg.Notifiers[i] = n
+			return nil
+		}
+		return fmt.Errorf("notifier %s %w", n.ID, errNotFound)
+	})
+	return respond(c, err, http.StatusOK, n.redacted())
+}
+
+// DeleteNotifier sert DELETE /api/alerts/notifiers/:id ; un destinataire
+// encore cité par une règle ne peut pas être supprimé
+func (e *Engine) DeleteNotifier(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	id := c.Param("id")
+	err := e.update(func(cfg *config) error {
+		for _, r := range cfg.Rules {
+			if contains(r.Notifiers, id) {
+				return conflictError{fmt.Sprintf("notifier %s is used by rule %q", id, r.Name)}
+			}
+		}
+		for i := range cfg.Notifiers {
+			if cfg.Notifiers[i].ID == id {
+				cfg.Notifiers = append(cfg.Notifiers[:i], cfg.Notifiers[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("notifier %s %w", id, errNotFound)
+	})
+	return respond(c, err, http.StatusNoContent, nil)
+}
+
+// TestNotifier sert POST /api/alerts/notifiers/:id/test et envoie une
+// notification fictive
+func (e *Engine) TestNotifier(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	e.mu.Lock()
+	var notifier *Notifier
+	for _, n := range e.cfg.Notifiers {
+		if n.ID == c.Param("id") {
+			notifier = &n
+			break
+		}
+	}
+	e.mu.Unlock()
+	if notifier == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "notifier not found"})
+	}
+
+	now := time.Now()
+	notification := Notification{Status: StateFiring, Alert: Alert{
+		Fingerprint: "test",
+		RuleName:    "Test notification",
+		Severity:    "info",
+		Target:      Target{Kind: "notifier", ID: notifier.ID, Name: notifier.Name},
+		State:       StateFiring,
+		Message:     "test notification from swarm-manager",
+		StartsAt:    now,
+		FiredAt:     now,
+		NotifiedAt:  now,
+	}}
+	if err := e.send(c.Request().Context(), *notifier, notification); err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "sent"})
+}
+
+// ListSilences sert GET /api/alerts/silences ; expired=false masque les
+// silences terminés
+func (e *Engine) ListSilences(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	now := time.Now()
+	hideExpired := c.QueryParam("expired") == "false"
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result := make([]Silence, 0, len(e.cfg.Silences))
+	for _, s := range e.cfg.Silences {
+		if hideExpired && !now.Before(s.EndsAt) {
+			continue
+		}
+		result = append(result, s)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// CreateSilence sert POST /api/alerts/silences. La fin est donnée par ends_at
+// ou par duration à partir de starts_at (maintenant par défaut).
+func (e *Engine) CreateSilence(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	var req struct {
+		Silence
+		Duration Duration `json:"duration"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	s := req.Silence
+	now := time.Now()
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	if s.EndsAt.IsZero() && req.Duration > 0 {
+		s.EndsAt = s.StartsAt.Add(time.Duration(req.Duration))
+	}
+	if !s.EndsAt.After(s.StartsAt) || !s.EndsAt.After(now) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "ends_at or duration must end the silence in the future"})
+	}
+	s.ID = newID()
+	s.CreatedBy = ""
+	if principal := auth.PrincipalFrom(c); principal != nil {
+		s.CreatedBy = principal.Name
+	}
+	err := e.update(func(cfg *config) error {
+		if s.RuleID != "" {
+			if _, ok := e.rule(s.RuleID); !ok {
+				return conflictError{fmt.Sprintf("rule %s does not exist", s.RuleID)}
+			}
+		}
+		cfg.Silences = append(cfg.Silences, s)
+		return nil
+	})
+	return respond(c, err, http.StatusCreated, s)
+}
+
+// DeleteSilence sert DELETE /api/alerts/silences/:id
+func (e *Engine) DeleteSilence(c echo.Context) error {
+	if e == nil {
+		return disabled(c)
+	}
+	id := c.Param("id")
+	err := e.update(func(cfg *config) error {
+		for i := range cfg.Silences {
+			if cfg.Silences[i].ID == id {
+				cfg.Silences = append(cfg.Silences[:i], cfg.Silences[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("silence %s %w", id, errNotFound)
+	})
+	return respond(c, err, http.StatusNoContent, nil)
+}
@@ -0,0 +1,385 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+	"github.com/Affell/swarm-manager/backend/pkg/stats"
+)
+
+const (
+	defaultEvalInterval = 30 * time.Second
+	// Alertes résolues conservées pour GET /api/alerts
+	maxResolved = 100
+	// Délai d'envoi d'une notification à un destinataire
+	notifyTimeout = 10 * time.Second
+	// Mesures de disque lancées en parallèle
+	diskConcurrency = 8
+)
+
+// Options règle le moteur d'alertes
+type Options struct {
+	// Fichier des règles, destinataires et silences ; vide pour une
+	// configuration uniquement en mémoire
+	Path string
+	// Intervalle entre deux évaluations (30s par défaut)
+	Interval time.Duration
+	// Source des mesures de disque des nodes (daemon local seul si nil)
+	Stats *stats.Source
+}
+
+// config est le contenu du fichier de configuration
+type config struct {
+	Rules     []Rule     `json:"rules"`
+	Notifiers []Notifier `json:"notifiers"`
+	Silences  []Silence  `json:"silences"`
+}
+
+// defaultRules sont créées quand le fichier de configuration n'existe pas
+func defaultRules() []Rule {
+	return []Rule{
+		{Name: "Service replicas missing", Type: RuleServiceReplicas, Severity: "critical", For: Duration(2 * time.Minute)},
+		{Name: "Node down", Type: RuleNodeDown, Severity: "critical", For: Duration(time.Minute)},
+		{Name: "Task restart loop", Type: RuleTaskRestarts, Threshold: 3, Window: Duration(10 * time.Minute)},
+		{Name: "Disk usage", Type: RuleDiskUsage, Threshold: 85, For: Duration(5 * time.Minute)},
+	}
+}
+
+// Engine évalue les règles périodiquement et notifie les changements d'état
+// des alertes. L'état des alertes est gardé en mémoire : après un redémarrage,
+// les conditions toujours vraies repassent par pending.
+type Engine struct {
+	api    infra.DockerAPI
+	opts   Options
+	client *http.Client
+
+	mu  sync.Mutex
+	cfg config
+	// Alertes pending et firing par empreinte
+	active   map[string]*Alert
+	resolved []Alert
+}
+
+// NewEngine crée le moteur et charge sa configuration ; Run le démarre
+func NewEngine(api infra.DockerAPI, opts Options) (*Engine, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultEvalInterval
+	}
+	if opts.Stats == nil {
+		opts.Stats = stats.NewSource(api, stats.AgentOptions{})
+	}
+	e := &Engine{
+		api:    api,
+		opts:   opts,
+		client: &http.Client{Timeout: notifyTimeout},
+		active: make(map[string]*Alert),
+	}
+	if err := e.load(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Run évalue les règles jusqu'à l'annulation de ctx
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for {
+		e.Evaluate(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pending est une notification à envoyer une fois le verrou relâché
+type pending struct {
+	notification Notification
+	notifiers    []Notifier
+}
+
+// Evaluate évalue toutes les règles actives à l'instant now et envoie les
+// notifications qui en résultent
+func (e *Engine) Evaluate(ctx context.Context, now time.Time) {
+	e.mu.Lock()
+	rules := make([]Rule, 0, len(e.cfg.Rules))
+	var diskPaths []string
+	for _, r := range e.cfg.Rules {
+		if r.Enabled {
+			rules = append(rules, r)
+			if r.Type == RuleDiskUsage && !contains(diskPaths, r.Path) {
+				diskPaths = append(diskPaths, r.Path)
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	snap, err := e.snapshot(ctx, now, diskPaths)
+	if err != nil {
+		log.Printf("alerts: failed to read swarm state: %v", err)
+		return
+	}
+
+	e.mu.Lock()
+	var outbox []pending
+	seen := make(map[string]bool)
+	evaluated := make(map[string]bool)
+	for _, r := range rules {
+		conds, err := evaluate(r, snap)
+		if err != nil {
+			// Les alertes de la règle restent dans leur état actuel
+			log.Printf("alerts: rule %q: %v", r.Name, err)
+			continue
+		}
+		evaluated[r.ID] = true
+		for _, cond := range conds {
+			fingerprint := r.ID + "/" + cond.target.Kind + "/" + cond.target.ID
+			seen[fingerprint] = true
+			a, ok := e.active[fingerprint]
+			if !ok {
+				a = &Alert{
+					Fingerprint: fingerprint,
+					RuleID:      r.ID,
+					State:       StatePending,
+					StartsAt:    now,
+				}
+				e.active[fingerprint] = a
+			}
+			a.RuleName, a.Type, a.Severity = r.Name, r.Type, r.Severity
+			a.Target, a.Value, a.Message = cond.target, cond.value, cond.message
+			a.Silenced = e.silenced(a, now)
+
+			if a.State == StatePending && now.Sub(a.StartsAt) >= time.Duration(r.For) {
+				a.State = StateFiring
+				a.FiredAt = now
+			}
+			if a.State != StateFiring || a.Silenced {
+				continue
+			}
+			// Première notification, éventuellement différée par un silence
+			// expiré depuis, puis rappels tous les RepeatInterval
+			if a.NotifiedAt.IsZero() || (r.RepeatInterval > 0 && now.Sub(a.NotifiedAt) >= time.Duration(r.RepeatInterval)) {
+				a.NotifiedAt = now
+				outbox = append(outbox, pending{notification: Notification{Status: StateFiring, Alert: *a}, notifiers: e.notifiersFor(r)})
+			}
+		}
+	}
+
+	for fingerprint, a := range e.active {
+		if seen[fingerprint] {
+			continue
+		}
+		rule, ok := e.rule(a.RuleID)
+		if ok && rule.Enabled && !evaluated[a.RuleID] {
+			continue
+		}
+		delete(e.active, fingerprint)
+		if a.State != StateFiring {
+			continue
+		}
+		a.State = StateResolved
+		a.ResolvedAt = now
+		a.Silenced = e.silenced(a, now)
+		// Une résolution n'est notifiée que si le déclenchement l'a été ;
+		// les alertes d'une règle supprimée ou désactivée sont résolues sans bruit
+		if ok && rule.Enabled && !a.NotifiedAt.IsZero() && !a.Silenced {
+			a.NotifiedAt = now
+			outbox = append(outbox, pending{notification: Notification{Status: StateResolved, Alert: *a}, notifiers: e.notifiersFor(rule)})
+		}
+		e.resolved = append(e.resolved, *a)
+	}
+	if n := len(e.resolved); n > maxResolved {
+		e.resolved = append([]Alert(nil), e.resolved[n-maxResolved:]...)
+	}
+	e.mu.Unlock()
+
+	for _, p := range outbox {
+		for _, n := range p.notifiers {
+			if err := e.send(ctx, n, p.notification); err != nil {
+				log.Printf("alerts: failed to notify %q for %s: %v", n.Name, p.notification.Alert.Fingerprint, err)
+			}
+		}
+	}
+}
+
+func (e *Engine) snapshot(ctx context.Context, now time.Time, diskPaths []string) (*snapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.opts.Interval)
+	defer cancel()
+
+	nodes, err := e.api.NodeList(ctx, dockerTypes.NodeListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	services, err := e.api.ServiceList(ctx, dockerTypes.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := e.api.TaskList(ctx, dockerTypes.TaskListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshot{now: now, nodes: nodes, services: services, tasks: tasks}
+	if len(diskPaths) > 0 {
+		s.disks = e.measureDisks(ctx, nodes, diskPaths)
+	}
+	return s, nil
+}
+
+// measureDisks mesure les chemins sur chaque node prête, en parallèle : la
+// node du daemon directement, les autres via leur agent de stats
+func (e *Engine) measureDisks(ctx context.Context, nodes []swarm.Node, paths []string) map[diskKey]diskResult {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[diskKey]diskResult)
+	)
+	limit := make(chan struct{}, diskConcurrency)
+	for _, n := range nodes {
+		if n.Status.State != swarm.NodeStateReady {
+			continue
+		}
+		for _, path := range paths {
+			wg.Add(1)
+			go func(key diskKey) {
+				defer wg.Done()
+				limit <- struct{}{}
+				defer func() { <-limit }()
+
+				disk, err := e.opts.Stats.Disk(ctx, key.nodeID, key.path)
+				mu.Lock()
+				results[key] = diskResult{disk: disk, err: err}
+				mu.Unlock()
+			}(diskKey{nodeID: n.ID, path: path})
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// silenced indique si un silence actif couvre l'alerte ; appelé verrou pris
+func (e *Engine) silenced(a *Alert, now time.Time) bool {
+	for _, s := range e.cfg.Silences {
+		if s.Active(now) && s.Matches(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifiersFor renvoie les destinataires de la règle ; appelé verrou pris
+func (e *Engine) notifiersFor(r Rule) []Notifier {
+	if len(r.Notifiers) == 0 {
+		return append([]Notifier(nil), e.cfg.Notifiers...)
+	}
+	var result []Notifier
+	for _, n := range e.cfg.Notifiers {
+		if contains(r.Notifiers, n.ID) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// rule renvoie la règle id ; appelé verrou pris
+func (e *Engine) rule(id string) (Rule, bool) {
+	for _, r := range e.cfg.Rules {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Alerts renvoie les alertes actives puis les alertes résolues récentes, des
+// plus récentes aux plus anciennes
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := make([]Alert, 0, len(e.active)+len(e.resolved))
+	for _, a := range e.active {
+		result = append(result, *a)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartsAt.After(result[j].StartsAt) })
+	for i := len(e.resolved) - 1; i >= 0; i-- {
+		result = append(result, e.resolved[i])
+	}
+	return result
+}
+
+func (e *Engine) load() error {
+	if e.opts.Path == "" {
+		e.cfg.Rules = defaultRules()
+		return e.seedRules()
+	}
+	data, err := os.ReadFile(e.opts.Path)
+	if os.IsNotExist(err) {
+		e.cfg.Rules = defaultRules()
+		if err := e.seedRules(); err != nil {
+			return err
+		}
+		return e.save()
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &e.cfg); err != nil {
+		return fmt.Errorf("invalid alerts file %s: %w", e.opts.Path, err)
+	}
+	for i := range e.cfg.Rules {
+		if err := e.cfg.Rules[i].Validate(); err != nil {
+			return fmt.Errorf("invalid rule %q in %s: %w", e.cfg.Rules[i].Name, e.opts.Path, err)
+		}
+	}
+	for i := range e.cfg.Notifiers {
+		if err := e.cfg.Notifiers[i].Validate(); err != nil {
+			return fmt.Errorf("invalid notifier %q in %s: %w", e.cfg.Notifiers[i].Name, e.opts.Path, err)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) seedRules() error {
+	for i := range e.cfg.Rules {
+		e.cfg.Rules[i].ID = newID()
+		e.cfg.Rules[i].Enabled = true
+		if err := e.cfg.Rules[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save écrit la configuration par remplacement atomique ; appelé verrou pris
+func (e *Engine) save() error {
+	if e.opts.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(e.cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(e.opts.Path), 0o750); err != nil {
+		return err
+	}
+	tmp := e.opts.Path + ".tmp"
+	// Le fichier contient les mots de passe SMTP
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.opts.Path)
+}
@@ -0,0 +1,105 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification est le corps JSON envoyé aux webhooks
+type Notification struct {
+	Status string `json:"status"` // firing ou resolved
+	Alert  Alert  `json:"alert"`
+}
+
+// subject résume la notification, en objet des emails
+func (n Notification) subject() string {
+	target := n.Alert.Target.Name
+	if target == "" {
+		target = n.Alert.Target.ID
+	}
+	return fmt.Sprintf("[%s] %s: %s", strings.ToUpper(n.Status), n.Alert.RuleName, target)
+}
+
+func (e *Engine) send(ctx context.Context, n Notifier, notification Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	switch n.Type {
+	case NotifierWebhook:
+		return e.sendWebhook(ctx, n, notification)
+	case NotifierSMTP:
+		return sendMail(ctx, n, notification)
+	}
+	return fmt.Errorf("unknown notifier type %q", n.Type)
+}
+
+func (e *Engine) sendWebhook(ctx context.Context, n Notifier, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sendMail envoie la notification en texte brut. STARTTLS est utilisé si le
+// serveur le propose, et l'authentification PLAIN si un utilisateur est défini.
+func sendMail(ctx context.Context, n Notifier, notification Notification) error {
+	addr := net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	a := notification.Alert
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", notification.subject())
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n", a.Message)
+	fmt.Fprintf(&msg, "Rule: %s (%s)\r\n", a.RuleName, a.Type)
+	fmt.Fprintf(&msg, "Severity: %s\r\n", a.Severity)
+	fmt.Fprintf(&msg, "Target: %s %s (%s)\r\n", a.Target.Kind, a.Target.Name, a.Target.ID)
+	fmt.Fprintf(&msg, "Started: %s\r\n", a.StartsAt.Format(time.RFC3339))
+	if !a.ResolvedAt.IsZero() {
+		fmt.Fprintf(&msg, "Resolved: %s\r\n", a.ResolvedAt.Format(time.RFC3339))
+	}
+
+	// net/smtp ne prend pas de contexte : l'envoi est abandonné à l'échéance
+	// mais la connexion se termine en arrière-plan
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(addr, auth, n.From, n.To, msg.Bytes()) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
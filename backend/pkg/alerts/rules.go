@@ -0,0 +1,206 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/stats"
+)
+
+const stackLabel = "com.docker.stack.namespace"
+
+// snapshot est l'état du swarm lu une fois par évaluation et partagé par
+// toutes les règles
+type snapshot struct {
+	now      time.Time
+	nodes    []swarm.Node
+	services []swarm.Service
+	// Toutes les tâches, y compris l'historique des tâches arrêtées
+	tasks []swarm.Task
+	// Remplissage des disques des nodes prêtes, pour les chemins des règles
+	// disk_usage ("" pour le répertoire racine de Docker)
+	disks map[diskKey]diskResult
+}
+
+type diskKey struct {
+	nodeID string
+	path   string
+}
+
+type diskResult struct {
+	disk stats.Disk
+	err  error
+}
+
+// condition est une cible pour laquelle la condition d'une règle est vraie
+type condition struct {
+	target  Target
+	value   float64
+	message string
+}
+
+// evaluate renvoie les cibles qui vérifient la condition de la règle
+func evaluate(r Rule, s *snapshot) ([]condition, error) {
+	switch r.Type {
+	case RuleServiceReplicas:
+		return evalServiceReplicas(r, s), nil
+	case RuleNodeDown:
+		return evalNodeDown(r, s), nil
+	case RuleTaskRestarts:
+		return evalTaskRestarts(r, s), nil
+	case RuleDiskUsage:
+		return evalDiskUsage(r, s)
+	}
+	return nil, fmt.Errorf("unknown rule type %q", r.Type)
+}
+
+func evalServiceReplicas(r Rule, s *snapshot) []condition {
+	running := make(map[string]int)
+	scheduled := make(map[string]int)
+	for _, t := range s.tasks {
+		if t.DesiredState != swarm.TaskStateRunning {
+			continue
+		}
+		scheduled[t.ServiceID]++
+		if t.Status.State == swarm.TaskStateRunning {
+			running[t.ServiceID]++
+		}
+	}
+
+	var result []condition
+	for _, svc := range s.services {
+		if !r.selectsService(svc) {
+			continue
+		}
+		desired := scheduled[svc.ID]
+		if svc.Spec.Mode.Replicated != nil && svc.Spec.Mode.Replicated.Replicas != nil {
+			desired = int(*svc.Spec.Mode.Replicated.Replicas)
+		} else if svc.Spec.Mode.Global == nil {
+			// Jobs : pas de nombre de réplicas à maintenir
+			continue
+		}
+		if running[svc.ID] >= desired {
+			continue
+		}
+		result = append(result, condition{
+			target:  serviceTarget(svc),
+			value:   float64(running[svc.ID]),
+			message: fmt.Sprintf("%s: %d/%d replicas running", svc.Spec.Name, running[svc.ID], desired),
+		})
+	}
+	return result
+}
+
+func evalNodeDown(r Rule, s *snapshot) []condition {
+	var result []condition
+	for _, n := range s.nodes {
+		if r.Node != "" && r.Node != n.ID && r.Node != n.Description.Hostname {
+			continue
+		}
+		if n.Status.State == swarm.NodeStateReady {
+			continue
+		}
+		message := fmt.Sprintf("node %s is %s", n.Description.Hostname, n.Status.State)
+		if n.Status.Message != "" {
+			message += ": " + n.Status.Message
+		}
+		result = append(result, condition{
+			target:  Target{Kind: "node", ID: n.ID, Name: n.Description.Hostname},
+			value:   0,
+			message: message,
+		})
+	}
+	return result
+}
+
+func evalTaskRestarts(r Rule, s *snapshot) []condition {
+	since := s.now.Add(-time.Duration(r.Window))
+	failures := make(map[string]int)
+	lastError := make(map[string]string)
+	for _, t := range s.tasks {
+		if t.Status.Timestamp.Before(since) {
+			continue
+		}
+		switch t.Status.State {
+		case swarm.TaskStateFailed, swarm.TaskStateRejected:
+		case swarm.TaskStateComplete:
+			// Une tâche terminée n'est un redémarrage que hors des jobs
+			if t.DesiredState == swarm.TaskStateComplete {
+				continue
+			}
+		default:
+			continue
+		}
+		failures[t.ServiceID]++
+		if t.Status.Err != "" {
+			lastError[t.ServiceID] = t.Status.Err
+		}
+	}
+
+	var result []condition
+	for _, svc := range s.services {
+		if !r.selectsService(svc) || float64(failures[svc.ID]) < r.Threshold {
+			continue
+		}
+		message := fmt.Sprintf("%s: %d tasks failed in the last %s", svc.Spec.Name, failures[svc.ID], time.Duration(r.Window))
+		if err := lastError[svc.ID]; err != "" {
+			message += " (last error: " + err + ")"
+		}
+		result = append(result, condition{target: serviceTarget(svc), value: float64(failures[svc.ID]), message: message})
+	}
+	return result
+}
+
+// evalDiskUsage vérifie chaque node prête. Les nodes sans agent sont ignorées ;
+// la règle n'échoue que si aucune node n'a pu être mesurée.
+func evalDiskUsage(r Rule, s *snapshot) ([]condition, error) {
+	var result []condition
+	measured := 0
+	var firstErr error
+	for _, n := range s.nodes {
+		if r.Node != "" && r.Node != n.ID && r.Node != n.Description.Hostname {
+			continue
+		}
+		m, ok := s.disks[diskKey{nodeID: n.ID, path: r.Path}]
+		if !ok {
+			continue
+		}
+		if m.err != nil {
+			if !errors.Is(m.err, stats.ErrNoAgent) && firstErr == nil {
+				firstErr = fmt.Errorf("failed to measure %s: %w", n.Description.Hostname, m.err)
+			}
+			continue
+		}
+		measured++
+		if m.disk.UsedPercent <= r.Threshold {
+			continue
+		}
+		result = append(result, condition{
+			target:  Target{Kind: "node", ID: n.ID, Name: n.Description.Hostname},
+			value:   m.disk.UsedPercent,
+			message: fmt.Sprintf("%s on %s is %.1f%% full (threshold %.0f%%)", m.disk.Path, n.Description.Hostname, m.disk.UsedPercent, r.Threshold),
+		})
+	}
+	if measured == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return result, nil
+}
+
+// selectsService applique les filtres stack et service de la règle
+func (r Rule) selectsService(svc swarm.Service) bool {
+	if r.Stack != "" && svc.Spec.Labels[stackLabel] != r.Stack {
+		return false
+	}
+	if r.Service != "" && r.Service != svc.ID && r.Service != svc.Spec.Name {
+		return false
+	}
+	return true
+}
+
+func serviceTarget(svc swarm.Service) Target {
+	return Target{Kind: "service", ID: svc.ID, Name: svc.Spec.Name}
+}
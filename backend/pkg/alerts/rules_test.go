@@ -0,0 +1,107 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+	"github.com/Affell/swarm-manager/backend/pkg/stats"
+)
+
+func node(id string) swarm.Node {
+	return swarm.Node{ID: id, Description: swarm.NodeDescription{Hostname: id}, Status: swarm.NodeStatus{State: swarm.NodeStateReady}}
+}
+
+func TestEvalDiskUsage(t *testing.T) {
+	disk := func(percent float64) diskResult {
+		return diskResult{disk: stats.Disk{Path: "/var/lib/docker", UsedPercent: percent}}
+	}
+	for _, tc := range []struct {
+		name  string
+		rule  Rule
+		disks map[string]diskResult
+		want  []string
+		err   string
+	}{
+		{
+			name:  "every node is checked",
+			rule:  Rule{Threshold: 85},
+			disks: map[string]diskResult{"n1": disk(91), "n2": disk(40), "n3": disk(86)},
+			want:  []string{"n1", "n3"},
+		},
+		{
+			name:  "node filter",
+			rule:  Rule{Threshold: 85, Node: "n3"},
+			disks: map[string]diskResult{"n1": disk(91), "n2": disk(40), "n3": disk(86)},
+			want:  []string{"n3"},
+		},
+		{
+			name:  "nodes without agent are skipped",
+			rule:  Rule{Threshold: 85},
+			disks: map[string]diskResult{"n1": disk(91), "n2": {err: stats.ErrNoAgent}, "n3": {err: errors.New("timeout")}},
+			want:  []string{"n1"},
+		},
+		{
+			name:  "no node measured",
+			rule:  Rule{Threshold: 85},
+			disks: map[string]diskResult{"n1": {err: stats.ErrNoAgent}, "n2": {err: errors.New("connection refused")}},
+			err:   "failed to measure n2: connection refused",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &snapshot{disks: make(map[diskKey]diskResult)}
+			for _, id := range []string{"n1", "n2", "n3"} {
+				s.nodes = append(s.nodes, node(id))
+				if d, ok := tc.disks[id]; ok {
+					s.disks[diskKey{nodeID: id}] = d
+				}
+			}
+			conds, err := evalDiskUsage(tc.rule, s)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, c := range conds {
+				got = append(got, c.target.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("targets = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotMeasuresDisksPerNode(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	manager := f.AddNode("manager", swarm.NodeRoleManager)
+	worker := f.AddNode("worker", swarm.NodeRoleWorker)
+	root := t.TempDir()
+	f.SetInfo(system.Info{DockerRootDir: root, Swarm: swarm.Info{NodeID: manager.ID}})
+	e, err := NewEngine(f, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := e.snapshot(context.Background(), time.Now(), []string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := s.disks[diskKey{nodeID: manager.ID}]; m.err != nil || m.disk.Path != root || m.disk.Total == 0 {
+		t.Errorf("manager disk = %+v", m)
+	}
+	if m := s.disks[diskKey{nodeID: worker.ID}]; !errors.Is(m.err, stats.ErrNoAgent) {
+		t.Errorf("worker disk = %+v, want ErrNoAgent", m)
+	}
+}
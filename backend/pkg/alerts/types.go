@@ -0,0 +1,258 @@
+// Package alerts évalue des règles d'alerte sur l'état du swarm, suit l'état
+// des alertes (pending, firing, resolved) et les envoie à des webhooks JSON ou
+// par SMTP.
+package alerts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Types de règles
+const (
+	// Service dont les tâches en cours sont moins nombreuses que les réplicas désirés
+	RuleServiceReplicas = "service_replicas"
+	// Node qui n'est pas prête (down, unknown, disconnected)
+	RuleNodeDown = "node_down"
+	// Service dont au moins Threshold tâches ont échoué sur Window
+	RuleTaskRestarts = "task_restarts"
+	// Système de fichiers de Docker rempli à plus de Threshold %
+	RuleDiskUsage = "disk_usage"
+)
+
+var ruleTypes = []string{RuleServiceReplicas, RuleNodeDown, RuleTaskRestarts, RuleDiskUsage}
+
+// Types de destinataires
+const (
+	NotifierWebhook = "webhook"
+	NotifierSMTP    = "smtp"
+)
+
+// États d'une alerte
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Duration est une durée lue et écrite en JSON sous la forme "2m"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"2m\"")
+	}
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Rule est une règle d'alerte
+type Rule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Enabled  bool   `json:"enabled"`
+	Severity string `json:"severity,omitempty"`
+	// Durée pendant laquelle la condition doit rester vraie avant de déclencher
+	For Duration `json:"for,omitempty"`
+	// Seuil : tâches échouées (task_restarts, 3 par défaut) ou pourcentage
+	// (disk_usage, 85 par défaut)
+	Threshold float64 `json:"threshold,omitempty"`
+	// Fenêtre de task_restarts (10m par défaut)
+	Window Duration `json:"window,omitempty"`
+	// Restreint la règle à une stack, un service ou une node (nom ou ID)
+	Stack   string `json:"stack,omitempty"`
+	Service string `json:"service,omitempty"`
+	Node    string `json:"node,omitempty"`
+	// Répertoire mesuré par disk_usage sur chaque node (DockerRootDir de la
+	// node par défaut)
+	Path string `json:"path,omitempty"`
+	// Renvoi des notifications tant que l'alerte reste active (0 : jamais)
+	RepeatInterval Duration `json:"repeat_interval,omitempty"`
+	// Destinataires ; tous si vide
+	Notifiers []string `json:"notifiers,omitempty"`
+}
+
+// Validate complète les valeurs par défaut et vérifie la règle
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !contains(ruleTypes, r.Type) {
+		return fmt.Errorf("invalid type %q (%s)", r.Type, strings.Join(ruleTypes, ", "))
+	}
+	if r.For < 0 || r.Window < 0 || r.RepeatInterval < 0 || r.Threshold < 0 {
+		return fmt.Errorf("durations and threshold must not be negative")
+	}
+	switch r.Type {
+	case RuleTaskRestarts:
+		if r.Threshold == 0 {
+			r.Threshold = 3
+		}
+		if r.Window == 0 {
+			r.Window = Duration(10 * time.Minute)
+		}
+	case RuleDiskUsage:
+		if r.Threshold == 0 {
+			r.Threshold = 85
+		}
+		if r.Threshold > 100 {
+			return fmt.Errorf("disk_usage threshold is a percentage")
+		}
+	}
+	if r.Severity == "" {
+		r.Severity = "warning"
+	}
+	return nil
+}
+
+// Notifier est un destinataire des notifications
+type Notifier struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Webhook : le corps JSON de Notification est envoyé en POST
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// SMTP
+	Host     string   `json:"host,omitempty"`
+	Port     int      `json:"port,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// Validate vérifie la configuration du destinataire
+func (n *Notifier) Validate() error {
+	if n.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch n.Type {
+	case NotifierWebhook:
+		u, err := url.Parse(n.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an http(s) URL")
+		}
+	case NotifierSMTP:
+		if n.Host == "" || n.From == "" || len(n.To) == 0 {
+			return fmt.Errorf("host, from and to are required")
+		}
+		if n.Port == 0 {
+			n.Port = 587
+		}
+	default:
+		return fmt.Errorf("invalid type %q (webhook, smtp)", n.Type)
+	}
+	return nil
+}
+
+// redactedPassword remplace les mots de passe SMTP dans les réponses de l'API
+const redactedPassword = "********"
+
+func (n Notifier) redacted() Notifier {
+	if n.Password != "" {
+		n.Password = redactedPassword
+	}
+	if len(n.Headers) > 0 {
+		headers := make(map[string]string, len(n.Headers))
+		for k, v := range n.Headers {
+			if strings.EqualFold(k, "Authorization") {
+				v = redactedPassword
+			}
+			headers[k] = v
+		}
+		n.Headers = headers
+	}
+	return n
+}
+
+// Silence empêche les notifications des alertes correspondantes entre
+// StartsAt et EndsAt. Les champs vides correspondent à tout.
+type Silence struct {
+	ID       string    `json:"id"`
+	RuleID   string    `json:"rule_id,omitempty"`
+	Target   string    `json:"target,omitempty"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Comment  string    `json:"comment,omitempty"`
+	// Auteur, renseigné à partir de l'utilisateur authentifié
+	CreatedBy string `json:"created_by,omitempty"`
+}
+
+// Active indique si le silence s'applique à l'instant t
+func (s Silence) Active(t time.Time) bool {
+	return !t.Before(s.StartsAt) && t.Before(s.EndsAt)
+}
+
+// Matches indique si le silence couvre l'alerte ; Target est comparé à l'ID et
+// au nom de la cible
+func (s Silence) Matches(a *Alert) bool {
+	if s.RuleID != "" && s.RuleID != a.RuleID {
+		return false
+	}
+	if s.Target != "" && s.Target != a.Target.ID && s.Target != a.Target.Name {
+		return false
+	}
+	return true
+}
+
+// Target est l'objet concerné par une alerte
+type Target struct {
+	Kind string `json:"kind"` // service, node
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// Alert est l'état d'une règle pour une cible. Une seule alerte existe par
+// règle et par cible (Fingerprint) tant qu'elle n'est pas résolue.
+type Alert struct {
+	Fingerprint string    `json:"fingerprint"`
+	RuleID      string    `json:"rule_id"`
+	RuleName    string    `json:"rule_name"`
+	Type        string    `json:"type"`
+	Severity    string    `json:"severity"`
+	Target      Target    `json:"target"`
+	State       string    `json:"state"`
+	Value       float64   `json:"value"`
+	Message     string    `json:"message"`
+	StartsAt    time.Time `json:"starts_at"`
+	FiredAt     time.Time `json:"fired_at,omitzero"`
+	ResolvedAt  time.Time `json:"resolved_at,omitzero"`
+	Silenced    bool      `json:"silenced"`
+	// Dernière notification envoyée pour l'état courant
+	NotifiedAt time.Time `json:"notified_at,omitzero"`
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
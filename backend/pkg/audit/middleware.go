@@ -0,0 +1,213 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/auth"
+)
+
+// Object est l'état d'un objet Docker visé par une route à un instant donné
+type Object struct {
+	Type    string
+	ID      string
+	Name    string
+	Version *uint64
+}
+
+// Resolver renvoie les objets visés par la requête. Il est appelé avant et
+// après le handler pour relever les versions de spec.
+type Resolver func(c echo.Context) []Object
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+	// Taille maximale du corps de réponse conservé pour extraire le message d'erreur
+	maxCapturedBody = 4096
+)
+
+// Middleware enregistre chaque requête modifiant l'état (tout sauf GET, HEAD et
+// OPTIONS). Il doit être placé après le middleware d'authentification et après
+// le contrôle de rôle de la route : voir Require.
+func Middleware(store *Store, resolve Resolver) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+
+			start := time.Now()
+			var before []Object
+			if resolve != nil {
+				before = resolve(c)
+			}
+
+			capture := &captureWriter{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = capture
+			err := next(c)
+			c.Response().Writer = capture.ResponseWriter
+
+			var after []Object
+			if resolve != nil {
+				after = resolve(c)
+			}
+
+			entry := Entry{
+				ID:         newID(),
+				Time:       start.UTC(),
+				Actor:      "anonymous",
+				Method:     req.Method,
+				Route:      c.Path(),
+				Path:       req.URL.Path,
+				Params:     routeParams(c),
+				Targets:    mergeTargets(before, after),
+				Status:     c.Response().Status,
+				Result:     "success",
+				DurationMs: time.Since(start).Milliseconds(),
+				RemoteIP:   c.RealIP(),
+			}
+			if principal := auth.PrincipalFrom(c); principal != nil {
+				entry.Actor = principal.Name
+				entry.Role = string(principal.Role)
+			}
+			if err != nil {
+				entry.Status = http.StatusInternalServerError
+				var he *echo.HTTPError
+				if errors.As(err, &he) {
+					entry.Status = he.Code
+				}
+				entry.Error = err.Error()
+			} else if entry.Status >= http.StatusBadRequest {
+				entry.Error = capture.errorMessage()
+			}
+			if entry.Status >= http.StatusBadRequest {
+				entry.Result = "failure"
+			}
+
+			if appendErr := store.Append(entry); appendErr != nil {
+				c.Logger().Errorf("audit: failed to record %s %s: %v", req.Method, req.URL.Path, appendErr)
+			}
+			return err
+		}
+	}
+}
+
+// Require vérifie le rôle de la route puis journalise la requête. Une requête
+// refusée ne déclenche ainsi aucune résolution des objets visés (et donc aucun
+// appel Docker) et n'est pas enregistrée.
+func Require(store *Store, resolve Resolver, role auth.Role) echo.MiddlewareFunc {
+	require := auth.Require(role)
+	audit := Middleware(store, resolve)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return require(audit(next))
+	}
+}
+
+// List renvoie le journal d'audit filtré par ?actor=, ?target=, ?since=, ?until= (RFC 3339) et ?limit=
+func (s *Store) List(c echo.Context) error {
+	filter := Filter{
+		Actor:  c.QueryParam("actor"),
+		Target: c.QueryParam("target"),
+		Limit:  defaultQueryLimit,
+	}
+
+	var err error
+	if v := c.QueryParam("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid since, expected RFC 3339"})
+		}
+	}
+	if v := c.QueryParam("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid until, expected RFC 3339"})
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		filter.Limit = min(limit, maxQueryLimit)
+	}
+
+	entries, err := s.Query(filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+func routeParams(c echo.Context) map[string]string {
+	names := c.ParamNames()
+	if len(names) == 0 {
+		return nil
+	}
+	params := make(map[string]string, len(names))
+	for _, name := range names {
+		params[name] = c.Param(name)
+	}
+	return params
+}
+
+// mergeTargets associe les états avant/après d'un même objet
+func mergeTargets(before, after []Object) []Target {
+	var targets []Target
+	index := make(map[string]int)
+	for _, o := range before {
+		index[o.Type+"/"+o.ID] = len(targets)
+		targets = append(targets, Target{Type: o.Type, ID: o.ID, Name: o.Name, VersionBefore: o.Version})
+	}
+	for _, o := range after {
+		if i, ok := index[o.Type+"/"+o.ID]; ok {
+			targets[i].VersionAfter = o.Version
+			continue
+		}
+		targets = append(targets, Target{Type: o.Type, ID: o.ID, Name: o.Name, VersionAfter: o.Version})
+	}
+	return targets
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// captureWriter conserve le début du corps de réponse pour en extraire l'erreur
+type captureWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if room := maxCapturedBody - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(len(b), room)])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *captureWriter) errorMessage() string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(w.body.Bytes(), &body) == nil && body.Error != "" {
+		return body.Error
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/auth"
+)
+
+func TestRequireChecksTheRoleBeforeAuditing(t *testing.T) {
+	var tokens []auth.TokenConfig
+	for _, role := range []auth.Role{auth.RoleViewer, auth.RoleOperator} {
+		digest := sha256.Sum256([]byte(string(role) + "-token"))
+		tokens = append(tokens, auth.TokenConfig{Name: string(role), TokenSHA256: hex.EncodeToString(digest[:]), Role: role})
+	}
+	a, err := auth.New(&auth.Config{Tokens: tokens})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	resolved := 0
+	resolve := func(c echo.Context) []Object {
+		resolved++
+		return []Object{{Type: "service", ID: c.Param("id")}}
+	}
+	e := echo.New()
+	g := e.Group("", a.Middleware())
+	g.POST("/services/:id/scale", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, Require(store, resolve, auth.RoleOperator))
+
+	for _, tc := range []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"?access_token=viewer-token", http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/services/s1/scale"+tc.query, nil))
+		if rec.Code != tc.code {
+			t.Errorf("%q: status = %d, want %d", tc.query, rec.Code, tc.code)
+		}
+	}
+	if resolved != 0 {
+		t.Errorf("targets resolved %d times for rejected requests", resolved)
+	}
+	if entries, _ := store.Query(Filter{}); len(entries) != 0 {
+		t.Errorf("rejected requests audited: %+v", entries)
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/services/s1/scale?access_token=operator-token", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", rec.Code)
+	}
+	entries, err := store.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "token:operator" || len(entries[0].Targets) != 1 || resolved != 2 {
+		t.Errorf("entries = %+v, resolved = %d", entries, resolved)
+	}
+}
+
+func TestMiddlewareIgnoresForwardedForFromClients(t *testing.T) {
+	store, err := Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.POST("/prune/images", func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	}, Middleware(store, nil))
+
+	req := httptest.NewRequest(http.MethodPost, "/prune/images", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.Header.Set(echo.HeaderXForwardedFor, "10.1.2.3")
+	req.Header.Set(echo.HeaderXRealIP, "10.1.2.3")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries, err := store.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].RemoteIP != "203.0.113.7" {
+		t.Errorf("entries = %+v, want remote_ip 203.0.113.7", entries)
+	}
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry est une action enregistrée dans le journal d'audit
+type Entry struct {
+	ID         string            `json:"id"`
+	Time       time.Time         `json:"time"`
+	Actor      string            `json:"actor"`
+	Role       string            `json:"role,omitempty"`
+	Method     string            `json:"method"`
+	Route      string            `json:"route"`
+	Path       string            `json:"path"`
+	Params     map[string]string `json:"params,omitempty"`
+	Targets    []Target          `json:"targets,omitempty"`
+	Status     int               `json:"status"`
+	Result     string            `json:"result"` // success ou failure
+	Error      string            `json:"error,omitempty"`
+	DurationMs int64             `json:"duration_ms"`
+	// Adresse donnée par l'IPExtractor d'Echo : celle de la connexion, sauf
+	// derrière un proxy de confiance
+	RemoteIP string `json:"remote_ip,omitempty"`
+}
+
+// Target est un objet Docker touché par l'action, avec la version de sa spec
+// avant et après (absente si l'objet n'existait pas ou plus)
+type Target struct {
+	Type          string  `json:"type"`
+	ID            string  `json:"id"`
+	Name          string  `json:"name,omitempty"`
+	VersionBefore *uint64 `json:"version_before,omitempty"`
+	VersionAfter  *uint64 `json:"version_after,omitempty"`
+}
+
+// Filter restreint les entrées renvoyées par Query
+type Filter struct {
+	Actor  string
+	Target string // ID ou nom d'objet, ou valeur d'un paramètre de route
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// Store est un journal en JSON lines, uniquement en ajout
+type Store struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// Open ouvre (ou crée) le journal au chemin donné
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{path: path, file: f}, nil
+}
+
+// Append ajoute une entrée à la fin du journal
+func (s *Store) Append(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(line)
+	return err
+}
+
+// Query renvoie les entrées correspondant au filtre, les plus récentes en premier
+func (s *Store) Query(filter Filter) ([]Entry, error) {
+	s.mu.Lock()
+	f, err := os.Open(s.path)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []Entry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// Ligne tronquée par un arrêt brutal : on l'ignore
+			continue
+		}
+		if filter.match(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	return entries, nil
+}
+
+// Close ferme le journal
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (f Filter) match(e Entry) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	if f.Target != "" && !e.concerns(f.Target) {
+		return false
+	}
+	return true
+}
+
+// concerns indique si l'entrée touche l'objet désigné par ID (ou préfixe d'ID) ou par nom
+func (e Entry) concerns(target string) bool {
+	for _, t := range e.Targets {
+		if t.Name == target || (t.ID != "" && strings.HasPrefix(t.ID, target)) {
+			return true
+		}
+	}
+	for _, v := range e.Params {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Role détermine les routes accessibles à un utilisateur ou un token
+type Role string
+
+const (
+	// RoleViewer peut consulter l'état du swarm et les logs
+	RoleViewer Role = "viewer"
+	// RoleOperator peut en plus arrêter, démarrer, redémarrer et déployer
+	RoleOperator Role = "operator"
+	// RoleAdmin peut tout faire, y compris supprimer et nettoyer
+	RoleAdmin Role = "admin"
+)
+
+var roleLevels = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+func (r Role) valid() bool {
+	_, ok := roleLevels[r]
+	return ok
+}
+
+// Allows indique si le rôle inclut les droits de required
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] >= roleLevels[required]
+}
+
+// Principal identifie l'auteur d'une requête
+type Principal struct {
+	Name   string `json:"name"`
+	Role   Role   `json:"role"`
+	Method string `json:"method"` // none, password, session ou token
+}
+
+// Clé du Principal dans le contexte Echo
+const principalKey = "auth.principal"
+
+// Paramètre de requête accepté pour les WebSockets, les navigateurs ne
+// permettant pas d'envoyer un header Authorization lors de l'upgrade
+const accessTokenParam = "access_token"
+
+var (
+	errInvalidCredentials = errors.New("invalid credentials")
+	errInvalidSession     = errors.New("invalid or expired session")
+)
+
+// Authenticator vérifie les identifiants des requêtes
+type Authenticator struct {
+	enabled bool
+	ttl     time.Duration
+	secret  []byte
+	users   map[string]UserConfig
+	tokens  []TokenConfig
+	// Ralentit les tentatives de mot de passe (login et Basic)
+	throttle *loginThrottle
+}
+
+// New crée un Authenticator à partir de la configuration chargée.
+// Avec cfg == nil, l'authentification est désactivée et toutes les requêtes
+// sont traitées comme venant d'un administrateur anonyme : main ne le permet
+// qu'avec AUTH_DISABLED=true.
+func New(cfg *Config) (*Authenticator, error) {
+	if cfg == nil {
+		return &Authenticator{}, nil
+	}
+
+	a := &Authenticator{
+		enabled:  true,
+		ttl:      cfg.SessionTTL,
+		secret:   []byte(cfg.SessionSecret),
+		users:    make(map[string]UserConfig),
+		tokens:   cfg.Tokens,
+		throttle: newLoginThrottle(),
+	}
+	if len(a.secret) == 0 {
+		a.secret = make([]byte, 32)
+		if _, err := rand.Read(a.secret); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range cfg.Users {
+		a.users[u.Username] = u
+	}
+	return a, nil
+}
+
+// Enabled indique si l'authentification est active
+func (a *Authenticator) Enabled() bool {
+	return a.enabled
+}
+
+// Middleware identifie l'auteur de chaque requête. Les identifiants acceptés sont :
+// Authorization: Bearer <session ou token d'API>, Authorization: Basic, ou
+// ?access_token= pour les WebSockets. Les routes sans Require restent accessibles.
+func (a *Authenticator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !a.enabled {
+				c.Set(principalKey, &Principal{Name: "anonymous", Role: RoleAdmin, Method: "none"})
+				return next(c)
+			}
+
+			principal, err := a.authenticate(c)
+			if err != nil {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="swarm-manager"`)
+				return authError(c, err)
+			}
+			if principal != nil {
+				c.Set(principalKey, principal)
+			}
+			return next(c)
+		}
+	}
+}
+
+// Require renvoie un middleware de route exigeant au moins le rôle donné
+func Require(role Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := PrincipalFrom(c)
+			if principal == nil {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="swarm-manager"`)
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+			}
+			if !principal.Role.Allows(role) {
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "role " + string(role) + " required"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// PrincipalFrom renvoie l'auteur de la requête, nil s'il n'est pas authentifié
+func PrincipalFrom(c echo.Context) *Principal {
+	principal, _ := c.Get(principalKey).(*Principal)
+	return principal
+}
+
+// Login ouvre une session à partir d'un nom d'utilisateur et d'un mot de passe
+func (a *Authenticator) Login(c echo.Context) error {
+	if !a.enabled {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "authentication is disabled"})
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+
+	user, err := a.checkPassword(req.Username, req.Password, c.RealIP())
+	if err != nil {
+		return authError(c, err)
+	}
+
+	expiresAt := time.Now().Add(a.ttl)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"token":      a.signSession(user.Username, expiresAt),
+		"expires_at": expiresAt,
+		"username":   user.Username,
+		"role":       user.Role,
+	})
+}
+
+// Me renvoie l'identité associée à la requête
+func (a *Authenticator) Me(c echo.Context) error {
+	principal := PrincipalFrom(c)
+	if principal == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "authentication required"})
+	}
+	return c.JSON(http.StatusOK, principal)
+}
+
+// authError renvoie 429 avec Retry-After pendant l'attente imposée après des
+// échecs de connexion, 401 sinon
+func authError(c echo.Context, err error) error {
+	var throttled tooManyAttemptsError
+	if errors.As(err, &throttled) {
+		seconds := int(throttled.retryAfter.Seconds() + 0.999)
+		c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds))
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+}
+
+// authenticate renvoie nil sans erreur si la requête ne porte aucun identifiant
+func (a *Authenticator) authenticate(c echo.Context) (*Principal, error) {
+	r := c.Request()
+	header := r.Header.Get(echo.HeaderAuthorization)
+	scheme, credentials, _ := strings.Cut(header, " ")
+
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		return a.checkBearer(strings.TrimSpace(credentials))
+	case strings.EqualFold(scheme, "Basic"):
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return nil, errInvalidCredentials
+		}
+		user, err := a.checkPassword(username, password, c.RealIP())
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{Name: user.Username, Role: user.Role, Method: "password"}, nil
+	case header != "":
+		return nil, errors.New("unsupported authorization scheme")
+	}
+
+	if token := r.URL.Query().Get(accessTokenParam); token != "" {
+		return a.checkBearer(token)
+	}
+	return nil, nil
+}
+
+// checkBearer accepte un token de session ou un token d'API statique. Un token
+// d'API choisi librement peut avoir la forme d'une session : il est cherché
+// parmi les tokens d'API quand la session n'est pas valide.
+func (a *Authenticator) checkBearer(token string) (*Principal, error) {
+	var sessionErr error
+	if strings.Count(token, ".") == 1 {
+		principal, err := a.verifySession(token)
+		if err == nil {
+			return principal, nil
+		}
+		sessionErr = err
+	}
+
+	digest := sha256.Sum256([]byte(token))
+	for _, t := range a.tokens {
+		expected, _ := hex.DecodeString(t.TokenSHA256)
+		if subtle.ConstantTimeCompare(digest[:], expected) == 1 {
+			return &Principal{Name: "token:" + t.Name, Role: t.Role, Method: "token"}, nil
+		}
+	}
+	if sessionErr != nil {
+		return nil, sessionErr
+	}
+	return nil, errInvalidCredentials
+}
+
+// checkPassword vérifie un mot de passe ; après freeLoginAttempts échecs pour
+// un même utilisateur depuis une adresse, ou depuis une même adresse, les
+// tentatives sont refusées pendant une attente qui double à chaque nouvel
+// échec. Les échecs d'un compte toutes adresses confondues ralentissent aussi
+// les tentatives, mais au plus de maxSharedUserBackoff, pour qu'un tiers ne
+// puisse pas bloquer le compte.
+func (a *Authenticator) checkPassword(username, password, ip string) (UserConfig, error) {
+	userKey, pairKey, ipKey := "user:"+username, "user:"+username+"@"+ip, "ip:"+ip
+	if err := a.throttle.check(userKey, pairKey, ipKey); err != nil {
+		return UserConfig{}, err
+	}
+	user, err := a.comparePassword(username, password)
+	if err != nil {
+		a.throttle.fail(maxLoginBackoff, pairKey, ipKey)
+		a.throttle.fail(maxSharedUserBackoff, userKey)
+		return UserConfig{}, err
+	}
+	// Le compteur de l'adresse n'est pas remis à zéro : un compte valide ne
+	// doit pas permettre d'essayer ceux des autres
+	a.throttle.reset(userKey, pairKey)
+	return user, nil
+}
+
+func (a *Authenticator) comparePassword(username, password string) (UserConfig, error) {
+	user, ok := a.users[username]
+	if !ok {
+		// Comparer quand même pour ne pas révéler l'existence du compte par le temps de réponse
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return UserConfig{}, errInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return UserConfig{}, errInvalidCredentials
+	}
+	return user, nil
+}
+
+// Hash bcrypt d'un mot de passe quelconque, utilisé pour les comptes inconnus
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("swarm-manager"), bcrypt.DefaultCost)
+
+type sessionClaims struct {
+	Username  string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// signSession produit "payload.signature" en base64url, signé par HMAC-SHA256
+func (a *Authenticator) signSession(username string, expiresAt time.Time) string {
+	payload, _ := json.Marshal(sessionClaims{Username: username, ExpiresAt: expiresAt.Unix()})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(a.sign(encoded))
+}
+
+// verifySession valide la signature et l'expiration. Le rôle est relu dans la
+// configuration pour qu'un changement de rôle s'applique aux sessions ouvertes.
+func (a *Authenticator) verifySession(token string) (*Principal, error) {
+	encoded, signature, _ := strings.Cut(token, ".")
+	expected := a.sign(encoded)
+	given, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(given, expected) {
+		return nil, errInvalidSession
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errInvalidSession
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errInvalidSession
+	}
+	user, ok := a.users[claims.Username]
+	if !ok {
+		return nil, errInvalidSession
+	}
+	return &Principal{Name: user.Username, Role: user.Role, Method: "session"}, nil
+}
+
+func (a *Authenticator) sign(data string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// HashPassword renvoie le hash bcrypt à placer dans password_hash
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newTestAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	hash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("ci-token"))
+	// Token d'API ayant la forme d'une session
+	dotted := sha256.Sum256([]byte("deploy.token"))
+	cfg := &Config{
+		Users: []UserConfig{{Username: "alice", PasswordHash: hash, Role: RoleOperator}},
+		Tokens: []TokenConfig{
+			{Name: "ci", TokenSHA256: hex.EncodeToString(digest[:]), Role: RoleViewer},
+			{Name: "deploy", TokenSHA256: hex.EncodeToString(dotted[:]), Role: RoleOperator},
+		},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func login(e *echo.Echo, username, password, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"`+username+`","password":"`+password+`"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRealIP, ip)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoginThrottle(t *testing.T) {
+	a := newTestAuthenticator(t)
+	now := time.Now()
+	a.throttle.now = func() time.Time { return now }
+	e := echo.New()
+	e.POST("/login", a.Login)
+
+	for i := 0; i < freeLoginAttempts; i++ {
+		if rec := login(e, "alice", "wrong", "10.0.0.1"); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want 401", i+1, rec.Code)
+		}
+	}
+	// Le sixième échec impose une attente d'une seconde
+	login(e, "alice", "wrong", "10.0.0.1")
+	rec := login(e, "alice", "secret", "10.0.0.2")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get(echo.HeaderRetryAfter) != "1" {
+		t.Fatalf("throttled user: status = %d, Retry-After = %q", rec.Code, rec.Header().Get(echo.HeaderRetryAfter))
+	}
+	// L'adresse est aussi ralentie, quel que soit le compte
+	if rec := login(e, "bob", "x", "10.0.0.1"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("throttled address: status = %d, want 429", rec.Code)
+	}
+
+	now = now.Add(2 * time.Second)
+	if rec := login(e, "alice", "secret", "10.0.0.2"); rec.Code != http.StatusOK {
+		t.Fatalf("after the backoff: status = %d, want 200", rec.Code)
+	}
+	// Une connexion réussie remet le compteur de l'utilisateur à zéro
+	if rec := login(e, "alice", "wrong", "10.0.0.2"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("after a success: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestLoginBackoffDoublesAndCaps(t *testing.T) {
+	th := newLoginThrottle()
+	now := time.Now()
+	th.now = func() time.Time { return now }
+
+	for i := 0; i < freeLoginAttempts+3; i++ {
+		th.fail(maxLoginBackoff, "user:alice")
+	}
+	err, ok := th.check("user:alice").(tooManyAttemptsError)
+	if !ok || err.retryAfter != 4*time.Second {
+		t.Fatalf("check = %v, want a 4s backoff", th.check("user:alice"))
+	}
+	for i := 0; i < 30; i++ {
+		th.fail(maxLoginBackoff, "user:alice")
+	}
+	if err := th.check("user:alice").(tooManyAttemptsError); err.retryAfter != maxLoginBackoff {
+		t.Errorf("backoff = %s, want %s", err.retryAfter, maxLoginBackoff)
+	}
+	if err := th.check("user:bob"); err != nil {
+		t.Errorf("other user: %v", err)
+	}
+}
+
+func TestLoginFailuresFromOtherAddressesAreCapped(t *testing.T) {
+	a := newTestAuthenticator(t)
+	now := time.Now()
+	a.throttle.now = func() time.Time { return now }
+	e := echo.New()
+	e.POST("/login", a.Login)
+
+	// Un tiers qui change d'adresse à chaque échec ne bloque le compte que
+	// pour maxSharedUserBackoff
+	for i := 0; i < freeLoginAttempts+10; i++ {
+		now = now.Add(maxSharedUserBackoff)
+		login(e, "alice", "wrong", "192.0.2."+strconv.Itoa(i))
+	}
+	rec := login(e, "alice", "secret", "10.0.0.2")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get(echo.HeaderRetryAfter) != "30" {
+		t.Fatalf("shared user backoff: status = %d, Retry-After = %q, want 429 and 30", rec.Code, rec.Header().Get(echo.HeaderRetryAfter))
+	}
+	now = now.Add(maxSharedUserBackoff)
+	if rec := login(e, "alice", "secret", "10.0.0.2"); rec.Code != http.StatusOK {
+		t.Fatalf("after the shared backoff: status = %d, want 200", rec.Code)
+	}
+
+	// Depuis une même adresse, l'attente sur le compte continue de doubler
+	for i := 0; i < freeLoginAttempts+8; i++ {
+		now = now.Add(maxSharedUserBackoff)
+		login(e, "alice", "wrong", "10.0.0.3")
+	}
+	err, ok := a.throttle.check("user:alice@10.0.0.3").(tooManyAttemptsError)
+	if !ok || err.retryAfter <= maxSharedUserBackoff {
+		t.Errorf("same address backoff = %v, want more than %s", a.throttle.check("user:alice@10.0.0.3"), maxSharedUserBackoff)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	a := newTestAuthenticator(t)
+	e := echo.New()
+	e.GET("/read", func(c echo.Context) error { return c.String(http.StatusOK, PrincipalFrom(c).Name) }, a.Middleware(), Require(RoleViewer))
+	e.POST("/write", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }, a.Middleware(), Require(RoleOperator))
+
+	for _, tc := range []struct {
+		name, method, url, authorization string
+		want                             int
+	}{
+		{"anonymous", http.MethodGet, "/read", "", http.StatusUnauthorized},
+		{"token", http.MethodGet, "/read", "Bearer ci-token", http.StatusOK},
+		{"token in query", http.MethodGet, "/read?access_token=ci-token", "", http.StatusOK},
+		{"bad token", http.MethodGet, "/read", "Bearer nope", http.StatusUnauthorized},
+		{"token with a dot", http.MethodPost, "/write", "Bearer deploy.token", http.StatusNoContent},
+		{"forged session", http.MethodGet, "/read", "Bearer eyJzdWIiOiJhbGljZSJ9.c2ln", http.StatusUnauthorized},
+		{"viewer on operator route", http.MethodPost, "/write", "Bearer ci-token", http.StatusForbidden},
+		{"basic", http.MethodPost, "/write", "Basic YWxpY2U6c2VjcmV0", http.StatusNoContent},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, nil)
+			if tc.authorization != "" {
+				req.Header.Set(echo.HeaderAuthorization, tc.authorization)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Errorf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
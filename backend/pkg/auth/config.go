@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config est le fichier de configuration de l'authentification (YAML).
+//
+//	session_ttl: 12h
+//	session_secret: "une-longue-chaine-aleatoire"
+//	users:
+//	  - username: admin
+//	    password_hash: "$2a$10$..."   # swarm-manager -hash-password
+//	    role: admin
+//	tokens:
+//	  - name: ci
+//	    token_sha256: "9f86d0..."     # sha256 hexadécimal du token
+//	    role: operator
+type Config struct {
+	// Durée de validité des sessions ouvertes par /api/auth/login
+	SessionTTL time.Duration `yaml:"session_ttl"`
+	// Clé HMAC des sessions ; générée au démarrage si vide (les sessions
+	// sont alors invalidées à chaque redémarrage)
+	SessionSecret string        `yaml:"session_secret"`
+	Users         []UserConfig  `yaml:"users"`
+	Tokens        []TokenConfig `yaml:"tokens"`
+}
+
+// UserConfig décrit un utilisateur local
+type UserConfig struct {
+	Username     string `yaml:"username"`
+	PasswordHash string `yaml:"password_hash"`
+	Role         Role   `yaml:"role"`
+}
+
+// TokenConfig décrit un token d'API statique
+type TokenConfig struct {
+	Name        string `yaml:"name"`
+	TokenSHA256 string `yaml:"token_sha256"`
+	Role        Role   `yaml:"role"`
+}
+
+const defaultSessionTTL = 12 * time.Hour
+
+// LoadConfig lit et valide le fichier de configuration
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid auth config %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) validate() error {
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = defaultSessionTTL
+	}
+	if len(cfg.Users) == 0 && len(cfg.Tokens) == 0 {
+		return fmt.Errorf("at least one user or token is required")
+	}
+
+	usernames := make(map[string]bool)
+	for _, u := range cfg.Users {
+		if u.Username == "" || u.PasswordHash == "" {
+			return fmt.Errorf("users need a username and a password_hash")
+		}
+		if usernames[u.Username] {
+			return fmt.Errorf("duplicate user %q", u.Username)
+		}
+		usernames[u.Username] = true
+		if !u.Role.valid() {
+			return fmt.Errorf("user %q: unknown role %q", u.Username, u.Role)
+		}
+	}
+	for _, t := range cfg.Tokens {
+		if t.Name == "" {
+			return fmt.Errorf("tokens need a name")
+		}
+		if digest, err := hex.DecodeString(t.TokenSHA256); err != nil || len(digest) != 32 {
+			return fmt.Errorf("token %q: token_sha256 must be a hex-encoded SHA-256 digest", t.Name)
+		}
+		if !t.Role.valid() {
+			return fmt.Errorf("token %q: unknown role %q", t.Name, t.Role)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Échecs consécutifs tolérés avant de ralentir les tentatives
+	freeLoginAttempts = 5
+	// Attente maximale entre deux tentatives, doublée à chaque échec
+	maxLoginBackoff = 15 * time.Minute
+	// Attente maximale d'un compte toutes adresses confondues : n'importe qui
+	// peut échouer sur un compte, qui ne doit pas rester bloqué pour autant
+	maxSharedUserBackoff = 30 * time.Second
+	// Un compteur sans échec depuis cette durée est oublié
+	loginFailureTTL = time.Hour
+	// Taille à partir de laquelle les compteurs oubliés sont purgés
+	loginThrottlePurgeSize = 1024
+)
+
+// tooManyAttemptsError refuse une tentative de connexion pendant l'attente
+type tooManyAttemptsError struct{ retryAfter time.Duration }
+
+func (e tooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry in %s", e.retryAfter.Round(time.Second))
+}
+
+// loginThrottle ralentit les tentatives de mot de passe après plusieurs
+// échecs, par nom d'utilisateur et par adresse IP
+type loginThrottle struct {
+	mu       sync.Mutex
+	failures map[string]*loginFailures
+	now      func() time.Time
+}
+
+type loginFailures struct {
+	count int
+	last  time.Time
+	until time.Time // pas de nouvelle tentative avant
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{failures: make(map[string]*loginFailures), now: time.Now}
+}
+
+// check renvoie une erreur si l'une des clés doit encore attendre
+func (t *loginThrottle) check(keys ...string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var wait time.Duration
+	for _, key := range keys {
+		if f := t.failures[key]; f != nil && f.until.After(now) {
+			wait = max(wait, f.until.Sub(now))
+		}
+	}
+	if wait > 0 {
+		return tooManyAttemptsError{retryAfter: wait}
+	}
+	return nil
+}
+
+// fail compte un échec : au-delà de freeLoginAttempts, l'attente double à
+// chaque échec jusqu'à limit
+func (t *loginThrottle) fail(limit time.Duration, keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if len(t.failures) >= loginThrottlePurgeSize {
+		for key, f := range t.failures {
+			if now.Sub(f.last) > loginFailureTTL {
+				delete(t.failures, key)
+			}
+		}
+	}
+	for _, key := range keys {
+		f := t.failures[key]
+		if f == nil || now.Sub(f.last) > loginFailureTTL {
+			f = &loginFailures{}
+			t.failures[key] = f
+		}
+		f.count++
+		f.last = now
+		if excess := f.count - freeLoginAttempts; excess > 0 {
+			backoff := time.Duration(math.Min(float64(time.Second)*math.Pow(2, float64(excess-1)), float64(limit)))
+			f.until = now.Add(backoff)
+		}
+	}
+}
+
+// reset oublie les échecs après une connexion réussie
+func (t *loginThrottle) reset(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		delete(t.failures, key)
+	}
+}
@@ -0,0 +1,596 @@
+package compose
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/go-units"
+)
+
+const (
+	// LabelNamespace est le label posé par `docker stack deploy` sur tous les objets d'une stack
+	LabelNamespace = "com.docker.stack.namespace"
+	// LabelImage mémorise l'image demandée dans le fichier compose
+	LabelImage = "com.docker.stack.image"
+	// LabelContentHash mémorise le SHA-256 du contenu d'un secret ou d'une
+	// config, que l'API ne renvoie pas pour les secrets
+	LabelContentHash = "swarm-manager.content-sha256"
+
+	defaultNetwork       = "default"
+	defaultNetworkDriver = "overlay"
+)
+
+// Stack regroupe les objets swarm à créer pour déployer un fichier compose
+type Stack struct {
+	Namespace string
+	// Services triés par nom. Les références aux secrets et configs ne
+	// contiennent que leur nom : les IDs sont résolus au déploiement.
+	Services []swarm.ServiceSpec
+	// Réseaux à créer s'ils n'existent pas, indexés par nom complet
+	Networks map[string]network.CreateOptions
+	// Réseaux externes qui doivent déjà exister
+	ExternalNetworks []string
+	Secrets          []swarm.SecretSpec
+	Configs          []swarm.ConfigSpec
+	// Secrets et configs externes qui doivent déjà exister
+	ExternalSecrets []string
+	ExternalConfigs []string
+	// Services dont le fichier fixe deploy.replicas, indexés par nom complet
+	FixedReplicas map[string]bool
+}
+
+// Convert traduit un fichier compose en objets swarm pour la stack namespace.
+// files contient le contenu des fichiers référencés par `file:` dans les
+// secrets et configs, indexé par chemin ou nom de fichier.
+func Convert(namespace string, cfg *Config, files map[string][]byte) (*Stack, error) {
+	stack := &Stack{
+		Namespace:     namespace,
+		Networks:      make(map[string]network.CreateOptions),
+		FixedReplicas: make(map[string]bool),
+	}
+
+	usedNetworks := make(map[string]bool)
+	usedSecrets := make(map[string]bool)
+	usedConfigs := make(map[string]bool)
+
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		svc := cfg.Services[name]
+		spec, err := convertService(namespace, name, svc, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", name, err)
+		}
+		stack.Services = append(stack.Services, spec)
+		if svc.Deploy.Replicas != nil {
+			stack.FixedReplicas[spec.Name] = true
+		}
+
+		if len(svc.Networks) == 0 {
+			usedNetworks[defaultNetwork] = true
+		}
+		for netName := range svc.Networks {
+			usedNetworks[netName] = true
+		}
+		for _, ref := range svc.Secrets {
+			usedSecrets[ref.Source] = true
+		}
+		for _, ref := range svc.Configs {
+			usedConfigs[ref.Source] = true
+		}
+	}
+
+	for netName := range usedNetworks {
+		netCfg := cfg.Networks[netName]
+		fullName := networkName(namespace, netName, netCfg)
+		if netCfg.External.External {
+			stack.ExternalNetworks = append(stack.ExternalNetworks, fullName)
+			continue
+		}
+		stack.Networks[fullName] = convertNetwork(namespace, netCfg)
+	}
+	sort.Strings(stack.ExternalNetworks)
+
+	for _, name := range sortedKeys(usedSecrets) {
+		obj := cfg.Secrets[name]
+		fullName := objectName(namespace, name, obj)
+		if obj.External.External {
+			stack.ExternalSecrets = append(stack.ExternalSecrets, fullName)
+			continue
+		}
+		data, err := objectData(obj, files)
+		if err != nil {
+			return nil, fmt.Errorf("secret %q: %w", name, err)
+		}
+		stack.Secrets = append(stack.Secrets, swarm.SecretSpec{
+			Annotations: swarm.Annotations{Name: fullName, Labels: objectLabels(obj, namespace, data)},
+			Data:        data,
+		})
+	}
+
+	for _, name := range sortedKeys(usedConfigs) {
+		obj := cfg.Configs[name]
+		fullName := objectName(namespace, name, obj)
+		if obj.External.External {
+			stack.ExternalConfigs = append(stack.ExternalConfigs, fullName)
+			continue
+		}
+		data, err := objectData(obj, files)
+		if err != nil {
+			return nil, fmt.Errorf("config %q: %w", name, err)
+		}
+		stack.Configs = append(stack.Configs, swarm.ConfigSpec{
+			Annotations: swarm.Annotations{Name: fullName, Labels: objectLabels(obj, namespace, data)},
+			Data:        data,
+		})
+	}
+
+	return stack, nil
+}
+
+// objectLabels ajoute aux labels d'un secret ou d'une config le namespace et
+// le hash de son contenu
+func objectLabels(obj FileObject, namespace string, data []byte) map[string]string {
+	labels := withNamespace(obj.Labels, namespace)
+	sum := sha256.Sum256(data)
+	labels[LabelContentHash] = hex.EncodeToString(sum[:])
+	return labels
+}
+
+// ScopedName préfixe un nom par le namespace de la stack, comme docker stack deploy
+func ScopedName(namespace, name string) string {
+	return namespace + "_" + name
+}
+
+func convertService(namespace, name string, svc ServiceConfig, cfg *Config) (swarm.ServiceSpec, error) {
+	labels := withNamespace(svc.Deploy.Labels, namespace)
+	labels[LabelImage] = svc.Image
+
+	containerSpec := &swarm.ContainerSpec{
+		Image:           svc.Image,
+		Labels:          withNamespace(svc.Labels, namespace),
+		Command:         svc.Entrypoint,
+		Args:            svc.Command,
+		Hostname:        svc.Hostname,
+		Env:             convertEnvironment(svc.Environment),
+		Dir:             svc.WorkingDir,
+		User:            svc.User,
+		Init:            svc.Init,
+		StopSignal:      svc.StopSignal,
+		StopGracePeriod: svc.StopGracePeriod.Value(),
+		TTY:             svc.Tty,
+		OpenStdin:       svc.StdinOpen,
+		ReadOnly:        svc.ReadOnly,
+		Hosts:           convertExtraHosts(svc.ExtraHosts),
+		Sysctls:         svc.Sysctls,
+		CapabilityAdd:   svc.CapAdd,
+		CapabilityDrop:  svc.CapDrop,
+	}
+	if len(svc.DNS) > 0 || len(svc.DNSSearch) > 0 {
+		containerSpec.DNSConfig = &swarm.DNSConfig{Nameservers: svc.DNS, Search: svc.DNSSearch}
+	}
+	if svc.Healthcheck != nil {
+		containerSpec.Healthcheck = convertHealthcheck(svc.Healthcheck)
+	}
+
+	mounts, err := convertVolumes(namespace, svc.Volumes, cfg)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+	containerSpec.Mounts = mounts
+
+	for _, ref := range svc.Secrets {
+		target := &swarm.SecretReferenceFileTarget{Name: ref.Source, UID: "0", GID: "0", Mode: 0o444}
+		applyFileTarget(ref, &target.Name, &target.UID, &target.GID, &target.Mode)
+		containerSpec.Secrets = append(containerSpec.Secrets, &swarm.SecretReference{
+			File:       target,
+			SecretName: objectName(namespace, ref.Source, cfg.Secrets[ref.Source]),
+		})
+	}
+	for _, ref := range svc.Configs {
+		target := &swarm.ConfigReferenceFileTarget{Name: "/" + ref.Source, UID: "0", GID: "0", Mode: 0o444}
+		applyFileTarget(ref, &target.Name, &target.UID, &target.GID, &target.Mode)
+		containerSpec.Configs = append(containerSpec.Configs, &swarm.ConfigReference{
+			File:       target,
+			ConfigName: objectName(namespace, ref.Source, cfg.Configs[ref.Source]),
+		})
+	}
+
+	mode, err := convertMode(svc.Deploy)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+	resources, err := convertResources(svc.Deploy.Resources)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+
+	spec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: ScopedName(namespace, name), Labels: labels},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: containerSpec,
+			Resources:     resources,
+			RestartPolicy: convertRestartPolicy(svc.Deploy.RestartPolicy),
+			Placement:     convertPlacement(svc.Deploy.Placement),
+			Networks:      convertServiceNetworks(namespace, name, svc.Networks, cfg),
+		},
+		Mode:           mode,
+		UpdateConfig:   convertUpdateConfig(svc.Deploy.UpdateConfig),
+		RollbackConfig: convertUpdateConfig(svc.Deploy.RollbackConfig),
+		EndpointSpec:   convertEndpoint(svc.Deploy.EndpointMode, svc.Ports),
+	}
+	if svc.Logging != nil {
+		spec.TaskTemplate.LogDriver = &swarm.Driver{Name: svc.Logging.Driver, Options: svc.Logging.Options}
+	}
+	return spec, nil
+}
+
+func convertMode(deploy DeployConfig) (swarm.ServiceMode, error) {
+	replicas := uint64(1)
+	if deploy.Replicas != nil {
+		replicas = *deploy.Replicas
+	}
+	switch deploy.Mode {
+	case "", "replicated":
+		return swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}}, nil
+	case "global":
+		if deploy.Replicas != nil {
+			return swarm.ServiceMode{}, fmt.Errorf("replicas cannot be set in global mode")
+		}
+		return swarm.ServiceMode{Global: &swarm.GlobalService{}}, nil
+	case "replicated-job":
+		return swarm.ServiceMode{ReplicatedJob: &swarm.ReplicatedJob{MaxConcurrent: &replicas, TotalCompletions: &replicas}}, nil
+	case "global-job":
+		return swarm.ServiceMode{GlobalJob: &swarm.GlobalJob{}}, nil
+	}
+	return swarm.ServiceMode{}, fmt.Errorf("unknown deploy mode %q", deploy.Mode)
+}
+
+// convertEnvironment omet les variables sans valeur, qui restent non définies
+func convertEnvironment(env Environment) []string {
+	var result []string
+	for key, value := range env {
+		if value == nil {
+			continue
+		}
+		result = append(result, key+"="+*value)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// convertExtraHosts passe de "host:ip" au format hosts(5) attendu par swarm : "ip host"
+func convertExtraHosts(hosts []string) []string {
+	var result []string
+	for _, entry := range hosts {
+		host, ip, found := strings.Cut(entry, ":")
+		if !found {
+			host, ip, _ = strings.Cut(entry, "=")
+		}
+		result = append(result, ip+" "+host)
+	}
+	return result
+}
+
+func convertHealthcheck(hc *HealthcheckConfig) *container.HealthConfig {
+	if hc.Disable {
+		return &container.HealthConfig{Test: []string{"NONE"}}
+	}
+	config := &container.HealthConfig{Test: hc.Test}
+	if hc.Interval != nil {
+		config.Interval = *hc.Interval.Value()
+	}
+	if hc.Timeout != nil {
+		config.Timeout = *hc.Timeout.Value()
+	}
+	if hc.StartPeriod != nil {
+		config.StartPeriod = *hc.StartPeriod.Value()
+	}
+	if hc.StartInterval != nil {
+		config.StartInterval = *hc.StartInterval.Value()
+	}
+	if hc.Retries != nil {
+		config.Retries = *hc.Retries
+	}
+	return config
+}
+
+func convertVolumes(namespace string, volumes []VolumeMount, cfg *Config) ([]mount.Mount, error) {
+	var mounts []mount.Mount
+	for _, v := range volumes {
+		m := mount.Mount{
+			Type:     mount.Type(v.Type),
+			Source:   v.Source,
+			Target:   v.Target,
+			ReadOnly: v.ReadOnly,
+		}
+		switch m.Type {
+		case mount.TypeBind:
+			if !path.IsAbs(v.Source) {
+				return nil, fmt.Errorf("bind mount source %q must be an absolute path on the nodes", v.Source)
+			}
+		case mount.TypeVolume:
+			m.VolumeOptions = &mount.VolumeOptions{}
+			if v.Volume != nil {
+				m.VolumeOptions.NoCopy = v.Volume.NoCopy
+			}
+			if v.Source == "" {
+				break
+			}
+			volCfg, ok := cfg.Volumes[v.Source]
+			if !ok {
+				return nil, fmt.Errorf("undefined volume %q", v.Source)
+			}
+			if volCfg.External.External {
+				m.Source = firstNonEmpty(volCfg.External.Name, volCfg.Name, v.Source)
+				break
+			}
+			m.Source = firstNonEmpty(volCfg.Name, ScopedName(namespace, v.Source))
+			m.VolumeOptions.Labels = withNamespace(volCfg.Labels, namespace)
+			if volCfg.Driver != "" || len(volCfg.DriverOpts) > 0 {
+				m.VolumeOptions.DriverConfig = &mount.Driver{Name: volCfg.Driver, Options: volCfg.DriverOpts}
+			}
+		case mount.TypeTmpfs:
+			if v.Source != "" {
+				return nil, fmt.Errorf("tmpfs mount %q cannot have a source", v.Target)
+			}
+			if v.Tmpfs != nil && v.Tmpfs.Size != "" {
+				size, err := units.RAMInBytes(v.Tmpfs.Size)
+				if err != nil {
+					return nil, fmt.Errorf("invalid tmpfs size %q", v.Tmpfs.Size)
+				}
+				m.TmpfsOptions = &mount.TmpfsOptions{SizeBytes: size}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported mount type %q", v.Type)
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+func convertResources(res Resources) (*swarm.ResourceRequirements, error) {
+	if res.Limits == nil && res.Reservations == nil {
+		return nil, nil
+	}
+	result := &swarm.ResourceRequirements{}
+	if res.Limits != nil {
+		cpus, memory, err := parseResourceSpec(res.Limits)
+		if err != nil {
+			return nil, err
+		}
+		result.Limits = &swarm.Limit{NanoCPUs: cpus, MemoryBytes: memory, Pids: res.Limits.Pids}
+	}
+	if res.Reservations != nil {
+		cpus, memory, err := parseResourceSpec(res.Reservations)
+		if err != nil {
+			return nil, err
+		}
+		result.Reservations = &swarm.Resources{NanoCPUs: cpus, MemoryBytes: memory}
+	}
+	return result, nil
+}
+
+func parseResourceSpec(spec *ResourceSpec) (nanoCPUs int64, memory int64, err error) {
+	if spec.CPUs != "" {
+		cpus, err := strconv.ParseFloat(spec.CPUs, 64)
+		if err != nil || cpus < 0 {
+			return 0, 0, fmt.Errorf("invalid cpus value %q", spec.CPUs)
+		}
+		nanoCPUs = int64(cpus * 1e9)
+	}
+	if spec.Memory != "" {
+		if memory, err = units.RAMInBytes(spec.Memory); err != nil {
+			return 0, 0, fmt.Errorf("invalid memory value %q", spec.Memory)
+		}
+	}
+	return nanoCPUs, memory, nil
+}
+
+func convertRestartPolicy(policy *RestartPolicy) *swarm.RestartPolicy {
+	if policy == nil {
+		return nil
+	}
+	result := &swarm.RestartPolicy{
+		Delay:       policy.Delay.Value(),
+		MaxAttempts: policy.MaxAttempts,
+		Window:      policy.Window.Value(),
+	}
+	switch policy.Condition {
+	case "none", "no":
+		result.Condition = swarm.RestartPolicyConditionNone
+	case "on-failure":
+		result.Condition = swarm.RestartPolicyConditionOnFailure
+	case "any", "always", "unless-stopped", "":
+		result.Condition = swarm.RestartPolicyConditionAny
+	default:
+		result.Condition = swarm.RestartPolicyCondition(policy.Condition)
+	}
+	return result
+}
+
+func convertPlacement(placement Placement) *swarm.Placement {
+	if len(placement.Constraints) == 0 && len(placement.Preferences) == 0 && placement.MaxReplicas == 0 {
+		return nil
+	}
+	result := &swarm.Placement{Constraints: placement.Constraints, MaxReplicas: placement.MaxReplicas}
+	for _, pref := range placement.Preferences {
+		result.Preferences = append(result.Preferences, swarm.PlacementPreference{
+			Spread: &swarm.SpreadOver{SpreadDescriptor: pref.Spread},
+		})
+	}
+	return result
+}
+
+func convertUpdateConfig(cfg *UpdateConfig) *swarm.UpdateConfig {
+	if cfg == nil {
+		return nil
+	}
+	parallelism := uint64(1)
+	if cfg.Parallelism != nil {
+		parallelism = *cfg.Parallelism
+	}
+	result := &swarm.UpdateConfig{
+		Parallelism:     parallelism,
+		FailureAction:   cfg.FailureAction,
+		MaxFailureRatio: cfg.MaxFailureRatio,
+		Order:           cfg.Order,
+	}
+	if cfg.Delay != nil {
+		result.Delay = *cfg.Delay.Value()
+	}
+	if cfg.Monitor != nil {
+		result.Monitor = *cfg.Monitor.Value()
+	}
+	return result
+}
+
+func convertEndpoint(endpointMode string, ports Ports) *swarm.EndpointSpec {
+	spec := &swarm.EndpointSpec{Mode: swarm.ResolutionMode(strings.ToLower(endpointMode))}
+	if spec.Mode == "" {
+		spec.Mode = swarm.ResolutionModeVIP
+	}
+	for _, p := range ports {
+		protocol := p.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		publishMode := swarm.PortConfigPublishModeIngress
+		if p.Mode == "host" {
+			publishMode = swarm.PortConfigPublishModeHost
+		}
+		spec.Ports = append(spec.Ports, swarm.PortConfig{
+			Protocol:      swarm.PortConfigProtocol(protocol),
+			TargetPort:    p.Target,
+			PublishedPort: p.Published,
+			PublishMode:   publishMode,
+		})
+	}
+	return spec
+}
+
+func convertServiceNetworks(namespace, serviceName string, networks ServiceNetworks, cfg *Config) []swarm.NetworkAttachmentConfig {
+	if len(networks) == 0 {
+		networks = ServiceNetworks{defaultNetwork: nil}
+	}
+	var result []swarm.NetworkAttachmentConfig
+	for _, netName := range sortedKeys(networks) {
+		aliases := []string{serviceName}
+		if netCfg := networks[netName]; netCfg != nil {
+			aliases = append(aliases, netCfg.Aliases...)
+		}
+		result = append(result, swarm.NetworkAttachmentConfig{
+			Target:  networkName(namespace, netName, cfg.Networks[netName]),
+			Aliases: aliases,
+		})
+	}
+	return result
+}
+
+func convertNetwork(namespace string, cfg NetworkConfig) network.CreateOptions {
+	options := network.CreateOptions{
+		Driver:     firstNonEmpty(cfg.Driver, defaultNetworkDriver),
+		Scope:      "swarm",
+		Options:    cfg.DriverOpts,
+		Internal:   cfg.Internal,
+		Attachable: cfg.Attachable,
+		Labels:     withNamespace(cfg.Labels, namespace),
+	}
+	if cfg.Ipam != nil {
+		options.IPAM = &network.IPAM{Driver: cfg.Ipam.Driver}
+		for _, pool := range cfg.Ipam.Config {
+			options.IPAM.Config = append(options.IPAM.Config, network.IPAMConfig{
+				Subnet:  pool.Subnet,
+				Gateway: pool.Gateway,
+				IPRange: pool.IPRange,
+			})
+		}
+	}
+	return options
+}
+
+func networkName(namespace, name string, cfg NetworkConfig) string {
+	if cfg.External.External {
+		return firstNonEmpty(cfg.External.Name, cfg.Name, name)
+	}
+	return firstNonEmpty(cfg.Name, ScopedName(namespace, name))
+}
+
+func objectName(namespace, name string, obj FileObject) string {
+	if obj.External.External {
+		return firstNonEmpty(obj.External.Name, obj.Name, name)
+	}
+	return firstNonEmpty(obj.Name, ScopedName(namespace, name))
+}
+
+func objectData(obj FileObject, files map[string][]byte) ([]byte, error) {
+	if obj.Content != "" {
+		return []byte(obj.Content), nil
+	}
+	if obj.File == "" {
+		return nil, fmt.Errorf("one of file, content or external is required")
+	}
+	if data, ok := files[path.Clean(obj.File)]; ok {
+		return data, nil
+	}
+	if data, ok := files[path.Base(obj.File)]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("file %q was not uploaded with the compose file", obj.File)
+}
+
+func applyFileTarget(ref FileReference, name, uid, gid *string, mode *os.FileMode) {
+	if ref.Target != "" {
+		*name = ref.Target
+	}
+	if ref.UID != "" {
+		*uid = ref.UID
+	}
+	if ref.GID != "" {
+		*gid = ref.GID
+	}
+	if ref.Mode != nil {
+		*mode = os.FileMode(*ref.Mode)
+	}
+}
+
+func withNamespace(labels map[string]string, namespace string) map[string]string {
+	result := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[LabelNamespace] = namespace
+	return result
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
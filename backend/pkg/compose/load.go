@@ -0,0 +1,402 @@
+package compose
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load parse un fichier compose v3 après interpolation des variables.
+// Seules les variables du fichier .env fourni sont utilisées : l'environnement
+// du serveur n'est volontairement jamais exposé aux fichiers compose envoyés.
+func Load(data []byte, envFile []byte) (*Config, error) {
+	env, err := ParseEnvFile(envFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid env file: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+	if len(root.Content) == 0 {
+		return nil, errors.New("compose file is empty")
+	}
+	if err := interpolateNode(&root, env); err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := root.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+	if err := validate(cfg); err != nil {
+		return nil, err
+	}
+	// Variables d'environnement sans valeur : reprises du fichier .env s'il
+	// les définit, sinon laissées non définies
+	for _, svc := range cfg.Services {
+		for key, value := range svc.Environment {
+			if v, ok := env[key]; ok && value == nil {
+				svc.Environment[key] = &v
+			}
+		}
+	}
+	return cfg, nil
+}
+
+func validate(cfg *Config) error {
+	if cfg.Version != "" && !strings.HasPrefix(cfg.Version, "3") {
+		return fmt.Errorf("unsupported compose file version %q: version 3 is required", cfg.Version)
+	}
+	if len(cfg.Services) == 0 {
+		return errors.New("compose file defines no services")
+	}
+	for name, svc := range cfg.Services {
+		if svc.Image == "" {
+			return fmt.Errorf("service %q: image is required (build is not supported by swarm)", name)
+		}
+		switch svc.Deploy.Mode {
+		case "", "replicated", "global", "replicated-job", "global-job":
+		default:
+			return fmt.Errorf("service %q: unknown deploy mode %q", name, svc.Deploy.Mode)
+		}
+		for netName := range svc.Networks {
+			if netName == "default" {
+				continue
+			}
+			if _, ok := cfg.Networks[netName]; !ok {
+				return fmt.Errorf("service %q refers to undefined network %q", name, netName)
+			}
+		}
+		for _, ref := range svc.Secrets {
+			if _, ok := cfg.Secrets[ref.Source]; !ok {
+				return fmt.Errorf("service %q refers to undefined secret %q", name, ref.Source)
+			}
+		}
+		for _, ref := range svc.Configs {
+			if _, ok := cfg.Configs[ref.Source]; !ok {
+				return fmt.Errorf("service %q refers to undefined config %q", name, ref.Source)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseEnvFile lit un fichier .env (CLE=valeur, commentaires, guillemets)
+func ParseEnvFile(data []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNumber)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			quote := value[0]
+			value = value[1 : len(value)-1]
+			if quote == '"' {
+				value = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(value)
+			}
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			// Commentaire en fin de ligne pour les valeurs sans guillemets
+			value = strings.TrimSpace(value[:i])
+		}
+		env[key] = value
+	}
+	return env, scanner.Err()
+}
+
+// interpolateNode remplace les variables dans toutes les valeurs scalaires
+func interpolateNode(node *yaml.Node, env map[string]string) error {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "$") {
+			return nil
+		}
+		value, err := interpolate(node.Value, env)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := interpolateNode(child, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interpolate gère $VAR, ${VAR}, ${VAR:-def}, ${VAR-def}, ${VAR:?err}, ${VAR?err}
+// et $$. La valeur par défaut et le message d'erreur peuvent eux-mêmes
+// contenir des variables, comme ${A:-${B}}.
+func interpolate(value string, env map[string]string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' {
+			out.WriteByte(value[i])
+			continue
+		}
+		if i+1 >= len(value) {
+			out.WriteByte('$')
+			continue
+		}
+		next := value[i+1]
+		switch {
+		case next == '$':
+			out.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(value, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("invalid interpolation format in %q: missing }", value)
+			}
+			resolved, err := resolveVariable(value[i+2:end], env)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(resolved)
+			i = end
+		case isVariableChar(next, true):
+			j := i + 1
+			for j < len(value) && isVariableChar(value[j], false) {
+				j++
+			}
+			out.WriteString(env[value[i+1:j]])
+			i = j - 1
+		default:
+			out.WriteByte('$')
+		}
+	}
+	return out.String(), nil
+}
+
+// closingBrace renvoie l'indice de l'accolade fermant l'expression commencée
+// à start, en sautant les ${...} imbriqués et les $$, ou -1
+func closingBrace(value string, start int) int {
+	depth := 1
+	for j := start; j < len(value); j++ {
+		switch {
+		case value[j] == '$' && j+1 < len(value) && value[j+1] == '$':
+			j++
+		case value[j] == '$' && j+1 < len(value) && value[j+1] == '{':
+			depth++
+			j++
+		case value[j] == '}':
+			if depth--; depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+func resolveVariable(expr string, env map[string]string) (string, error) {
+	for _, op := range []string{":-", ":?", "-", "?"} {
+		name, arg, found := strings.Cut(expr, op)
+		if !found || !validVariableName(name) {
+			continue
+		}
+		value, set := env[name]
+		empty := !set || (strings.HasPrefix(op, ":") && value == "")
+		if !empty {
+			return value, nil
+		}
+		arg, err := interpolate(arg, env)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasSuffix(op, "?") {
+			if arg == "" {
+				arg = "required variable " + name + " is missing a value"
+			}
+			return "", errors.New(arg)
+		}
+		return arg, nil
+	}
+	if !validVariableName(expr) {
+		return "", fmt.Errorf("invalid interpolation format for ${%s}", expr)
+	}
+	return env[expr], nil
+}
+
+func validVariableName(name string) bool {
+	if name == "" || !isVariableChar(name[0], true) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isVariableChar(name[i], false) {
+			return false
+		}
+	}
+	return true
+}
+
+func isVariableChar(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	return !first && c >= '0' && c <= '9'
+}
+
+// splitShellWords découpe une commande en respectant les guillemets et les échappements
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var current strings.Builder
+	inWord := false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+				i++
+				current.WriteByte(s[i])
+			} else {
+				current.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\' && i+1 < len(s):
+			i++
+			current.WriteByte(s[i])
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+	return words, nil
+}
+
+// parsePortSpec parse la syntaxe courte [ip:][published:]target[/protocol]
+func parsePortSpec(spec string) ([]PortConfig, error) {
+	protocol := "tcp"
+	if base, proto, found := strings.Cut(spec, "/"); found {
+		spec, protocol = base, proto
+	}
+	parts := strings.Split(spec, ":")
+	var publishedSpec, targetSpec string
+	switch len(parts) {
+	case 1:
+		targetSpec = parts[0]
+	case 2:
+		publishedSpec, targetSpec = parts[0], parts[1]
+	case 3:
+		// L'adresse IP d'écoute n'est pas supportée par le routing mesh
+		publishedSpec, targetSpec = parts[1], parts[2]
+	default:
+		return nil, fmt.Errorf("invalid port specification %q", spec)
+	}
+
+	targetStart, targetEnd, err := parsePortRange(targetSpec)
+	if err != nil {
+		return nil, err
+	}
+	var publishedStart, publishedEnd uint32
+	if publishedSpec != "" {
+		if publishedStart, publishedEnd, err = parsePortRange(publishedSpec); err != nil {
+			return nil, err
+		}
+		if publishedEnd-publishedStart != targetEnd-targetStart {
+			return nil, fmt.Errorf("invalid port specification %q: ranges must have the same size", spec)
+		}
+	}
+
+	var ports []PortConfig
+	for offset := uint32(0); offset <= targetEnd-targetStart; offset++ {
+		port := PortConfig{Target: targetStart + offset, Protocol: protocol}
+		if publishedSpec != "" {
+			port.Published = publishedStart + offset
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func parsePortRange(spec string) (uint32, uint32, error) {
+	startSpec, endSpec, isRange := strings.Cut(spec, "-")
+	start, err := strconv.ParseUint(startSpec, 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port %q", spec)
+	}
+	end := start
+	if isRange {
+		if end, err = strconv.ParseUint(endSpec, 10, 16); err != nil || end < start {
+			return 0, 0, fmt.Errorf("invalid port range %q", spec)
+		}
+	}
+	return uint32(start), uint32(end), nil
+}
+
+// parseVolumeSpec parse la syntaxe courte [source:]target[:mode]
+func parseVolumeSpec(spec string) (VolumeMount, error) {
+	parts := strings.Split(spec, ":")
+	mount := VolumeMount{}
+	switch len(parts) {
+	case 1:
+		mount.Target = parts[0]
+	case 2:
+		mount.Source, mount.Target = parts[0], parts[1]
+	case 3:
+		mount.Source, mount.Target = parts[0], parts[1]
+		for _, option := range strings.Split(parts[2], ",") {
+			switch option {
+			case "ro":
+				mount.ReadOnly = true
+			case "rw", "z", "Z", "cached", "delegated", "consistent":
+			case "nocopy":
+				mount.Volume = &struct {
+					NoCopy bool `yaml:"nocopy"`
+				}{NoCopy: true}
+			default:
+				return mount, fmt.Errorf("invalid volume mode %q in %q", option, spec)
+			}
+		}
+	default:
+		return mount, fmt.Errorf("invalid volume specification %q", spec)
+	}
+	if mount.Target == "" {
+		return mount, fmt.Errorf("invalid volume specification %q: missing target", spec)
+	}
+
+	switch {
+	case mount.Source == "":
+		mount.Type = "volume"
+	case strings.HasPrefix(mount.Source, "/") || strings.HasPrefix(mount.Source, ".") || strings.HasPrefix(mount.Source, "~"):
+		mount.Type = "bind"
+	default:
+		mount.Type = "volume"
+	}
+	return mount, nil
+}
@@ -0,0 +1,228 @@
+package compose
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"TAG": "1.27", "EMPTY": "", "PORT": "8080"}
+	for _, tc := range []struct {
+		name, value, want, err string
+	}{
+		{"plain", "nginx:latest", "nginx:latest", ""},
+		{"bare variable", "nginx:$TAG", "nginx:1.27", ""},
+		{"braces", "nginx:${TAG}-alpine", "nginx:1.27-alpine", ""},
+		{"unset variable", "${MISSING}", "", ""},
+		{"default when unset", "${MISSING:-80}", "80", ""},
+		{"default when empty", "${EMPTY:-80}", "80", ""},
+		{"set variable ignores default", "${PORT:-80}", "8080", ""},
+		{"dash default keeps empty", "${EMPTY-80}", "", ""},
+		{"dash default when unset", "${MISSING-80}", "80", ""},
+		{"required set", "${TAG?tag is required}", "1.27", ""},
+		{"required empty is accepted", "${EMPTY?tag is required}", "", ""},
+		{"required unset", "${MISSING?tag is required}", "", "tag is required"},
+		{"colon required empty", "${EMPTY:?tag is required}", "", "tag is required"},
+		{"required default message", "${MISSING:?}", "", "required variable MISSING is missing a value"},
+		{"escaped dollar", "echo $$HOME", "echo $HOME", ""},
+		{"trailing dollar", "cost$", "cost$", ""},
+		{"missing brace", "${TAG", "", "missing }"},
+		{"invalid name", "${1TAG}", "", "invalid interpolation format"},
+		{"nested default", "${MISSING:-${TAG}}", "1.27", ""},
+		{"nested default not used", "${PORT:-${TAG}}", "8080", ""},
+		{"nested default unset", "${MISSING:-${OTHER:-80}}", "80", ""},
+		{"nested dash default", "${MISSING-${TAG}-alpine}", "1.27-alpine", ""},
+		{"nested default then text", "${MISSING:-${TAG}}:${PORT}", "1.27:8080", ""},
+		{"nested required message", "${MISSING:?set ${PORT}}", "", "set 8080"},
+		{"nested required inside default", "${MISSING:-${OTHER:?other is required}}", "", "other is required"},
+		{"escaped dollar in default", "${MISSING:-$${TAG}}", "${TAG}", ""},
+		{"nested missing brace", "${MISSING:-${TAG}", "", "missing }"},
+		{"nested variable name", "${${TAG}}", "", "invalid interpolation format"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := interpolate(tc.value, env)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("interpolate(%q) error = %v, want %q", tc.value, err, tc.err)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("interpolate(%q) = %q, %v, want %q", tc.value, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadInterpolatesFromEnvFile(t *testing.T) {
+	data := []byte(`
+services:
+  web:
+    image: "nginx:${TAG:-latest}"
+    environment:
+      DB: ${DB_HOST?DB_HOST must be set}
+`)
+	cfg, err := Load(data, []byte("TAG=1.27\nDB_HOST=db\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := cfg.Services["web"]
+	if db := web.Environment["DB"]; web.Image != "nginx:1.27" || db == nil || *db != "db" {
+		t.Errorf("web = %+v", web)
+	}
+
+	_, err = Load(data, nil)
+	if err == nil || !strings.Contains(err.Error(), "DB_HOST must be set") {
+		t.Errorf("without DB_HOST: error = %v", err)
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	for _, tc := range []struct {
+		name, environment string
+		want              []string
+	}{
+		{"list", "[A=1, B=]", []string{"A=1", "B="}},
+		{"list without value is unset", "[A=1, UNSET]", []string{"A=1"}},
+		{"list without value from the env file", "[FROM_ENV]", []string{"FROM_ENV=db"}},
+		{"map", "{A: 1, B: ''}", []string{"A=1", "B="}},
+		{"map null is unset", "{A: 1, UNSET: }", []string{"A=1"}},
+		{"map null from the env file", "{FROM_ENV: }", []string{"FROM_ENV=db"}},
+		{"explicit value wins over the env file", "[FROM_ENV=other]", []string{"FROM_ENV=other"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := Load([]byte("services:\n  web:\n    image: nginx\n    environment: "+tc.environment+"\n"), []byte("FROM_ENV=db\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := convertEnvironment(cfg.Services["web"].Environment); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("env = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadAnchors(t *testing.T) {
+	data := []byte(`
+x-defaults: &defaults
+  image: "app:${TAG}"
+  environment:
+    LOG_LEVEL: info
+  deploy:
+    replicas: 2
+services:
+  api:
+    <<: *defaults
+    command: api
+  worker:
+    <<: *defaults
+    image: worker:1
+    deploy:
+      replicas: 5
+`)
+	cfg, err := Load(data, []byte("TAG=2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		service, image string
+		replicas       uint64
+	}{
+		{"api", "app:2", 2},
+		{"worker", "worker:1", 5},
+	} {
+		svc := cfg.Services[tc.service]
+		if svc.Image != tc.image || svc.Deploy.Replicas == nil || *svc.Deploy.Replicas != tc.replicas {
+			t.Errorf("%s: image = %q, replicas = %v, want %q and %d", tc.service, svc.Image, svc.Deploy.Replicas, tc.image, tc.replicas)
+		}
+		if level := svc.Environment["LOG_LEVEL"]; level == nil || *level != "info" {
+			t.Errorf("%s: LOG_LEVEL = %v, want info", tc.service, level)
+		}
+	}
+}
+
+// loadService charge un fichier compose réduit au service web décrit par body
+func loadService(t *testing.T, body string) (ServiceConfig, error) {
+	t.Helper()
+	cfg, err := Load([]byte("services:\n  web:\n    image: nginx\n"+body), nil)
+	if err != nil {
+		return ServiceConfig{}, err
+	}
+	return cfg.Services["web"], nil
+}
+
+func TestLoadPorts(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		want       Ports
+		err        string
+	}{
+		{"target only", `    ports: ["80"]`, Ports{{Target: 80, Protocol: "tcp"}}, ""},
+		{"published", `    ports: ["8080:80"]`, Ports{{Target: 80, Published: 8080, Protocol: "tcp"}}, ""},
+		{"protocol", `    ports: ["53:53/udp"]`, Ports{{Target: 53, Published: 53, Protocol: "udp"}}, ""},
+		{"ip ignored", `    ports: ["127.0.0.1:8080:80"]`, Ports{{Target: 80, Published: 8080, Protocol: "tcp"}}, ""},
+		{"range", `    ports: ["8000-8001:80-81"]`, Ports{{Target: 80, Published: 8000, Protocol: "tcp"}, {Target: 81, Published: 8001, Protocol: "tcp"}}, ""},
+		{"range size mismatch", `    ports: ["8000-8002:80-81"]`, nil, "same size"},
+		{"invalid port", `    ports: ["http"]`, nil, "invalid port"},
+		{"long syntax", "    ports:\n      - target: 80\n        published: 8080\n        protocol: tcp\n        mode: host", Ports{{Target: 80, Published: 8080, Protocol: "tcp", Mode: "host"}}, ""},
+		{"mixed syntax", "    ports:\n      - \"443:443\"\n      - target: 80\n        published: 8080", Ports{{Target: 443, Published: 443, Protocol: "tcp"}, {Target: 80, Published: 8080}}, ""},
+		{"not a list", `    ports: "80"`, nil, "ports must be a list"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, err := loadService(t, tc.body)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(svc.Ports, tc.want) {
+				t.Errorf("ports = %+v, want %+v", svc.Ports, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadVolumes(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		want       VolumeMount
+		err        string
+	}{
+		{"anonymous", `    volumes: ["/data"]`, VolumeMount{Type: "volume", Target: "/data"}, ""},
+		{"named", `    volumes: ["data:/data"]`, VolumeMount{Type: "volume", Source: "data", Target: "/data"}, ""},
+		{"bind read only", `    volumes: ["/srv/app:/app:ro"]`, VolumeMount{Type: "bind", Source: "/srv/app", Target: "/app", ReadOnly: true}, ""},
+		{"relative bind", `    volumes: ["./conf:/conf:rw"]`, VolumeMount{Type: "bind", Source: "./conf", Target: "/conf"}, ""},
+		{"invalid mode", `    volumes: ["data:/data:rx"]`, VolumeMount{}, "invalid volume mode"},
+		{"missing target", `    volumes: ["data:"]`, VolumeMount{}, "missing target"},
+		{"long bind", "    volumes:\n      - type: bind\n        source: /srv/app\n        target: /app\n        read_only: true", VolumeMount{Type: "bind", Source: "/srv/app", Target: "/app", ReadOnly: true}, ""},
+		{"long tmpfs", "    volumes:\n      - type: tmpfs\n        target: /tmp\n        tmpfs:\n          size: 64m", VolumeMount{Type: "tmpfs", Target: "/tmp", Tmpfs: &struct {
+			Size string `yaml:"size"`
+		}{Size: "64m"}}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, err := loadService(t, tc.body)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(svc.Volumes) != 1 || !reflect.DeepEqual(svc.Volumes[0], tc.want) {
+				t.Errorf("volumes = %+v, want %+v", svc.Volumes, tc.want)
+			}
+		})
+	}
+
+	svc, err := loadService(t, `    volumes: ["data:/data:nocopy"]`)
+	if err != nil || len(svc.Volumes) != 1 || svc.Volumes[0].Volume == nil || !svc.Volumes[0].Volume.NoCopy {
+		t.Errorf("nocopy: volumes = %+v, err = %v", svc.Volumes, err)
+	}
+}
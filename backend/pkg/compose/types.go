@@ -0,0 +1,437 @@
+package compose
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config est le sous-ensemble du format compose v3 supporté par `docker stack deploy`
+type Config struct {
+	Version  string                   `yaml:"version"`
+	Services map[string]ServiceConfig `yaml:"services"`
+	Networks map[string]NetworkConfig `yaml:"networks"`
+	Volumes  map[string]VolumeConfig  `yaml:"volumes"`
+	Secrets  map[string]FileObject    `yaml:"secrets"`
+	Configs  map[string]FileObject    `yaml:"configs"`
+}
+
+// ServiceConfig décrit un service du fichier compose
+type ServiceConfig struct {
+	Image           string             `yaml:"image"`
+	Command         ShellCommand       `yaml:"command"`
+	Entrypoint      ShellCommand       `yaml:"entrypoint"`
+	Environment     Environment        `yaml:"environment"`
+	Labels          MappingWithEquals  `yaml:"labels"`
+	Hostname        string             `yaml:"hostname"`
+	User            string             `yaml:"user"`
+	WorkingDir      string             `yaml:"working_dir"`
+	StopSignal      string             `yaml:"stop_signal"`
+	StopGracePeriod *Duration          `yaml:"stop_grace_period"`
+	Init            *bool              `yaml:"init"`
+	Tty             bool               `yaml:"tty"`
+	StdinOpen       bool               `yaml:"stdin_open"`
+	ReadOnly        bool               `yaml:"read_only"`
+	CapAdd          []string           `yaml:"cap_add"`
+	CapDrop         []string           `yaml:"cap_drop"`
+	DNS             StringOrList       `yaml:"dns"`
+	DNSSearch       StringOrList       `yaml:"dns_search"`
+	ExtraHosts      StringOrList       `yaml:"extra_hosts"`
+	Sysctls         MappingWithEquals  `yaml:"sysctls"`
+	Ports           Ports              `yaml:"ports"`
+	Volumes         []VolumeMount      `yaml:"volumes"`
+	Networks        ServiceNetworks    `yaml:"networks"`
+	Secrets         []FileReference    `yaml:"secrets"`
+	Configs         []FileReference    `yaml:"configs"`
+	Healthcheck     *HealthcheckConfig `yaml:"healthcheck"`
+	Logging         *LoggingConfig     `yaml:"logging"`
+	Deploy          DeployConfig       `yaml:"deploy"`
+}
+
+// DeployConfig correspond à la section deploy d'un service
+type DeployConfig struct {
+	Mode           string            `yaml:"mode"`
+	Replicas       *uint64           `yaml:"replicas"`
+	Labels         MappingWithEquals `yaml:"labels"`
+	EndpointMode   string            `yaml:"endpoint_mode"`
+	UpdateConfig   *UpdateConfig     `yaml:"update_config"`
+	RollbackConfig *UpdateConfig     `yaml:"rollback_config"`
+	RestartPolicy  *RestartPolicy    `yaml:"restart_policy"`
+	Placement      Placement         `yaml:"placement"`
+	Resources      Resources         `yaml:"resources"`
+}
+
+// UpdateConfig correspond à update_config et rollback_config
+type UpdateConfig struct {
+	Parallelism     *uint64   `yaml:"parallelism"`
+	Delay           *Duration `yaml:"delay"`
+	FailureAction   string    `yaml:"failure_action"`
+	Monitor         *Duration `yaml:"monitor"`
+	MaxFailureRatio float32   `yaml:"max_failure_ratio"`
+	Order           string    `yaml:"order"`
+}
+
+// RestartPolicy correspond à deploy.restart_policy
+type RestartPolicy struct {
+	Condition   string    `yaml:"condition"`
+	Delay       *Duration `yaml:"delay"`
+	MaxAttempts *uint64   `yaml:"max_attempts"`
+	Window      *Duration `yaml:"window"`
+}
+
+// Placement correspond à deploy.placement
+type Placement struct {
+	Constraints []string              `yaml:"constraints"`
+	Preferences []PlacementPreference `yaml:"preferences"`
+	MaxReplicas uint64                `yaml:"max_replicas_per_node"`
+}
+
+// PlacementPreference correspond à une entrée de deploy.placement.preferences
+type PlacementPreference struct {
+	Spread string `yaml:"spread"`
+}
+
+// Resources correspond à deploy.resources
+type Resources struct {
+	Limits       *ResourceSpec `yaml:"limits"`
+	Reservations *ResourceSpec `yaml:"reservations"`
+}
+
+// ResourceSpec décrit une limite ou une réservation de ressources
+type ResourceSpec struct {
+	CPUs   string `yaml:"cpus"`
+	Memory string `yaml:"memory"`
+	Pids   int64  `yaml:"pids"`
+}
+
+// HealthcheckConfig correspond à la section healthcheck
+type HealthcheckConfig struct {
+	Test          HealthcheckTest `yaml:"test"`
+	Interval      *Duration       `yaml:"interval"`
+	Timeout       *Duration       `yaml:"timeout"`
+	StartPeriod   *Duration       `yaml:"start_period"`
+	StartInterval *Duration       `yaml:"start_interval"`
+	Retries       *int            `yaml:"retries"`
+	Disable       bool            `yaml:"disable"`
+}
+
+// LoggingConfig correspond à la section logging
+type LoggingConfig struct {
+	Driver  string            `yaml:"driver"`
+	Options map[string]string `yaml:"options"`
+}
+
+// NetworkConfig décrit un réseau de premier niveau
+type NetworkConfig struct {
+	Name       string            `yaml:"name"`
+	Driver     string            `yaml:"driver"`
+	DriverOpts map[string]string `yaml:"driver_opts"`
+	External   External          `yaml:"external"`
+	Internal   bool              `yaml:"internal"`
+	Attachable bool              `yaml:"attachable"`
+	Labels     MappingWithEquals `yaml:"labels"`
+	Ipam       *IPAMConfig       `yaml:"ipam"`
+}
+
+// IPAMConfig décrit la configuration IPAM d'un réseau
+type IPAMConfig struct {
+	Driver string `yaml:"driver"`
+	Config []struct {
+		Subnet  string `yaml:"subnet"`
+		Gateway string `yaml:"gateway"`
+		IPRange string `yaml:"ip_range"`
+	} `yaml:"config"`
+}
+
+// VolumeConfig décrit un volume nommé de premier niveau
+type VolumeConfig struct {
+	Name       string            `yaml:"name"`
+	Driver     string            `yaml:"driver"`
+	DriverOpts map[string]string `yaml:"driver_opts"`
+	External   External          `yaml:"external"`
+	Labels     MappingWithEquals `yaml:"labels"`
+}
+
+// FileObject décrit un secret ou une config de premier niveau
+type FileObject struct {
+	Name     string            `yaml:"name"`
+	File     string            `yaml:"file"`
+	Content  string            `yaml:"content"`
+	External External          `yaml:"external"`
+	Labels   MappingWithEquals `yaml:"labels"`
+}
+
+// FileReference est une référence à un secret ou une config dans un service
+type FileReference struct {
+	Source string  `yaml:"source"`
+	Target string  `yaml:"target"`
+	UID    string  `yaml:"uid"`
+	GID    string  `yaml:"gid"`
+	Mode   *uint32 `yaml:"mode"`
+}
+
+// UnmarshalYAML accepte la syntaxe courte (nom) et la syntaxe longue
+func (r *FileReference) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		r.Source = node.Value
+		return nil
+	}
+	type plain FileReference
+	return node.Decode((*plain)(r))
+}
+
+// External accepte `external: true` et l'ancienne forme `external: {name: x}`
+type External struct {
+	External bool
+	Name     string
+}
+
+func (e *External) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&e.External)
+	}
+	var legacy struct {
+		Name string `yaml:"name"`
+	}
+	if err := node.Decode(&legacy); err != nil {
+		return err
+	}
+	e.External = true
+	e.Name = legacy.Name
+	return nil
+}
+
+// StringOrList accepte une chaîne ou une liste de chaînes
+type StringOrList []string
+
+func (s *StringOrList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = []string{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// ShellCommand accepte une liste ou une chaîne découpée comme le ferait un shell
+type ShellCommand []string
+
+func (s *ShellCommand) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		words, err := splitShellWords(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		*s = words
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// HealthcheckTest accepte ["CMD", ...], ["CMD-SHELL", "..."], ["NONE"] ou une chaîne (CMD-SHELL)
+type HealthcheckTest []string
+
+func (t *HealthcheckTest) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = []string{"CMD-SHELL", node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// MappingWithEquals accepte une map ou une liste "CLE=valeur"
+type MappingWithEquals map[string]string
+
+func (m *MappingWithEquals) UnmarshalYAML(node *yaml.Node) error {
+	result := make(map[string]string)
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			// Une valeur nulle (`KEY:`) est conservée vide
+			if value.Tag == "!!null" {
+				result[key.Value] = ""
+				continue
+			}
+			result[key.Value] = value.Value
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			key, value, _ := strings.Cut(item.Value, "=")
+			result[key] = value
+		}
+	default:
+		return fmt.Errorf("line %d: expected a mapping or a list of KEY=value", node.Line)
+	}
+	*m = result
+	return nil
+}
+
+// Environment accepte une map ou une liste "CLE=valeur". Une variable sans
+// valeur (`- CLE` ou `CLE:`) vaut nil : elle est reprise du fichier .env par
+// Load, ou n'est pas définie dans le conteneur, comme avec docker stack deploy.
+type Environment map[string]*string
+
+func (m *Environment) UnmarshalYAML(node *yaml.Node) error {
+	result := make(map[string]*string)
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Tag == "!!null" {
+				result[key.Value] = nil
+				continue
+			}
+			v := value.Value
+			result[key.Value] = &v
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			key, value, found := strings.Cut(item.Value, "=")
+			if !found {
+				result[key] = nil
+				continue
+			}
+			result[key] = &value
+		}
+	default:
+		return fmt.Errorf("line %d: expected a mapping or a list of KEY=value", node.Line)
+	}
+	*m = result
+	return nil
+}
+
+// ServiceNetworks accepte une liste de noms ou une map nom -> {aliases}
+type ServiceNetworks map[string]*ServiceNetwork
+
+// ServiceNetwork décrit l'attachement d'un service à un réseau
+type ServiceNetwork struct {
+	Aliases []string `yaml:"aliases"`
+}
+
+func (n *ServiceNetworks) UnmarshalYAML(node *yaml.Node) error {
+	result := make(map[string]*ServiceNetwork)
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			result[item.Value] = nil
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if value.Tag == "!!null" {
+				result[key.Value] = nil
+				continue
+			}
+			cfg := &ServiceNetwork{}
+			if err := value.Decode(cfg); err != nil {
+				return err
+			}
+			result[key.Value] = cfg
+		}
+	default:
+		return fmt.Errorf("line %d: expected a list or a mapping of networks", node.Line)
+	}
+	*n = result
+	return nil
+}
+
+// Ports est la liste des ports publiés ; une plage en syntaxe courte
+// ("8000-8002:80-82") produit plusieurs entrées
+type Ports []PortConfig
+
+func (p *Ports) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		return fmt.Errorf("line %d: ports must be a list", node.Line)
+	}
+	var result []PortConfig
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode {
+			ports, err := parsePortSpec(item.Value)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", item.Line, err)
+			}
+			result = append(result, ports...)
+			continue
+		}
+		var port PortConfig
+		if err := item.Decode(&port); err != nil {
+			return err
+		}
+		result = append(result, port)
+	}
+	*p = result
+	return nil
+}
+
+// PortConfig décrit un port publié (syntaxe longue)
+type PortConfig struct {
+	Target    uint32 `yaml:"target"`
+	Published uint32 `yaml:"published"`
+	Protocol  string `yaml:"protocol"`
+	Mode      string `yaml:"mode"`
+}
+
+// VolumeMount décrit un montage de service (syntaxe courte ou longue)
+type VolumeMount struct {
+	Type     string `yaml:"type"`
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"read_only"`
+	Volume   *struct {
+		NoCopy bool `yaml:"nocopy"`
+	} `yaml:"volume"`
+	Tmpfs *struct {
+		Size string `yaml:"size"`
+	} `yaml:"tmpfs"`
+}
+
+func (v *VolumeMount) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		mount, err := parseVolumeSpec(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		*v = mount
+		return nil
+	}
+	type plain VolumeMount
+	return node.Decode((*plain)(v))
+}
+
+// Duration accepte les durées au format Go ("10s", "1m30s")
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	value, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q", node.Line, node.Value)
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// Value renvoie un pointeur vers la durée, nil si elle n'est pas définie
+func (d *Duration) Value() *time.Duration {
+	if d == nil {
+		return nil
+	}
+	value := time.Duration(*d)
+	return &value
+}
@@ -1,15 +1,61 @@
 package domain
 
+import "time"
+
 // Node represents a Docker Swarm node
 type Node struct {
-	ID           string `json:"id"`
-	Hostname     string `json:"hostname"`
-	Status       string `json:"status"`
-	Availability string `json:"availability"`
-	Role         string `json:"role"`
-	CPU          string `json:"cpu"`
-	Memory       string `json:"memory"`
-	IPAddress    string `json:"ipAddress"`
+	ID           string  `json:"id"`
+	Hostname     string  `json:"hostname"`
+	Status       string  `json:"status"`
+	Availability string  `json:"availability"`
+	Role         string  `json:"role"`
+	CPU          string  `json:"cpu"`
+	Memory       string  `json:"memory"`
+	CPUCores     float64 `json:"cpuCores"`
+	MemoryBytes  int64   `json:"memoryBytes"`
+	IPAddress    string  `json:"ipAddress"`
+}
+
+// NodeDetails is a node with its engine, platform, labels, manager status
+// and TLS information
+type NodeDetails struct {
+	Node
+	EngineVersion    string            `json:"engineVersion"`
+	OS               string            `json:"os"`
+	Architecture     string            `json:"architecture"`
+	NanoCPUs         int64             `json:"nanoCpus"`
+	GenericResources map[string]int64  `json:"genericResources,omitempty"` // discrete generic resources (GPUs...)
+	NodeLabels       map[string]string `json:"nodeLabels"`
+	EngineLabels     map[string]string `json:"engineLabels"`
+	Plugins          []NodePlugin      `json:"plugins"`
+	Message          string            `json:"message,omitempty"`
+	Manager          *NodeManager      `json:"manager,omitempty"` // nil for a worker
+	TLS              NodeTLS           `json:"tls"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+}
+
+// NodePlugin is a plugin of the node's engine (Volume, Network, Log...)
+type NodePlugin struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// NodeManager is the raft status of a manager node
+type NodeManager struct {
+	Leader       bool   `json:"leader"`
+	Reachability string `json:"reachability"`
+	Addr         string `json:"addr"`
+}
+
+// NodeTLS describes the certificates of the node. Docker does not expose the
+// expiry of the node certificate itself: RootCANotAfter is the expiry of the
+// swarm root CA and NodeCertLifetime the validity period given to every node
+// certificate by the cluster (renewed automatically before it ends).
+type NodeTLS struct {
+	IssuerSubject    string     `json:"issuerSubject,omitempty"`
+	RootCANotAfter   *time.Time `json:"rootCaNotAfter,omitempty"`
+	NodeCertLifetime string     `json:"nodeCertLifetime,omitempty"` // cluster setting, e.g. 2160h0m0s
 }
 
 // Service represents a Docker Swarm service
@@ -19,6 +65,7 @@ type Service struct {
 	Image        string `json:"image"`
 	DesiredCount uint64 `json:"desired_count"`
 	CurrentCount uint64 `json:"current_count"`
+	Health       string `json:"health,omitempty"` // see ServiceHealth.Status
 }
 
 // Stack groups services under a namespace
@@ -33,3 +80,204 @@ type Image struct {
 	RepoTags []string `json:"repo_tags"`
 	Size     int64    `json:"size"`
 }
+
+// ServiceReplicas reports the replica count of a service after it is stopped
+// or started, or the error that left it unchanged
+type ServiceReplicas struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Replicas uint64 `json:"replicas"`
+	Restored bool   `json:"restored"`
+	Error    string `json:"error,omitempty"`
+}
+
+// StackServiceChange describes what a stack deployment did to one service
+type StackServiceChange struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Action string `json:"action"` // created, updated or removed
+}
+
+// StackDeployResult summarizes a stack deployment or update
+type StackDeployResult struct {
+	Name            string               `json:"name"`
+	Services        []StackServiceChange `json:"services"`
+	NetworksCreated []string             `json:"networks_created"`
+	SecretsCreated  []string             `json:"secrets_created"`
+	ConfigsCreated  []string             `json:"configs_created"`
+}
+
+// NodePruneReport is the result of a prune run on a single node
+type NodePruneReport struct {
+	NodeID            string `json:"nodeId"`
+	Hostname          string `json:"hostname"`
+	ContainersDeleted int    `json:"containersDeleted"`
+	ImagesDeleted     int    `json:"imagesDeleted"`
+	VolumesDeleted    int    `json:"volumesDeleted"`
+	NetworksDeleted   int    `json:"networksDeleted"`
+	SpaceReclaimed    uint64 `json:"spaceReclaimed"`
+	Error             string `json:"error,omitempty"`
+}
+
+// ClusterPruneResult aggregates the per-node reports of a swarm-wide prune
+type ClusterPruneResult struct {
+	Kind              string                     `json:"kind"`
+	Nodes             map[string]NodePruneReport `json:"nodes"` // keyed by node ID, hostnames can be shared
+	ContainersDeleted int                        `json:"containersDeleted"`
+	ImagesDeleted     int                        `json:"imagesDeleted"`
+	VolumesDeleted    int                        `json:"volumesDeleted"`
+	NetworksDeleted   int                        `json:"networksDeleted"`
+	SpaceReclaimed    uint64                     `json:"spaceReclaimed"`
+	FailedNodes       int                        `json:"failedNodes"`
+}
+
+// ServiceScale reports the replica count requested for a service and how many
+// of its tasks are running, with the error that left it at its previous count
+type ServiceScale struct {
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	PreviousReplicas uint64 `json:"previous_replicas"`
+	Replicas         uint64 `json:"replicas"`
+	Running          uint64 `json:"running"`
+	Converged        bool   `json:"converged"`
+	Error            string `json:"error,omitempty"`
+}
+
+// ServiceImageUpdate reports an image change requested on a service
+type ServiceImageUpdate struct {
+	ID            string   `json:"id"`
+	Name          string   `json:"name"`
+	PreviousImage string   `json:"previous_image"`
+	Image         string   `json:"image"`
+	Digest        string   `json:"digest,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+}
+
+// ServiceUpdateStatus exposes the progress of the last update or rollback of a service
+type ServiceUpdateStatus struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	Version       uint64     `json:"version"`
+	Image         string     `json:"image"`
+	PreviousImage string     `json:"previous_image,omitempty"`
+	State         string     `json:"state"` // none when the service was never updated
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	Message       string     `json:"message,omitempty"`
+}
+
+// Task is one attempt of swarm to run a replica of a service
+type Task struct {
+	ID           string    `json:"id"`
+	ServiceID    string    `json:"service_id"`
+	ServiceName  string    `json:"service_name"`
+	Slot         int       `json:"slot,omitempty"` // 0 for global services
+	NodeID       string    `json:"node_id,omitempty"`
+	NodeHostname string    `json:"node_hostname,omitempty"`
+	Image        string    `json:"image"`
+	DesiredState string    `json:"desired_state"`
+	CurrentState string    `json:"current_state"`
+	Message      string    `json:"message,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ContainerID  string    `json:"container_id,omitempty"`
+	ExitCode     *int      `json:"exit_code,omitempty"` // set once the container has exited
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	StateSince   time.Time `json:"state_since"` // time of the last state change
+}
+
+// TaskSlot groups the tasks of one replica, newest first: the first task is
+// the current one, the others are the previous attempts
+type TaskSlot struct {
+	Slot   int    `json:"slot,omitempty"`
+	NodeID string `json:"node_id,omitempty"` // identifies the slot of a global service
+	Tasks  []Task `json:"tasks"`
+}
+
+// ServiceTasks lists the tasks of a service by slot
+type ServiceTasks struct {
+	ServiceID   string     `json:"service_id"`
+	ServiceName string     `json:"service_name"`
+	Slots       []TaskSlot `json:"slots"`
+}
+
+// TaskDetails is a task with the other tasks of its slot, newest first
+type TaskDetails struct {
+	Task
+	History []Task `json:"history"`
+}
+
+// Health statuses of a service
+const (
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"   // fewer running tasks than desired
+	HealthFlapping  = "flapping"   // a slot keeps restarting but is running
+	HealthCrashLoop = "crash_loop" // a slot keeps restarting and is down
+)
+
+// SlotRestarts counts the restarts of one replica over the health window
+type SlotRestarts struct {
+	Slot      int    `json:"slot,omitempty"`
+	NodeID    string `json:"node_id,omitempty"` // identifies the slot of a global service
+	Restarts  int    `json:"restarts"`
+	Running   bool   `json:"running"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ServiceHealth summarizes the restarts of a service over a window
+type ServiceHealth struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Stack        string         `json:"stack"`
+	Status       string         `json:"status"`
+	DesiredCount uint64         `json:"desired_count"`
+	CurrentCount uint64         `json:"current_count"`
+	Restarts     int            `json:"restarts"`
+	Slots        []SlotRestarts `json:"slots,omitempty"` // slots that restarted, most restarts first
+	LastError    string         `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time     `json:"last_error_at,omitempty"`
+}
+
+// HealthReport lists the services found unhealthy over a window
+type HealthReport struct {
+	Window    string          `json:"window"`
+	Threshold int             `json:"threshold"`
+	Services  []ServiceHealth `json:"services"`
+}
+
+// NodeChange reports the state of a node after a role, availability or label change
+type NodeChange struct {
+	ID           string            `json:"id"`
+	Hostname     string            `json:"hostname"`
+	Role         string            `json:"role"`
+	Availability string            `json:"availability"`
+	Labels       map[string]string `json:"labels"`
+	Warnings     []string          `json:"warnings,omitempty"`
+}
+
+// DrainTask follows a task of a drained node until it runs elsewhere
+type DrainTask struct {
+	TaskID      string `json:"task_id"`
+	ServiceID   string `json:"service_id"`
+	ServiceName string `json:"service_name"`
+	Slot        int    `json:"slot,omitempty"`
+	Global      bool   `json:"global,omitempty"` // stopped with the node, not rescheduled
+	State       string `json:"state"`            // pending, moved, stopped or unschedulable
+	Candidates  int    `json:"candidates,omitempty"`
+	NewTaskID   string `json:"new_task_id,omitempty"`
+	NewNodeID   string `json:"new_node_id,omitempty"`
+	NewHostname string `json:"new_hostname,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// DrainReport is the progress of a node drain
+type DrainReport struct {
+	NodeID               string      `json:"node_id"`
+	Hostname             string      `json:"hostname"`
+	PreviousAvailability string      `json:"previous_availability"`
+	Availability         string      `json:"availability"`
+	State                string      `json:"state"` // checked, refused, draining, drained, failed, timeout or aborted
+	Tasks                []DrainTask `json:"tasks"`
+	// Set when the previous availability could not be restored after a failure
+	Error string `json:"error,omitempty"`
+}
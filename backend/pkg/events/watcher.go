@@ -0,0 +1,287 @@
+// Package events suit l'API Events du daemon Docker et diffuse les événements
+// du swarm aux clients abonnés.
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+)
+
+// Types d'événements suivis. Docker n'émet pas d'événement de tâche : les
+// événements "task" sont les événements de conteneurs créés par une tâche.
+const (
+	TypeNode      = "node"
+	TypeService   = "service"
+	TypeTask      = "task"
+	TypeContainer = "container"
+	TypeNetwork   = "network"
+	TypeSecret    = "secret"
+	TypeConfig    = "config"
+)
+
+// Types valides pour les filtres des abonnés
+var Types = []string{TypeNode, TypeService, TypeTask, TypeContainer, TypeNetwork, TypeSecret, TypeConfig}
+
+const (
+	defaultHistorySize = 1000
+	subscriberBuffer   = 256
+	reconnectDelay     = time.Second
+	maxReconnectDelay  = 30 * time.Second
+
+	taskIDAttribute    = "com.docker.swarm.task.id"
+	serviceIDAttribute = "com.docker.swarm.service.id"
+	nodeIDAttribute    = "com.docker.swarm.node.id"
+)
+
+// Event est un événement Docker simplifié, numéroté dans l'ordre de réception
+type Event struct {
+	ID         uint64            `json:"id"`
+	Time       time.Time         `json:"time"`
+	Type       string            `json:"type"`
+	Action     string            `json:"action"`
+	ActorID    string            `json:"actor_id"`
+	Name       string            `json:"name,omitempty"`
+	Scope      string            `json:"scope,omitempty"`
+	ServiceID  string            `json:"service_id,omitempty"`
+	TaskID     string            `json:"task_id,omitempty"`
+	NodeID     string            `json:"node_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Subscription reçoit les événements des types demandés. C est fermé quand
+// l'abonné est trop lent ou que Unsubscribe est appelé.
+type Subscription struct {
+	C     <-chan Event
+	c     chan Event
+	types map[string]bool
+}
+
+// Watcher maintient un unique abonnement aux événements du daemon, garde les
+// derniers dans un tampon circulaire et les diffuse aux abonnés
+type Watcher struct {
+	api infra.DockerAPI
+
+	mu      sync.Mutex
+	history []Event
+	next    int
+	full    bool
+	lastID  uint64
+	subs    map[*Subscription]struct{}
+}
+
+// NewWatcher crée un watcher gardant les size derniers événements ; Run le démarre
+func NewWatcher(api infra.DockerAPI, size int) *Watcher {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	return &Watcher{
+		api:     api,
+		history: make([]Event, size),
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Run suit les événements jusqu'à l'annulation de ctx. En cas de coupure, il se
+// reconnecte en reprenant après le dernier événement reçu.
+func (w *Watcher) Run(ctx context.Context) {
+	delay := reconnectDelay
+	var since time.Time
+	for {
+		opts := events.ListOptions{Filters: filters.NewArgs(
+			filters.Arg("type", string(events.NodeEventType)),
+			filters.Arg("type", string(events.ServiceEventType)),
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("type", string(events.NetworkEventType)),
+			filters.Arg("type", string(events.SecretEventType)),
+			filters.Arg("type", string(events.ConfigEventType)),
+		)}
+		if !since.IsZero() {
+			opts.Since = since.Format(time.RFC3339Nano)
+		}
+
+		messages, errs := w.api.Events(ctx, opts)
+	receive:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-messages:
+				delay = reconnectDelay
+				e := w.publish(msg)
+				since = e.Time.Add(time.Nanosecond)
+			case err := <-errs:
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("events watcher: stream interrupted: %v", err)
+				break receive
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// Subscribe abonne aux types donnés (tous si vide). Les événements d'ID
+// supérieur à afterID encore présents dans l'historique sont rejoués d'abord :
+// le tampon de l'abonné est agrandi pour les contenir tous, sans quoi la fin
+// du rejeu serait perdue sans que le client le sache.
+func (w *Watcher) Subscribe(types []string, afterID uint64) *Subscription {
+	sub := &Subscription{}
+	if len(types) > 0 {
+		sub.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var replay []Event
+	if afterID > 0 {
+		for _, e := range w.snapshot() {
+			if e.ID > afterID && sub.wants(e) {
+				replay = append(replay, e)
+			}
+		}
+	}
+	c := make(chan Event, len(replay)+subscriberBuffer)
+	for _, e := range replay {
+		c <- e
+	}
+	sub.C, sub.c = c, c
+	w.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe met fin à l'abonnement
+func (w *Watcher) Unsubscribe(sub *Subscription) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.subs[sub]; ok {
+		delete(w.subs, sub)
+		close(sub.c)
+	}
+}
+
+// HistoryFilter restreint les événements renvoyés par History
+type HistoryFilter struct {
+	Types   []string
+	AfterID uint64
+	Since   time.Time
+	Limit   int
+}
+
+// History renvoie les événements conservés, du plus ancien au plus récent.
+// Avec une limite, seuls les plus récents sont gardés.
+func (w *Watcher) History(filter HistoryFilter) []Event {
+	w.mu.Lock()
+	all := w.snapshot()
+	w.mu.Unlock()
+
+	sub := Subscription{}
+	if len(filter.Types) > 0 {
+		sub.types = make(map[string]bool, len(filter.Types))
+		for _, t := range filter.Types {
+			sub.types[t] = true
+		}
+	}
+	result := []Event{}
+	for _, e := range all {
+		if e.ID <= filter.AfterID || (!filter.Since.IsZero() && e.Time.Before(filter.Since)) || !sub.wants(e) {
+			continue
+		}
+		result = append(result, e)
+	}
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[len(result)-filter.Limit:]
+	}
+	return result
+}
+
+// publish convertit, conserve et diffuse un événement du daemon
+func (w *Watcher) publish(msg events.Message) Event {
+	e := convert(msg)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastID++
+	e.ID = w.lastID
+	w.history[w.next] = e
+	w.next = (w.next + 1) % len(w.history)
+	if w.next == 0 {
+		w.full = true
+	}
+
+	for sub := range w.subs {
+		if !sub.wants(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			// Abonné trop lent : il est déconnecté et pourra reprendre depuis
+			// l'historique avec le dernier ID reçu
+			delete(w.subs, sub)
+			close(sub.c)
+		}
+	}
+	return e
+}
+
+// snapshot copie l'historique dans l'ordre chronologique ; w.mu doit être tenu
+func (w *Watcher) snapshot() []Event {
+	if !w.full {
+		return append([]Event(nil), w.history[:w.next]...)
+	}
+	return append(append([]Event(nil), w.history[w.next:]...), w.history[:w.next]...)
+}
+
+func (s *Subscription) wants(e Event) bool {
+	if s.types == nil {
+		return true
+	}
+	if s.types[e.Type] {
+		return true
+	}
+	// Un événement de tâche est aussi un événement de conteneur
+	return e.Type == TypeTask && s.types[TypeContainer]
+}
+
+func convert(msg events.Message) Event {
+	e := Event{
+		Type:       string(msg.Type),
+		Action:     string(msg.Action),
+		ActorID:    msg.Actor.ID,
+		Name:       msg.Actor.Attributes["name"],
+		Scope:      msg.Scope,
+		Attributes: msg.Actor.Attributes,
+	}
+	switch {
+	case msg.TimeNano != 0:
+		e.Time = time.Unix(0, msg.TimeNano)
+	case msg.Time != 0:
+		e.Time = time.Unix(msg.Time, 0)
+	default:
+		e.Time = time.Now()
+	}
+	e.ServiceID = msg.Actor.Attributes[serviceIDAttribute]
+	e.TaskID = msg.Actor.Attributes[taskIDAttribute]
+	e.NodeID = msg.Actor.Attributes[nodeIDAttribute]
+	if msg.Type == events.ContainerEventType && e.TaskID != "" {
+		e.Type = TypeTask
+	}
+	return e
+}
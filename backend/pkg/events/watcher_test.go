@@ -0,0 +1,50 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestSubscribeReplaysTheWholeHistory(t *testing.T) {
+	w := NewWatcher(nil, 2*subscriberBuffer)
+	for range 2 * subscriberBuffer {
+		w.publish(events.Message{Type: events.ServiceEventType, Action: events.ActionUpdate})
+	}
+
+	sub := w.Subscribe(nil, 1)
+	defer w.Unsubscribe(sub)
+	// Un événement publié après le rejeu ne doit pas déconnecter l'abonné
+	w.publish(events.Message{Type: events.NodeEventType, Action: events.ActionUpdate})
+
+	want := uint64(2)
+	for want <= 2*subscriberBuffer+1 {
+		e, ok := <-sub.C
+		if !ok {
+			t.Fatalf("subscription closed before event %d", want)
+		}
+		if e.ID != want {
+			t.Fatalf("got event %d, want %d", e.ID, want)
+		}
+		want++
+	}
+	if n := len(sub.C); n != 0 {
+		t.Errorf("%d unexpected events left", n)
+	}
+}
+
+func TestSubscribeFiltersReplay(t *testing.T) {
+	w := NewWatcher(nil, 10)
+	w.publish(events.Message{Type: events.NodeEventType})
+	w.publish(events.Message{Type: events.ServiceEventType})
+	w.publish(events.Message{Type: events.ContainerEventType, Actor: events.Actor{Attributes: map[string]string{taskIDAttribute: "t1"}}})
+
+	sub := w.Subscribe([]string{TypeContainer}, 1)
+	defer w.Unsubscribe(sub)
+	if e := <-sub.C; e.ID != 3 || e.Type != TypeTask {
+		t.Errorf("replayed %+v, want the task event", e)
+	}
+	if n := len(sub.C); n != 0 {
+		t.Errorf("%d unexpected events replayed", n)
+	}
+}
@@ -0,0 +1,85 @@
+package history
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/logs"
+)
+
+const (
+	defaultRange = time.Hour
+	// Nombre de points visé quand step n'est pas précisé
+	defaultPoints = 300
+	maxPoints     = 10000
+)
+
+// ServiceHistory sert GET /api/history/services/:id
+func (s *Store) ServiceHistory(c echo.Context) error {
+	return s.serve(c, KindService)
+}
+
+// NodeHistory sert GET /api/history/nodes/:id
+func (s *Store) NodeHistory(c echo.Context) error {
+	return s.serve(c, KindNode)
+}
+
+// serve lit la fenêtre demandée : range (durée jusqu'à maintenant, 1h par
+// défaut) ou from/to (date, timestamp ou durée relative), et step
+func (s *Store) serve(c echo.Context, kind string) error {
+	if s == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "history is disabled"})
+	}
+
+	now := time.Now()
+	to := now
+	from := now.Add(-defaultRange)
+	if v := c.QueryParam("range"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid range"})
+		}
+		from = now.Add(-d)
+	}
+	if v := c.QueryParam("from"); v != "" {
+		t, err := logs.ParseTime(v, now)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid from: %v", err)})
+		}
+		from = t
+	}
+	if v := c.QueryParam("to"); v != "" {
+		t, err := logs.ParseTime(v, now)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid to: %v", err)})
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+	}
+
+	step := to.Sub(from) / defaultPoints
+	if v := c.QueryParam("step"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid step"})
+		}
+		if to.Sub(from)/d > maxPoints {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("step too small, at most %d points per series", maxPoints)})
+		}
+		step = d
+	}
+	if step < s.interval {
+		step = s.interval
+	}
+
+	result := s.Query(kind, c.Param("id"), from, to, step, now)
+	if len(result.Series) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": fmt.Sprintf("no history for %s %s", kind, c.Param("id"))})
+	}
+	return c.JSON(http.StatusOK, result)
+}
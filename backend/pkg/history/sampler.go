@@ -0,0 +1,226 @@
+package history
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+	"github.com/Affell/swarm-manager/backend/pkg/stats"
+)
+
+const (
+	defaultSampleInterval = 30 * time.Second
+	// Fréquence de sauvegarde sur disque et de nettoyage de la rétention
+	saveInterval = 5 * time.Minute
+	// Mesures de conteneurs lancées en parallèle, augmentées avec le nombre de
+	// tâches pour qu'un tour tienne dans la moitié de l'intervalle
+	minStatsConcurrency = 8
+	maxStatsConcurrency = 64
+	// Durée d'une mesure sans flux : le daemon attend une seconde entre les
+	// deux relevés CPU
+	statsSampleDuration = 2 * time.Second
+)
+
+// Séries enregistrées pour chaque service
+const (
+	MetricDesired     = "desired"
+	MetricRunning     = "running"
+	MetricCPUPercent  = "cpu_percent"
+	MetricMemoryUsage = "memory_usage"
+)
+
+// Séries enregistrées pour chaque node, en plus de cpu_percent et memory_usage
+const (
+	// 1 si la node est prête, 0 sinon
+	MetricReady = "ready"
+	// 1 si la node accepte des tâches (availability active), 0 sinon
+	MetricActive = "active"
+	// Tâches en cours sur la node
+	MetricTasks = "tasks"
+)
+
+// SamplerOptions règle l'échantillonnage
+type SamplerOptions struct {
+	Interval time.Duration
+	// Source des mesures des conteneurs ; nil pour ne garder que les réplicas
+	// et l'état des nodes
+	Stats *stats.Source
+}
+
+// Sampler enregistre périodiquement l'état du swarm dans un Store
+type Sampler struct {
+	api   infra.DockerAPI
+	store *Store
+	opts  SamplerOptions
+}
+
+// NewSampler crée un échantillonneur ; Run le démarre
+func NewSampler(api infra.DockerAPI, store *Store, opts SamplerOptions) *Sampler {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultSampleInterval
+	}
+	store.interval = opts.Interval
+	return &Sampler{api: api, store: store, opts: opts}
+}
+
+// Run échantillonne jusqu'à l'annulation de ctx, puis sauvegarde le stockage
+func (s *Sampler) Run(ctx context.Context) {
+	sample := time.NewTicker(s.opts.Interval)
+	defer sample.Stop()
+	save := time.NewTicker(saveInterval)
+	defer save.Stop()
+
+	s.Sample(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.store.Save(); err != nil {
+				log.Printf("history: failed to save: %v", err)
+			}
+			return
+		case now := <-sample.C:
+			s.Sample(ctx, now)
+		case now := <-save.C:
+			s.store.Prune(now)
+			if err := s.store.Save(); err != nil {
+				log.Printf("history: failed to save: %v", err)
+			}
+		}
+	}
+}
+
+// Sample enregistre une mesure de chaque service et de chaque node
+func (s *Sampler) Sample(ctx context.Context, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Interval)
+	defer cancel()
+
+	nodes, err := s.api.NodeList(ctx, dockerTypes.NodeListOptions{})
+	if err != nil {
+		log.Printf("history: failed to list nodes: %v", err)
+		return
+	}
+	services, err := s.api.ServiceList(ctx, dockerTypes.ServiceListOptions{})
+	if err != nil {
+		log.Printf("history: failed to list services: %v", err)
+		return
+	}
+	f := filters.NewArgs(filters.Arg("desired-state", string(swarm.TaskStateRunning)))
+	tasks, err := s.api.TaskList(ctx, dockerTypes.TaskListOptions{Filters: f})
+	if err != nil {
+		log.Printf("history: failed to list tasks: %v", err)
+		return
+	}
+
+	var running []swarm.Task
+	scheduled := make(map[string]int)
+	runningByService := make(map[string]int)
+	runningByNode := make(map[string]int)
+	for _, t := range tasks {
+		scheduled[t.ServiceID]++
+		if t.Status.State == swarm.TaskStateRunning {
+			running = append(running, t)
+			runningByService[t.ServiceID]++
+			runningByNode[t.NodeID]++
+		}
+	}
+	samples := s.measure(ctx, running)
+
+	for _, svc := range services {
+		desired := scheduled[svc.ID]
+		if svc.Spec.Mode.Replicated != nil && svc.Spec.Mode.Replicated.Replicas != nil {
+			desired = int(*svc.Spec.Mode.Replicated.Replicas)
+		}
+		values := map[string]float64{
+			MetricDesired: float64(desired),
+			MetricRunning: float64(runningByService[svc.ID]),
+		}
+		addUsage(values, samples, func(sample serviceSample) bool { return sample.ServiceID == svc.ID })
+		s.store.Add(KindService, svc.ID, now, values)
+	}
+	for _, n := range nodes {
+		values := map[string]float64{
+			MetricReady:  boolValue(n.Status.State == swarm.NodeStateReady),
+			MetricActive: boolValue(n.Spec.Availability == swarm.NodeAvailabilityActive),
+			MetricTasks:  float64(runningByNode[n.ID]),
+		}
+		addUsage(values, samples, func(sample serviceSample) bool { return sample.NodeID == n.ID })
+		s.store.Add(KindNode, n.ID, now, values)
+	}
+}
+
+// serviceSample associe une mesure de conteneur au service de sa tâche
+type serviceSample struct {
+	stats.Sample
+	ServiceID string
+}
+
+// measure relève la consommation des tâches en cours ; les tâches sans mesure
+// disponible (node sans agent, conteneur arrêté) sont ignorées
+func (s *Sampler) measure(ctx context.Context, tasks []swarm.Task) []serviceSample {
+	if s.opts.Stats == nil || len(tasks) == 0 {
+		return nil
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		samples []serviceSample
+	)
+	limit := make(chan struct{}, statsConcurrency(len(tasks), s.opts.Interval))
+	for _, t := range tasks {
+		wg.Add(1)
+		go func(t swarm.Task) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			sample, err := s.opts.Stats.Sample(ctx, t)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			samples = append(samples, serviceSample{Sample: sample, ServiceID: t.ServiceID})
+			mu.Unlock()
+		}(t)
+	}
+	wg.Wait()
+	return samples
+}
+
+// statsConcurrency renvoie le nombre de mesures à lancer en parallèle pour
+// mesurer count tâches en la moitié de interval
+func statsConcurrency(count int, interval time.Duration) int {
+	perWorker := int(interval / 2 / statsSampleDuration)
+	if perWorker < 1 {
+		perWorker = 1
+	}
+	return min(max((count+perWorker-1)/perWorker, minStatsConcurrency), maxStatsConcurrency)
+}
+
+// addUsage ajoute CPU et mémoire des mesures retenues, s'il y en a
+func addUsage(values map[string]float64, samples []serviceSample, keep func(serviceSample) bool) {
+	var usage stats.Usage
+	for _, sample := range samples {
+		if keep(sample) {
+			usage.Add(sample.Sample)
+		}
+	}
+	if usage.Tasks == 0 {
+		return
+	}
+	values[MetricCPUPercent] = usage.CPUPercent
+	values[MetricMemoryUsage] = float64(usage.MemoryUsage)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package history
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+func TestStatsConcurrency(t *testing.T) {
+	for _, tc := range []struct {
+		tasks    int
+		interval time.Duration
+		want     int
+	}{
+		{0, 30 * time.Second, minStatsConcurrency},
+		{50, 30 * time.Second, minStatsConcurrency},
+		// 7 mesures de 2s par worker en 15s
+		{140, 30 * time.Second, 20},
+		{5000, 30 * time.Second, maxStatsConcurrency},
+		{10, time.Second, 10},
+	} {
+		if got := statsConcurrency(tc.tasks, tc.interval); got != tc.want {
+			t.Errorf("statsConcurrency(%d, %s) = %d, want %d", tc.tasks, tc.interval, got, tc.want)
+		}
+	}
+}
+
+func TestSamplerRunSavesOnCancel(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	f.AddNode("n1", swarm.NodeRoleManager)
+	path := filepath.Join(t.TempDir(), "history.json")
+	store, err := NewStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Une mesure au démarrage, puis uniquement au rythme de l'intervalle
+	NewSampler(f, store, SamplerOptions{Interval: time.Hour}).Run(ctx)
+	if calls := f.Calls("NodeList"); calls != 1 {
+		t.Errorf("NodeList called %d times, want a single sample", calls)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Errorf("history not saved on cancel: %v", err)
+	}
+}
@@ -0,0 +1,422 @@
+// Package history échantillonne périodiquement l'état du swarm (réplicas,
+// état des nodes, consommation des tâches) et le conserve dans une base de
+// séries temporelles embarquée, sous-échantillonnée avec l'âge.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Types de séries
+const (
+	KindService = "service"
+	KindNode    = "node"
+)
+
+// Tier est un niveau de résolution : les mesures sont regroupées en
+// intervalles de Resolution (0 pour les garder telles quelles) pendant Retention
+type Tier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// DefaultTiers garde les mesures brutes 1h, des moyennes sur 5 minutes 7 jours
+// et des moyennes horaires 90 jours
+var DefaultTiers = []Tier{
+	{Resolution: 0, Retention: time.Hour},
+	{Resolution: 5 * time.Minute, Retention: 7 * 24 * time.Hour},
+	{Resolution: time.Hour, Retention: 90 * 24 * time.Hour},
+}
+
+// Point est une valeur agrégée sur un intervalle commençant à Time
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+}
+
+// bucket cumule les mesures d'un intervalle
+type bucket struct {
+	Start time.Time `json:"t"`
+	Sum   float64   `json:"s"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Count int       `json:"n"`
+}
+
+func (b *bucket) add(v float64) {
+	if b.Count == 0 || v < b.Min {
+		b.Min = v
+	}
+	if b.Count == 0 || v > b.Max {
+		b.Max = v
+	}
+	b.Sum += v
+	b.Count++
+}
+
+func (b *bucket) merge(o bucket) {
+	if b.Count == 0 || o.Min < b.Min {
+		b.Min = o.Min
+	}
+	if b.Count == 0 || o.Max > b.Max {
+		b.Max = o.Max
+	}
+	b.Sum += o.Sum
+	b.Count += o.Count
+}
+
+type seriesKey struct {
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	Metric string `json:"metric"`
+}
+
+// Store conserve les séries en mémoire, une liste d'intervalles par niveau.
+// La sauvegarde est un journal : chaque sauvegarde n'y ajoute que les mesures
+// et intervalles modifiés depuis la précédente.
+type Store struct {
+	mu     sync.Mutex
+	tiers  []Tier
+	series map[seriesKey][][]bucket
+	// Fichier de sauvegarde ; vide pour un stockage uniquement en mémoire
+	path string
+	// Intervalle d'échantillonnage, pas minimal des requêtes
+	interval time.Duration
+	// Par niveau, début du premier intervalle pas encore écrit
+	flushed []time.Time
+	// Lignes du fichier, dont celles d'intervalles réécrits ou expirés
+	lines int
+}
+
+// NewStore crée un stockage avec les niveaux donnés (DefaultTiers si vide).
+// Avec un chemin, les séries déjà sauvegardées sont rechargées.
+func NewStore(path string, tiers []Tier) (*Store, error) {
+	if len(tiers) == 0 {
+		tiers = DefaultTiers
+	}
+	s := &Store{tiers: tiers, series: make(map[seriesKey][][]bucket), path: path, interval: defaultSampleInterval, flushed: make([]time.Time, len(tiers))}
+	if path == "" {
+		return s, nil
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add enregistre les mesures d'un objet à l'instant t
+func (s *Store) Add(kind, id string, t time.Time, values map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for metric, v := range values {
+		key := seriesKey{Kind: kind, ID: id, Metric: metric}
+		tiers, ok := s.series[key]
+		if !ok {
+			tiers = make([][]bucket, len(s.tiers))
+		}
+		for i, tier := range s.tiers {
+			start := t
+			if tier.Resolution > 0 {
+				start = t.Truncate(tier.Resolution)
+			}
+			buckets := tiers[i]
+			if n := len(buckets); n > 0 && tier.Resolution > 0 && buckets[n-1].Start.Equal(start) {
+				buckets[n-1].add(v)
+			} else {
+				b := bucket{Start: start}
+				b.add(v)
+				buckets = append(buckets, b)
+			}
+			tiers[i] = buckets
+		}
+		s.series[key] = tiers
+	}
+}
+
+// Prune supprime les intervalles sortis de la rétention de leur niveau et les
+// séries devenues vides (services et nodes supprimés)
+func (s *Store) Prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, tiers := range s.series {
+		empty := true
+		for i, tier := range s.tiers {
+			cutoff := now.Add(-tier.Retention)
+			buckets := tiers[i]
+			drop := sort.Search(len(buckets), func(j int) bool { return !buckets[j].Start.Before(cutoff) })
+			if drop > 0 {
+				tiers[i] = append([]bucket(nil), buckets[drop:]...)
+			}
+			if len(tiers[i]) > 0 {
+				empty = false
+			}
+		}
+		if empty {
+			delete(s.series, key)
+		}
+	}
+}
+
+// Result est la réponse d'une requête sur l'historique d'un objet
+type Result struct {
+	Kind string    `json:"kind"`
+	ID   string    `json:"id"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Pas demandé et résolution du niveau utilisé
+	Step       string             `json:"step"`
+	Resolution string             `json:"resolution"`
+	Series     map[string][]Point `json:"series"`
+}
+
+// Query renvoie les séries d'un objet entre from et to, regroupées par pas de
+// step. Le niveau le plus fin couvrant from est utilisé.
+func (s *Store) Query(kind, id string, from, to time.Time, step time.Duration, now time.Time) Result {
+	tier := len(s.tiers) - 1
+	for i, t := range s.tiers {
+		if !from.Before(now.Add(-t.Retention)) {
+			tier = i
+			break
+		}
+	}
+	if r := s.tiers[tier].Resolution; step < r {
+		step = r
+	}
+	result := Result{
+		Kind:       kind,
+		ID:         id,
+		From:       from,
+		To:         to,
+		Step:       step.String(),
+		Resolution: s.tiers[tier].Resolution.String(),
+		Series:     make(map[string][]Point),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, tiers := range s.series {
+		if key.Kind != kind || key.ID != id {
+			continue
+		}
+		var points []Point
+		var current bucket
+		flush := func() {
+			if current.Count > 0 {
+				points = append(points, Point{Time: current.Start, Value: current.Sum / float64(current.Count), Min: current.Min, Max: current.Max})
+			}
+		}
+		for _, b := range tiers[tier] {
+			if b.Start.Before(from) || b.Start.After(to) {
+				continue
+			}
+			// Intervalles alignés sur le pas pour que les points restent
+			// stables d'une requête à l'autre
+			start := b.Start.Truncate(step)
+			if current.Count > 0 && !current.Start.Equal(start) {
+				flush()
+				current = bucket{}
+			}
+			current.Start = start
+			current.merge(b)
+		}
+		flush()
+		if points == nil {
+			points = []Point{}
+		}
+		result.Series[key.Metric] = points
+	}
+	return result
+}
+
+// Le fichier est réécrit quand il compte plus de compactRatio fois les
+// intervalles encore retenus
+const (
+	compactRatio    = 2
+	compactMinLines = 10000
+)
+
+// record est une ligne du fichier de sauvegarde : une mesure brute ou un
+// intervalle d'un niveau agrégé. Un intervalle écrit plusieurs fois garde sa
+// dernière version.
+type record struct {
+	seriesKey
+	Resolution time.Duration `json:"res"`
+	bucket
+}
+
+// Save ajoute au fichier de sauvegarde les mesures brutes et les intervalles
+// modifiés depuis la sauvegarde précédente ; les intervalles en cours y sont
+// aussi pour ne rien perdre à l'arrêt. Le fichier n'est réécrit en entier que
+// lorsque les lignes périmées (expirées ou réécrites) y dominent.
+func (s *Store) Save() error {
+	return s.save(time.Now())
+}
+
+func (s *Store) save(now time.Time) error {
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	cutoffs := make([]time.Time, len(s.tiers))
+	for i, tier := range s.tiers {
+		cutoffs[i] = now
+		if tier.Resolution > 0 {
+			cutoffs[i] = now.Truncate(tier.Resolution)
+		}
+	}
+	live := 0
+	for _, tiers := range s.series {
+		for i := range s.tiers {
+			live += len(tiers[i])
+		}
+	}
+	compact := s.lines > compactMinLines && s.lines > compactRatio*live
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	lines := 0
+	for key, tiers := range s.series {
+		for i, tier := range s.tiers {
+			for _, b := range tiers[i] {
+				if !compact && b.Start.Before(s.flushed[i]) {
+					continue
+				}
+				if err := enc.Encode(record{seriesKey: key, Resolution: tier.Resolution, bucket: b}); err != nil {
+					s.mu.Unlock()
+					return err
+				}
+				lines++
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o750); err != nil {
+		return err
+	}
+	if compact {
+		tmp := s.path + ".tmp"
+		if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, s.path); err != nil {
+			return err
+		}
+	} else if lines > 0 {
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(buf.Bytes())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if compact {
+		s.lines = 0
+	}
+	s.lines += lines
+	for i := range s.tiers {
+		if cutoffs[i].After(s.flushed[i]) {
+			s.flushed[i] = cutoffs[i]
+		}
+	}
+	return nil
+}
+
+func (s *Store) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tierOf := make(map[time.Duration]int)
+	for i, tier := range s.tiers {
+		tierOf[tier.Resolution] = i
+	}
+	reader := bufio.NewReader(f)
+	// Fin de la dernière ligne valide
+	var offset int64
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if len(data) == 0 {
+			break
+		}
+		var r record
+		if jsonErr := json.Unmarshal(data, &r); jsonErr != nil || data[len(data)-1] != '\n' {
+			if _, peekErr := reader.Peek(1); errors.Is(peekErr, io.EOF) {
+				// Sauvegarde interrompue par un arrêt brutal : la ligne partielle
+				// est retirée pour que les ajouts suivants restent lisibles
+				log.Printf("history: dropping a partial record at the end of %s", s.path)
+				if err := os.Truncate(s.path, offset); err != nil {
+					return err
+				}
+				break
+			}
+			return fmt.Errorf("invalid history file %s at offset %d: %v", s.path, offset, jsonErr)
+		}
+		offset += int64(len(data))
+		s.lines++
+		// Les niveaux ont pu changer depuis la sauvegarde : seuls ceux qui
+		// existent encore sont repris
+		i, ok := tierOf[r.Resolution]
+		if !ok || r.Kind == "" {
+			continue
+		}
+		tiers, ok := s.series[r.seriesKey]
+		if !ok {
+			tiers = make([][]bucket, len(s.tiers))
+			s.series[r.seriesKey] = tiers
+		}
+		tiers[i] = append(tiers[i], r.bucket)
+	}
+
+	for _, tiers := range s.series {
+		for i, buckets := range tiers {
+			sort.SliceStable(buckets, func(a, b int) bool { return buckets[a].Start.Before(buckets[b].Start) })
+			kept := buckets[:0]
+			for _, b := range buckets {
+				if n := len(kept); n > 0 && kept[n-1].Start.Equal(b.Start) {
+					kept[n-1] = b
+					continue
+				}
+				kept = append(kept, b)
+			}
+			tiers[i] = kept
+			// Le dernier intervalle était peut-être en cours : il sera réécrit
+			if n := len(kept); n > 0 && kept[n-1].Start.After(s.flushed[i]) {
+				s.flushed[i] = kept[n-1].Start
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package history
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testTiers = []Tier{
+	{Resolution: 0, Retention: time.Hour},
+	{Resolution: 5 * time.Minute, Retention: 24 * time.Hour},
+}
+
+func lineCount(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestStoreAppendsOnlyChangedBuckets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	s, err := NewStore(path, testTiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		now := start.Add(time.Duration(i) * 30 * time.Second)
+		s.Add(KindService, "web", now, map[string]float64{MetricRunning: float64(i)})
+		s.Add(KindService, "db", now, map[string]float64{MetricRunning: 1})
+	}
+
+	// 10 minutes de mesures : 20 mesures brutes et deux intervalles par série
+	now := start.Add(10 * time.Minute)
+	if err := s.save(now); err != nil {
+		t.Fatal(err)
+	}
+	if n := lineCount(t, path); n != 44 {
+		t.Fatalf("first save wrote %d lines, want 44", n)
+	}
+	// Sans nouvelle mesure, rien n'est réécrit
+	if err := s.save(now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := lineCount(t, path); n != 44 {
+		t.Errorf("second save: %d lines, want 44", n)
+	}
+
+	// L'intervalle en cours est écrit, puis réécrit une fois terminé ; les
+	// mesures brutes ne sont écrites qu'une fois
+	s.Add(KindService, "web", now.Add(2*time.Minute), map[string]float64{MetricRunning: 100})
+	if err := s.save(now.Add(3 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	s.Add(KindService, "web", now.Add(4*time.Minute), map[string]float64{MetricRunning: 200})
+	if err := s.save(now.Add(5 * time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := lineCount(t, path); n != 48 {
+		t.Errorf("after the open bucket: %d lines, want 48", n)
+	}
+
+	reloaded, err := NewStore(path, testTiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to := start, now.Add(5*time.Minute)
+	got := reloaded.Query(KindService, "web", from, to, 5*time.Minute, to).Series[MetricRunning]
+	want := s.Query(KindService, "web", from, to, 5*time.Minute, to).Series[MetricRunning]
+	if raw := reloaded.Query(KindService, "web", from, to, time.Second, to).Series[MetricRunning]; len(raw) != 22 {
+		t.Errorf("reloaded %d raw samples, want 22", len(raw))
+	}
+	if len(got) != 3 || len(want) != 3 {
+		t.Fatalf("points = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("point %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got[2].Value != 150 {
+		t.Errorf("last bucket = %+v, want the latest version (average 150)", got[2])
+	}
+}
+
+func TestStoreCompactsStaleLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	s, err := NewStore(path, testTiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Add(KindNode, "n1", start, map[string]float64{MetricReady: 1})
+	if err := s.save(start); err != nil {
+		t.Fatal(err)
+	}
+	// Le fichier est considéré comme plein de versions périmées
+	s.lines = compactMinLines + 1
+	if err := s.save(start.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n := lineCount(t, path); n != 2 || s.lines != 2 {
+		t.Errorf("after compaction: %d lines in the file, %d counted, want 2", n, s.lines)
+	}
+}
+
+func TestStoreDropsPartialTrailingRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	s, err := NewStore(path, testTiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Add(KindNode, "n1", start, map[string]float64{MetricReady: 1})
+	if err := s.save(start); err != nil {
+		t.Fatal(err)
+	}
+	// Arrêt brutal au milieu d'une sauvegarde
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"kind":"node","id":"n1","metric":"ready","res":0,"t":"2024-01-01T00:0`)
+	f.Close()
+
+	reloaded, err := NewStore(path, testTiers)
+	if err != nil {
+		t.Fatalf("partial record: %v", err)
+	}
+	if n := lineCount(t, path); n != 2 || reloaded.lines != 2 {
+		t.Errorf("%d lines in the file, %d counted, want the 2 complete lines", n, reloaded.lines)
+	}
+	// Les ajouts suivants restent lisibles
+	reloaded.Add(KindNode, "n1", start.Add(time.Minute), map[string]float64{MetricReady: 0})
+	if err := reloaded.save(start.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	again, err := NewStore(path, testTiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := start.Add(2 * time.Minute)
+	if raw := again.Query(KindNode, "n1", start, to, time.Second, to).Series[MetricReady]; len(raw) != 2 {
+		t.Errorf("reloaded %d raw samples, want 2", len(raw))
+	}
+}
+
+func TestStoreRejectsCorruptedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	data := "{\"kind\":\"node\",\"id\":\"n1\",\"metric\":\"ready\",\"res\":0,\"t\":\"2024-01-01T00:00:00Z\",\"s\":1,\"min\":1,\"max\":1,\"n\":1}\n" +
+		"not json\n" +
+		"{\"kind\":\"node\",\"id\":\"n1\",\"metric\":\"ready\",\"res\":0,\"t\":\"2024-01-01T00:01:00Z\",\"s\":1,\"min\":1,\"max\":1,\"n\":1}\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStore(path, testTiers); err == nil {
+		t.Error("a corrupted record before the end was accepted")
+	}
+}
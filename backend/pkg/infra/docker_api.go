@@ -0,0 +1,71 @@
+package infra
+
+import (
+	"context"
+	"io"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// DockerAPI est le sous-ensemble de l'API Docker utilisé par les handlers.
+// Il est implémenté par *client.Client et par infratest.FakeSwarm pour les tests.
+type DockerAPI interface {
+	// Nodes
+	NodeList(ctx context.Context, options dockerTypes.NodeListOptions) ([]swarm.Node, error)
+	NodeInspectWithRaw(ctx context.Context, nodeID string) (swarm.Node, []byte, error)
+	NodeUpdate(ctx context.Context, nodeID string, version swarm.Version, node swarm.NodeSpec) error
+	NodeRemove(ctx context.Context, nodeID string, options dockerTypes.NodeRemoveOptions) error
+
+	// Services et tâches
+	ServiceCreate(ctx context.Context, service swarm.ServiceSpec, options dockerTypes.ServiceCreateOptions) (swarm.ServiceCreateResponse, error)
+	ServiceList(ctx context.Context, options dockerTypes.ServiceListOptions) ([]swarm.Service, error)
+	ServiceInspectWithRaw(ctx context.Context, serviceID string, options dockerTypes.ServiceInspectOptions) (swarm.Service, []byte, error)
+	ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options dockerTypes.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error)
+	ServiceRemove(ctx context.Context, serviceID string) error
+	ServiceLogs(ctx context.Context, serviceID string, options container.LogsOptions) (io.ReadCloser, error)
+	TaskList(ctx context.Context, options dockerTypes.TaskListOptions) ([]swarm.Task, error)
+	TaskInspectWithRaw(ctx context.Context, taskID string) (swarm.Task, []byte, error)
+
+	// Images, conteneurs, volumes et réseaux
+	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	ImageRemove(ctx context.Context, image string, options image.RemoveOptions) ([]image.DeleteResponse, error)
+	DistributionInspect(ctx context.Context, imageRef, encodedRegistryAuth string) (registry.DistributionInspect, error)
+	ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
+	ContainerStats(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error)
+	VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error)
+	NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error)
+	NetworkCreate(ctx context.Context, name string, options network.CreateOptions) (network.CreateResponse, error)
+	NetworkRemove(ctx context.Context, networkID string) error
+
+	// Secrets et configs
+	SecretList(ctx context.Context, options dockerTypes.SecretListOptions) ([]swarm.Secret, error)
+	SecretCreate(ctx context.Context, secret swarm.SecretSpec) (dockerTypes.SecretCreateResponse, error)
+	SecretRemove(ctx context.Context, id string) error
+	ConfigList(ctx context.Context, options dockerTypes.ConfigListOptions) ([]swarm.Config, error)
+	ConfigCreate(ctx context.Context, config swarm.ConfigSpec) (dockerTypes.ConfigCreateResponse, error)
+	ConfigRemove(ctx context.Context, id string) error
+
+	// Prune
+	ImagesPrune(ctx context.Context, pruneFilter filters.Args) (image.PruneReport, error)
+	ContainersPrune(ctx context.Context, pruneFilters filters.Args) (container.PruneReport, error)
+	VolumesPrune(ctx context.Context, pruneFilter filters.Args) (volume.PruneReport, error)
+	NetworksPrune(ctx context.Context, pruneFilter filters.Args) (network.PruneReport, error)
+
+	// Système
+	Info(ctx context.Context) (system.Info, error)
+	DiskUsage(ctx context.Context, options dockerTypes.DiskUsageOptions) (dockerTypes.DiskUsage, error)
+	Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+}
+
+// Vérification à la compilation que le vrai client satisfait l'interface
+var _ DockerAPI = (*client.Client)(nil)
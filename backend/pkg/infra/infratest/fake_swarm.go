@@ -0,0 +1,1432 @@
+// Package infratest fournit un swarm en mémoire pour les tests : il n'est
+// importé que par des fichiers _test.go.
+package infratest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+)
+
+// FakeSwarm est une implémentation en mémoire de DockerAPI.
+// Elle simule un swarm avec des nodes, des services et des tâches : chaque
+// mise à jour d'un service réconcilie ses tâches (replicas, force update,
+// changement d'image) comme le ferait l'orchestrateur.
+type FakeSwarm struct {
+	mu sync.Mutex
+
+	nodes      []swarm.Node
+	services   []swarm.Service
+	tasks      []swarm.Task
+	images     []image.Summary
+	containers []container.Summary
+	volumes    []*volume.Volume
+	networks   []network.Summary
+	secrets    []swarm.Secret
+	configs    []swarm.Config
+	logs       map[string][]byte
+	// Mesures renvoyées par ContainerStats, par ID de conteneur
+	stats map[string][]container.StatsResponse
+	info  system.Info
+	// Digest renvoyé par DistributionInspect, par référence d'image
+	digests map[string]digest.Digest
+	// Options du dernier appel à ServiceUpdate
+	lastUpdate dockerTypes.ServiceUpdateOptions
+
+	// Exécute les tâches des jobs globaux sur une node (sortie standard, erreur)
+	jobRunner func(spec swarm.TaskSpec, node swarm.Node) ([]byte, error)
+	// Abonnés à Events
+	subscribers map[chan events.Message]filters.Args
+
+	// Erreurs injectées par nom de méthode
+	errors map[string]error
+	// Erreurs renvoyées une seule fois, par le prochain appel de la méthode
+	errorsOnce map[string]error
+	// Nombre d'appels par nom de méthode
+	calls  map[string]int
+	nextID int
+}
+
+var _ infra.DockerAPI = (*FakeSwarm)(nil)
+
+// NewFakeSwarm crée un swarm vide
+func NewFakeSwarm() *FakeSwarm {
+	return &FakeSwarm{
+		logs:        make(map[string][]byte),
+		stats:       make(map[string][]container.StatsResponse),
+		digests:     make(map[string]digest.Digest),
+		subscribers: make(map[chan events.Message]filters.Args),
+		errors:      make(map[string]error),
+		errorsOnce:  make(map[string]error),
+		calls:       make(map[string]int),
+	}
+}
+
+// AddNode ajoute une node prête et active au swarm
+func (f *FakeSwarm) AddNode(hostname string, role swarm.NodeRole) swarm.Node {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	node := swarm.Node{
+		ID:   f.newID(),
+		Meta: swarm.Meta{Version: swarm.Version{Index: 1}, CreatedAt: now, UpdatedAt: now},
+		Spec: swarm.NodeSpec{
+			Role:         role,
+			Availability: swarm.NodeAvailabilityActive,
+		},
+		Description: swarm.NodeDescription{
+			Hostname: hostname,
+			Platform: swarm.Platform{OS: "linux", Architecture: "x86_64"},
+			Resources: swarm.Resources{
+				NanoCPUs:    2e9,
+				MemoryBytes: 4 * 1024 * 1024 * 1024,
+			},
+			Engine: swarm.EngineDescription{
+				EngineVersion: "28.1.1",
+				Plugins: []swarm.PluginDescription{
+					{Type: "Log", Name: "json-file"},
+					{Type: "Network", Name: "overlay"},
+					{Type: "Volume", Name: "local"},
+				},
+			},
+		},
+		Status: swarm.NodeStatus{
+			State: swarm.NodeStateReady,
+			Addr:  fmt.Sprintf("10.0.0.%d", len(f.nodes)+1),
+		},
+	}
+	if role == swarm.NodeRoleManager {
+		node.ManagerStatus = &swarm.ManagerStatus{
+			Leader:       !f.hasLeader(),
+			Reachability: swarm.ReachabilityReachable,
+			Addr:         node.Status.Addr + ":2377",
+		}
+	}
+	f.nodes = append(f.nodes, node)
+	return clone(node)
+}
+
+// SetNodeState modifie l'état d'une node (ready, down...)
+func (f *FakeSwarm) SetNodeState(nodeID string, state swarm.NodeState) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if n := f.findNode(nodeID); n != nil {
+		n.Status.State = state
+	}
+}
+
+// AddService crée un service et ses tâches
+func (f *FakeSwarm) AddService(spec swarm.ServiceSpec) swarm.Service {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	svc := swarm.Service{
+		ID:   f.newID(),
+		Meta: swarm.Meta{Version: swarm.Version{Index: 1}, CreatedAt: now, UpdatedAt: now},
+		Spec: clone(spec),
+	}
+	f.services = append(f.services, svc)
+	f.reconcile(&f.services[len(f.services)-1], nil)
+	return clone(svc)
+}
+
+// AddTask ajoute une tâche arbitraire, par exemple pour simuler un historique d'échecs
+func (f *FakeSwarm) AddTask(task swarm.Task) swarm.Task {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if task.ID == "" {
+		task.ID = f.newID()
+	}
+	f.tasks = append(f.tasks, clone(task))
+	return clone(task)
+}
+
+// SetTaskState modifie l'état courant d'une tâche
+func (f *FakeSwarm) SetTaskState(taskID string, state swarm.TaskState, errMsg string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.tasks {
+		if f.tasks[i].ID == taskID {
+			f.tasks[i].Status.State = state
+			f.tasks[i].Status.Err = errMsg
+			f.tasks[i].Status.Timestamp = time.Now()
+			return
+		}
+	}
+}
+
+// AddImage ajoute une image locale
+func (f *FakeSwarm) AddImage(img image.Summary) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if img.ID == "" {
+		img.ID = "sha256:" + f.newID()
+	}
+	f.images = append(f.images, img)
+}
+
+// AddContainer ajoute un conteneur local
+func (f *FakeSwarm) AddContainer(ctr container.Summary) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ctr.ID == "" {
+		ctr.ID = f.newID()
+	}
+	f.containers = append(f.containers, ctr)
+}
+
+// AddVolume ajoute un volume local
+func (f *FakeSwarm) AddVolume(vol volume.Volume) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.volumes = append(f.volumes, &vol)
+}
+
+// AddNetwork ajoute un réseau
+func (f *FakeSwarm) AddNetwork(nw network.Summary) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if nw.ID == "" {
+		nw.ID = f.newID()
+	}
+	f.networks = append(f.networks, nw)
+}
+
+// SetServiceLogs définit le flux brut (multiplexé ou non) renvoyé par ServiceLogs
+func (f *FakeSwarm) SetServiceLogs(serviceID string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.logs[serviceID] = data
+}
+
+// SetContainerStats définit les mesures renvoyées par ContainerStats pour un
+// conteneur ; en mode stream elles sont toutes envoyées puis le flux se termine
+func (f *FakeSwarm) SetContainerStats(containerID string, samples []container.StatsResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stats[containerID] = clone(samples)
+}
+
+// SetJobRunner définit l'exécution simulée des tâches de jobs globaux. La sortie
+// est ajoutée aux logs du service, une erreur fait échouer la tâche.
+func (f *FakeSwarm) SetJobRunner(run func(spec swarm.TaskSpec, node swarm.Node) ([]byte, error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.jobRunner = run
+}
+
+// SetImageDigest définit le digest résolu dans le registre pour une référence
+func (f *FakeSwarm) SetImageDigest(ref string, d digest.Digest) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.digests[ref] = d
+}
+
+// LastServiceUpdateOptions renvoie les options du dernier appel à ServiceUpdate
+func (f *FakeSwarm) LastServiceUpdateOptions() dockerTypes.ServiceUpdateOptions {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.lastUpdate
+}
+
+// EmitEvent diffuse un événement aux abonnés de Events
+func (f *FakeSwarm) EmitEvent(msg events.Message) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.emit(msg)
+}
+
+// SetInfo définit la réponse de Info
+func (f *FakeSwarm) SetInfo(info system.Info) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.info = info
+}
+
+// FailOn force la méthode donnée à renvoyer err (nil pour annuler)
+func (f *FakeSwarm) FailOn(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		delete(f.errors, method)
+		return
+	}
+	f.errors[method] = err
+}
+
+// FailOnce force le prochain appel de la méthode donnée à renvoyer err
+func (f *FakeSwarm) FailOnce(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errorsOnce[method] = err
+}
+
+// Calls renvoie le nombre d'appels reçus par la méthode donnée
+func (f *FakeSwarm) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[method]
+}
+
+// ResetCalls remet les compteurs d'appels à zéro
+func (f *FakeSwarm) ResetCalls() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = make(map[string]int)
+}
+
+// --- DockerAPI ---
+
+func (f *FakeSwarm) NodeList(_ context.Context, options dockerTypes.NodeListOptions) ([]swarm.Node, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("NodeList"); err != nil {
+		return nil, err
+	}
+	var result []swarm.Node
+	for _, n := range f.nodes {
+		if matchNode(options.Filters, n) {
+			result = append(result, clone(n))
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeSwarm) NodeInspectWithRaw(_ context.Context, nodeID string) (swarm.Node, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("NodeInspectWithRaw"); err != nil {
+		return swarm.Node{}, nil, err
+	}
+	n := f.findNode(nodeID)
+	if n == nil {
+		return swarm.Node{}, nil, errdefs.NotFound(fmt.Errorf("node %s not found", nodeID))
+	}
+	raw, _ := json.Marshal(n)
+	return clone(*n), raw, nil
+}
+
+func (f *FakeSwarm) NodeUpdate(_ context.Context, nodeID string, version swarm.Version, spec swarm.NodeSpec) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("NodeUpdate"); err != nil {
+		return err
+	}
+	n := f.findNode(nodeID)
+	if n == nil {
+		return errdefs.NotFound(fmt.Errorf("node %s not found", nodeID))
+	}
+	if n.Version.Index != version.Index {
+		return errOutOfSequence
+	}
+	// Promotion et rétrogradation : la node rejoint ou quitte le raft, et le
+	// leadership passe à un autre manager joignable
+	switch {
+	case spec.Role == swarm.NodeRoleManager && n.ManagerStatus == nil:
+		n.ManagerStatus = &swarm.ManagerStatus{
+			Leader:       !f.hasLeader(),
+			Reachability: swarm.ReachabilityReachable,
+			Addr:         n.Status.Addr + ":2377",
+		}
+	case spec.Role == swarm.NodeRoleWorker && n.ManagerStatus != nil:
+		wasLeader := n.ManagerStatus.Leader
+		n.ManagerStatus = nil
+		if wasLeader {
+			for i := range f.nodes {
+				if ms := f.nodes[i].ManagerStatus; ms != nil && ms.Reachability == swarm.ReachabilityReachable {
+					ms.Leader = true
+					break
+				}
+			}
+		}
+	}
+	n.Spec = clone(spec)
+	n.Version.Index++
+	n.UpdatedAt = time.Now()
+	f.emitObject(events.NodeEventType, events.ActionUpdate, n.ID, n.Description.Hostname)
+
+	// Une node drainée perd ses tâches, qui sont replanifiées ailleurs ; une
+	// node réactivée ou dont les labels changent peut accueillir les tâches en attente
+	if spec.Availability != swarm.NodeAvailabilityPause {
+		for i := range f.services {
+			if mode := f.services[i].Spec.Mode; mode.Replicated != nil || mode.Global != nil {
+				f.reconcile(&f.services[i], nil)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *FakeSwarm) NodeRemove(_ context.Context, nodeID string, options dockerTypes.NodeRemoveOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("NodeRemove"); err != nil {
+		return err
+	}
+	for i, n := range f.nodes {
+		if n.ID != nodeID && n.Description.Hostname != nodeID {
+			continue
+		}
+		if n.ManagerStatus != nil {
+			return errdefs.Conflict(fmt.Errorf("node %s is a cluster manager and is a member of the raft cluster. It must be demoted to worker before removal", n.ID))
+		}
+		if n.Status.State != swarm.NodeStateDown && !options.Force {
+			return errdefs.Conflict(fmt.Errorf("node %s is not down and can't be removed", n.ID))
+		}
+		f.nodes = append(f.nodes[:i], f.nodes[i+1:]...)
+		f.emitObject(events.NodeEventType, events.ActionRemove, n.ID, n.Description.Hostname)
+		return nil
+	}
+	return errdefs.NotFound(fmt.Errorf("node %s not found", nodeID))
+}
+
+func (f *FakeSwarm) ServiceList(_ context.Context, options dockerTypes.ServiceListOptions) ([]swarm.Service, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ServiceList"); err != nil {
+		return nil, err
+	}
+	var result []swarm.Service
+	for _, s := range f.services {
+		if matchService(options.Filters, s) {
+			result = append(result, clone(s))
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeSwarm) ServiceCreate(_ context.Context, spec swarm.ServiceSpec, _ dockerTypes.ServiceCreateOptions) (swarm.ServiceCreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ServiceCreate"); err != nil {
+		return swarm.ServiceCreateResponse{}, err
+	}
+	if f.findService(spec.Name) != nil {
+		return swarm.ServiceCreateResponse{}, errdefs.Conflict(fmt.Errorf("service %s already exists", spec.Name))
+	}
+	now := time.Now()
+	f.services = append(f.services, swarm.Service{
+		ID:   f.newID(),
+		Meta: swarm.Meta{Version: swarm.Version{Index: 1}, CreatedAt: now, UpdatedAt: now},
+		Spec: clone(spec),
+	})
+	s := &f.services[len(f.services)-1]
+	f.emitObject(events.ServiceEventType, events.ActionCreate, s.ID, s.Spec.Name)
+	f.reconcile(s, nil)
+	return swarm.ServiceCreateResponse{ID: s.ID}, nil
+}
+
+func (f *FakeSwarm) ServiceRemove(_ context.Context, serviceID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ServiceRemove"); err != nil {
+		return err
+	}
+	for i, s := range f.services {
+		if s.ID == serviceID || s.Spec.Name == serviceID {
+			f.services = append(f.services[:i], f.services[i+1:]...)
+			var kept []swarm.Task
+			for _, t := range f.tasks {
+				if t.ServiceID != s.ID {
+					kept = append(kept, t)
+				}
+			}
+			f.tasks = kept
+			f.emitObject(events.ServiceEventType, events.ActionRemove, s.ID, s.Spec.Name)
+			return nil
+		}
+	}
+	return errdefs.NotFound(fmt.Errorf("service %s not found", serviceID))
+}
+
+func (f *FakeSwarm) ServiceInspectWithRaw(_ context.Context, serviceID string, _ dockerTypes.ServiceInspectOptions) (swarm.Service, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ServiceInspectWithRaw"); err != nil {
+		return swarm.Service{}, nil, err
+	}
+	s := f.findService(serviceID)
+	if s == nil {
+		return swarm.Service{}, nil, errdefs.NotFound(fmt.Errorf("service %s not found", serviceID))
+	}
+	raw, _ := json.Marshal(s)
+	return clone(*s), raw, nil
+}
+
+func (f *FakeSwarm) ServiceUpdate(_ context.Context, serviceID string, version swarm.Version, spec swarm.ServiceSpec, options dockerTypes.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ServiceUpdate"); err != nil {
+		return swarm.ServiceUpdateResponse{}, err
+	}
+	s := f.findService(serviceID)
+	if s == nil {
+		return swarm.ServiceUpdateResponse{}, errdefs.NotFound(fmt.Errorf("service %s not found", serviceID))
+	}
+	if s.Version.Index != version.Index {
+		return swarm.ServiceUpdateResponse{}, errOutOfSequence
+	}
+	f.lastUpdate = options
+
+	// Un rollback ignore la spec fournie et revient à PreviousSpec
+	state, message := swarm.UpdateStateCompleted, "update completed"
+	if options.Rollback == "previous" {
+		if s.PreviousSpec == nil {
+			return swarm.ServiceUpdateResponse{}, errdefs.InvalidParameter(fmt.Errorf("service %s does not have a previous spec", serviceID))
+		}
+		spec = *s.PreviousSpec
+		state, message = swarm.UpdateStateRollbackCompleted, "rollback completed"
+	}
+
+	now := time.Now()
+	previous := clone(s.Spec)
+	s.PreviousSpec = &previous
+	s.Spec = clone(spec)
+	s.Version.Index++
+	s.UpdatedAt = now
+	s.UpdateStatus = &swarm.UpdateStatus{State: state, StartedAt: &now, CompletedAt: &now, Message: message}
+	f.emitObject(events.ServiceEventType, events.ActionUpdate, s.ID, s.Spec.Name)
+	f.reconcile(s, &previous)
+	return swarm.ServiceUpdateResponse{}, nil
+}
+
+func (f *FakeSwarm) ServiceLogs(_ context.Context, serviceID string, _ container.LogsOptions) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ServiceLogs"); err != nil {
+		return nil, err
+	}
+	if f.findService(serviceID) == nil {
+		return nil, errdefs.NotFound(fmt.Errorf("service %s not found", serviceID))
+	}
+	return io.NopCloser(bytes.NewReader(f.logs[serviceID])), nil
+}
+
+func (f *FakeSwarm) TaskList(_ context.Context, options dockerTypes.TaskListOptions) ([]swarm.Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("TaskList"); err != nil {
+		return nil, err
+	}
+	var result []swarm.Task
+	for _, t := range f.tasks {
+		if f.matchTask(options.Filters, t) {
+			result = append(result, clone(t))
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeSwarm) TaskInspectWithRaw(_ context.Context, taskID string) (swarm.Task, []byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("TaskInspectWithRaw"); err != nil {
+		return swarm.Task{}, nil, err
+	}
+	for _, t := range f.tasks {
+		if t.ID == taskID {
+			raw, _ := json.Marshal(t)
+			return clone(t), raw, nil
+		}
+	}
+	return swarm.Task{}, nil, errdefs.NotFound(fmt.Errorf("task %s not found", taskID))
+}
+
+func (f *FakeSwarm) ImageList(_ context.Context, _ image.ListOptions) ([]image.Summary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ImageList"); err != nil {
+		return nil, err
+	}
+	return clone(f.images), nil
+}
+
+func (f *FakeSwarm) ImageRemove(_ context.Context, imageID string, _ image.RemoveOptions) ([]image.DeleteResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ImageRemove"); err != nil {
+		return nil, err
+	}
+	for i, img := range f.images {
+		if img.ID == imageID || strings.HasPrefix(img.ID, "sha256:"+imageID) || contains(img.RepoTags, imageID) {
+			f.images = append(f.images[:i], f.images[i+1:]...)
+			return []image.DeleteResponse{{Deleted: img.ID}}, nil
+		}
+	}
+	return nil, errdefs.NotFound(fmt.Errorf("No such image: %s", imageID))
+}
+
+func (f *FakeSwarm) DistributionInspect(_ context.Context, imageRef, _ string) (registry.DistributionInspect, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("DistributionInspect"); err != nil {
+		return registry.DistributionInspect{}, err
+	}
+	d, ok := f.digests[imageRef]
+	if !ok {
+		return registry.DistributionInspect{}, errdefs.NotFound(fmt.Errorf("manifest unknown: %s", imageRef))
+	}
+	return registry.DistributionInspect{Descriptor: ocispec.Descriptor{Digest: d}}, nil
+}
+
+func (f *FakeSwarm) ContainerList(_ context.Context, options container.ListOptions) ([]container.Summary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ContainerList"); err != nil {
+		return nil, err
+	}
+	var result []container.Summary
+	for _, ctr := range f.containers {
+		if !options.All && ctr.State != "running" {
+			continue
+		}
+		if options.Filters.Contains("id") && !options.Filters.FuzzyMatch("id", ctr.ID) {
+			continue
+		}
+		result = append(result, clone(ctr))
+	}
+	return result, nil
+}
+
+func (f *FakeSwarm) ContainerStats(_ context.Context, containerID string, stream bool) (container.StatsResponseReader, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ContainerStats"); err != nil {
+		return container.StatsResponseReader{}, err
+	}
+	samples, ok := f.stats[containerID]
+	if !ok {
+		return container.StatsResponseReader{}, errdefs.NotFound(fmt.Errorf("No such container: %s", containerID))
+	}
+	if !stream && len(samples) > 1 {
+		samples = samples[len(samples)-1:]
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, sample := range samples {
+		enc.Encode(sample)
+	}
+	return container.StatsResponseReader{Body: io.NopCloser(&buf), OSType: "linux"}, nil
+}
+
+func (f *FakeSwarm) VolumeList(_ context.Context, _ volume.ListOptions) (volume.ListResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("VolumeList"); err != nil {
+		return volume.ListResponse{}, err
+	}
+	return volume.ListResponse{Volumes: clone(f.volumes)}, nil
+}
+
+func (f *FakeSwarm) NetworkList(_ context.Context, options network.ListOptions) ([]network.Summary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("NetworkList"); err != nil {
+		return nil, err
+	}
+	var result []network.Summary
+	for _, nw := range f.networks {
+		if matchObject(options.Filters, nw.ID, nw.Name, nw.Labels) {
+			result = append(result, clone(nw))
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeSwarm) NetworkCreate(_ context.Context, name string, options network.CreateOptions) (network.CreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("NetworkCreate"); err != nil {
+		return network.CreateResponse{}, err
+	}
+	for _, nw := range f.networks {
+		if nw.Name == name {
+			return network.CreateResponse{}, errdefs.Conflict(fmt.Errorf("network with name %s already exists", name))
+		}
+	}
+	nw := network.Summary{
+		ID:         f.newID(),
+		Name:       name,
+		Created:    time.Now(),
+		Driver:     options.Driver,
+		Scope:      options.Scope,
+		Internal:   options.Internal,
+		Attachable: options.Attachable,
+		Options:    options.Options,
+		Labels:     options.Labels,
+	}
+	f.networks = append(f.networks, nw)
+	return network.CreateResponse{ID: nw.ID}, nil
+}
+
+func (f *FakeSwarm) NetworkRemove(_ context.Context, networkID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("NetworkRemove"); err != nil {
+		return err
+	}
+	for i, nw := range f.networks {
+		if nw.ID == networkID || nw.Name == networkID {
+			f.networks = append(f.networks[:i], f.networks[i+1:]...)
+			return nil
+		}
+	}
+	return errdefs.NotFound(fmt.Errorf("network %s not found", networkID))
+}
+
+func (f *FakeSwarm) SecretList(_ context.Context, options dockerTypes.SecretListOptions) ([]swarm.Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("SecretList"); err != nil {
+		return nil, err
+	}
+	var result []swarm.Secret
+	for _, s := range f.secrets {
+		if matchObject(options.Filters, s.ID, s.Spec.Name, s.Spec.Labels) {
+			result = append(result, clone(s))
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeSwarm) SecretCreate(_ context.Context, spec swarm.SecretSpec) (dockerTypes.SecretCreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("SecretCreate"); err != nil {
+		return dockerTypes.SecretCreateResponse{}, err
+	}
+	for _, s := range f.secrets {
+		if s.Spec.Name == spec.Name {
+			return dockerTypes.SecretCreateResponse{}, errdefs.Conflict(fmt.Errorf("secret %s already exists", spec.Name))
+		}
+	}
+	now := time.Now()
+	secret := swarm.Secret{
+		ID:   f.newID(),
+		Meta: swarm.Meta{Version: swarm.Version{Index: 1}, CreatedAt: now, UpdatedAt: now},
+		Spec: clone(spec),
+	}
+	// Comme le vrai démon, ne jamais renvoyer le contenu d'un secret
+	secret.Spec.Data = nil
+	f.secrets = append(f.secrets, secret)
+	return dockerTypes.SecretCreateResponse{ID: secret.ID}, nil
+}
+
+func (f *FakeSwarm) SecretRemove(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("SecretRemove"); err != nil {
+		return err
+	}
+	for i, s := range f.secrets {
+		if s.ID == id || s.Spec.Name == id {
+			f.secrets = append(f.secrets[:i], f.secrets[i+1:]...)
+			return nil
+		}
+	}
+	return errdefs.NotFound(fmt.Errorf("secret %s not found", id))
+}
+
+func (f *FakeSwarm) ConfigList(_ context.Context, options dockerTypes.ConfigListOptions) ([]swarm.Config, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ConfigList"); err != nil {
+		return nil, err
+	}
+	var result []swarm.Config
+	for _, c := range f.configs {
+		if matchObject(options.Filters, c.ID, c.Spec.Name, c.Spec.Labels) {
+			result = append(result, clone(c))
+		}
+	}
+	return result, nil
+}
+
+func (f *FakeSwarm) ConfigCreate(_ context.Context, spec swarm.ConfigSpec) (dockerTypes.ConfigCreateResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ConfigCreate"); err != nil {
+		return dockerTypes.ConfigCreateResponse{}, err
+	}
+	for _, c := range f.configs {
+		if c.Spec.Name == spec.Name {
+			return dockerTypes.ConfigCreateResponse{}, errdefs.Conflict(fmt.Errorf("config %s already exists", spec.Name))
+		}
+	}
+	now := time.Now()
+	config := swarm.Config{
+		ID:   f.newID(),
+		Meta: swarm.Meta{Version: swarm.Version{Index: 1}, CreatedAt: now, UpdatedAt: now},
+		Spec: clone(spec),
+	}
+	f.configs = append(f.configs, config)
+	return dockerTypes.ConfigCreateResponse{ID: config.ID}, nil
+}
+
+func (f *FakeSwarm) ConfigRemove(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ConfigRemove"); err != nil {
+		return err
+	}
+	for i, c := range f.configs {
+		if c.ID == id || c.Spec.Name == id {
+			f.configs = append(f.configs[:i], f.configs[i+1:]...)
+			return nil
+		}
+	}
+	return errdefs.NotFound(fmt.Errorf("config %s not found", id))
+}
+
+func (f *FakeSwarm) ImagesPrune(_ context.Context, _ filters.Args) (image.PruneReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ImagesPrune"); err != nil {
+		return image.PruneReport{}, err
+	}
+	report := image.PruneReport{}
+	var kept []image.Summary
+	for _, img := range f.images {
+		dangling := len(img.RepoTags) == 0 || (len(img.RepoTags) == 1 && img.RepoTags[0] == "<none>:<none>")
+		if dangling && img.Containers <= 0 {
+			report.ImagesDeleted = append(report.ImagesDeleted, image.DeleteResponse{Deleted: img.ID})
+			report.SpaceReclaimed += uint64(img.Size)
+			continue
+		}
+		kept = append(kept, img)
+	}
+	f.images = kept
+	return report, nil
+}
+
+func (f *FakeSwarm) ContainersPrune(_ context.Context, _ filters.Args) (container.PruneReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("ContainersPrune"); err != nil {
+		return container.PruneReport{}, err
+	}
+	report := container.PruneReport{}
+	var kept []container.Summary
+	for _, ctr := range f.containers {
+		if ctr.State != "running" {
+			report.ContainersDeleted = append(report.ContainersDeleted, ctr.ID)
+			report.SpaceReclaimed += uint64(ctr.SizeRw)
+			continue
+		}
+		kept = append(kept, ctr)
+	}
+	f.containers = kept
+	return report, nil
+}
+
+func (f *FakeSwarm) VolumesPrune(_ context.Context, _ filters.Args) (volume.PruneReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("VolumesPrune"); err != nil {
+		return volume.PruneReport{}, err
+	}
+	used := make(map[string]bool)
+	for _, ctr := range f.containers {
+		for _, m := range ctr.Mounts {
+			used[m.Name] = true
+		}
+	}
+	report := volume.PruneReport{}
+	var kept []*volume.Volume
+	for _, vol := range f.volumes {
+		if !used[vol.Name] {
+			report.VolumesDeleted = append(report.VolumesDeleted, vol.Name)
+			if vol.UsageData != nil && vol.UsageData.Size > 0 {
+				report.SpaceReclaimed += uint64(vol.UsageData.Size)
+			}
+			continue
+		}
+		kept = append(kept, vol)
+	}
+	f.volumes = kept
+	return report, nil
+}
+
+func (f *FakeSwarm) NetworksPrune(_ context.Context, _ filters.Args) (network.PruneReport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("NetworksPrune"); err != nil {
+		return network.PruneReport{}, err
+	}
+	report := network.PruneReport{}
+	var kept []network.Summary
+	for _, nw := range f.networks {
+		builtin := nw.Name == "bridge" || nw.Name == "host" || nw.Name == "none" || nw.Name == "ingress" || nw.Name == "docker_gwbridge"
+		if !builtin && len(nw.Containers) == 0 {
+			report.NetworksDeleted = append(report.NetworksDeleted, nw.Name)
+			continue
+		}
+		kept = append(kept, nw)
+	}
+	f.networks = kept
+	return report, nil
+}
+
+func (f *FakeSwarm) Info(_ context.Context) (system.Info, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("Info"); err != nil {
+		return system.Info{}, err
+	}
+	info := clone(f.info)
+	info.Swarm.Nodes = len(f.nodes)
+	managers := 0
+	for _, n := range f.nodes {
+		if n.Spec.Role == swarm.NodeRoleManager {
+			managers++
+		}
+	}
+	info.Swarm.Managers = managers
+	info.Swarm.LocalNodeState = swarm.LocalNodeStateActive
+	return info, nil
+}
+
+func (f *FakeSwarm) DiskUsage(_ context.Context, _ dockerTypes.DiskUsageOptions) (dockerTypes.DiskUsage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.record("DiskUsage"); err != nil {
+		return dockerTypes.DiskUsage{}, err
+	}
+	usage := dockerTypes.DiskUsage{}
+	for i := range f.images {
+		img := f.images[i]
+		usage.LayersSize += img.Size
+		usage.Images = append(usage.Images, &img)
+	}
+	for i := range f.containers {
+		ctr := f.containers[i]
+		usage.Containers = append(usage.Containers, &ctr)
+	}
+	usage.Volumes = clone(f.volumes)
+	return usage, nil
+}
+
+// Events renvoie les événements émis après l'abonnement (modifications de
+// services et de nodes, EmitEvent), filtrés par type
+func (f *FakeSwarm) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	messages := make(chan events.Message, 100)
+	errs := make(chan error, 1)
+	if err := f.record("Events"); err != nil {
+		errs <- err
+		return messages, errs
+	}
+	f.subscribers[messages] = options.Filters
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		delete(f.subscribers, messages)
+		f.mu.Unlock()
+		errs <- ctx.Err()
+	}()
+	return messages, errs
+}
+
+// --- Simulation de l'orchestrateur ---
+
+var errOutOfSequence = fmt.Errorf("rpc error: code = Unknown desc = update out of sequence")
+
+// reconcile aligne les tâches d'un service sur sa spec. Les tâches existantes
+// sont remplacées si le template a changé (image, force update).
+func (f *FakeSwarm) reconcile(s *swarm.Service, previous *swarm.ServiceSpec) {
+	replace := previous != nil &&
+		(previous.TaskTemplate.ForceUpdate != s.Spec.TaskTemplate.ForceUpdate ||
+			containerImage(previous.TaskTemplate) != containerImage(s.Spec.TaskTemplate))
+
+	nodes := f.schedulableNodes()
+	var running []*swarm.Task
+	for i := range f.tasks {
+		t := &f.tasks[i]
+		if t.ServiceID != s.ID || t.DesiredState != swarm.TaskStateRunning {
+			continue
+		}
+		// Tâche en attente d'une node : elle garde son slot
+		if t.NodeID == "" && !replace {
+			running = append(running, t)
+			continue
+		}
+		if replace || !containsNode(nodes, t.NodeID) {
+			f.shutdownTask(t)
+			continue
+		}
+		running = append(running, t)
+	}
+
+	switch {
+	case s.Spec.Mode.Replicated != nil:
+		want := 0
+		if s.Spec.Mode.Replicated.Replicas != nil {
+			want = int(*s.Spec.Mode.Replicated.Replicas)
+		}
+		sort.Slice(running, func(i, j int) bool { return running[i].Slot < running[j].Slot })
+		for len(running) > want {
+			f.shutdownTask(running[len(running)-1])
+			running = running[:len(running)-1]
+		}
+		var eligible []swarm.Node
+		for _, n := range nodes {
+			if matchConstraints(s.Spec.TaskTemplate.Placement, n) {
+				eligible = append(eligible, n)
+			}
+		}
+		used := make(map[int]bool)
+		for _, t := range running {
+			used[t.Slot] = true
+			if t.NodeID == "" && len(eligible) > 0 {
+				f.assignTask(t, eligible[(t.Slot-1)%len(eligible)].ID)
+			}
+		}
+		slot := 1
+		for i := len(running); i < want; i++ {
+			for used[slot] {
+				slot++
+			}
+			used[slot] = true
+			if len(eligible) == 0 {
+				f.pendingTask(s, slot, fmt.Sprintf("no suitable node (scheduling constraints not satisfied on %d nodes)", len(f.nodes)))
+				continue
+			}
+			f.startTask(s, slot, eligible[(slot-1)%len(eligible)].ID)
+		}
+	case s.Spec.Mode.Global != nil:
+		covered := make(map[string]bool)
+		for _, t := range running {
+			covered[t.NodeID] = true
+		}
+		for _, n := range nodes {
+			if !covered[n.ID] {
+				f.startTask(s, 0, n.ID)
+			}
+		}
+	case s.Spec.Mode.GlobalJob != nil:
+		if previous != nil {
+			return
+		}
+		for _, n := range nodes {
+			if matchConstraints(s.Spec.TaskTemplate.Placement, n) {
+				f.runJobTask(s, n)
+			}
+		}
+	}
+}
+
+// runJobTask exécute immédiatement la tâche d'un job sur la node donnée
+func (f *FakeSwarm) runJobTask(s *swarm.Service, n swarm.Node) {
+	now := time.Now()
+	task := swarm.Task{
+		ID:           f.newID(),
+		Meta:         swarm.Meta{Version: swarm.Version{Index: 1}, CreatedAt: now, UpdatedAt: now},
+		Spec:         clone(s.Spec.TaskTemplate),
+		ServiceID:    s.ID,
+		NodeID:       n.ID,
+		DesiredState: swarm.TaskStateComplete,
+		Status: swarm.TaskStatus{
+			Timestamp:       now,
+			State:           swarm.TaskStateComplete,
+			Message:         "finished",
+			ContainerStatus: &swarm.ContainerStatus{ContainerID: f.newID() + f.newID()},
+		},
+	}
+	if f.jobRunner != nil {
+		out, err := f.jobRunner(task.Spec, clone(n))
+		if len(out) > 0 {
+			var buf bytes.Buffer
+			stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write(out)
+			f.logs[s.ID] = append(f.logs[s.ID], buf.Bytes()...)
+		}
+		if err != nil {
+			task.Status.State = swarm.TaskStateFailed
+			task.Status.Message = "started"
+			task.Status.Err = err.Error()
+			task.Status.ContainerStatus.ExitCode = 1
+		}
+	}
+	f.tasks = append(f.tasks, task)
+}
+
+func (f *FakeSwarm) startTask(s *swarm.Service, slot int, nodeID string) {
+	now := time.Now()
+	f.tasks = append(f.tasks, swarm.Task{
+		ID:           f.newID(),
+		Meta:         swarm.Meta{Version: swarm.Version{Index: 1}, CreatedAt: now, UpdatedAt: now},
+		Spec:         clone(s.Spec.TaskTemplate),
+		ServiceID:    s.ID,
+		Slot:         slot,
+		NodeID:       nodeID,
+		DesiredState: swarm.TaskStateRunning,
+		Status: swarm.TaskStatus{
+			Timestamp:       now,
+			State:           swarm.TaskStateRunning,
+			Message:         "started",
+			ContainerStatus: &swarm.ContainerStatus{ContainerID: f.newID() + f.newID()},
+		},
+	})
+}
+
+// pendingTask crée une tâche qu'aucune node ne peut accueillir
+func (f *FakeSwarm) pendingTask(s *swarm.Service, slot int, reason string) {
+	now := time.Now()
+	f.tasks = append(f.tasks, swarm.Task{
+		ID:           f.newID(),
+		Meta:         swarm.Meta{Version: swarm.Version{Index: 1}, CreatedAt: now, UpdatedAt: now},
+		Spec:         clone(s.Spec.TaskTemplate),
+		ServiceID:    s.ID,
+		Slot:         slot,
+		DesiredState: swarm.TaskStateRunning,
+		Status: swarm.TaskStatus{
+			Timestamp: now,
+			State:     swarm.TaskStatePending,
+			Message:   "pending task scheduling",
+			Err:       reason,
+		},
+	})
+}
+
+// assignTask démarre une tâche en attente sur une node
+func (f *FakeSwarm) assignTask(t *swarm.Task, nodeID string) {
+	t.NodeID = nodeID
+	t.Status = swarm.TaskStatus{
+		Timestamp:       time.Now(),
+		State:           swarm.TaskStateRunning,
+		Message:         "started",
+		ContainerStatus: &swarm.ContainerStatus{ContainerID: f.newID() + f.newID()},
+	}
+}
+
+func (f *FakeSwarm) shutdownTask(t *swarm.Task) {
+	t.DesiredState = swarm.TaskStateShutdown
+	t.Status.State = swarm.TaskStateShutdown
+	t.Status.Message = "shutdown"
+	t.Status.Timestamp = time.Now()
+}
+
+func (f *FakeSwarm) schedulableNodes() []swarm.Node {
+	var nodes []swarm.Node
+	for _, n := range f.nodes {
+		if n.Status.State == swarm.NodeStateReady && n.Spec.Availability == swarm.NodeAvailabilityActive {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+func (f *FakeSwarm) hasLeader() bool {
+	for _, n := range f.nodes {
+		if n.ManagerStatus != nil && n.ManagerStatus.Leader {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FakeSwarm) findNode(id string) *swarm.Node {
+	for i := range f.nodes {
+		if f.nodes[i].ID == id || f.nodes[i].Description.Hostname == id {
+			return &f.nodes[i]
+		}
+	}
+	return nil
+}
+
+func (f *FakeSwarm) findService(id string) *swarm.Service {
+	for i := range f.services {
+		if f.services[i].ID == id || f.services[i].Spec.Name == id {
+			return &f.services[i]
+		}
+	}
+	return nil
+}
+
+func (f *FakeSwarm) emitObject(typ events.Type, action events.Action, id, name string) {
+	f.emit(events.Message{
+		Type:   typ,
+		Action: action,
+		Actor:  events.Actor{ID: id, Attributes: map[string]string{"name": name}},
+		Scope:  "swarm",
+	})
+}
+
+// emit envoie l'événement aux abonnés sans les attendre
+func (f *FakeSwarm) emit(msg events.Message) {
+	now := time.Now()
+	if msg.TimeNano == 0 {
+		msg.Time, msg.TimeNano = now.Unix(), now.UnixNano()
+	}
+	for ch, args := range f.subscribers {
+		if args.Len() > 0 && !args.ExactMatch("type", string(msg.Type)) {
+			continue
+		}
+		select {
+		case ch <- clone(msg):
+		default:
+		}
+	}
+}
+
+func (f *FakeSwarm) record(method string) error {
+	f.calls[method]++
+	if err, ok := f.errorsOnce[method]; ok {
+		delete(f.errorsOnce, method)
+		return err
+	}
+	return f.errors[method]
+}
+
+func (f *FakeSwarm) newID() string {
+	f.nextID++
+	return fmt.Sprintf("%025x", f.nextID)
+}
+
+// --- Filtres ---
+
+func matchNode(args filters.Args, n swarm.Node) bool {
+	if args.Len() == 0 {
+		return true
+	}
+	if args.Contains("id") && !args.FuzzyMatch("id", n.ID) {
+		return false
+	}
+	if args.Contains("name") && !args.Match("name", n.Description.Hostname) {
+		return false
+	}
+	if args.Contains("role") && !args.ExactMatch("role", string(n.Spec.Role)) {
+		return false
+	}
+	if args.Contains("node.label") && !args.MatchKVList("node.label", n.Spec.Labels) {
+		return false
+	}
+	return true
+}
+
+func matchService(args filters.Args, s swarm.Service) bool {
+	if args.Len() == 0 {
+		return true
+	}
+	if args.Contains("id") && !args.FuzzyMatch("id", s.ID) {
+		return false
+	}
+	if args.Contains("name") && !args.Match("name", s.Spec.Name) {
+		return false
+	}
+	if args.Contains("label") && !args.MatchKVList("label", s.Spec.Labels) {
+		return false
+	}
+	if args.Contains("mode") {
+		mode := "replicated"
+		if s.Spec.Mode.Global != nil {
+			mode = "global"
+		}
+		if !args.ExactMatch("mode", mode) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchObject applique les filtres id, name et label communs aux réseaux, secrets et configs
+func matchObject(args filters.Args, id, name string, labels map[string]string) bool {
+	if args.Len() == 0 {
+		return true
+	}
+	if args.Contains("id") && !args.FuzzyMatch("id", id) {
+		return false
+	}
+	if args.Contains("name") && !args.Match("name", name) {
+		return false
+	}
+	if args.Contains("label") && !args.MatchKVList("label", labels) {
+		return false
+	}
+	return true
+}
+
+func (f *FakeSwarm) matchTask(args filters.Args, t swarm.Task) bool {
+	if args.Len() == 0 {
+		return true
+	}
+	if args.Contains("id") && !args.FuzzyMatch("id", t.ID) {
+		return false
+	}
+	if args.Contains("service") {
+		name := ""
+		if s := f.findService(t.ServiceID); s != nil {
+			name = s.Spec.Name
+		}
+		if !args.ExactMatch("service", t.ServiceID) && !args.ExactMatch("service", name) {
+			return false
+		}
+	}
+	if args.Contains("node") {
+		hostname := ""
+		if n := f.findNode(t.NodeID); n != nil {
+			hostname = n.Description.Hostname
+		}
+		if !args.ExactMatch("node", t.NodeID) && !args.ExactMatch("node", hostname) {
+			return false
+		}
+	}
+	if args.Contains("desired-state") && !args.ExactMatch("desired-state", string(t.DesiredState)) {
+		return false
+	}
+	if args.Contains("label") && !args.MatchKVList("label", t.Labels) {
+		return false
+	}
+	return true
+}
+
+// --- Utilitaires ---
+
+// clone renvoie une copie profonde pour que les appelants ne modifient
+// jamais l'état interne du fake (les specs Docker contiennent des pointeurs).
+func clone[T any](v T) T {
+	var out T
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func containerImage(spec swarm.TaskSpec) string {
+	if spec.ContainerSpec == nil {
+		return ""
+	}
+	return spec.ContainerSpec.Image
+}
+
+func containsNode(nodes []swarm.Node, id string) bool {
+	for _, n := range nodes {
+		if n.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// matchConstraints évalue les contraintes de placement node.id, node.hostname,
+// node.role et node.labels.* (les autres sont considérées satisfaites)
+func matchConstraints(placement *swarm.Placement, n swarm.Node) bool {
+	if placement == nil {
+		return true
+	}
+	for _, constraint := range placement.Constraints {
+		key, value, equal := strings.Cut(constraint, "==")
+		if !equal {
+			key, value, _ = strings.Cut(constraint, "!=")
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		var actual string
+		switch {
+		case key == "node.id":
+			actual = n.ID
+		case key == "node.hostname":
+			actual = n.Description.Hostname
+		case key == "node.role":
+			actual = string(n.Spec.Role)
+		case strings.HasPrefix(key, "node.labels."):
+			actual = n.Spec.Labels[strings.TrimPrefix(key, "node.labels.")]
+		default:
+			continue
+		}
+		if (actual == value) != equal {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+)
+
+const (
+	defaultScanInterval = 30 * time.Second
+	collectorFlushDelay = time.Second
+	collectorBatchSize  = 500
+	retentionInterval   = time.Minute
+	stackLabel          = "com.docker.stack.namespace"
+)
+
+// CollectorOptions sélectionne les services suivis. Sans stack ni service,
+// tous les services du swarm sont suivis.
+type CollectorOptions struct {
+	Stacks   []string
+	Services []string
+	// Fréquence de découverte des nouveaux services
+	ScanInterval time.Duration
+}
+
+// Collector suit en continu les logs des services sélectionnés et les écrit
+// dans un Store, pour qu'ils restent consultables après la disparition des
+// tâches ou la fermeture des WebSockets
+type Collector struct {
+	api   infra.DockerAPI
+	store *Store
+	opts  CollectorOptions
+	lines chan Line
+
+	mu sync.Mutex
+	// Services suivis et horodatage de leur dernière ligne, pour reprendre
+	// quand un flux se termine
+	following map[string]bool
+	last      map[string]time.Time
+}
+
+// NewCollector crée un collecteur ; Run le démarre
+func NewCollector(api infra.DockerAPI, store *Store, opts CollectorOptions) *Collector {
+	if opts.ScanInterval <= 0 {
+		opts.ScanInterval = defaultScanInterval
+	}
+	return &Collector{
+		api:       api,
+		store:     store,
+		opts:      opts,
+		lines:     make(chan Line, collectorBatchSize),
+		following: make(map[string]bool),
+		last:      make(map[string]time.Time),
+	}
+}
+
+// Run découvre les services à suivre, écrit leurs lignes et applique la
+// rétention jusqu'à l'annulation de ctx
+func (c *Collector) Run(ctx context.Context) {
+	go c.write(ctx)
+
+	// Les logs antérieurs au démarrage ne sont pas repris
+	started := time.Now()
+	scan := time.NewTicker(c.opts.ScanInterval)
+	defer scan.Stop()
+	for {
+		c.scan(ctx, started)
+		select {
+		case <-ctx.Done():
+			return
+		case <-scan.C:
+		}
+	}
+}
+
+// scan lance un suivi pour chaque service sélectionné qui n'en a pas
+func (c *Collector) scan(ctx context.Context, started time.Time) {
+	services, err := c.api.ServiceList(ctx, dockerTypes.ServiceListOptions{})
+	if err != nil {
+		log.Printf("log collector: failed to list services: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Oublier les services supprimés, sinon last grandit avec chaque service créé
+	present := make(map[string]bool, len(services))
+	for _, svc := range services {
+		present[svc.ID] = true
+	}
+	for id := range c.last {
+		if !present[id] && !c.following[id] {
+			delete(c.last, id)
+		}
+	}
+	for _, svc := range services {
+		if c.following[svc.ID] || !c.selected(svc) {
+			continue
+		}
+		// Reprendre après la dernière ligne écrite pour éviter les doublons
+		since := started
+		if last, ok := c.last[svc.ID]; ok {
+			since = last.Add(time.Nanosecond)
+		}
+		c.following[svc.ID] = true
+		go c.follow(ctx, svc, since)
+	}
+}
+
+func (c *Collector) selected(svc swarm.Service) bool {
+	if len(c.opts.Stacks) == 0 && len(c.opts.Services) == 0 {
+		return true
+	}
+	for _, stack := range c.opts.Stacks {
+		if svc.Spec.Labels[stackLabel] == stack {
+			return true
+		}
+	}
+	for _, name := range c.opts.Services {
+		if svc.Spec.Name == name || svc.ID == name {
+			return true
+		}
+	}
+	return false
+}
+
+// follow suit les logs d'un service jusqu'à la fin du flux ; le prochain scan
+// le relance si le service existe toujours
+func (c *Collector) follow(ctx context.Context, svc swarm.Service, since time.Time) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.following, svc.ID)
+		c.mu.Unlock()
+	}()
+
+	opts := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: true,
+		Details:    true,
+		Since:      since.Format(time.RFC3339Nano),
+	}
+	reader, err := c.api.ServiceLogs(ctx, svc.ID, opts)
+	if err != nil {
+		log.Printf("log collector: failed to follow %s: %v", svc.Spec.Name, err)
+		return
+	}
+	defer reader.Close()
+	stop := context.AfterFunc(ctx, func() { reader.Close() })
+	defer stop()
+
+	dec := NewDecoder(reader, DecoderOptions{
+		TTY:        svc.Spec.TaskTemplate.ContainerSpec != nil && svc.Spec.TaskTemplate.ContainerSpec.TTY,
+		Timestamps: true,
+		Details:    true,
+		Service:    svc.Spec.Name,
+		ServiceID:  svc.ID,
+	})
+	for {
+		line, err := dec.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				log.Printf("log collector: stream of %s failed: %v", svc.Spec.Name, err)
+			}
+			return
+		}
+		if !line.Timestamp.IsZero() {
+			c.mu.Lock()
+			if line.Timestamp.After(c.last[svc.ID]) {
+				c.last[svc.ID] = line.Timestamp
+			}
+			c.mu.Unlock()
+		}
+
+		select {
+		case c.lines <- line:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// write regroupe les lignes avant de les écrire et applique la rétention
+func (c *Collector) write(ctx context.Context) {
+	flush := time.NewTicker(collectorFlushDelay)
+	defer flush.Stop()
+	retention := time.NewTicker(retentionInterval)
+	defer retention.Stop()
+
+	batch := make([]Line, 0, collectorBatchSize)
+	save := func() {
+		if err := c.store.Append(batch); err != nil {
+			log.Printf("log collector: failed to write %d lines: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			save()
+			return
+		case line := <-c.lines:
+			batch = append(batch, line)
+			if len(batch) >= collectorBatchSize {
+				save()
+			}
+		case <-flush.C:
+			save()
+		case now := <-retention.C:
+			if err := c.store.Prune(now); err != nil {
+				log.Printf("log collector: retention failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package logs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+func TestCollectorForgetsRemovedServices(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	svc := f.AddService(swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "api"}})
+	c := NewCollector(f, nil, CollectorOptions{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	now := time.Now()
+	c.last[svc.ID] = now
+	c.last["removed"] = now
+	c.scan(ctx, now)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.last["removed"]; ok {
+		t.Error("last still holds the removed service")
+	}
+	if !c.last[svc.ID].Equal(now) {
+		t.Error("last lost the position of a listed service")
+	}
+}
@@ -0,0 +1,242 @@
+// Package logs décode et transforme les flux de logs renvoyés par l'API Docker.
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Noms des flux d'une ligne de log
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// Attributs ajoutés par Docker à chaque ligne quand LogsOptions.Details est actif
+const (
+	attrNodeID    = "com.docker.swarm.node.id"
+	attrServiceID = "com.docker.swarm.service.id"
+	attrTaskID    = "com.docker.swarm.task.id"
+)
+
+// Taille maximale d'une ligne : au-delà, elle est découpée
+const maxLineSize = 1 << 20
+
+// Taille maximale d'une trame multiplexée ; le daemon découpe les lignes en
+// trames de 16 Kio, une taille supérieure signale un flux mal identifié
+const maxFrameSize = 1 << 20
+
+// Line est une ligne de log complète d'une tâche
+type Line struct {
+	Timestamp time.Time `json:"timestamp"`
+	Stream    string    `json:"stream"`
+	Service   string    `json:"service,omitempty"`
+	ServiceID string    `json:"service_id,omitempty"`
+	TaskID    string    `json:"task,omitempty"`
+	NodeID    string    `json:"node,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// DecoderOptions décrit le format du flux, qui dépend des options de la requête
+// de logs et du mode TTY du service
+type DecoderOptions struct {
+	// Flux brut sans en-têtes de multiplexage (services avec tty: true)
+	TTY bool
+	// Chaque ligne commence par un horodatage RFC 3339 (LogsOptions.Timestamps)
+	Timestamps bool
+	// Chaque ligne porte les attributs de la tâche (LogsOptions.Details)
+	Details bool
+	// Service auquel rattacher les lignes (ServiceID sert à défaut d'attribut)
+	Service   string
+	ServiceID string
+}
+
+// Decoder découpe un flux de logs Docker en lignes complètes. Dans le format
+// multiplexé, chaque trame a un en-tête de 8 octets (flux, 3 octets nuls, taille
+// big-endian sur 4 octets) ; une ligne peut être répartie sur plusieurs trames et
+// une trame peut contenir plusieurs lignes, d'où un tampon par flux.
+type Decoder struct {
+	r       *bufio.Reader
+	opts    DecoderOptions
+	partial map[string][]byte
+	pending []Line
+	err     error
+	// Trames multiplexées déjà décodées
+	frames int
+}
+
+// NewDecoder crée un décodeur sur r
+func NewDecoder(r io.Reader, opts DecoderOptions) *Decoder {
+	return &Decoder{
+		r:       bufio.NewReaderSize(r, 32*1024),
+		opts:    opts,
+		partial: make(map[string][]byte),
+	}
+}
+
+// Next renvoie la ligne suivante. À la fin du flux, les lignes incomplètes sont
+// renvoyées telles quelles puis io.EOF.
+func (d *Decoder) Next() (Line, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return Line{}, d.err
+		}
+		if err := d.fill(); err != nil {
+			d.err = err
+			if errors.Is(err, io.EOF) {
+				d.flush()
+			}
+		}
+	}
+	line := d.pending[0]
+	d.pending = d.pending[1:]
+	return line, nil
+}
+
+// fill lit une trame (ou un bloc en mode TTY) et découpe les lignes complètes
+func (d *Decoder) fill() error {
+	if d.opts.TTY {
+		chunk, err := d.r.ReadSlice('\n')
+		if len(chunk) > 0 {
+			d.appendData(StreamStdout, chunk)
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil
+		}
+		return err
+	}
+
+	var header [8]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return io.EOF
+		}
+		return err
+	}
+	size := binary.BigEndian.Uint32(header[4:])
+	if !validFrameHeader(header) || size > maxFrameSize {
+		// Un flux TTY pris pour un flux multiplexé : son début est du texte,
+		// qui est décodé tel quel. Au milieu d'un flux multiplexé, c'est une
+		// erreur, la suite ne peut plus être découpée.
+		if d.frames > 0 {
+			return fmt.Errorf("invalid log frame header % x", header)
+		}
+		d.opts.TTY = true
+		d.appendData(StreamStdout, header[:])
+		return nil
+	}
+	d.frames++
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(d.r, payload); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			d.appendData(streamName(header[0]), payload)
+			return io.EOF
+		}
+		return err
+	}
+
+	if header[0] == 3 {
+		// Erreur remontée par le daemon au milieu du flux
+		return fmt.Errorf("error from daemon in stream: %s", strings.TrimSpace(string(payload)))
+	}
+	d.appendData(streamName(header[0]), payload)
+	return nil
+}
+
+// validFrameHeader vérifie le flux (stdin, stdout, stderr ou erreur du daemon)
+// et les 3 octets nuls de l'en-tête
+func validFrameHeader(header [8]byte) bool {
+	return header[0] <= 3 && header[1] == 0 && header[2] == 0 && header[3] == 0
+}
+
+func (d *Decoder) appendData(stream string, data []byte) {
+	buf := append(d.partial[stream], data...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		d.emit(stream, buf[:i])
+		buf = buf[i+1:]
+	}
+	for len(buf) > maxLineSize {
+		d.emit(stream, buf[:maxLineSize])
+		buf = buf[maxLineSize:]
+	}
+	// Copier le reste pour ne pas retenir le tampon de lecture
+	d.partial[stream] = append([]byte(nil), buf...)
+}
+
+func (d *Decoder) flush() {
+	for _, stream := range []string{StreamStdout, StreamStderr} {
+		if rest := d.partial[stream]; len(rest) > 0 {
+			d.emit(stream, rest)
+			d.partial[stream] = nil
+		}
+	}
+}
+
+func (d *Decoder) emit(stream string, raw []byte) {
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	line := Line{Stream: stream, Service: d.opts.Service, ServiceID: d.opts.ServiceID}
+	rest := string(raw)
+
+	if d.opts.Timestamps {
+		if ts, after, ok := strings.Cut(rest, " "); ok {
+			if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+				line.Timestamp = t
+				rest = after
+			}
+		}
+	}
+	if d.opts.Details {
+		details, after, _ := strings.Cut(rest, " ")
+		if parseDetails(details, &line) {
+			rest = after
+		}
+	}
+	line.Message = strings.ToValidUTF8(rest, "�")
+	d.pending = append(d.pending, line)
+}
+
+// parseDetails lit les attributs "clé=valeur" séparés par des virgules et
+// échappés façon URL. Renvoie false si le champ n'a pas ce format.
+func parseDetails(details string, line *Line) bool {
+	if details == "" {
+		return true
+	}
+	for _, attr := range strings.Split(details, ",") {
+		k, v, ok := strings.Cut(attr, "=")
+		if !ok {
+			return false
+		}
+		key, err1 := url.QueryUnescape(k)
+		value, err2 := url.QueryUnescape(v)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		switch key {
+		case attrNodeID:
+			line.NodeID = value
+		case attrServiceID:
+			line.ServiceID = value
+		case attrTaskID:
+			line.TaskID = value
+		}
+	}
+	return true
+}
+
+func streamName(b byte) string {
+	if b == 2 {
+		return StreamStderr
+	}
+	return StreamStdout
+}
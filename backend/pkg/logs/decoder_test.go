@@ -0,0 +1,90 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// frame construit une trame multiplexée
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+// readAll renvoie les lignes décodées sous la forme "flux:message"
+func readAll(t *testing.T, d *Decoder) ([]string, error) {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := d.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return lines, nil
+			}
+			return lines, err
+		}
+		lines = append(lines, line.Stream+":"+line.Message)
+	}
+}
+
+func TestDecoderMultiplexed(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(frame(1, "hello wo"))
+	stream.Write(frame(2, "oops\n"))
+	stream.Write(frame(1, "rld\nsecond\nthi"))
+	stream.Write(frame(1, "rd"))
+
+	lines, err := readAll(t, NewDecoder(&stream, DecoderOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"stderr:oops", "stdout:hello world", "stdout:second", "stdout:third"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestDecoderDaemonError(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(frame(1, "ok\n"))
+	stream.Write(frame(3, "container not found\n"))
+
+	lines, err := readAll(t, NewDecoder(&stream, DecoderOptions{}))
+	if len(lines) != 1 || err == nil || !strings.Contains(err.Error(), "container not found") {
+		t.Errorf("lines = %q, err = %v", lines, err)
+	}
+}
+
+// Un flux TTY pris pour un flux multiplexé ne doit pas faire lire ses
+// premiers octets comme une taille de trame
+func TestDecoderFallsBackToRaw(t *testing.T) {
+	text := "2024-01-01 starting server\nready\n"
+	lines, err := readAll(t, NewDecoder(strings.NewReader(text), DecoderOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"stdout:2024-01-01 starting server", "stdout:ready"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestDecoderRejectsOversizedFrame(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(frame(1, "ok\n"))
+	header := make([]byte, 8)
+	header[0] = 1
+	binary.BigEndian.PutUint32(header[4:], 0xFFFFFFF0)
+	stream.Write(header)
+
+	lines, err := readAll(t, NewDecoder(&stream, DecoderOptions{}))
+	if len(lines) != 1 || err == nil || !strings.Contains(err.Error(), "invalid log frame header") {
+		t.Errorf("lines = %q, err = %v", lines, err)
+	}
+}
@@ -0,0 +1,205 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Niveaux de log détectés, du moins au plus grave
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var levelRank = map[string]int{LevelDebug: 1, LevelInfo: 2, LevelWarn: 3, LevelError: 4}
+
+// Formats reconnus : level=error, "level":"error", [ERROR], ERROR:, E/W/I de klog...
+var (
+	levelKeyPattern  = regexp.MustCompile(`(?i)"?(?:level|lvl|severity)"?\s*[=:]\s*"?([a-z]+)`)
+	levelWordPattern = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|CRIT|CRITICAL|FATAL|PANIC)\b`)
+	levelKlogPattern = regexp.MustCompile(`^([DIWEF])\d{4} `)
+)
+
+// DetectLevel devine le niveau d'une ligne à partir des conventions courantes
+// (logfmt, JSON, mots en majuscules, klog). Renvoie "" si aucun n'est reconnu.
+func DetectLevel(message string) string {
+	if m := levelKeyPattern.FindStringSubmatch(message); m != nil {
+		if level := normalizeLevel(m[1]); level != "" {
+			return level
+		}
+	}
+	if m := levelWordPattern.FindStringSubmatch(message); m != nil {
+		return normalizeLevel(m[1])
+	}
+	if m := levelKlogPattern.FindStringSubmatch(message); m != nil {
+		return map[string]string{"D": LevelDebug, "I": LevelInfo, "W": LevelWarn, "E": LevelError, "F": LevelError}[m[1]]
+	}
+	return ""
+}
+
+func normalizeLevel(s string) string {
+	switch strings.ToLower(s) {
+	case "trace", "debug", "dbg":
+		return LevelDebug
+	case "info", "notice", "inf":
+		return LevelInfo
+	case "warn", "warning", "wrn":
+		return LevelWarn
+	case "error", "err", "crit", "critical", "fatal", "panic", "alert", "emerg":
+		return LevelError
+	}
+	return ""
+}
+
+// FilterSpec décrit les filtres tels que reçus (paramètres de requête ou
+// commande WebSocket)
+type FilterSpec struct {
+	// Expressions régulières (RE2) que le message doit contenir / ne pas contenir
+	Include string `json:"include,omitempty"`
+	Exclude string `json:"exclude,omitempty"`
+	// Niveau minimal détecté ; les lignes sans niveau reconnu sont écartées
+	Level string `json:"level,omitempty"`
+	// stdout ou stderr
+	Stream string `json:"stream,omitempty"`
+	// Date RFC 3339, timestamp Unix ou durée relative ("15m")
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+	// Nombre de lignes reprises de l'historique de chaque service ("all" pour tout)
+	Tail string `json:"tail,omitempty"`
+}
+
+// Filter est la forme compilée d'une FilterSpec
+type Filter struct {
+	Spec    FilterSpec
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+	level   int
+	since   time.Time
+	until   time.Time
+}
+
+// Compile valide la spec et prépare le filtre. Les dates relatives sont
+// résolues par rapport à now.
+func (s FilterSpec) Compile(now time.Time) (*Filter, error) {
+	f := &Filter{Spec: s}
+	var err error
+	if s.Include != "" {
+		if f.include, err = regexp.Compile(s.Include); err != nil {
+			return nil, fmt.Errorf("invalid include pattern: %w", err)
+		}
+	}
+	if s.Exclude != "" {
+		if f.exclude, err = regexp.Compile(s.Exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+		}
+	}
+	if s.Level != "" {
+		level := normalizeLevel(s.Level)
+		if level == "" {
+			return nil, fmt.Errorf("invalid level %q", s.Level)
+		}
+		f.level = levelRank[level]
+	}
+	if s.Stream != "" && s.Stream != StreamStdout && s.Stream != StreamStderr {
+		return nil, fmt.Errorf("invalid stream %q", s.Stream)
+	}
+	if f.since, err = ParseTime(s.Since, now); err != nil {
+		return nil, fmt.Errorf("invalid since: %w", err)
+	}
+	if f.until, err = ParseTime(s.Until, now); err != nil {
+		return nil, fmt.Errorf("invalid until: %w", err)
+	}
+	if s.Tail != "" && s.Tail != "all" {
+		if n, err := strconv.Atoi(s.Tail); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid tail %q", s.Tail)
+		}
+	}
+	return f, nil
+}
+
+// Since renvoie le début de la fenêtre (zéro si absent)
+func (f *Filter) Since() time.Time {
+	if f == nil {
+		return time.Time{}
+	}
+	return f.since
+}
+
+// Until renvoie la fin de la fenêtre (zéro si absente)
+func (f *Filter) Until() time.Time {
+	if f == nil {
+		return time.Time{}
+	}
+	return f.until
+}
+
+// Match indique si la ligne passe le filtre
+func (f *Filter) Match(line Line) bool {
+	if f == nil {
+		return true
+	}
+	if f.Spec.Stream != "" && line.Stream != f.Spec.Stream {
+		return false
+	}
+	if !line.Timestamp.IsZero() {
+		if !f.since.IsZero() && line.Timestamp.Before(f.since) {
+			return false
+		}
+		if !f.until.IsZero() && line.Timestamp.After(f.until) {
+			return false
+		}
+	}
+	if f.include != nil && !f.include.MatchString(line.Message) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(line.Message) {
+		return false
+	}
+	if f.level > 0 && levelRank[DetectLevel(line.Message)] < f.level {
+		return false
+	}
+	return true
+}
+
+// ParseTime lit une date RFC 3339, un timestamp Unix (secondes, éventuellement
+// décimales) ou une durée relative à now. Une valeur vide donne le temps zéro.
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if t, ok := parseUnix(value); ok {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date, a Unix timestamp or a duration", value)
+}
+
+// parseUnix lit un horodatage Unix en secondes, la partie décimale est lue
+// en entier pour garder la précision à la nanoseconde (un float64 la perd).
+func parseUnix(value string) (time.Time, bool) {
+	secPart, fracPart, _ := strings.Cut(value, ".")
+	secs, err := strconv.ParseInt(secPart, 10, 64)
+	if err != nil || len(fracPart) > 9 || strings.ContainsAny(fracPart, "+-") {
+		return time.Time{}, false
+	}
+	var nanos int64
+	if fracPart != "" {
+		if nanos, err = strconv.ParseInt(fracPart+strings.Repeat("0", 9-len(fracPart)), 10, 64); err != nil {
+			return time.Time{}, false
+		}
+		if strings.HasPrefix(secPart, "-") {
+			nanos = -nanos
+		}
+	}
+	return time.Unix(secs, nanos), true
+}
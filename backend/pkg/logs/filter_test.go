@@ -0,0 +1,153 @@
+package logs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectLevel(t *testing.T) {
+	for _, tc := range []struct {
+		message, want string
+	}{
+		{`time=2024-01-01 level=error msg="boom"`, LevelError},
+		{`lvl=WARN msg=slow`, LevelWarn},
+		{`{"level":"info","msg":"ready"}`, LevelInfo},
+		{`{"severity": "debug"}`, LevelDebug},
+		{`[ERROR] connection refused`, LevelError},
+		{`2024-01-01 WARNING disk almost full`, LevelWarn},
+		{`FATAL: out of memory`, LevelError},
+		{`NOTICE: listening`, LevelInfo},
+		{`TRACE entering handler`, LevelDebug},
+		{`E0101 12:00:00.000000 1 main.go:10] failed`, LevelError},
+		{`I0101 12:00:00.000000 1 main.go:10] started`, LevelInfo},
+		// Une clé au niveau inconnu laisse la place aux mots en majuscules
+		{`level=verbose ERROR later`, LevelError},
+		// Les mots doivent être isolés et en majuscules
+		{`no errors found`, ""},
+		{`TERRORIST`, ""},
+		{`Error: lowercase word`, ""},
+		{``, ""},
+	} {
+		if got := DetectLevel(tc.message); got != tc.want {
+			t.Errorf("DetectLevel(%q) = %q, want %q", tc.message, got, tc.want)
+		}
+	}
+}
+
+func TestFilterSpecCompile(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name  string
+		spec  FilterSpec
+		err   string
+		since time.Time
+		until time.Time
+	}{
+		{name: "empty", spec: FilterSpec{}},
+		{name: "all filters", spec: FilterSpec{Include: "err|warn", Exclude: "^health", Level: "WARNING", Stream: StreamStderr, Tail: "100"}},
+		{name: "tail all", spec: FilterSpec{Tail: "all"}},
+		{name: "relative since", spec: FilterSpec{Since: "15m"}, since: now.Add(-15 * time.Minute)},
+		{name: "RFC 3339 window", spec: FilterSpec{Since: "2024-01-01T10:00:00Z", Until: "2024-01-01T11:00:00.5+01:00"},
+			since: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), until: time.Date(2024, 1, 1, 10, 0, 0, 500000000, time.UTC)},
+		{name: "Unix timestamp", spec: FilterSpec{Since: "1704067200", Until: "1704067200.25"},
+			since: time.Unix(1704067200, 0), until: time.Unix(1704067200, 250000000)},
+		{name: "invalid include", spec: FilterSpec{Include: "(unclosed"}, err: "invalid include pattern"},
+		{name: "invalid exclude", spec: FilterSpec{Exclude: "a**"}, err: "invalid exclude pattern"},
+		{name: "invalid level", spec: FilterSpec{Level: "loud"}, err: `invalid level "loud"`},
+		{name: "invalid stream", spec: FilterSpec{Stream: "stdin"}, err: `invalid stream "stdin"`},
+		{name: "invalid since", spec: FilterSpec{Since: "yesterday"}, err: `invalid since: "yesterday" is not a date`},
+		{name: "invalid until", spec: FilterSpec{Until: "2024-13-01"}, err: "invalid until"},
+		{name: "negative tail", spec: FilterSpec{Tail: "-1"}, err: `invalid tail "-1"`},
+		{name: "invalid tail", spec: FilterSpec{Tail: "last"}, err: `invalid tail "last"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := tc.spec.Compile(now)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !f.Since().Equal(tc.since) || !f.Until().Equal(tc.until) {
+				t.Errorf("since, until = %s, %s, want %s, %s", f.Since(), f.Until(), tc.since, tc.until)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	line := func(stream, message string, seconds int) Line {
+		return Line{Stream: stream, Message: message, Timestamp: base.Add(time.Duration(seconds) * time.Second)}
+	}
+	for _, tc := range []struct {
+		name string
+		spec FilterSpec
+		line Line
+		want bool
+	}{
+		{"no filter", FilterSpec{}, line(StreamStdout, "anything", 0), true},
+		{"include", FilterSpec{Include: "time(out)?"}, line(StreamStdout, "request timeout", 0), true},
+		{"include misses", FilterSpec{Include: "^timeout"}, line(StreamStdout, "request timeout", 0), false},
+		{"exclude", FilterSpec{Exclude: "GET /health"}, line(StreamStdout, "GET /health 200", 0), false},
+		{"include and exclude", FilterSpec{Include: "GET", Exclude: "/health"}, line(StreamStdout, "GET /api 200", 0), true},
+		{"stream", FilterSpec{Stream: StreamStderr}, line(StreamStdout, "boom", 0), false},
+		{"level above the minimum", FilterSpec{Level: "warn"}, line(StreamStdout, "level=error boom", 0), true},
+		{"level at the minimum", FilterSpec{Level: "warn"}, line(StreamStdout, "WARN slow", 0), true},
+		{"level below the minimum", FilterSpec{Level: "warn"}, line(StreamStdout, "INFO ready", 0), false},
+		{"no level detected", FilterSpec{Level: "debug"}, line(StreamStdout, "ready", 0), false},
+		{"since is inclusive", FilterSpec{Since: "2024-01-01T12:00:00Z"}, line(StreamStdout, "x", 0), true},
+		{"before since", FilterSpec{Since: "2024-01-01T12:00:01Z"}, line(StreamStdout, "x", 0), false},
+		{"until is inclusive", FilterSpec{Until: "2024-01-01T12:00:05Z"}, line(StreamStdout, "x", 5), true},
+		{"after until", FilterSpec{Until: "2024-01-01T12:00:05Z"}, line(StreamStdout, "x", 6), false},
+		// Sans horodatage, la fenêtre ne peut pas être vérifiée
+		{"no timestamp", FilterSpec{Since: "2024-01-01T12:00:01Z"}, Line{Stream: StreamStdout, Message: "x"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := tc.spec.Compile(base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.Match(tc.line); got != tc.want {
+				t.Errorf("match = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	var nilFilter *Filter
+	if !nilFilter.Match(line(StreamStderr, "x", 0)) || !nilFilter.Since().IsZero() || !nilFilter.Until().IsZero() {
+		t.Error("a nil filter must accept every line")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value string
+		want  time.Time
+		err   bool
+	}{
+		{"", time.Time{}, false},
+		{"2024-01-01T10:30:00Z", time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC), false},
+		{"2024-01-01T10:30:00.123456789Z", time.Date(2024, 1, 1, 10, 30, 0, 123456789, time.UTC), false},
+		{"1704067200", time.Unix(1704067200, 0), false},
+		{"1704067200.5", time.Unix(1704067200, 500000000), false},
+		{"1704067200.000000001", time.Unix(1704067200, 1), false},
+		{"-1.5", time.Unix(-2, 500000000), false},
+		{"1704067200.-5", time.Time{}, true},
+		{"1704067200.1234567891", time.Time{}, true},
+		{"90s", now.Add(-90 * time.Second), false},
+		{"1h30m", now.Add(-90 * time.Minute), false},
+		{"2024-01-01", time.Time{}, true},
+		{"tomorrow", time.Time{}, true},
+	} {
+		got, err := ParseTime(tc.value, now)
+		if (err != nil) != tc.err || !got.Equal(tc.want) {
+			t.Errorf("ParseTime(%q) = %s, %v, want %s", tc.value, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package logs
+
+import (
+	"container/heap"
+	"errors"
+	"io"
+)
+
+// Source fournit des lignes jusqu'à io.EOF, comme Decoder
+type Source interface {
+	Next() (Line, error)
+}
+
+// Merger fusionne plusieurs sources triées par horodatage en un seul flux trié.
+// Chaque source n'est lue qu'au fur et à mesure : la fusion ne charge qu'une
+// ligne par source en mémoire. Les logs d'un service entrelacent ceux de ses
+// tâches dans l'ordre d'arrivée : ils doivent passer par Reorder avant la fusion.
+type Merger struct {
+	sources []Source
+	heads   []*Line
+	started bool
+	err     error
+}
+
+// Merge crée la fusion des sources
+func Merge(sources ...Source) *Merger {
+	return &Merger{sources: sources, heads: make([]*Line, len(sources))}
+}
+
+// Next renvoie la plus ancienne ligne des sources, ou io.EOF quand toutes sont
+// épuisées. Les lignes sans horodatage passent en premier ; à égalité, l'ordre
+// des sources est conservé.
+func (m *Merger) Next() (Line, error) {
+	if !m.started {
+		m.started = true
+		for i := range m.sources {
+			m.advance(i)
+		}
+	}
+	if m.err != nil {
+		return Line{}, m.err
+	}
+
+	next := -1
+	for i, head := range m.heads {
+		if head == nil {
+			continue
+		}
+		if next < 0 || head.Timestamp.Before(m.heads[next].Timestamp) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return Line{}, io.EOF
+	}
+	line := *m.heads[next]
+	m.advance(next)
+	return line, nil
+}
+
+// advance lit la ligne suivante de la source i ; une erreur autre que io.EOF
+// est renvoyée à l'appel suivant de Next
+func (m *Merger) advance(i int) {
+	line, err := m.sources[i].Next()
+	if err != nil {
+		m.heads[i] = nil
+		if !errors.Is(err, io.EOF) && m.err == nil {
+			m.err = err
+		}
+		return
+	}
+	m.heads[i] = &line
+}
+
+// Reorder trie les lignes d'une source presque triée, comme les logs d'un
+// service dont le daemon entrelace les tâches dans l'ordre d'arrivée. Au plus
+// window lignes sont retenues : une ligne en retard de plus de window lignes
+// sur une ligne plus récente reste hors d'ordre.
+func Reorder(src Source, window int) Source {
+	return &reorderer{src: src, window: max(window, 1)}
+}
+
+type reorderer struct {
+	src    Source
+	window int
+	buf    lineHeap
+	seq    int
+	done   bool
+	err    error
+}
+
+func (r *reorderer) Next() (Line, error) {
+	for !r.done && len(r.buf) < r.window {
+		line, err := r.src.Next()
+		if err != nil {
+			r.done = true
+			if !errors.Is(err, io.EOF) {
+				r.err = err
+			}
+			break
+		}
+		heap.Push(&r.buf, bufferedLine{line: line, seq: r.seq})
+		r.seq++
+	}
+	if len(r.buf) == 0 {
+		if r.err != nil {
+			return Line{}, r.err
+		}
+		return Line{}, io.EOF
+	}
+	return heap.Pop(&r.buf).(bufferedLine).line, nil
+}
+
+// bufferedLine garde l'ordre d'arrivée pour départager les horodatages égaux
+type bufferedLine struct {
+	line Line
+	seq  int
+}
+
+type lineHeap []bufferedLine
+
+func (h lineHeap) Len() int { return len(h) }
+func (h lineHeap) Less(i, j int) bool {
+	if !h[i].line.Timestamp.Equal(h[j].line.Timestamp) {
+		return h[i].line.Timestamp.Before(h[j].line.Timestamp)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h lineHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *lineHeap) Push(x any)   { *h = append(*h, x.(bufferedLine)) }
+func (h *lineHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,103 @@
+package logs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sliceSource renvoie des lignes horodatées en secondes, dans l'ordre donné
+type sliceSource struct {
+	lines []Line
+	err   error
+}
+
+func lines(stream string, seconds ...int) *sliceSource {
+	src := &sliceSource{}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, s := range seconds {
+		src.lines = append(src.lines, Line{Timestamp: base.Add(time.Duration(s) * time.Second), Stream: stream})
+	}
+	return src
+}
+
+func (s *sliceSource) Next() (Line, error) {
+	if len(s.lines) == 0 {
+		if s.err != nil {
+			return Line{}, s.err
+		}
+		return Line{}, io.EOF
+	}
+	line := s.lines[0]
+	s.lines = s.lines[1:]
+	return line, nil
+}
+
+// order renvoie les lignes d'une source sous la forme "flux@seconde"
+func order(t *testing.T, src Source) (string, error) {
+	t.Helper()
+	var out []string
+	for {
+		line, err := src.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return strings.Join(out, " "), err
+		}
+		out = append(out, line.Stream+"@"+line.Timestamp.Format("05"))
+	}
+}
+
+func TestReorder(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		seconds []int
+		window  int
+		want    string
+	}{
+		{"sorted", []int{1, 2, 3}, 4, "a@01 a@02 a@03"},
+		{"interleaved tasks", []int{1, 4, 2, 5, 3, 6}, 4, "a@01 a@02 a@03 a@04 a@05 a@06"},
+		{"one task then the other", []int{3, 4, 5, 1, 2}, 8, "a@01 a@02 a@03 a@04 a@05"},
+		{"late beyond the window", []int{3, 4, 5, 1}, 2, "a@03 a@04 a@01 a@05"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := order(t, Reorder(lines("a", tc.seconds...), tc.window))
+			if err != nil || got != tc.want {
+				t.Errorf("got %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReorderKeepsArrivalOrderOnTies(t *testing.T) {
+	src := &sliceSource{}
+	for _, stream := range []string{"first", "second", "third"} {
+		src.lines = append(src.lines, Line{Stream: stream})
+	}
+	got, _ := order(t, Reorder(src, 10))
+	if got != "first@00 second@00 third@00" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestReorderReturnsSourceErrorLast(t *testing.T) {
+	src := lines("a", 2, 1)
+	src.err = errors.New("connection reset")
+	got, err := order(t, Reorder(src, 10))
+	if got != "a@01 a@02" || err == nil || err.Error() != "connection reset" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestMergeReorderedSources(t *testing.T) {
+	got, err := order(t, Merge(
+		Reorder(lines("web", 1, 5, 3), 10),
+		Reorder(lines("db", 4, 2), 10),
+	))
+	if want := "web@01 db@02 web@03 db@04 web@05"; err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+}
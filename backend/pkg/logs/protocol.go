@@ -0,0 +1,64 @@
+package logs
+
+// Protocol est le sous-protocole WebSocket (Sec-WebSocket-Protocol) des flux de
+// logs en JSON. Un client qui ne le demande pas reçoit l'ancien format texte.
+const Protocol = "swarm-manager.logs.v1"
+
+// TimestampLayout est le format des horodatages Docker (nanosecondes sur 9 chiffres)
+const TimestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// Types des messages du protocole
+const (
+	// Une ligne de log
+	TypeLog = "log"
+	// Erreur sur le flux d'un service (ou de la connexion si service est vide)
+	TypeError = "error"
+	// Fin du flux d'un service ; la connexion reste ouverte
+	TypeEOF = "eof"
+	// Lignes écartées faute de place dans le tampon de la connexion
+	TypeDropped = "dropped"
+	// Filtres actifs, en réponse à une commande filter
+	TypeFilter = "filter"
+)
+
+// Message est un message JSON du protocole Protocol, envoyé seul dans une trame
+// texte. Les champs vides sont omis.
+type Message struct {
+	Type      string `json:"type"`
+	Service   string `json:"service,omitempty"`
+	ServiceID string `json:"service_id,omitempty"`
+	Task      string `json:"task,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Stream    string `json:"stream,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Message   string `json:"message,omitempty"`
+	// Nombre de lignes écartées (type dropped)
+	Count uint64 `json:"count,omitempty"`
+	// Filtres actifs (type filter)
+	Filter *FilterSpec `json:"filter,omitempty"`
+}
+
+// Command est une commande envoyée par le client sur une WebSocket de logs, en
+// JSON quel que soit le protocole. {"type": "filter", ...} remplace tous les
+// filtres de la connexion.
+type Command struct {
+	Type string `json:"type"`
+	FilterSpec
+}
+
+// LogMessage convertit une ligne décodée en message de type log
+func LogMessage(line Line) Message {
+	msg := Message{
+		Type:      TypeLog,
+		Service:   line.Service,
+		ServiceID: line.ServiceID,
+		Task:      line.TaskID,
+		Node:      line.NodeID,
+		Stream:    line.Stream,
+		Message:   line.Message,
+	}
+	if !line.Timestamp.IsZero() {
+		msg.Timestamp = line.Timestamp.Format(TimestampLayout)
+	}
+	return msg
+}
@@ -0,0 +1,80 @@
+package logs
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLogMessage(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		line Line
+		want string
+	}{
+		{
+			name: "full line",
+			line: Line{
+				Timestamp: time.Date(2024, 1, 1, 0, 0, 1, 500000000, time.UTC),
+				Stream:    StreamStderr, Service: "web_api", ServiceID: "s1", TaskID: "t1", NodeID: "n1",
+				Message: "boom",
+			},
+			// Horodatage sur 9 chiffres, comme Docker
+			want: `{"type":"log","service":"web_api","service_id":"s1","task":"t1","node":"n1","stream":"stderr","timestamp":"2024-01-01T00:00:01.500000000Z","message":"boom"}`,
+		},
+		{
+			name: "no timestamp nor task",
+			line: Line{Stream: StreamStdout, Service: "web_api", Message: "ready"},
+			want: `{"type":"log","service":"web_api","stream":"stdout","message":"ready"}`,
+		},
+		{
+			name: "empty message",
+			line: Line{Stream: StreamStdout},
+			want: `{"type":"log","stream":"stdout"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(LogMessage(tc.line))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.want {
+				t.Errorf("got %s, want %s", data, tc.want)
+			}
+		})
+	}
+}
+
+func TestControlMessages(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{"eof", Message{Type: TypeEOF, Service: "web_api", ServiceID: "s1"}, `{"type":"eof","service":"web_api","service_id":"s1"}`},
+		{"service error", Message{Type: TypeError, Service: "web_api", ServiceID: "s1", Message: "EOF"}, `{"type":"error","service":"web_api","service_id":"s1","message":"EOF"}`},
+		{"connection error", Message{Type: TypeError, Message: "not found"}, `{"type":"error","message":"not found"}`},
+		{"dropped", Message{Type: TypeDropped, Service: "web_api", ServiceID: "s1", Count: 12}, `{"type":"dropped","service":"web_api","service_id":"s1","count":12}`},
+		{"filter", Message{Type: TypeFilter, Filter: &FilterSpec{Level: "warn", Tail: "10"}}, `{"type":"filter","filter":{"level":"warn","tail":"10"}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.want {
+				t.Errorf("got %s, want %s", data, tc.want)
+			}
+		})
+	}
+}
+
+func TestCommandDecoding(t *testing.T) {
+	var cmd Command
+	if err := json.Unmarshal([]byte(`{"type":"filter","include":"err","level":"warn","tail":"all"}`), &cmd); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Type != TypeFilter || cmd.Include != "err" || cmd.Level != "warn" || cmd.Tail != "all" {
+		t.Errorf("command = %+v", cmd)
+	}
+}
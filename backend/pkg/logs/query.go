@@ -0,0 +1,157 @@
+package logs
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSearchLimit = 500
+	maxSearchLimit     = 5000
+)
+
+// Query est une recherche dans l'historique des logs
+type Query struct {
+	// Mots ou phrases que le message doit tous contenir, sans tenir compte de la casse
+	Terms []string
+	// Service (nom ou ID), tâche et node (ID ou préfixe d'ID)
+	Service string
+	Task    string
+	Node    string
+	// Filtres communs aux flux de logs : include, exclude, level, stream, since, until
+	Filter *Filter
+	Limit  int
+}
+
+// ParseQuery lit une recherche textuelle : les mots "champ:valeur" filtrent
+// sur service, task, node, stream ou level, les autres mots (ou "phrases entre
+// guillemets") doivent apparaître dans le message. Les champs stream et level
+// complètent spec.
+func ParseQuery(text string, spec FilterSpec, now time.Time) (Query, error) {
+	var q Query
+	for _, token := range splitQuery(text) {
+		field, value, ok := strings.Cut(token, ":")
+		if !ok || value == "" {
+			q.Terms = append(q.Terms, strings.ToLower(token))
+			continue
+		}
+		switch field {
+		case "service":
+			q.Service = value
+		case "task":
+			q.Task = value
+		case "node":
+			q.Node = value
+		case "stream":
+			spec.Stream = value
+		case "level":
+			spec.Level = value
+		default:
+			// "http://..." ou "erreur: ..." restent des mots du message
+			q.Terms = append(q.Terms, strings.ToLower(token))
+		}
+	}
+	filter, err := spec.Compile(now)
+	if err != nil {
+		return q, err
+	}
+	q.Filter = filter
+	return q, nil
+}
+
+// Match indique si la ligne correspond à la requête
+func (q Query) Match(line Line) bool {
+	if q.Service != "" && line.Service != q.Service && line.ServiceID != q.Service {
+		return false
+	}
+	if q.Task != "" && !strings.HasPrefix(line.TaskID, q.Task) {
+		return false
+	}
+	if q.Node != "" && !strings.HasPrefix(line.NodeID, q.Node) {
+		return false
+	}
+	if len(q.Terms) > 0 {
+		message := strings.ToLower(line.Message)
+		for _, term := range q.Terms {
+			if !strings.Contains(message, term) {
+				return false
+			}
+		}
+	}
+	return q.Filter.Match(line)
+}
+
+// splitQuery découpe la recherche en mots, en gardant ensemble les phrases
+// entre guillemets
+func splitQuery(text string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case (r == ' ' || r == '\t') && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// Search sert GET /api/logs/search : q (texte et champs), include, exclude,
+// level, stream, since, until et limit (500 par défaut)
+func (s *Store) Search(c echo.Context) error {
+	if s == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "log retention is disabled (set LOG_STORE_DIR)"})
+	}
+
+	spec := FilterSpec{
+		Include: c.QueryParam("include"),
+		Exclude: c.QueryParam("exclude"),
+		Level:   c.QueryParam("level"),
+		Stream:  c.QueryParam("stream"),
+		Since:   c.QueryParam("since"),
+		Until:   c.QueryParam("until"),
+	}
+	q, err := ParseQuery(c.QueryParam("q"), spec, time.Now())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if v := c.QueryParam("service"); v != "" {
+		q.Service = v
+	}
+	q.Limit = defaultSearchLimit
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		q.Limit = min(limit, maxSearchLimit)
+	}
+
+	lines, truncated, err := s.Query(q)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("search failed: %v", err)})
+	}
+	if lines == nil {
+		lines = []Line{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"lines":     lines,
+		"count":     len(lines),
+		"truncated": truncated,
+	})
+}
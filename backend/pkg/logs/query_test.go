@@ -0,0 +1,85 @@
+package logs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name    string
+		text    string
+		spec    FilterSpec
+		terms   string
+		service string
+		task    string
+		node    string
+		stream  string
+		level   string
+		err     string
+	}{
+		{name: "words", text: "Timeout  upstream", terms: "timeout|upstream"},
+		{name: "phrase", text: `"connection refused" db`, terms: "connection refused|db"},
+		{name: "fields", text: "service:api task:t1 node:n1 stream:stderr level:warn boom", terms: "boom", service: "api", task: "t1", node: "n1", stream: StreamStderr, level: "warn"},
+		{name: "unknown field stays a word", text: "http://api:8080 erreur: x", terms: "http://api:8080|erreur:|x"},
+		{name: "empty value stays a word", text: "service:", terms: "service:"},
+		{name: "field overrides spec", text: "level:error", spec: FilterSpec{Level: "info", Stream: StreamStdout}, stream: StreamStdout, level: "error"},
+		{name: "empty", text: "", spec: FilterSpec{Level: "warn"}, level: "warn"},
+		{name: "invalid level", text: "level:loud", err: `invalid level "loud"`},
+		{name: "invalid stream", text: "stream:stdin", err: `invalid stream "stdin"`},
+		{name: "invalid since", text: "boom", spec: FilterSpec{Since: "yesterday"}, err: "invalid since"},
+		{name: "invalid include", text: "boom", spec: FilterSpec{Include: "("}, err: "invalid include pattern"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := ParseQuery(tc.text, tc.spec, now)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(q.Terms, "|"); got != tc.terms {
+				t.Errorf("terms = %q, want %q", got, tc.terms)
+			}
+			if q.Service != tc.service || q.Task != tc.task || q.Node != tc.node {
+				t.Errorf("service, task, node = %q, %q, %q", q.Service, q.Task, q.Node)
+			}
+			if q.Filter.Spec.Stream != tc.stream || q.Filter.Spec.Level != tc.level {
+				t.Errorf("stream, level = %q, %q, want %q, %q", q.Filter.Spec.Stream, q.Filter.Spec.Level, tc.stream, tc.level)
+			}
+		})
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	line := Line{Stream: StreamStderr, Service: "web_api", ServiceID: "svc123", TaskID: "task456", NodeID: "node789", Message: "ERROR Connection refused by db"}
+	for _, tc := range []struct {
+		text string
+		want bool
+	}{
+		{"", true},
+		{"connection REFUSED", true},
+		{`"refused by db"`, true},
+		{`"db by refused"`, false},
+		{"service:web_api", true},
+		{"service:svc123", true},
+		{"service:web", false},
+		{"task:task4 node:node7", true},
+		{"node:789", false},
+		{"level:error stream:stderr", true},
+		{"stream:stdout", false},
+	} {
+		q, err := ParseQuery(tc.text, FilterSpec{}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := q.Match(line); got != tc.want {
+			t.Errorf("%q: match = %v, want %v", tc.text, got, tc.want)
+		}
+	}
+}
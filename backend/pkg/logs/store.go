@@ -0,0 +1,244 @@
+package logs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".ndjson"
+
+	defaultSegmentBytes = 16 << 20
+	defaultSegmentAge   = time.Hour
+)
+
+// StoreOptions règle la rétention du stockage des logs. Les valeurs nulles
+// désactivent la limite correspondante.
+type StoreOptions struct {
+	// Taille totale maximale des segments, en octets
+	MaxBytes int64
+	// Âge maximal d'un segment, à partir de sa dernière ligne
+	MaxAge time.Duration
+	// Taille et durée d'un segment avant d'en ouvrir un nouveau
+	SegmentBytes int64
+	SegmentAge   time.Duration
+}
+
+// segment est un fichier de lignes en JSON ; il couvre la période entre son
+// ouverture et l'ouverture du suivant
+type segment struct {
+	path  string
+	start time.Time
+	size  int64
+}
+
+// Store conserve les lignes de logs sur disque dans des segments NDJSON
+// uniquement en ajout. Les segments les plus anciens sont supprimés pour
+// respecter la taille et l'âge maximaux.
+type Store struct {
+	mu       sync.Mutex
+	dir      string
+	opts     StoreOptions
+	segments []segment
+	active   *os.File
+}
+
+// OpenStore ouvre (ou crée) le stockage dans dir et démarre un nouveau segment
+func OpenStore(dir string, opts StoreOptions) (*Store, error) {
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	if opts.SegmentAge <= 0 {
+		opts.SegmentAge = defaultSegmentAge
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, opts: opts}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, segment{path: filepath.Join(dir, name), start: time.Unix(0, nanos), size: info.Size()})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].start.Before(s.segments[j].start) })
+
+	if err := s.roll(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append ajoute des lignes au segment courant, en ouvrant un nouveau segment
+// si le courant est plein ou trop ancien
+func (s *Store) Append(lines []Line) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, line := range lines {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	current := &s.segments[len(s.segments)-1]
+	if current.size > 0 && (current.size+int64(len(buf)) > s.opts.SegmentBytes || now.Sub(current.start) > s.opts.SegmentAge) {
+		if err := s.roll(now); err != nil {
+			return err
+		}
+		current = &s.segments[len(s.segments)-1]
+	}
+	n, err := s.active.Write(buf)
+	current.size += int64(n)
+	return err
+}
+
+// Prune supprime les segments au-delà de la taille ou de l'âge maximal. Le
+// segment courant n'est jamais supprimé.
+func (s *Store) Prune(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	var firstErr error
+	for len(s.segments) > 1 {
+		oldest := s.segments[0]
+		// Un segment se termine à l'ouverture du suivant
+		expired := s.opts.MaxAge > 0 && now.Sub(s.segments[1].start) > s.opts.MaxAge
+		oversize := s.opts.MaxBytes > 0 && total > s.opts.MaxBytes
+		if !expired && !oversize {
+			break
+		}
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+		total -= oldest.size
+		s.segments = s.segments[1:]
+	}
+	return firstErr
+}
+
+// Size renvoie la taille totale des segments, en octets
+func (s *Store) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	return total
+}
+
+// Query renvoie les lignes correspondant à la requête dans l'ordre
+// chronologique. Au-delà de q.Limit, seules les plus récentes sont gardées et
+// truncated vaut true.
+func (s *Store) Query(q Query) (lines []Line, truncated bool, err error) {
+	s.mu.Lock()
+	segments := append([]segment(nil), s.segments...)
+	s.mu.Unlock()
+
+	since, until := q.Filter.Since(), q.Filter.Until()
+	// Parcourir les segments du plus récent au plus ancien pour s'arrêter à la limite
+	for i := len(segments) - 1; i >= 0; i-- {
+		if !until.IsZero() && segments[i].start.After(until) {
+			continue
+		}
+		if !since.IsZero() && i+1 < len(segments) && segments[i+1].start.Before(since) {
+			break
+		}
+		matches, err := q.scan(segments[i].path)
+		if err != nil {
+			return nil, false, err
+		}
+		// Les lignes plus récentes déjà trouvées passent après celles de ce segment
+		lines = append(matches, lines...)
+		if q.Limit > 0 && len(lines) > q.Limit {
+			return lines[len(lines)-q.Limit:], true, nil
+		}
+	}
+	return lines, false, nil
+}
+
+// Close ferme le segment courant
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active.Close()
+}
+
+// roll ferme le segment courant et en ouvre un nouveau
+func (s *Store) roll(now time.Time) error {
+	path := filepath.Join(s.dir, fmt.Sprintf("%s%d%s", segmentPrefix, now.UnixNano(), segmentSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if s.active != nil {
+		s.active.Close()
+	}
+	s.active = f
+	s.segments = append(s.segments, segment{path: path, start: now})
+	return nil
+}
+
+// scan lit un segment et renvoie ses lignes correspondant à la requête
+func (q Query) scan(path string) ([]Line, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Supprimé par la rétention pendant la recherche
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []Line
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 2*maxLineSize)
+	for scanner.Scan() {
+		var line Line
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			// Ligne tronquée par un arrêt brutal : on l'ignore
+			continue
+		}
+		if q.Match(line) {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
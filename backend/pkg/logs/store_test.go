@@ -0,0 +1,205 @@
+package logs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var storeBase = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// at renvoie l'instant storeBase + minutes
+func at(minutes int) time.Time {
+	return storeBase.Add(time.Duration(minutes) * time.Minute)
+}
+
+// writeSegment crée un segment ouvert à start contenant une ligne par minute
+// donnée, avec la minute pour message
+func writeSegment(t *testing.T, dir string, start time.Time, minutes ...int) {
+	t.Helper()
+	var buf []byte
+	for _, m := range minutes {
+		data, err := json.Marshal(Line{Timestamp: at(m), Stream: StreamStdout, Service: "api", Message: fmt.Sprint(m)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf = append(append(buf, data...), '\n')
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s%d%s", segmentPrefix, start.UnixNano(), segmentSuffix))
+	if err := os.WriteFile(path, buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func openStore(t *testing.T, dir string, opts StoreOptions) *Store {
+	t.Helper()
+	s, err := OpenStore(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// messages renvoie les messages des lignes séparés par des espaces
+func messages(lines []Line) string {
+	var out []string
+	for _, line := range lines {
+		out = append(out, line.Message)
+	}
+	return strings.Join(out, " ")
+}
+
+func segmentFiles(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestStoreAppendRollsSegments(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir, StoreOptions{SegmentBytes: 150})
+
+	for i := 0; i < 3; i++ {
+		line := Line{Timestamp: at(i), Stream: StreamStdout, Service: "api", Message: fmt.Sprint(i)}
+		if err := s.Append([]Line{line}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Append(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Une ligne fait environ 100 octets : chaque ajout ouvre un segment, sauf le
+	// premier qui remplit le segment vide
+	if n := segmentFiles(t, dir); n != 3 {
+		t.Errorf("got %d segments, want 3", n)
+	}
+	var size int64
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		info, _ := e.Info()
+		size += info.Size()
+	}
+	if s.Size() != size {
+		t.Errorf("Size() = %d, want %d", s.Size(), size)
+	}
+	lines, truncated, err := s.Query(Query{})
+	if err != nil || truncated || messages(lines) != "0 1 2" {
+		t.Errorf("query = %q, %v, %v, want the three lines in order", messages(lines), truncated, err)
+	}
+
+	// Les segments existants sont repris à la réouverture
+	s.Close()
+	s = openStore(t, dir, StoreOptions{SegmentBytes: 150})
+	if lines, _, _ := s.Query(Query{}); messages(lines) != "0 1 2" {
+		t.Errorf("after reopen = %q", messages(lines))
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts StoreOptions
+		now  time.Time
+		want string
+	}{
+		{"no limit", StoreOptions{}, at(600), "0 60 120"},
+		// Un segment expire à l'ouverture du suivant : celui de 60 se termine à
+		// 120, exactement MaxAge avant now, et reste
+		{"age", StoreOptions{MaxAge: time.Hour}, at(180), "60 120"},
+		{"age boundary", StoreOptions{MaxAge: time.Hour}, at(181), "120"},
+		{"size", StoreOptions{MaxBytes: 150}, at(0), "120"},
+		// Le segment courant n'est jamais supprimé
+		{"all expired", StoreOptions{MaxAge: time.Minute}, time.Now().Add(time.Hour), ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeSegment(t, dir, at(0), 0)
+			writeSegment(t, dir, at(60), 60)
+			writeSegment(t, dir, at(120), 120)
+			s := openStore(t, dir, tc.opts)
+
+			if err := s.Prune(tc.now); err != nil {
+				t.Fatal(err)
+			}
+			lines, _, err := s.Query(Query{})
+			if err != nil || messages(lines) != tc.want {
+				t.Errorf("lines = %q, %v, want %q", messages(lines), err, tc.want)
+			}
+			if n, want := segmentFiles(t, dir), len(strings.Fields(tc.want))+1; n != want {
+				t.Errorf("got %d segment files, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestStoreQuery(t *testing.T) {
+	dir := t.TempDir()
+	writeSegment(t, dir, at(0), 0, 10, 20)
+	writeSegment(t, dir, at(30), 30, 40, 50)
+	writeSegment(t, dir, at(60), 60, 70)
+	s := openStore(t, dir, StoreOptions{})
+
+	for _, tc := range []struct {
+		name         string
+		since, until time.Time
+		limit        int
+		want         string
+		truncated    bool
+	}{
+		{"everything", time.Time{}, time.Time{}, 0, "0 10 20 30 40 50 60 70", false},
+		{"since is inclusive", at(30), time.Time{}, 0, "30 40 50 60 70", false},
+		{"since inside a segment", at(15), time.Time{}, 0, "20 30 40 50 60 70", false},
+		{"until is inclusive", time.Time{}, at(40), 0, "0 10 20 30 40", false},
+		{"until at a segment start", time.Time{}, at(60), 0, "0 10 20 30 40 50 60", false},
+		{"window", at(10), at(50), 0, "10 20 30 40 50", false},
+		{"limit keeps the newest", time.Time{}, time.Time{}, 4, "40 50 60 70", true},
+		{"limit across segments", at(10), time.Time{}, 6, "20 30 40 50 60 70", true},
+		{"limit not reached", at(60), time.Time{}, 2, "60 70", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := FilterSpec{}
+			if !tc.since.IsZero() {
+				spec.Since = tc.since.Format(time.RFC3339Nano)
+			}
+			if !tc.until.IsZero() {
+				spec.Until = tc.until.Format(time.RFC3339Nano)
+			}
+			filter, err := spec.Compile(storeBase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines, truncated, err := s.Query(Query{Filter: filter, Limit: tc.limit})
+			if err != nil || messages(lines) != tc.want || truncated != tc.truncated {
+				t.Errorf("lines = %q, truncated = %v, %v, want %q, %v", messages(lines), truncated, err, tc.want, tc.truncated)
+			}
+		})
+	}
+}
+
+func TestStoreQuerySkipsTruncatedLines(t *testing.T) {
+	dir := t.TempDir()
+	writeSegment(t, dir, at(0), 0, 10)
+	path := filepath.Join(dir, fmt.Sprintf("%s%d%s", segmentPrefix, at(0).UnixNano(), segmentSuffix))
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Arrêt brutal au milieu d'une écriture
+	f.WriteString(`{"timestamp":"2024-01-01T00:20:00Z","mess`)
+	f.Close()
+	s := openStore(t, dir, StoreOptions{})
+
+	lines, _, err := s.Query(Query{})
+	if err != nil || messages(lines) != "0 10" {
+		t.Errorf("lines = %q, %v, want the complete lines", messages(lines), err)
+	}
+}
@@ -0,0 +1,244 @@
+// Package metrics expose l'état du swarm et celui du manager au format texte
+// de Prometheus.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+)
+
+const (
+	namespace = "swarm_manager"
+	// Durée maximale des appels Docker faits pendant une collecte
+	scrapeTimeout = 10 * time.Second
+	// Type de contenu du format texte de Prometheus
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+	// DiskUsage parcourt toutes les images et tous les volumes du daemon : il
+	// n'est pas rappelé à chaque collecte
+	diskUsageInterval = 5 * time.Minute
+)
+
+// Bornes des histogrammes de latence, en secondes (celles du client Prometheus)
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Types de WebSockets de logs comptés par TrackLogStream
+const (
+	LogStreamService = "service"
+	LogStreamSwarm   = "swarm"
+)
+
+type requestKey struct {
+	method string
+	route  string
+	code   string
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Registry collecte les métriques du manager (requêtes HTTP, WebSockets de
+// logs) et interroge Docker à chaque collecte pour l'état du swarm
+type Registry struct {
+	api infra.DockerAPI
+
+	mu       sync.Mutex
+	requests map[requestKey]*histogram
+
+	// Dernière mesure de l'espace disque du manager, rafraîchie toutes les
+	// diskInterval
+	diskMu       sync.Mutex
+	disk         *diskSnapshot
+	diskInterval time.Duration
+
+	serviceLogStreams atomic.Int64
+	swarmLogStreams   atomic.Int64
+}
+
+// New crée un registre ; Handler sert GET /metrics
+func New(api infra.DockerAPI) *Registry {
+	return &Registry{
+		api:          api,
+		requests:     make(map[requestKey]*histogram),
+		diskInterval: diskUsageInterval,
+	}
+}
+
+// Middleware mesure la durée des requêtes par méthode, route et code de
+// statut. Les WebSockets et les flux SSE, qui durent toute la connexion, ne
+// sont pas mesurés.
+func (r *Registry) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if r == nil || websocket.IsWebSocketUpgrade(c.Request()) {
+				return next(c)
+			}
+
+			start := time.Now()
+			err := next(c)
+			if strings.HasPrefix(c.Response().Header().Get(echo.HeaderContentType), "text/event-stream") {
+				return err
+			}
+
+			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				// L'erreur sera écrite par le HTTPErrorHandler après ce middleware
+				status = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			r.observe(requestKey{method: c.Request().Method, route: route, code: strconv.Itoa(status)}, time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+func (r *Registry) observe(key requestKey, seconds float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.requests[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		r.requests[key] = h
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// TrackLogStream compte une WebSocket de logs ouverte (LogStreamService ou
+// LogStreamSwarm) ; la fonction renvoyée doit être appelée à sa fermeture
+func (r *Registry) TrackLogStream(kind string) (done func()) {
+	if r == nil {
+		return func() {}
+	}
+	gauge := &r.serviceLogStreams
+	if kind == LogStreamSwarm {
+		gauge = &r.swarmLogStreams
+	}
+	gauge.Add(1)
+	return func() { gauge.Add(-1) }
+}
+
+// Handler sert GET /metrics au format texte de Prometheus
+func (r *Registry) Handler(c echo.Context) error {
+	if r == nil || r.api == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "metrics are not initialized"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), scrapeTimeout)
+	defer cancel()
+
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().WriteHeader(http.StatusOK)
+	w := &writer{w: bufio.NewWriter(c.Response())}
+	r.writeSwarm(ctx, w, time.Now())
+	r.writeManager(w)
+	return w.w.Flush()
+}
+
+// writeManager écrit les métriques propres au manager
+func (r *Registry) writeManager(w *writer) {
+	w.header("log_streams", "gauge", "Open log WebSockets by kind.")
+	w.sample("log_streams", labels{"kind", LogStreamService}, float64(r.serviceLogStreams.Load()))
+	w.sample("log_streams", labels{"kind", LogStreamSwarm}, float64(r.swarmLogStreams.Load()))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]requestKey, 0, len(r.requests))
+	for key := range r.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+
+	w.header("http_request_duration_seconds", "histogram", "Duration of HTTP requests by method, route and status code.")
+	for _, key := range keys {
+		h := r.requests[key]
+		l := labels{"method", key.method, "route", key.route, "code", key.code}
+		for i, bound := range latencyBuckets {
+			w.sample("http_request_duration_seconds_bucket", append(l, "le", formatFloat(bound)), float64(h.counts[i]))
+		}
+		w.sample("http_request_duration_seconds_bucket", append(l, "le", "+Inf"), float64(h.count))
+		w.sample("http_request_duration_seconds_sum", l, h.sum)
+		w.sample("http_request_duration_seconds_count", l, float64(h.count))
+	}
+}
+
+// labels est une liste de paires nom, valeur
+type labels []string
+
+// writer écrit le format texte de Prometheus ; les noms sont préfixés par le
+// namespace
+type writer struct {
+	w *bufio.Writer
+}
+
+func (w *writer) header(name, typ, help string) {
+	fmt.Fprintf(w.w, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", namespace, name, help, namespace, name, typ)
+}
+
+func (w *writer) sample(name string, l labels, value float64) {
+	w.w.WriteString(namespace + "_" + name)
+	if len(l) > 0 {
+		w.w.WriteByte('{')
+		for i := 0; i+1 < len(l); i += 2 {
+			if i > 0 {
+				w.w.WriteByte(',')
+			}
+			w.w.WriteString(l[i] + `="` + escapeLabel(l[i+1]) + `"`)
+		}
+		w.w.WriteByte('}')
+	}
+	w.w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
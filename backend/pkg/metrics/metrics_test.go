@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// render renvoie ce que write écrit au format texte
+func render(write func(w *writer)) string {
+	var out strings.Builder
+	w := &writer{w: bufio.NewWriter(&out)}
+	write(w)
+	w.w.Flush()
+	return out.String()
+}
+
+func TestWriterFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		write func(w *writer)
+		want  string
+	}{
+		{"header", func(w *writer) { w.header("nodes", "gauge", "Swarm nodes.") },
+			"# HELP swarm_manager_nodes Swarm nodes.\n# TYPE swarm_manager_nodes gauge\n"},
+		{"no label", func(w *writer) { w.sample("docker_up", nil, 1) }, "swarm_manager_docker_up 1\n"},
+		{"labels", func(w *writer) { w.sample("tasks", labels{"stack", "web", "state", "running"}, 3) },
+			`swarm_manager_tasks{stack="web",state="running"} 3` + "\n"},
+		{"escaped label", func(w *writer) { w.sample("tasks", labels{"stack", "a\"b\\c\nd"}, 0) },
+			`swarm_manager_tasks{stack="a\"b\\c\nd"} 0` + "\n"},
+		{"float", func(w *writer) { w.sample("sum", nil, 0.25) }, "swarm_manager_sum 0.25\n"},
+		{"large", func(w *writer) { w.sample("bytes", nil, 1<<40) }, "swarm_manager_bytes 1.099511627776e+12\n"},
+		{"infinity", func(w *writer) { w.sample("bound", nil, math.Inf(1)) }, "swarm_manager_bound +Inf\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := render(tc.write); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareLabels(t *testing.T) {
+	r := New(nil)
+	e := echo.New()
+	e.Use(r.Middleware())
+	e.GET("/api/services/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	e.GET("/api/denied", func(c echo.Context) error { return echo.NewHTTPError(http.StatusForbidden) })
+	e.GET("/api/failed", func(c echo.Context) error { return errors.New("boom") })
+	e.GET("/api/events", func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/ws", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	for _, path := range []string{"/api/services/a", "/api/services/b", "/api/denied", "/api/failed", "/api/events", "/missing"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	ws := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	ws.Header.Set("Connection", "Upgrade")
+	ws.Header.Set("Upgrade", "websocket")
+	e.ServeHTTP(httptest.NewRecorder(), ws)
+
+	want := map[requestKey]uint64{
+		// Les paramètres de la route ne créent pas une série par valeur
+		{method: "GET", route: "/api/services/:id", code: "204"}: 2,
+		{method: "GET", route: "/api/denied", code: "403"}:       1,
+		{method: "GET", route: "/api/failed", code: "500"}:       1,
+		{method: "GET", route: "unmatched", code: "404"}:         1,
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, count := range want {
+		if h := r.requests[key]; h == nil || h.count != count {
+			t.Errorf("%+v: got %+v, want %d requests", key, h, count)
+		}
+	}
+	if len(r.requests) != len(want) {
+		t.Errorf("got series %v, want only %v (no SSE nor WebSocket)", r.requests, want)
+	}
+}
+
+func TestManagerHistogram(t *testing.T) {
+	r := New(nil)
+	r.observe(requestKey{method: "GET", route: "/api/nodes", code: "200"}, 0.03)
+	r.observe(requestKey{method: "GET", route: "/api/nodes", code: "200"}, 20)
+	done := r.TrackLogStream(LogStreamSwarm)
+	defer done()
+
+	got := render(r.writeManager)
+	for _, line := range []string{
+		`swarm_manager_log_streams{kind="service"} 0`,
+		`swarm_manager_log_streams{kind="swarm"} 1`,
+		`swarm_manager_http_request_duration_seconds_bucket{method="GET",route="/api/nodes",code="200",le="0.025"} 0`,
+		`swarm_manager_http_request_duration_seconds_bucket{method="GET",route="/api/nodes",code="200",le="0.05"} 1`,
+		`swarm_manager_http_request_duration_seconds_bucket{method="GET",route="/api/nodes",code="200",le="10"} 1`,
+		`swarm_manager_http_request_duration_seconds_bucket{method="GET",route="/api/nodes",code="200",le="+Inf"} 2`,
+		`swarm_manager_http_request_duration_seconds_sum{method="GET",route="/api/nodes",code="200"} 20.03`,
+		`swarm_manager_http_request_duration_seconds_count{method="GET",route="/api/nodes",code="200"} 2`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, got)
+		}
+	}
+}
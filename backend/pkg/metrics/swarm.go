@@ -0,0 +1,222 @@
+package metrics
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+const (
+	stackLabel = "com.docker.stack.namespace"
+	// Stack des services déployés hors stack, comme dans GET /api/stacks
+	unassignedStack = "unassigned"
+)
+
+// diskSnapshot est l'espace disque du daemon du manager à un instant donné
+type diskSnapshot struct {
+	usage    dockerTypes.DiskUsage
+	nodeID   string
+	hostname string
+	at       time.Time
+}
+
+// writeSwarm interroge Docker et écrit l'état du swarm. Une partie en échec
+// est omise et signalée par swarm_manager_docker_up à 0.
+func (r *Registry) writeSwarm(ctx context.Context, w *writer, now time.Time) {
+	up := 1.0
+
+	nodes, err := r.api.NodeList(ctx, dockerTypes.NodeListOptions{})
+	if err != nil {
+		log.Printf("metrics: failed to list nodes: %v", err)
+		up = 0
+	} else {
+		writeNodes(w, nodes)
+	}
+
+	services, err := r.api.ServiceList(ctx, dockerTypes.ServiceListOptions{})
+	if err != nil {
+		log.Printf("metrics: failed to list services: %v", err)
+		up = 0
+	} else if tasks, err := r.api.TaskList(ctx, dockerTypes.TaskListOptions{}); err != nil {
+		log.Printf("metrics: failed to list tasks: %v", err)
+		up = 0
+	} else {
+		writeServices(w, services, tasks)
+	}
+
+	if disk, err := r.diskUsage(ctx, now); err != nil {
+		log.Printf("metrics: failed to get disk usage: %v", err)
+		up = 0
+	} else {
+		writeDiskUsage(w, disk)
+	}
+
+	w.header("docker_up", "gauge", "Whether the last queries to the Docker daemon succeeded.")
+	w.sample("docker_up", nil, up)
+}
+
+// diskUsage renvoie la dernière mesure de l'espace disque, refaite si elle
+// date de plus de diskInterval
+func (r *Registry) diskUsage(ctx context.Context, now time.Time) (*diskSnapshot, error) {
+	r.diskMu.Lock()
+	defer r.diskMu.Unlock()
+
+	if r.disk != nil && now.Sub(r.disk.at) < r.diskInterval {
+		return r.disk, nil
+	}
+	info, err := r.api.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := r.api.DiskUsage(ctx, dockerTypes.DiskUsageOptions{
+		Types: []dockerTypes.DiskUsageObject{dockerTypes.ImageObject, dockerTypes.VolumeObject},
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.disk = &diskSnapshot{usage: usage, nodeID: info.Swarm.NodeID, hostname: info.Name, at: now}
+	return r.disk, nil
+}
+
+func writeNodes(w *writer, nodes []swarm.Node) {
+	type nodeKey struct{ state, availability, role string }
+	counts := make(map[nodeKey]int)
+	for _, n := range nodes {
+		counts[nodeKey{string(n.Status.State), string(n.Spec.Availability), string(n.Spec.Role)}]++
+	}
+	keys := make([]nodeKey, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.state != b.state {
+			return a.state < b.state
+		}
+		if a.availability != b.availability {
+			return a.availability < b.availability
+		}
+		return a.role < b.role
+	})
+
+	w.header("nodes", "gauge", "Swarm nodes by state, availability and role.")
+	for _, key := range keys {
+		w.sample("nodes", labels{"state", key.state, "availability", key.availability, "role", key.role}, float64(counts[key]))
+	}
+}
+
+func writeServices(w *writer, services []swarm.Service, tasks []swarm.Task) {
+	running := make(map[string]int)
+	// Pour un service global, le nombre désiré est celui des tâches à lancer
+	scheduled := make(map[string]int)
+	type taskKey struct{ stack, state string }
+	taskCounts := make(map[taskKey]int)
+
+	stacks := make(map[string]string, len(services))
+	for _, s := range services {
+		stacks[s.ID] = stackName(s)
+	}
+	for _, t := range tasks {
+		if t.DesiredState == swarm.TaskStateRunning {
+			scheduled[t.ServiceID]++
+			if t.Status.State == swarm.TaskStateRunning {
+				running[t.ServiceID]++
+			}
+		}
+		stack, ok := stacks[t.ServiceID]
+		if !ok {
+			// Tâche d'un service supprimé entre les deux appels
+			continue
+		}
+		taskCounts[taskKey{stack, string(t.Status.State)}]++
+	}
+
+	sorted := append([]swarm.Service(nil), services...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if stacks[sorted[i].ID] != stacks[sorted[j].ID] {
+			return stacks[sorted[i].ID] < stacks[sorted[j].ID]
+		}
+		return sorted[i].Spec.Name < sorted[j].Spec.Name
+	})
+
+	w.header("service_replicas_desired", "gauge", "Desired replicas per service.")
+	for _, s := range sorted {
+		desired := scheduled[s.ID]
+		if s.Spec.Mode.Replicated != nil && s.Spec.Mode.Replicated.Replicas != nil {
+			desired = int(*s.Spec.Mode.Replicated.Replicas)
+		}
+		w.sample("service_replicas_desired", serviceLabels(s, stacks[s.ID]), float64(desired))
+	}
+	w.header("service_replicas_running", "gauge", "Running tasks per service.")
+	for _, s := range sorted {
+		w.sample("service_replicas_running", serviceLabels(s, stacks[s.ID]), float64(running[s.ID]))
+	}
+
+	keys := make([]taskKey, 0, len(taskCounts))
+	for key := range taskCounts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].stack != keys[j].stack {
+			return keys[i].stack < keys[j].stack
+		}
+		return keys[i].state < keys[j].state
+	})
+	w.header("tasks", "gauge", "Tasks known to the swarm by stack and state, including the task history.")
+	for _, key := range keys {
+		w.sample("tasks", labels{"stack", key.stack, "state", key.state}, float64(taskCounts[key]))
+	}
+}
+
+func writeDiskUsage(w *writer, disk *diskSnapshot) {
+	usage := disk.usage
+	var imagesSize, imagesReclaimable int64
+	for _, img := range usage.Images {
+		if img == nil {
+			continue
+		}
+		imagesSize += img.Size
+		if img.Containers == 0 {
+			imagesReclaimable += img.Size
+		}
+	}
+	var volumesSize, volumesReclaimable int64
+	for _, vol := range usage.Volumes {
+		// Taille inconnue (-1) pour les drivers qui ne la calculent pas
+		if vol == nil || vol.UsageData == nil || vol.UsageData.Size < 0 {
+			continue
+		}
+		volumesSize += vol.UsageData.Size
+		if vol.UsageData.RefCount == 0 {
+			volumesReclaimable += vol.UsageData.Size
+		}
+	}
+
+	node := func(typ string) labels {
+		return labels{"node", disk.hostname, "node_id", disk.nodeID, "type", typ}
+	}
+	w.header("disk_objects", "gauge", "Images and volumes on the manager daemon, measured every 5 minutes.")
+	w.sample("disk_objects", node("images"), float64(len(usage.Images)))
+	w.sample("disk_objects", node("volumes"), float64(len(usage.Volumes)))
+	w.header("disk_usage_bytes", "gauge", "Disk space used by images and volumes on the manager daemon, measured every 5 minutes.")
+	w.sample("disk_usage_bytes", node("images"), float64(imagesSize))
+	w.sample("disk_usage_bytes", node("volumes"), float64(volumesSize))
+	w.header("disk_reclaimable_bytes", "gauge", "Disk space of unused images and volumes on the manager daemon, measured every 5 minutes.")
+	w.sample("disk_reclaimable_bytes", node("images"), float64(imagesReclaimable))
+	w.sample("disk_reclaimable_bytes", node("volumes"), float64(volumesReclaimable))
+}
+
+func stackName(s swarm.Service) string {
+	if name := s.Spec.Labels[stackLabel]; name != "" {
+		return name
+	}
+	return unassignedStack
+}
+
+func serviceLabels(s swarm.Service, stack string) labels {
+	return labels{"stack", stack, "service", s.Spec.Name, "service_id", s.ID}
+}
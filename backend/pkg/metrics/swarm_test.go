@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/api/types/volume"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+func TestWriteServices(t *testing.T) {
+	three := uint64(3)
+	services := []swarm.Service{
+		{ID: "s1", Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: "web_api", Labels: map[string]string{stackLabel: "web"}},
+			Mode:        swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &three}},
+		}},
+		{ID: "s2", Spec: swarm.ServiceSpec{
+			Annotations: swarm.Annotations{Name: "agent"},
+			Mode:        swarm.ServiceMode{Global: &swarm.GlobalService{}},
+		}},
+	}
+	task := func(service string, desired, state swarm.TaskState) swarm.Task {
+		return swarm.Task{ServiceID: service, DesiredState: desired, Status: swarm.TaskStatus{State: state}}
+	}
+	tasks := []swarm.Task{
+		task("s1", swarm.TaskStateRunning, swarm.TaskStateRunning),
+		task("s1", swarm.TaskStateRunning, swarm.TaskStateRunning),
+		task("s1", swarm.TaskStateRunning, swarm.TaskStatePending),
+		task("s1", swarm.TaskStateShutdown, swarm.TaskStateFailed),
+		// Global : le désiré est le nombre de tâches à lancer
+		task("s2", swarm.TaskStateRunning, swarm.TaskStateRunning),
+		task("s2", swarm.TaskStateRunning, swarm.TaskStateStarting),
+		// Service supprimé entre les deux appels
+		task("gone", swarm.TaskStateRunning, swarm.TaskStateRunning),
+	}
+
+	got := render(func(w *writer) { writeServices(w, services, tasks) })
+	want := `# HELP swarm_manager_service_replicas_desired Desired replicas per service.
+# TYPE swarm_manager_service_replicas_desired gauge
+swarm_manager_service_replicas_desired{stack="unassigned",service="agent",service_id="s2"} 2
+swarm_manager_service_replicas_desired{stack="web",service="web_api",service_id="s1"} 3
+# HELP swarm_manager_service_replicas_running Running tasks per service.
+# TYPE swarm_manager_service_replicas_running gauge
+swarm_manager_service_replicas_running{stack="unassigned",service="agent",service_id="s2"} 1
+swarm_manager_service_replicas_running{stack="web",service="web_api",service_id="s1"} 2
+# HELP swarm_manager_tasks Tasks known to the swarm by stack and state, including the task history.
+# TYPE swarm_manager_tasks gauge
+swarm_manager_tasks{stack="unassigned",state="running"} 1
+swarm_manager_tasks{stack="unassigned",state="starting"} 1
+swarm_manager_tasks{stack="web",state="failed"} 1
+swarm_manager_tasks{stack="web",state="pending"} 1
+swarm_manager_tasks{stack="web",state="running"} 2
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDiskUsageIsCached(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	f.SetInfo(system.Info{Name: "manager-1", Swarm: swarm.Info{NodeID: "n1"}})
+	f.AddImage(image.Summary{Size: 100})
+	f.AddImage(image.Summary{Size: 50, Containers: 1})
+	f.AddVolume(volume.Volume{Name: "data", UsageData: &volume.UsageData{Size: 30, RefCount: 0}})
+	r := New(f)
+	ctx := context.Background()
+	now := time.Now()
+
+	scrape := func(at time.Time) string {
+		return render(func(w *writer) { r.writeSwarm(ctx, w, at) })
+	}
+	got := scrape(now)
+	for _, line := range []string{
+		`swarm_manager_disk_objects{node="manager-1",node_id="n1",type="images"} 2`,
+		`swarm_manager_disk_usage_bytes{node="manager-1",node_id="n1",type="images"} 150`,
+		`swarm_manager_disk_reclaimable_bytes{node="manager-1",node_id="n1",type="images"} 100`,
+		`swarm_manager_disk_reclaimable_bytes{node="manager-1",node_id="n1",type="volumes"} 30`,
+		`swarm_manager_docker_up 1`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, got)
+		}
+	}
+
+	// Les collectes suivantes reprennent la mesure jusqu'à diskInterval
+	f.AddImage(image.Summary{Size: 10})
+	got = scrape(now.Add(time.Minute))
+	if calls := f.Calls("DiskUsage"); calls != 1 || !strings.Contains(got, `type="images"} 2`+"\n") {
+		t.Errorf("DiskUsage called %d times, want the cached usage", calls)
+	}
+	got = scrape(now.Add(diskUsageInterval))
+	if calls := f.Calls("DiskUsage"); calls != 2 || !strings.Contains(got, `swarm_manager_disk_objects{node="manager-1",node_id="n1",type="images"} 3`) {
+		t.Errorf("DiskUsage called %d times, want a new measure", calls)
+	}
+
+	// Un échec est signalé par docker_up et retenté à la collecte suivante
+	f.FailOn("DiskUsage", errors.New("boom"))
+	got = scrape(now.Add(2 * diskUsageInterval))
+	if strings.Contains(got, "disk_objects") || !strings.Contains(got, "swarm_manager_docker_up 0\n") {
+		t.Errorf("failed measure:\n%s", got)
+	}
+	f.FailOn("DiskUsage", nil)
+	if got := scrape(now.Add(2*diskUsageInterval + time.Second)); !strings.Contains(got, "swarm_manager_docker_up 1\n") {
+		t.Errorf("after recovery:\n%s", got)
+	}
+}
@@ -0,0 +1,82 @@
+// Package prune exécute les nettoyages Docker sur le daemon local. Il sert au
+// mode -prune-node du binaire, lancé sur chaque nœud par un job global.
+package prune
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/filters"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+)
+
+// Types de nettoyage, identiques aux routes /api/prune/*
+const (
+	KindImages     = "images"
+	KindContainers = "containers"
+	KindVolumes    = "volumes"
+	KindNetworks   = "networks"
+	KindSystem     = "system"
+)
+
+// ValidKind indique si kind est un type de nettoyage connu
+func ValidKind(kind string) bool {
+	switch kind {
+	case KindImages, KindContainers, KindVolumes, KindNetworks, KindSystem:
+		return true
+	}
+	return false
+}
+
+// Local nettoie le daemon auquel api est connecté. Pour system, all ajoute les
+// images et les volumes comme dans PruneSystem.
+func Local(ctx context.Context, api infra.DockerAPI, kind string, all bool) (domain.NodePruneReport, error) {
+	var report domain.NodePruneReport
+
+	info, err := api.Info(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.NodeID = info.Swarm.NodeID
+	report.Hostname = info.Name
+
+	if !ValidKind(kind) {
+		return report, fmt.Errorf("unknown prune kind %q", kind)
+	}
+	system := kind == KindSystem
+
+	if kind == KindContainers || system {
+		r, err := api.ContainersPrune(ctx, filters.NewArgs())
+		if err != nil {
+			return report, fmt.Errorf("error pruning containers: %w", err)
+		}
+		report.ContainersDeleted = len(r.ContainersDeleted)
+		report.SpaceReclaimed += r.SpaceReclaimed
+	}
+	if kind == KindNetworks || system {
+		r, err := api.NetworksPrune(ctx, filters.NewArgs())
+		if err != nil {
+			return report, fmt.Errorf("error pruning networks: %w", err)
+		}
+		report.NetworksDeleted = len(r.NetworksDeleted)
+	}
+	if kind == KindImages || (system && all) {
+		r, err := api.ImagesPrune(ctx, filters.NewArgs())
+		if err != nil {
+			return report, fmt.Errorf("error pruning images: %w", err)
+		}
+		report.ImagesDeleted = len(r.ImagesDeleted)
+		report.SpaceReclaimed += r.SpaceReclaimed
+	}
+	if kind == KindVolumes || (system && all) {
+		r, err := api.VolumesPrune(ctx, filters.NewArgs())
+		if err != nil {
+			return report, fmt.Errorf("error pruning volumes: %w", err)
+		}
+		report.VolumesDeleted = len(r.VolumesDeleted)
+		report.SpaceReclaimed += r.SpaceReclaimed
+	}
+	return report, nil
+}
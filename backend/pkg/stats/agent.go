@@ -0,0 +1,106 @@
+package stats
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/docker/docker/errdefs"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+)
+
+// Agent sert les mesures des conteneurs de son daemon au backend. Il tourne
+// sur chaque node dans un service global (mode -stats-agent).
+type Agent struct {
+	api   infra.DockerAPI
+	token string
+	mux   *http.ServeMux
+}
+
+// NewAgent crée l'agent ; les requêtes doivent présenter token en Bearer. Sans
+// jeton, toutes sont refusées.
+func NewAgent(api infra.DockerAPI, token string) *Agent {
+	a := &Agent{api: api, token: token, mux: http.NewServeMux()}
+	a.mux.HandleFunc("GET /containers/{id}/stats", a.containerStats)
+	a.mux.HandleFunc("GET /disk", a.disk)
+	return a
+}
+
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid agent token")
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+// containerStats relaie le flux de l'API stats du daemon local, ou une seule
+// mesure avec ?stream=false
+func (a *Agent) containerStats(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.api.ContainerStats(r.Context(), r.PathValue("id"), r.URL.Query().Get("stream") != "false")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			// Fin du flux ou erreur après l'envoi du statut : le backend voit
+			// la fin du flux et relance la lecture
+			return
+		}
+	}
+}
+
+// disk mesure le système de fichiers de ?path=, ou celui du répertoire racine
+// de Docker. Le répertoire doit être monté dans le conteneur de l'agent au
+// même chemin que sur la node.
+func (a *Agent) disk(w http.ResponseWriter, r *http.Request) {
+	d, err := localDisk(r.Context(), a.api, r.URL.Query().Get("path"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
+
+// localDisk mesure path, ou le répertoire racine du daemon api si path est vide
+func localDisk(ctx context.Context, api infra.DockerAPI, path string) (Disk, error) {
+	if path == "" {
+		info, err := api.Info(ctx)
+		if err != nil {
+			return Disk{}, err
+		}
+		path = info.DockerRootDir
+	}
+	return DiskUsage(path)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
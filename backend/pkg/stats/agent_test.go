@@ -0,0 +1,61 @@
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker/docker/api/types/system"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+func TestAgentDisk(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	root, other := t.TempDir(), t.TempDir()
+	f.SetInfo(system.Info{DockerRootDir: root})
+	agent := NewAgent(f, "secret")
+
+	for _, tc := range []struct {
+		name, url, token, path string
+		status                 int
+	}{
+		{"docker root by default", "/disk", "secret", root, http.StatusOK},
+		{"explicit path", "/disk?path=" + other, "secret", other, http.StatusOK},
+		{"missing path", "/disk?path=" + other + "/missing", "secret", "", http.StatusInternalServerError},
+		{"bad token", "/disk", "nope", "", http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rec := httptest.NewRecorder()
+			agent.ServeHTTP(rec, req)
+			if rec.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.status, rec.Body.String())
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			var d Disk
+			if err := json.Unmarshal(rec.Body.Bytes(), &d); err != nil {
+				t.Fatal(err)
+			}
+			if d.Path != tc.path || d.Total == 0 || d.UsedPercent < 0 || d.UsedPercent > 100 {
+				t.Errorf("disk = %+v", d)
+			}
+		})
+	}
+}
+
+func TestAgentRequiresToken(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	for _, token := range []string{"", "secret"} {
+		req := httptest.NewRequest(http.MethodGet, "/disk", nil)
+		rec := httptest.NewRecorder()
+		NewAgent(f, token).ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("agent token %q without Authorization: status = %d, want 401", token, rec.Code)
+		}
+	}
+}
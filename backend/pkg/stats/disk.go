@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+)
+
+// Disk est le remplissage d'un système de fichiers d'une node
+type Disk struct {
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// Disk mesure le système de fichiers de path sur une node : directement sur
+// la node du daemon, via son agent sinon. Sans path, le répertoire racine de
+// Docker de la node est mesuré.
+func (s *Source) Disk(ctx context.Context, nodeID, path string) (Disk, error) {
+	local, err := s.local(ctx)
+	if err != nil {
+		return Disk{}, err
+	}
+	if nodeID == local {
+		return localDisk(ctx, s.api, path)
+	}
+
+	addr, err := s.agentAddr(ctx, nodeID)
+	if err != nil {
+		return Disk{}, err
+	}
+	query := url.Values{}
+	if path != "" {
+		query.Set("path", path)
+	}
+	body, err := s.getAgent(ctx, addr, "/disk", query)
+	if err != nil {
+		return Disk{}, err
+	}
+	defer body.Close()
+	var d Disk
+	if err := json.NewDecoder(body).Decode(&d); err != nil {
+		return Disk{}, err
+	}
+	return d, nil
+}
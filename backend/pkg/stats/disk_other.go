@@ -0,0 +1,9 @@
+//go:build !unix
+
+package stats
+
+import "errors"
+
+func DiskUsage(path string) (Disk, error) {
+	return Disk{}, errors.New("disk usage is not supported on this platform")
+}
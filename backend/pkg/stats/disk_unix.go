@@ -0,0 +1,21 @@
+//go:build unix
+
+package stats
+
+import "syscall"
+
+// DiskUsage mesure le système de fichiers qui contient path
+func DiskUsage(path string) (Disk, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Disk{}, err
+	}
+	d := Disk{Path: path, Total: uint64(st.Blocks) * uint64(st.Bsize)}
+	if d.Total == 0 {
+		return d, nil
+	}
+	// Comme df : l'espace réservé à root compte comme utilisé
+	d.Used = d.Total - uint64(st.Bavail)*uint64(st.Bsize)
+	d.UsedPercent = float64(d.Used) / float64(d.Total) * 100
+	return d, nil
+}
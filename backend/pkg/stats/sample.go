@@ -0,0 +1,164 @@
+// Package stats lit les mesures de ressources (CPU, mémoire, réseau, disque)
+// des conteneurs des tâches, sur le daemon local ou via un agent déployé sur
+// les autres nodes, et les agrège par service et par node.
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// Sample est une mesure des ressources d'un conteneur de tâche
+type Sample struct {
+	Time          time.Time `json:"time"`
+	TaskID        string    `json:"task_id,omitempty"`
+	NodeID        string    `json:"node_id,omitempty"`
+	ContainerID   string    `json:"container_id"`
+	Slot          int       `json:"slot,omitempty"`
+	CPUPercent    float64   `json:"cpu_percent"`
+	MemoryUsage   uint64    `json:"memory_usage"`
+	MemoryLimit   uint64    `json:"memory_limit"`
+	MemoryPercent float64   `json:"memory_percent"`
+	NetworkRx     uint64    `json:"network_rx"`
+	NetworkTx     uint64    `json:"network_tx"`
+	BlockRead     uint64    `json:"block_read"`
+	BlockWrite    uint64    `json:"block_write"`
+	PIDs          uint64    `json:"pids"`
+}
+
+// FromResponse calcule une mesure à partir d'une réponse de l'API stats, avec
+// les mêmes formules que docker stats
+func FromResponse(r container.StatsResponse) Sample {
+	s := Sample{
+		Time:        r.Read,
+		ContainerID: r.ID,
+		MemoryLimit: r.MemoryStats.Limit,
+		PIDs:        r.PidsStats.Current,
+	}
+
+	// CPU : part du temps système consommée depuis la mesure précédente
+	cpuDelta := float64(r.CPUStats.CPUUsage.TotalUsage) - float64(r.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(r.CPUStats.SystemUsage) - float64(r.PreCPUStats.SystemUsage)
+	cpus := float64(r.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(r.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		s.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+
+	// Mémoire : le cache de pages inactif est exclu (cgroup v1 puis v2)
+	s.MemoryUsage = r.MemoryStats.Usage
+	inactive, ok := r.MemoryStats.Stats["total_inactive_file"]
+	if !ok {
+		inactive = r.MemoryStats.Stats["inactive_file"]
+	}
+	if inactive < s.MemoryUsage {
+		s.MemoryUsage -= inactive
+	}
+	if s.MemoryLimit > 0 {
+		s.MemoryPercent = float64(s.MemoryUsage) / float64(s.MemoryLimit) * 100
+	}
+
+	for _, nw := range r.Networks {
+		s.NetworkRx += nw.RxBytes
+		s.NetworkTx += nw.TxBytes
+	}
+	for _, entry := range r.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			s.BlockRead += entry.Value
+		case "write":
+			s.BlockWrite += entry.Value
+		}
+	}
+	return s
+}
+
+// Decode lit un flux de l'API stats (un objet JSON par mesure) et appelle fn
+// pour chaque mesure jusqu'à la fin du flux ou jusqu'à ce que fn renvoie false
+func Decode(r io.Reader, fn func(Sample) bool) error {
+	dec := json.NewDecoder(r)
+	for {
+		var resp container.StatsResponse
+		if err := dec.Decode(&resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if !fn(FromResponse(resp)) {
+			return nil
+		}
+	}
+}
+
+// Usage est la somme des ressources de plusieurs conteneurs
+type Usage struct {
+	Tasks       int     `json:"tasks"`
+	CPUPercent  float64 `json:"cpu_percent"`
+	MemoryUsage uint64  `json:"memory_usage"`
+	// Somme des limites des conteneurs (mémoire de la node sans limite)
+	MemoryLimit   uint64  `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+	NetworkRx     uint64  `json:"network_rx"`
+	NetworkTx     uint64  `json:"network_tx"`
+	BlockRead     uint64  `json:"block_read"`
+	BlockWrite    uint64  `json:"block_write"`
+}
+
+// Add ajoute une mesure au total
+func (u *Usage) Add(s Sample) {
+	u.Tasks++
+	u.CPUPercent += s.CPUPercent
+	u.MemoryUsage += s.MemoryUsage
+	u.MemoryLimit += s.MemoryLimit
+	u.NetworkRx += s.NetworkRx
+	u.NetworkTx += s.NetworkTx
+	u.BlockRead += s.BlockRead
+	u.BlockWrite += s.BlockWrite
+	if u.MemoryLimit > 0 {
+		u.MemoryPercent = float64(u.MemoryUsage) / float64(u.MemoryLimit) * 100
+	}
+}
+
+// NodeUsage est la consommation des tâches d'un service sur une node
+type NodeUsage struct {
+	NodeID   string `json:"node_id"`
+	Hostname string `json:"hostname,omitempty"`
+	Usage
+}
+
+// Aggregate somme les mesures pour le service et pour chaque node ; hostnames
+// associe les IDs de nodes à leur nom
+func Aggregate(samples []Sample, hostnames map[string]string) (Usage, []NodeUsage) {
+	var total Usage
+	byNode := make(map[string]*NodeUsage)
+	for _, s := range samples {
+		total.Add(s)
+		n, ok := byNode[s.NodeID]
+		if !ok {
+			n = &NodeUsage{NodeID: s.NodeID, Hostname: hostnames[s.NodeID]}
+			byNode[s.NodeID] = n
+		}
+		n.Add(s)
+	}
+
+	nodes := make([]NodeUsage, 0, len(byNode))
+	for _, n := range byNode {
+		nodes = append(nodes, *n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Hostname != nodes[j].Hostname {
+			return nodes[i].Hostname < nodes[j].Hostname
+		}
+		return nodes[i].NodeID < nodes[j].NodeID
+	})
+	return total, nodes
+}
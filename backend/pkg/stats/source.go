@@ -0,0 +1,230 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+)
+
+const (
+	// DefaultAgentPort est le port d'écoute par défaut de l'agent
+	DefaultAgentPort = 9324
+	// Durée de validité de la liste des agents
+	agentCacheTTL = 30 * time.Second
+	// Taille maximale du message d'erreur lu dans une réponse de l'agent
+	maxAgentError = 1024
+)
+
+// ErrNoAgent signale une tâche sur une autre node sans agent joignable
+var ErrNoAgent = errors.New("no stats agent on this node")
+
+// AgentOptions décrit le service global d'agents qui sert les mesures des
+// nodes autres que celle du daemon
+type AgentOptions struct {
+	// Nom du service d'agents ; vide si aucun agent n'est déployé
+	Service string
+	// Port d'écoute des agents (DefaultAgentPort si nul)
+	Port int
+	// Jeton partagé envoyé en Bearer aux agents
+	Token string
+}
+
+// Source ouvre les flux de mesures des conteneurs de tâches : directement si la
+// tâche tourne sur la node du daemon, via l'agent de sa node sinon
+type Source struct {
+	api    infra.DockerAPI
+	agent  AgentOptions
+	client *http.Client
+
+	mu        sync.Mutex
+	localNode string
+	agents    map[string]string
+	agentsAt  time.Time
+}
+
+// NewSource crée une source de mesures ; sans service d'agents, seules les
+// tâches de la node du daemon sont mesurées
+func NewSource(api infra.DockerAPI, agent AgentOptions) *Source {
+	if agent.Port <= 0 {
+		agent.Port = DefaultAgentPort
+	}
+	return &Source{api: api, agent: agent, client: &http.Client{}}
+}
+
+// Open ouvre le flux continu des mesures du conteneur d'une tâche, au format de
+// l'API stats de Docker
+func (s *Source) Open(ctx context.Context, task swarm.Task) (io.ReadCloser, error) {
+	return s.open(ctx, task, true)
+}
+
+// open ouvre le flux des mesures, continu ou réduit à une seule mesure
+func (s *Source) open(ctx context.Context, task swarm.Task, stream bool) (io.ReadCloser, error) {
+	if task.Status.ContainerStatus == nil || task.Status.ContainerStatus.ContainerID == "" {
+		return nil, fmt.Errorf("task %s has no container", task.ID)
+	}
+	containerID := task.Status.ContainerStatus.ContainerID
+
+	local, err := s.local(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if task.NodeID == local {
+		resp, err := s.api.ContainerStats(ctx, containerID, stream)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+
+	addr, err := s.agentAddr(ctx, task.NodeID)
+	if err != nil {
+		return nil, err
+	}
+	return s.openAgent(ctx, addr, containerID, stream)
+}
+
+// Sample renvoie une mesure ponctuelle du conteneur d'une tâche. Elle est
+// demandée sans flux (stream=false) : le daemon renvoie une seule mesure dont
+// la référence CPU est relevée une seconde plus tôt.
+func (s *Source) Sample(ctx context.Context, task swarm.Task) (Sample, error) {
+	body, err := s.open(ctx, task, false)
+	if err != nil {
+		return Sample{}, err
+	}
+	defer body.Close()
+	stop := context.AfterFunc(ctx, func() { body.Close() })
+	defer stop()
+
+	var result Sample
+	count := 0
+	err = Decode(body, func(sample Sample) bool {
+		result = sample
+		count++
+		return false
+	})
+	if err != nil {
+		return Sample{}, err
+	}
+	if count == 0 {
+		return Sample{}, fmt.Errorf("no stats for task %s", task.ID)
+	}
+	result.TaskID = task.ID
+	result.NodeID = task.NodeID
+	result.Slot = task.Slot
+	return result, nil
+}
+
+// local renvoie l'ID de la node du daemon
+func (s *Source) local(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.localNode != "" {
+		return s.localNode, nil
+	}
+	info, err := s.api.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.localNode = info.Swarm.NodeID
+	return s.localNode, nil
+}
+
+// agentAddr renvoie l'adresse de l'agent d'une node, à partir des tâches du
+// service d'agents
+func (s *Source) agentAddr(ctx context.Context, nodeID string) (string, error) {
+	if s.agent.Service == "" {
+		return "", ErrNoAgent
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.agents == nil || time.Since(s.agentsAt) > agentCacheTTL {
+		f := filters.NewArgs(
+			filters.Arg("service", s.agent.Service),
+			filters.Arg("desired-state", string(swarm.TaskStateRunning)),
+		)
+		tasks, err := s.api.TaskList(ctx, dockerTypes.TaskListOptions{Filters: f})
+		if err != nil {
+			return "", fmt.Errorf("failed to list stats agents: %w", err)
+		}
+		s.agents = make(map[string]string)
+		for _, t := range tasks {
+			if t.Status.State != swarm.TaskStateRunning {
+				continue
+			}
+			if ip := taskIP(t); ip != "" {
+				s.agents[t.NodeID] = net.JoinHostPort(ip, strconv.Itoa(s.agent.Port))
+			}
+		}
+		s.agentsAt = time.Now()
+	}
+	addr, ok := s.agents[nodeID]
+	if !ok {
+		return "", ErrNoAgent
+	}
+	return addr, nil
+}
+
+func (s *Source) openAgent(ctx context.Context, addr, containerID string, stream bool) (io.ReadCloser, error) {
+	query := url.Values{}
+	if !stream {
+		query.Set("stream", "false")
+	}
+	return s.getAgent(ctx, addr, "/containers/"+url.PathEscape(containerID)+"/stats", query)
+}
+
+// getAgent envoie une requête GET à l'agent d'adresse addr et renvoie le corps
+// d'une réponse 200
+func (s *Source) getAgent(ctx context.Context, addr, path string, query url.Values) (io.ReadCloser, error) {
+	u := url.URL{Scheme: "http", Host: addr, Path: path, RawQuery: query.Encode()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.agent.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.agent.Token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Agent en cours de redéploiement : relire la liste au prochain essai
+		s.mu.Lock()
+		s.agents = nil
+		s.mu.Unlock()
+		return nil, fmt.Errorf("stats agent %s: %w", addr, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxAgentError))
+		return nil, fmt.Errorf("stats agent %s: %s: %s", addr, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp.Body, nil
+}
+
+// taskIP renvoie l'adresse de la tâche sur son premier réseau hors ingress
+func taskIP(t swarm.Task) string {
+	for _, attachment := range t.NetworksAttachments {
+		if attachment.Network.Spec.Ingress {
+			continue
+		}
+		for _, addr := range attachment.Addresses {
+			if ip, _, err := net.ParseCIDR(addr); err == nil {
+				return ip.String()
+			}
+		}
+	}
+	return ""
+}
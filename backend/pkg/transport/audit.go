@@ -0,0 +1,73 @@
+package transport
+
+import (
+	"context"
+	"strings"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/audit"
+)
+
+// AuditTargets relève les objets visés par une route et la version de leur spec,
+// pour le journal d'audit. Les objets introuvables sont simplement omis.
+func (h *Handler) AuditTargets(c echo.Context) []audit.Object {
+	if h == nil || h.dockerClient == nil {
+		return nil
+	}
+	ctx := context.Background()
+	path := c.Path()
+
+	switch {
+	case strings.HasPrefix(path, "/api/services/:id"):
+		service, _, err := h.dockerClient.ServiceInspectWithRaw(ctx, c.Param("id"), dockerTypes.ServiceInspectOptions{})
+		if err != nil {
+			return nil
+		}
+		version := service.Version.Index
+		return []audit.Object{{Type: "service", ID: service.ID, Name: service.Spec.Name, Version: &version}}
+
+	case strings.HasPrefix(path, "/api/nodes/:id"):
+		node, _, err := h.dockerClient.NodeInspectWithRaw(ctx, c.Param("id"))
+		if err != nil {
+			return nil
+		}
+		version := node.Version.Index
+		return []audit.Object{{Type: "node", ID: node.ID, Name: node.Description.Hostname, Version: &version}}
+
+	case strings.HasPrefix(path, "/api/stacks"):
+		name := auditStackName(c)
+		if name == "" {
+			return nil
+		}
+		services, err := h.dockerClient.ServiceList(ctx, dockerTypes.ServiceListOptions{Filters: stackFilter(name)})
+		if err != nil {
+			return nil
+		}
+		objects := make([]audit.Object, 0, len(services))
+		for _, s := range services {
+			version := s.Version.Index
+			objects = append(objects, audit.Object{Type: "service", ID: s.ID, Name: s.Spec.Name, Version: &version})
+		}
+		return objects
+
+	case strings.HasPrefix(path, "/api/images/:id"):
+		return []audit.Object{{Type: "image", ID: c.Param("id")}}
+	}
+	return nil
+}
+
+// auditStackName retrouve le nom de la stack, y compris pour un déploiement
+// où il est passé dans le formulaire (disponible seulement après le handler)
+func auditStackName(c echo.Context) string {
+	if name := c.Param("name"); name != "" {
+		return name
+	}
+	if form := c.Request().MultipartForm; form != nil {
+		if name := firstFormValue(form, "name"); name != "" {
+			return name
+		}
+	}
+	return c.QueryParam("name")
+}
@@ -0,0 +1,422 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+const (
+	defaultDrainTimeout = 5 * time.Minute
+	maxDrainTimeout     = 30 * time.Minute
+	drainPollDelay      = time.Second
+)
+
+// États d'un drain
+const (
+	drainChecked  = "checked"  // dry_run : rien n'a été modifié
+	drainRefused  = "refused"  // des tâches ne pourraient pas être replanifiées
+	drainDraining = "draining" // la node est drainée, les tâches sont en cours de déplacement
+	drainDrained  = "drained"
+	drainFailed   = "failed"  // des tâches ne trouvent pas de node
+	drainTimeout  = "timeout" // des tâches n'ont pas redémarré à temps
+	drainAborted  = "aborted" // échec, délai dépassé ou client parti : la node a été réactivée
+)
+
+// États des tâches d'une node drainée
+const (
+	drainTaskPending       = "pending"
+	drainTaskMoved         = "moved"
+	drainTaskStopped       = "stopped"
+	drainTaskUnschedulable = "unschedulable"
+)
+
+// drainRequest est le corps, facultatif, de POST /nodes/:id/drain
+type drainRequest struct {
+	// Attend que les tâches tournent ailleurs (NDJSON avec Accept: application/x-ndjson)
+	Wait    bool   `json:"wait"`
+	Timeout string `json:"timeout"`
+	// Vérifie seulement où les tâches pourraient aller
+	DryRun bool `json:"dry_run"`
+	// Refuse le drain si des tâches ne pourraient pas être replanifiées
+	Check bool `json:"check"`
+	// Rétablit la disponibilité précédente si le drain échoue, expire ou si
+	// le client se déconnecte pendant l'attente
+	AbortOnFailure bool `json:"abort_on_failure"`
+}
+
+// drainProgress est une ligne du flux NDJSON renvoyé pendant l'attente
+type drainProgress struct {
+	Event string `json:"event"` // progress ou done
+	domain.DrainReport
+}
+
+// DrainNode draine une node et indique où ses tâches devraient être
+// replanifiées (contraintes, plateforme, max replicas, ressources réservées).
+// Cette estimation ne bloque le drain qu'avec check. Corps facultatif :
+// {"wait": true, "timeout": "5m", "dry_run": false, "check": false,
+// "abort_on_failure": true}.
+func (h *Handler) DrainNode(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	req, timeout, err := readDrainRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	ctx := context.Background()
+	node, _, err := h.dockerClient.NodeInspectWithRaw(ctx, c.Param("id"))
+	if err != nil {
+		return nodeError(c, err)
+	}
+	report, err := h.planDrain(ctx, node)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	var unschedulable []string
+	for _, t := range report.Tasks {
+		if t.State == drainTaskUnschedulable {
+			unschedulable = append(unschedulable, t.ServiceName)
+		}
+	}
+	if req.DryRun {
+		report.State = drainChecked
+		return c.JSON(http.StatusOK, report)
+	}
+	if len(unschedulable) > 0 && req.Check {
+		report.State = drainRefused
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error": fmt.Sprintf("tasks of %s cannot be rescheduled (drain without check to drain anyway)", strings.Join(dedupe(unschedulable), ", ")),
+			"drain": report,
+		})
+	}
+
+	if _, err := h.updateNode(ctx, node.ID, func(_ swarm.Node, spec *swarm.NodeSpec) error {
+		spec.Availability = swarm.NodeAvailabilityDrain
+		return nil
+	}); err != nil {
+		return nodeError(c, err)
+	}
+	report.Availability = string(swarm.NodeAvailabilityDrain)
+	report.State = drainDraining
+	if !req.Wait {
+		return c.JSON(http.StatusOK, report)
+	}
+	return h.followDrain(c, &report, timeout, req.AbortOnFailure)
+}
+
+func readDrainRequest(c echo.Context) (drainRequest, time.Duration, error) {
+	var req drainRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return req, 0, fmt.Errorf("invalid request body: %w", err)
+	}
+	for name, flag := range map[string]*bool{"wait": &req.Wait, "dry_run": &req.DryRun, "check": &req.Check, "abort_on_failure": &req.AbortOnFailure} {
+		if c.QueryParam(name) == "true" {
+			*flag = true
+		}
+	}
+
+	timeout := defaultDrainTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			return req, 0, errors.New("invalid timeout")
+		}
+		timeout = min(d, maxDrainTimeout)
+	}
+	return req, timeout, nil
+}
+
+// planDrain relève les tâches de la node et cherche pour chacune une autre
+// node, en tenant compte des tâches déjà placées
+func (h *Handler) planDrain(ctx context.Context, node swarm.Node) (domain.DrainReport, error) {
+	report := domain.DrainReport{
+		NodeID:               node.ID,
+		Hostname:             node.Description.Hostname,
+		PreviousAvailability: string(node.Spec.Availability),
+		Availability:         string(node.Spec.Availability),
+		Tasks:                []domain.DrainTask{},
+	}
+
+	running := filters.NewArgs(filters.Arg("desired-state", string(swarm.TaskStateRunning)))
+	tasks, err := h.dockerClient.TaskList(ctx, dockerTypes.TaskListOptions{Filters: running})
+	if err != nil {
+		return report, err
+	}
+	services, err := h.dockerClient.ServiceList(ctx, dockerTypes.ServiceListOptions{})
+	if err != nil {
+		return report, err
+	}
+	nodes, err := h.dockerClient.NodeList(ctx, dockerTypes.NodeListOptions{})
+	if err != nil {
+		return report, err
+	}
+	byID := make(map[string]swarm.Service, len(services))
+	for _, s := range services {
+		byID[s.ID] = s
+	}
+
+	var onNode []swarm.Task
+	for _, t := range tasks {
+		if t.NodeID == node.ID {
+			onNode = append(onNode, t)
+		}
+	}
+	sort.Slice(onNode, func(i, j int) bool {
+		a, b := byID[onNode[i].ServiceID].Spec.Name, byID[onNode[j].ServiceID].Spec.Name
+		if a != b {
+			return a < b
+		}
+		return onNode[i].Slot < onNode[j].Slot
+	})
+
+	placement := newPlacementState(nodes, tasks, node.ID)
+	for _, t := range onNode {
+		svc := byID[t.ServiceID]
+		dt := domain.DrainTask{
+			TaskID:      t.ID,
+			ServiceID:   t.ServiceID,
+			ServiceName: svc.Spec.Name,
+			Slot:        t.Slot,
+			State:       drainTaskPending,
+		}
+		if svc.Spec.Mode.Global != nil || svc.Spec.Mode.GlobalJob != nil {
+			dt.Global = true
+			dt.Reason = "global service, the task stops with the node"
+		} else if _, candidates, err := placement.place(svc, node.ID); err != nil {
+			dt.State = drainTaskUnschedulable
+			dt.Reason = err.Error()
+		} else {
+			dt.Candidates = candidates
+		}
+		report.Tasks = append(report.Tasks, dt)
+	}
+	return report, nil
+}
+
+// followDrain suit les tâches jusqu'à ce qu'elles tournent ailleurs, qu'elles
+// ne trouvent pas de node ou que le délai expire. Avec Accept:
+// application/x-ndjson, chaque relevé est envoyé au fil de l'eau.
+func (h *Handler) followDrain(c echo.Context, report *domain.DrainReport, timeout time.Duration, abort bool) error {
+	ctx := context.Background()
+	stream := strings.Contains(c.Request().Header.Get(echo.HeaderAccept), mimeNDJSON)
+
+	var enc *json.Encoder
+	if stream {
+		c.Response().Header().Set(echo.HeaderContentType, mimeNDJSON)
+		c.Response().WriteHeader(http.StatusOK)
+		enc = json.NewEncoder(c.Response())
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		settled, err := h.refreshDrain(ctx, report)
+		if err != nil {
+			if stream {
+				return enc.Encode(map[string]string{"event": "error", "error": err.Error()})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		expired := time.Now().After(deadline)
+		if settled || expired {
+			report.State = drainDrained
+			for _, t := range report.Tasks {
+				if t.State == drainTaskUnschedulable {
+					report.State = drainFailed
+				}
+			}
+			if !settled {
+				report.State = drainTimeout
+			}
+			if report.State != drainDrained && abort {
+				h.reactivate(ctx, report)
+			}
+		}
+		if stream {
+			progress := drainProgress{Event: "progress", DrainReport: *report}
+			if settled || expired {
+				progress.Event = "done"
+			}
+			if err := enc.Encode(progress); err != nil {
+				return nil
+			}
+			c.Response().Flush()
+		}
+		if settled || expired {
+			break
+		}
+		select {
+		case <-c.Request().Context().Done():
+			// Personne ne verra l'échec : la node ne doit pas rester drainée
+			if abort {
+				h.reactivate(ctx, report)
+				if report.Error != "" {
+					c.Logger().Errorf("drain of %s: %s", report.Hostname, report.Error)
+				}
+			}
+			return nil
+		case <-time.After(drainPollDelay):
+		}
+	}
+
+	if stream {
+		return nil
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+// reactivate rétablit la disponibilité de la node d'avant le drain ; en cas
+// d'échec, la node reste drainée et l'erreur est reportée dans report
+func (h *Handler) reactivate(ctx context.Context, report *domain.DrainReport) {
+	node, err := h.updateNode(ctx, report.NodeID, func(_ swarm.Node, spec *swarm.NodeSpec) error {
+		spec.Availability = swarm.NodeAvailability(report.PreviousAvailability)
+		return nil
+	})
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to restore availability %s: %v", report.PreviousAvailability, err)
+		return
+	}
+	report.Availability = string(node.Spec.Availability)
+	report.State = drainAborted
+}
+
+// refreshDrain met à jour l'état des tâches avec un seul appel à TaskList et
+// indique si plus aucune n'est en attente
+func (h *Handler) refreshDrain(ctx context.Context, report *domain.DrainReport) (bool, error) {
+	if len(report.Tasks) == 0 {
+		return true, nil
+	}
+	f := filters.NewArgs(filters.Arg("desired-state", string(swarm.TaskStateRunning)))
+	for _, t := range report.Tasks {
+		f.Add("service", t.ServiceID)
+	}
+	tasks, err := h.dockerClient.TaskList(ctx, dockerTypes.TaskListOptions{Filters: f})
+	if err != nil {
+		return false, err
+	}
+	hostnames, err := h.nodeHostnames(ctx)
+	if err != nil {
+		return false, err
+	}
+	// Nombre de replicas courant : un slot au-delà a disparu avec un scale
+	// down et ne sera jamais remplacé
+	services, err := h.dockerClient.ServiceList(ctx, dockerTypes.ServiceListOptions{Filters: idFilters(report.Tasks)})
+	if err != nil {
+		return false, err
+	}
+	replicas := make(map[string]uint64, len(services))
+	for _, s := range services {
+		replicas[s.ID] = math.MaxUint64 // jobs : pas de borne sur les slots
+		if s.Spec.Mode.Replicated != nil {
+			replicas[s.ID] = replicaCount(s.Spec)
+		}
+	}
+
+	settled := true
+	for i := range report.Tasks {
+		dt := &report.Tasks[i]
+		if dt.State == drainTaskMoved || dt.State == drainTaskStopped {
+			continue
+		}
+		if dt.Global {
+			dt.State = drainTaskStopped
+			for _, t := range tasks {
+				if t.ID == dt.TaskID {
+					dt.State = drainTaskPending
+				}
+			}
+		} else {
+			refreshDrainTask(dt, tasks, replicas, report.NodeID, hostnames)
+		}
+		settled = settled && dt.State != drainTaskPending
+	}
+	return settled, nil
+}
+
+// idFilters filtre les services des tâches drainées
+func idFilters(tasks []domain.DrainTask) filters.Args {
+	f := filters.NewArgs()
+	for _, t := range tasks {
+		f.Add("id", t.ServiceID)
+	}
+	return f
+}
+
+// refreshDrainTask cherche la tâche qui remplace dt dans son slot. replicas
+// donne le nombre de replicas courant des services encore présents.
+func refreshDrainTask(dt *domain.DrainTask, tasks []swarm.Task, replicas map[string]uint64, nodeID string, hostnames map[string]string) {
+	count, ok := replicas[dt.ServiceID]
+	switch {
+	case !ok:
+		dt.State = drainTaskStopped
+		dt.Reason = "service removed"
+		return
+	case uint64(dt.Slot) > count:
+		dt.State = drainTaskStopped
+		dt.Reason = fmt.Sprintf("service scaled down to %d replicas", count)
+		return
+	}
+	for _, t := range tasks {
+		if t.ServiceID != dt.ServiceID || t.Slot != dt.Slot {
+			continue
+		}
+		if t.ID == dt.TaskID {
+			// Le drain n'a pas encore été pris en compte par l'orchestrateur
+			dt.State = drainTaskPending
+			dt.Reason = "waiting for the task to stop"
+			return
+		}
+		if t.NodeID == nodeID {
+			continue
+		}
+		dt.NewTaskID = t.ID
+		dt.NewNodeID = t.NodeID
+		dt.NewHostname = hostnames[t.NodeID]
+		switch {
+		case t.Status.State == swarm.TaskStateRunning:
+			dt.State = drainTaskMoved
+			dt.Reason = ""
+		case strings.Contains(t.Status.Err, "no suitable node"):
+			dt.State = drainTaskUnschedulable
+			dt.Reason = t.Status.Err
+		default:
+			dt.State = drainTaskPending
+			dt.Reason = fmt.Sprintf("new task is %s", t.Status.State)
+			if t.Status.Err != "" {
+				dt.Reason += ": " + t.Status.Err
+			}
+		}
+		return
+	}
+	dt.State = drainTaskPending
+	dt.Reason = "waiting for a replacement task"
+}
+
+// dedupe retire les doublons en gardant l'ordre
+func dedupe(values []string) []string {
+	var result []string
+	for _, v := range values {
+		if !containsString(result, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+// seedPinned crée deux nodes et un service dont l'unique tâche ne peut
+// tourner que sur la première
+func seedPinned(f *infratest.FakeSwarm) swarm.Node {
+	node := f.AddNode("n1", swarm.NodeRoleManager)
+	f.AddNode("n2", swarm.NodeRoleWorker)
+	spec := replicated("pinned", 1, nil)
+	spec.TaskTemplate.Placement = &swarm.Placement{Constraints: []string{"node.hostname==n1"}}
+	f.AddService(spec)
+	return node
+}
+
+func availability(t *testing.T, f *infratest.FakeSwarm, id string) swarm.NodeAvailability {
+	t.Helper()
+	n, _, err := f.NodeInspectWithRaw(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n.Spec.Availability
+}
+
+func TestDrainNodeCheckIsOptIn(t *testing.T) {
+	for _, tc := range []struct {
+		name, query string
+		status      int
+		state       string
+		want        swarm.NodeAvailability
+	}{
+		{"default drains", "", http.StatusOK, drainDraining, swarm.NodeAvailabilityDrain},
+		{"check refuses", "?check=true", http.StatusConflict, drainRefused, swarm.NodeAvailabilityActive},
+		{"dry run", "?dry_run=true", http.StatusOK, drainChecked, swarm.NodeAvailabilityActive},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, e := newTestServer(t)
+			node := seedPinned(f)
+
+			var resp struct {
+				domain.DrainReport
+				Drain *domain.DrainReport `json:"drain"`
+			}
+			if code := do(t, e, http.MethodPost, "/nodes/"+node.ID+"/drain"+tc.query, "", &resp); code != tc.status {
+				t.Fatalf("status = %d, want %d", code, tc.status)
+			}
+			report := resp.DrainReport
+			if resp.Drain != nil {
+				report = *resp.Drain
+			}
+			if report.State != tc.state || len(report.Tasks) != 1 || report.Tasks[0].State != drainTaskUnschedulable {
+				t.Errorf("report = %+v", report)
+			}
+			if got := availability(t, f, node.ID); got != tc.want {
+				t.Errorf("availability = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDrainNodeAbortsOnFailure(t *testing.T) {
+	f, e := newTestServer(t)
+	node := seedPinned(f)
+
+	var report domain.DrainReport
+	if code := do(t, e, http.MethodPost, "/nodes/"+node.ID+"/drain", `{"wait": true, "abort_on_failure": true}`, &report); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if report.State != drainAborted || report.Error != "" || availability(t, f, node.ID) != swarm.NodeAvailabilityActive {
+		t.Errorf("report = %+v, availability = %s", report, availability(t, f, node.ID))
+	}
+}
+
+// failingReactivation refuse toute mise à jour de node après la première
+type failingReactivation struct {
+	*infratest.FakeSwarm
+	updates int
+}
+
+func (f *failingReactivation) NodeUpdate(ctx context.Context, nodeID string, version swarm.Version, spec swarm.NodeSpec) error {
+	f.updates++
+	if f.updates > 1 {
+		return errors.New("raft unavailable")
+	}
+	return f.FakeSwarm.NodeUpdate(ctx, nodeID, version, spec)
+}
+
+func TestDrainNodeReportsReactivationError(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	node := seedPinned(f)
+	h := NewHandler(&failingReactivation{FakeSwarm: f})
+	e := echo.New()
+	e.POST("/nodes/:id/drain", h.DrainNode)
+
+	var report domain.DrainReport
+	if code := do(t, e, http.MethodPost, "/nodes/"+node.ID+"/drain", `{"wait": true, "abort_on_failure": true}`, &report); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if report.State != drainFailed || !strings.Contains(report.Error, "raft unavailable") || report.Availability != string(swarm.NodeAvailabilityDrain) {
+		t.Errorf("report = %+v, want failed with the reactivation error", report)
+	}
+}
+
+// stalledSwarm renvoie toujours les tâches d'avant le drain, comme un
+// orchestrateur qui n'a pas encore réagi
+type stalledSwarm struct {
+	*infratest.FakeSwarm
+	tasks []swarm.Task
+}
+
+func (f *stalledSwarm) TaskList(ctx context.Context, options dockerTypes.TaskListOptions) ([]swarm.Task, error) {
+	if f.tasks == nil {
+		tasks, err := f.FakeSwarm.TaskList(ctx, options)
+		if err != nil {
+			return nil, err
+		}
+		f.tasks = tasks
+	}
+	return f.tasks, nil
+}
+
+func TestDrainNodeAbortsWhenTheClientLeaves(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		abort bool
+		want  swarm.NodeAvailability
+	}{
+		{"abort on failure", true, swarm.NodeAvailabilityActive},
+		{"without abort", false, swarm.NodeAvailabilityDrain},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := infratest.NewFakeSwarm()
+			node := f.AddNode("n1", swarm.NodeRoleManager)
+			f.AddNode("n2", swarm.NodeRoleWorker)
+			f.AddService(replicated("web", 2, nil))
+			h := NewHandler(&stalledSwarm{FakeSwarm: f})
+			e := echo.New()
+			e.POST("/nodes/:id/drain", h.DrainNode)
+
+			body := `{"wait": true, "abort_on_failure": false}`
+			if tc.abort {
+				body = `{"wait": true, "abort_on_failure": true}`
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			req := httptest.NewRequest(http.MethodPost, "/nodes/"+node.ID+"/drain", strings.NewReader(body)).WithContext(ctx)
+			e.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got := availability(t, f, node.ID); got != tc.want {
+				t.Errorf("availability = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// Les plateformes d'image (amd64, arm64) sont comparées aux architectures uname
+// des nodes (x86_64, aarch64)
+func TestDrainNodePlatforms(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		platform swarm.Platform
+		want     string
+	}{
+		{"amd64 image", swarm.Platform{OS: "linux", Architecture: "amd64"}, drainTaskPending},
+		{"uname name", swarm.Platform{OS: "linux", Architecture: "x86_64"}, drainTaskPending},
+		{"any architecture", swarm.Platform{OS: "linux"}, drainTaskPending},
+		{"other architecture", swarm.Platform{OS: "linux", Architecture: "arm64"}, drainTaskUnschedulable},
+		{"other OS", swarm.Platform{OS: "windows", Architecture: "amd64"}, drainTaskUnschedulable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, e := newTestServer(t)
+			f.AddNode("n1", swarm.NodeRoleManager)
+			f.AddNode("n2", swarm.NodeRoleWorker)
+			spec := replicated("web", 1, nil)
+			spec.TaskTemplate.Placement = &swarm.Placement{Platforms: []swarm.Platform{tc.platform}}
+			f.AddService(spec)
+			tasks, _ := f.TaskList(context.Background(), dockerTypes.TaskListOptions{})
+			if len(tasks) != 1 {
+				t.Fatalf("tasks = %d, want 1", len(tasks))
+			}
+
+			var report domain.DrainReport
+			if code := do(t, e, http.MethodPost, "/nodes/"+tasks[0].NodeID+"/drain?dry_run=true", "", &report); code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			if len(report.Tasks) != 1 || report.Tasks[0].State != tc.want {
+				t.Errorf("tasks = %+v, want %s", report.Tasks, tc.want)
+			}
+		})
+	}
+
+	node := swarm.Node{Description: swarm.NodeDescription{Platform: swarm.Platform{OS: "linux", Architecture: "aarch64"}}}
+	placement := &swarm.Placement{Platforms: []swarm.Platform{{OS: "linux", Architecture: "arm64"}}}
+	if !matchPlatform(placement, node) {
+		t.Error("arm64 image refused on an aarch64 node")
+	}
+}
+
+func TestRefreshDrainTask(t *testing.T) {
+	task := func(id, node string, slot int, state swarm.TaskState) swarm.Task {
+		return swarm.Task{ID: id, ServiceID: "s1", NodeID: node, Slot: slot, Status: swarm.TaskStatus{State: state}}
+	}
+	hostnames := map[string]string{"n1": "n1", "n2": "n2"}
+
+	for _, tc := range []struct {
+		name     string
+		tasks    []swarm.Task
+		replicas map[string]uint64
+		state    string
+		reason   string
+	}{
+		{"not yet stopped", []swarm.Task{task("t1", "n1", 2, swarm.TaskStateRunning)}, map[string]uint64{"s1": 2}, drainTaskPending, "waiting for the task to stop"},
+		{"moved", []swarm.Task{task("t2", "n2", 2, swarm.TaskStateRunning)}, map[string]uint64{"s1": 2}, drainTaskMoved, ""},
+		{"starting", []swarm.Task{task("t2", "n2", 2, swarm.TaskStatePreparing)}, map[string]uint64{"s1": 2}, drainTaskPending, "new task is preparing"},
+		{"no replacement yet", nil, map[string]uint64{"s1": 2}, drainTaskPending, "waiting for a replacement task"},
+		{"scaled down", []swarm.Task{task("t3", "n2", 1, swarm.TaskStateRunning)}, map[string]uint64{"s1": 1}, drainTaskStopped, "service scaled down to 1 replicas"},
+		{"scaled to zero", nil, map[string]uint64{"s1": 0}, drainTaskStopped, "service scaled down to 0 replicas"},
+		{"service removed", nil, map[string]uint64{}, drainTaskStopped, "service removed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dt := domain.DrainTask{TaskID: "t1", ServiceID: "s1", Slot: 2, State: drainTaskPending}
+			refreshDrainTask(&dt, tc.tasks, tc.replicas, "n1", hostnames)
+			if dt.State != tc.state || dt.Reason != tc.reason {
+				t.Errorf("state = %q, reason = %q, want %q, %q", dt.State, dt.Reason, tc.state, tc.reason)
+			}
+		})
+	}
+}
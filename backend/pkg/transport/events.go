@@ -0,0 +1,187 @@
+package transport
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/events"
+)
+
+const (
+	defaultEventHistoryLimit = 100
+	eventHeartbeatInterval   = 30 * time.Second
+)
+
+// SetEventWatcher branche le watcher d'événements Docker démarré dans main
+func (h *Handler) SetEventWatcher(w *events.Watcher) {
+	h.eventWatcher = w
+}
+
+// Events diffuse les événements du swarm en direct, sur une WebSocket si la
+// requête en demande une, en Server-Sent Events sinon. ?types= restreint les
+// types (node, service, task, container, network, secret, config) ; ?since_id=
+// ou l'en-tête Last-Event-ID rejoue d'abord les événements manqués encore en
+// historique.
+func (h *Handler) Events(c echo.Context) error {
+	if h == nil || h.eventWatcher == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "events watcher not started"})
+	}
+
+	types, err := eventTypes(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	sinceID := c.QueryParam("since_id")
+	if sinceID == "" {
+		sinceID = c.Request().Header.Get("Last-Event-ID")
+	}
+	var afterID uint64
+	if sinceID != "" {
+		if afterID, err = strconv.ParseUint(sinceID, 10, 64); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid since_id"})
+		}
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request()) {
+		return h.streamEventsWebSocket(c, types, afterID)
+	}
+	return h.streamEventsSSE(c, types, afterID)
+}
+
+func (h *Handler) streamEventsWebSocket(c echo.Context, types []string, afterID uint64) error {
+	ws, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not upgrade to WebSocket: " + err.Error()})
+	}
+	defer ws.Close()
+
+	sub := h.eventWatcher.Subscribe(types, afterID)
+	defer h.eventWatcher.Unsubscribe(sub)
+
+	// Canal pour signaler la fermeture de la connexion
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-heartbeat.C:
+			if err := ws.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+				return nil
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// Client trop lent : il peut se reconnecter avec since_id
+				ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow, reconnect with since_id"))
+				return nil
+			}
+			if err := ws.WriteJSON(e); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func (h *Handler) streamEventsSSE(c echo.Context, types []string, afterID uint64) error {
+	sub := h.eventWatcher.Subscribe(types, afterID)
+	defer h.eventWatcher.Unsubscribe(sub)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+				return nil
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// Client trop lent : EventSource se reconnecte avec Last-Event-ID
+				return nil
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return nil
+			}
+		}
+		res.Flush()
+	}
+}
+
+// EventHistory renvoie les derniers événements conservés : ?types=,
+// ?since= (RFC 3339), ?after_id= et ?limit= (100 par défaut)
+func (h *Handler) EventHistory(c echo.Context) error {
+	if h == nil || h.eventWatcher == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "events watcher not started"})
+	}
+
+	types, err := eventTypes(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	filter := events.HistoryFilter{Types: types, Limit: defaultEventHistoryLimit}
+	if v := c.QueryParam("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid since, expected RFC 3339"})
+		}
+	}
+	if v := c.QueryParam("after_id"); v != "" {
+		if filter.AfterID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid after_id"})
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+		}
+		filter.Limit = limit
+	}
+	return c.JSON(http.StatusOK, h.eventWatcher.History(filter))
+}
+
+// eventTypes lit ?types= (liste séparée par des virgules)
+func eventTypes(c echo.Context) ([]string, error) {
+	var types []string
+	for _, v := range c.QueryParams()["types"] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t == "" {
+				continue
+			}
+			if !containsString(events.Types, t) {
+				return nil, fmt.Errorf("invalid event type %q (%s)", t, strings.Join(events.Types, ", "))
+			}
+			types = append(types, t)
+		}
+	}
+	return types, nil
+}
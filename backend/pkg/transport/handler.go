@@ -3,9 +3,10 @@ package transport
 import (
 	"context"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	dockerTypes "github.com/docker/docker/api/types"
@@ -17,28 +18,84 @@ import (
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/api/types/system"
 	"github.com/docker/docker/api/types/volume"
-	"github.com/docker/docker/client"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 
 	"github.com/Affell/swarm-manager/backend/pkg/domain"
+	"github.com/Affell/swarm-manager/backend/pkg/events"
+	"github.com/Affell/swarm-manager/backend/pkg/infra"
+	"github.com/Affell/swarm-manager/backend/pkg/metrics"
+	"github.com/Affell/swarm-manager/backend/pkg/prune"
+	"github.com/Affell/swarm-manager/backend/pkg/stats"
 )
 
-// Configurez l'upgrader WebSocket
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Autoriser toutes les origines en développement (à configurer pour la production)
-	},
+type Handler struct {
+	dockerClient infra.DockerAPI
+	upgrader     websocket.Upgrader
+	// Origines autorisées pour les WebSockets en plus de la même origine ("*" pour toutes)
+	allowedOrigins []string
+	// Image des jobs de nettoyage lancés sur chaque node (?scope=cluster),
+	// celle du service du backend si elle n'est pas configurée
+	pruneJobImage string
+	pruneMu       sync.Mutex
+	// Taille par défaut du tampon des WebSockets de logs
+	logBufferSize int
+	// Watcher des événements Docker pour /api/events (nil si non démarré)
+	eventWatcher *events.Watcher
+	// Métriques Prometheus (nil si non exposées)
+	metrics *metrics.Registry
+	// Mesures des conteneurs de tâches, locales ou via les agents
+	stats *stats.Source
+	// Chemins des nodes que les stacks d'un operator peuvent monter en bind
+	allowedBindSources []string
 }
 
-type Handler struct {
-	dockerClient *client.Client
+// NewHandler crée les handlers HTTP à partir d'un client Docker (réel ou infratest.FakeSwarm)
+func NewHandler(dc infra.DockerAPI) *Handler {
+	h := &Handler{dockerClient: dc, stats: stats.NewSource(dc, stats.AgentOptions{})}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     h.checkOrigin,
+	}
+	return h
+}
+
+// SetAllowedOrigins définit les origines acceptées lors de l'upgrade WebSocket,
+// en général les mêmes que celles du middleware CORS
+func (h *Handler) SetAllowedOrigins(origins []string) {
+	h.allowedOrigins = origins
+}
+
+// SetAllowedBindSources définit les chemins (et leurs sous-dossiers) que les
+// stacks déployées par un operator peuvent monter en bind ; les autres bind
+// mounts exigent le rôle admin
+func (h *Handler) SetAllowedBindSources(paths []string) {
+	h.allowedBindSources = paths
+}
+
+// SetMetrics branche le registre de métriques, qui compte les WebSockets de logs
+func (h *Handler) SetMetrics(m *metrics.Registry) {
+	h.metrics = m
 }
 
-func NewHandler(dc *client.Client) *Handler {
-	return &Handler{dockerClient: dc}
+// checkOrigin accepte les clients sans Origin (CLI, scripts), la même origine
+// que la requête et les origines configurées
+func (h *Handler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range h.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *Handler) ListNodes(c echo.Context) error {
@@ -54,42 +111,49 @@ func (h *Handler) ListNodes(c echo.Context) error {
 
 	var result []domain.Node
 	for _, n := range nodes {
-		// Extraire le rôle du nœud
-		role := "Worker"
-		if n.Spec.Role == swarm.NodeRoleManager {
-			role = "Manager"
-		}
+		result = append(result, toDomainNode(n))
+	}
+	return c.JSON(http.StatusOK, result)
+}
 
-		// Extraire les informations CPU et Memory
-		cpu := "Unknown"
-		memory := "Unknown"
-		if n.Description.Resources.NanoCPUs > 0 {
-			cpuCores := float64(n.Description.Resources.NanoCPUs) / 1e9
-			cpu = fmt.Sprintf("%.1f cores", cpuCores)
-		}
-		if n.Description.Resources.MemoryBytes > 0 {
-			memoryGB := float64(n.Description.Resources.MemoryBytes) / (1024 * 1024 * 1024)
-			memory = fmt.Sprintf("%.1f GB", memoryGB)
-		}
+// toDomainNode résume une node, avec sa capacité formatée et brute
+func toDomainNode(n swarm.Node) domain.Node {
+	// Extraire le rôle du nœud
+	role := "Worker"
+	if n.Spec.Role == swarm.NodeRoleManager {
+		role = "Manager"
+	}
 
-		// Extraire l'adresse IP
-		ipAddress := "Unknown"
-		if n.Status.Addr != "" {
-			ipAddress = n.Status.Addr
-		}
+	// Extraire les informations CPU et Memory
+	cpu := "Unknown"
+	memory := "Unknown"
+	cpuCores := float64(n.Description.Resources.NanoCPUs) / 1e9
+	if n.Description.Resources.NanoCPUs > 0 {
+		cpu = fmt.Sprintf("%.1f cores", cpuCores)
+	}
+	if n.Description.Resources.MemoryBytes > 0 {
+		memoryGB := float64(n.Description.Resources.MemoryBytes) / (1024 * 1024 * 1024)
+		memory = fmt.Sprintf("%.1f GB", memoryGB)
+	}
 
-		result = append(result, domain.Node{
-			ID:           n.ID,
-			Hostname:     n.Description.Hostname,
-			Status:       string(n.Status.State),
-			Availability: string(n.Spec.Availability),
-			Role:         role,
-			CPU:          cpu,
-			Memory:       memory,
-			IPAddress:    ipAddress,
-		})
+	// Extraire l'adresse IP
+	ipAddress := "Unknown"
+	if n.Status.Addr != "" {
+		ipAddress = n.Status.Addr
+	}
+
+	return domain.Node{
+		ID:           n.ID,
+		Hostname:     n.Description.Hostname,
+		Status:       string(n.Status.State),
+		Availability: string(n.Spec.Availability),
+		Role:         role,
+		CPU:          cpu,
+		Memory:       memory,
+		CPUCores:     cpuCores,
+		MemoryBytes:  n.Description.Resources.MemoryBytes,
+		IPAddress:    ipAddress,
 	}
-	return c.JSON(http.StatusOK, result)
 }
 
 func (h *Handler) ListStacks(c echo.Context) error {
@@ -103,6 +167,15 @@ func (h *Handler) ListStacks(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
+	// Un seul appel à TaskList pour tous les services, dont sont tirés les
+	// compteurs et la santé ; en cas d'erreur les compteurs restent à 0
+	tasks, err := h.listTasks(context.Background(), nil)
+	running := runningTasksByService(tasks)
+	var health map[string]string
+	if err == nil {
+		health = h.healthByService(services, tasks)
+	}
+
 	stacksMap := make(map[string][]domain.Service)
 
 	for _, s := range services {
@@ -113,39 +186,8 @@ func (h *Handler) ListStacks(c echo.Context) error {
 			stackName = "unassigned"
 		}
 
-		// Préparer les données du service avec des vérifications de sécurité
-		svc := domain.Service{
-			ID:           s.ID,
-			Name:         s.Spec.Name,
-			Image:        s.Spec.TaskTemplate.ContainerSpec.Image,
-			DesiredCount: 0,
-			CurrentCount: 0, // Par défaut à 0
-		}
-
-		// Récupérer le nombre de tâches en cours en utilisant TaskList
-		taskFilter := filters.NewArgs()
-		taskFilter.Add("service", s.ID)
-		taskFilter.Add("desired-state", "running") // Seulement les tâches en cours d'exécution
-		tasks, err := h.dockerClient.TaskList(context.Background(), dockerTypes.TaskListOptions{Filters: taskFilter})
-		if err == nil {
-			// Compter les tâches qui sont effectivement en cours d'exécution
-			runningTasks := 0
-			for _, task := range tasks {
-				if task.Status.State == swarm.TaskState("running") {
-					runningTasks++
-				}
-			}
-			svc.CurrentCount = uint64(runningTasks)
-		}
-
-		// Vérifier si le service est en mode Replicated et a des réplicas définies
-		if s.Spec.Mode.Replicated != nil && s.Spec.Mode.Replicated.Replicas != nil {
-			svc.DesiredCount = *s.Spec.Mode.Replicated.Replicas
-		} else if s.Spec.Mode.Global != nil {
-			// Pour les services en mode global, on utilise le nombre actuel comme nombre désiré
-			svc.DesiredCount = svc.CurrentCount
-		}
-
+		svc := toDomainService(s, running[s.ID])
+		svc.Health = health[s.ID]
 		stacksMap[stackName] = append(stacksMap[stackName], svc)
 	}
 
@@ -172,46 +214,29 @@ func (h *Handler) GetStack(c echo.Context) error {
 	}
 
 	var result []domain.Service
-	for _, s := range services {
-		// Préparer les données du service avec des vérifications de sécurité
-		svc := domain.Service{
-			ID:           s.ID,
-			Name:         s.Spec.Name,
-			Image:        s.Spec.TaskTemplate.ContainerSpec.Image,
-			DesiredCount: 0,
-			CurrentCount: 0, // Par défaut à 0
-		}
-
-		// Récupérer le nombre de tâches en cours en utilisant TaskList
-		taskFilter := filters.NewArgs()
-		taskFilter.Add("service", s.ID)
-		taskFilter.Add("desired-state", "running") // Seulement les tâches en cours d'exécution
-		tasks, err := h.dockerClient.TaskList(context.Background(), dockerTypes.TaskListOptions{Filters: taskFilter})
-		if err == nil {
-			// Compter les tâches qui sont effectivement en cours d'exécution
-			runningTasks := 0
-			for _, task := range tasks {
-				if task.Status.State == swarm.TaskState("running") {
-					runningTasks++
-				}
-			}
-			svc.CurrentCount = uint64(runningTasks)
-		}
-
-		// Vérifier si le service est en mode Replicated et a des réplicas définies
-		if s.Spec.Mode.Replicated != nil && s.Spec.Mode.Replicated.Replicas != nil {
-			svc.DesiredCount = *s.Spec.Mode.Replicated.Replicas
-		} else if s.Spec.Mode.Global != nil {
-			// Pour les services en mode global, on utilise le nombre actuel comme nombre désiré
-			svc.DesiredCount = svc.CurrentCount
-		}
+	if len(services) == 0 {
+		return c.JSON(http.StatusOK, result)
+	}
 
+	// Un seul appel à TaskList pour tous les services de la stack
+	tasks, err := h.listTasks(context.Background(), serviceIDs(services))
+	running := runningTasksByService(tasks)
+	var health map[string]string
+	if err == nil {
+		health = h.healthByService(services, tasks)
+	}
+	for _, s := range services {
+		svc := toDomainService(s, running[s.ID])
+		svc.Health = health[s.ID]
 		result = append(result, svc)
 	}
 
 	return c.JSON(http.StatusOK, result)
 }
 
+// StopStack passe les services répliqués d'une stack à 0 réplicas en
+// mémorisant leur nombre. Chaque service est traité même si un autre échoue,
+// et la réponse donne l'état de chacun.
 func (h *Handler) StopStack(c echo.Context) error {
 	// Vérifier que le client Docker est initialisé
 	if h == nil || h.dockerClient == nil {
@@ -225,20 +250,31 @@ func (h *Handler) StopStack(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	result := []domain.ServiceReplicas{}
 	for _, s := range services {
 		spec := s.Spec
-		if spec.Mode.Replicated != nil {
-			zero := uint64(0)
-			spec.Mode.Replicated.Replicas = &zero
+		if spec.Mode.Replicated == nil {
+			continue
+		}
+		// La spec partage Mode.Replicated avec s.Spec : relever le nombre avant
+		current := replicaCount(spec)
+		status := domain.ServiceReplicas{ID: s.ID, Name: s.Spec.Name}
+		// Mémoriser le nombre de réplicas pour que StartStack puisse le restaurer
+		if stopReplicas(&spec) {
 			_, err = h.dockerClient.ServiceUpdate(context.Background(), s.ID, s.Version, spec, dockerTypes.ServiceUpdateOptions{})
 			if err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				status.Replicas = current
+				status.Error = err.Error()
 			}
 		}
+		result = append(result, status)
 	}
-	return c.NoContent(http.StatusNoContent)
+	return stackReplicasResponse(c, name, result)
 }
 
+// StartStack restaure le nombre de réplicas mémorisé par StopStack. Les
+// services à 0 sans nombre mémorisé n'ont pas été arrêtés par StopStack et
+// restent à 0. Chaque service est traité même si un autre échoue.
 func (h *Handler) StartStack(c echo.Context) error {
 	// Vérifier que le client Docker est initialisé
 	if h == nil || h.dockerClient == nil {
@@ -252,17 +288,45 @@ func (h *Handler) StartStack(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	result := []domain.ServiceReplicas{}
 	for _, s := range services {
 		spec := s.Spec
-		if spec.Mode.Replicated != nil {
-			// replicas already set to desired count in spec
+		if spec.Mode.Replicated == nil {
+			continue
+		}
+		current := replicaCount(spec)
+		// Restaurer le nombre de réplicas mémorisé par StopStack
+		replicas, restored, changed := startReplicas(&spec, 0)
+		status := domain.ServiceReplicas{ID: s.ID, Name: s.Spec.Name, Replicas: replicas, Restored: restored}
+		if changed {
 			_, err = h.dockerClient.ServiceUpdate(context.Background(), s.ID, s.Version, spec, dockerTypes.ServiceUpdateOptions{})
 			if err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				status = domain.ServiceReplicas{ID: s.ID, Name: s.Spec.Name, Replicas: current, Error: err.Error()}
 			}
 		}
+		result = append(result, status)
 	}
-	return c.NoContent(http.StatusNoContent)
+	return stackReplicasResponse(c, name, result)
+}
+
+// stackReplicasResponse renvoie l'état des services d'une stack après un
+// arrêt ou un démarrage, avec 500 si l'un d'eux n'a pas pu être modifié
+func stackReplicasResponse(c echo.Context, name string, services []domain.ServiceReplicas) error {
+	response := map[string]interface{}{
+		"stack":    name,
+		"services": services,
+	}
+	failed := 0
+	for _, s := range services {
+		if s.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		response["error"] = fmt.Sprintf("%d of %d services could not be updated", failed, len(services))
+		return c.JSON(http.StatusInternalServerError, response)
+	}
+	return c.JSON(http.StatusOK, response)
 }
 
 func (h *Handler) ListImages(c echo.Context) error {
@@ -312,9 +376,9 @@ func (h *Handler) StopService(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 	spec := svc.Spec
-	if spec.Mode.Replicated != nil {
-		zero := uint64(0)
-		spec.Mode.Replicated.Replicas = &zero
+	// Mémoriser le nombre de réplicas pour que StartService puisse le restaurer
+	if !stopReplicas(&spec) {
+		return c.NoContent(http.StatusNoContent)
 	}
 	_, err = h.dockerClient.ServiceUpdate(context.Background(), id, svc.Version, spec, dockerTypes.ServiceUpdateOptions{})
 	if err != nil {
@@ -323,6 +387,38 @@ func (h *Handler) StopService(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+// StartService redémarre un service arrêté avec son nombre de réplicas précédent
+func (h *Handler) StartService(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	id := c.Param("id")
+	svc, _, err := h.dockerClient.ServiceInspectWithRaw(context.Background(), id, dockerTypes.ServiceInspectOptions{})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if svc.Spec.Mode.Replicated == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "service " + svc.Spec.Name + " is not in replicated mode"})
+	}
+
+	spec := svc.Spec
+	replicas, restored, changed := startReplicas(&spec, defaultStartReplicas)
+	if changed {
+		_, err = h.dockerClient.ServiceUpdate(context.Background(), svc.ID, svc.Version, spec, dockerTypes.ServiceUpdateOptions{})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+	return c.JSON(http.StatusOK, domain.ServiceReplicas{
+		ID:       svc.ID,
+		Name:     svc.Spec.Name,
+		Replicas: replicas,
+		Restored: restored,
+	})
+}
+
 func (h *Handler) RestartService(c echo.Context) error {
 	// Vérifier que le client Docker est initialisé
 	if h == nil || h.dockerClient == nil {
@@ -343,130 +439,35 @@ func (h *Handler) RestartService(c echo.Context) error {
 	return c.NoContent(http.StatusNoContent)
 }
 
+// ServiceLogs diffuse les logs d'un service sur une WebSocket, une ligne par
+// message (texte, ou JSON avec le sous-protocole logs.Protocol)
 func (h *Handler) ServiceLogs(c echo.Context) error {
 	// Vérifier que le client Docker est initialisé
 	if h == nil || h.dockerClient == nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
 	}
 
-	// Upgrade HTTP connection to WebSocket
-	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	// Filtres et politique de débordement
+	session, err := h.newLogSession(c, false, "")
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not upgrade to WebSocket: " + err.Error()})
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
-	defer ws.Close()
 
-	id := c.Param("id")
-
-	// Configuration des options de logs Docker
-	opts := container.LogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Follow:     true,
-		Timestamps: true,
+	// Upgrade HTTP connection to WebSocket
+	if err := session.upgrade(c); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not upgrade to WebSocket: " + err.Error()})
 	}
+	defer session.ws.Close()
 
-	// Obtenir le reader de logs
-	reader, err := h.dockerClient.ServiceLogs(context.Background(), id, opts)
+	// Le mode TTY du service détermine le format du flux
+	svc, _, err := h.dockerClient.ServiceInspectWithRaw(context.Background(), c.Param("id"), dockerTypes.ServiceInspectOptions{})
 	if err != nil {
-		ws.WriteMessage(websocket.TextMessage, []byte("Error: "+err.Error()))
+		session.fail(err)
 		return nil
 	}
-	defer reader.Close()
-
-	// Canal pour signaler la fermeture de la connexion
-	done := make(chan struct{})
-
-	// Gérer les messages entrants du client (fermeture de connexion)
-	go func() {
-		defer close(done)
-		for {
-			_, _, err := ws.ReadMessage()
-			if err != nil {
-				// Client a fermé la connexion ou erreur de lecture
-				return
-			}
-		}
-	}()
-
-	// Utiliser un buffer pour traiter les données binaires de Docker
-	buffer := make([]byte, 8192)               // Buffer de taille raisonnable pour la lecture
-	ticker := time.NewTicker(30 * time.Second) // Heartbeat pour maintenir la connexion
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-done:
-			// Client a fermé la connexion
-			return nil
-		case <-ticker.C:
-			// Envoyer un heartbeat
-			if err := ws.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
-				return nil
-			}
-		default:
-			// Lire à partir du flux de logs
-			n, err := reader.Read(buffer)
-			if n > 0 {
-				// Convertir les données binaires en string et diviser par lignes
-				logData := string(buffer[:n])
-				lines := strings.SplitSeq(logData, "\n")
-
-				for line := range lines {
-					// Ignorer les lignes vides
-					if strings.TrimSpace(line) == "" {
-						continue
-					}
-
-					// Enlever les 8 premiers octets de chaque ligne
-					if len(line) > 8 {
-						line = line[8:]
-					}
-
-					// Nettoyer et envoyer ligne par ligne
-					cleanLine := strings.TrimSpace(line)
-					if cleanLine != "" {
-						formattedLog := cleanLine + "\n"
-						cleanMsg := strings.ToValidUTF8(formattedLog, "")
-						if err := ws.WriteMessage(websocket.TextMessage, []byte(cleanMsg)); err != nil {
-							return nil
-						}
-					}
-				}
-			}
-			if err != nil {
-				if err == io.EOF {
-					// Fin normale du flux
-					time.Sleep(100 * time.Millisecond)
-					continue
-				}
-				// Erreur de lecture
-				errMsg := fmt.Sprintf("Error reading logs: %s", err.Error())
-				ws.WriteMessage(websocket.TextMessage, []byte(errMsg))
-				return nil
-			}
-		}
-	}
-}
-
-func (h *Handler) DrainNode(c echo.Context) error {
-	// Vérifier que le client Docker est initialisé
-	if h == nil || h.dockerClient == nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
-	}
 
-	id := c.Param("id")
-	node, _, err := h.dockerClient.NodeInspectWithRaw(context.Background(), id)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	}
-	spec := node.Spec
-	spec.Availability = swarm.NodeAvailabilityDrain
-	err = h.dockerClient.NodeUpdate(context.Background(), id, node.Version, spec)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	}
-	return c.NoContent(http.StatusNoContent)
+	session.run([]swarm.Service{svc})
+	return nil
 }
 
 func (h *Handler) ActivateNode(c echo.Context) error {
@@ -502,6 +503,10 @@ func (h *Handler) PruneImages(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
 	}
 
+	if c.QueryParam("scope") == "cluster" {
+		return h.pruneCluster(c, prune.KindImages)
+	}
+
 	report, err := h.dockerClient.ImagesPrune(context.Background(), filters.NewArgs())
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -522,6 +527,10 @@ func (h *Handler) PruneContainers(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
 	}
 
+	if c.QueryParam("scope") == "cluster" {
+		return h.pruneCluster(c, prune.KindContainers)
+	}
+
 	report, err := h.dockerClient.ContainersPrune(context.Background(), filters.NewArgs())
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -542,6 +551,10 @@ func (h *Handler) PruneVolumes(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
 	}
 
+	if c.QueryParam("scope") == "cluster" {
+		return h.pruneCluster(c, prune.KindVolumes)
+	}
+
 	report, err := h.dockerClient.VolumesPrune(context.Background(), filters.NewArgs())
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -562,6 +575,10 @@ func (h *Handler) PruneNetworks(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
 	}
 
+	if c.QueryParam("scope") == "cluster" {
+		return h.pruneCluster(c, prune.KindNetworks)
+	}
+
 	report, err := h.dockerClient.NetworksPrune(context.Background(), filters.NewArgs())
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -581,6 +598,10 @@ func (h *Handler) PruneSystem(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
 	}
 
+	if c.QueryParam("scope") == "cluster" {
+		return h.pruneCluster(c, prune.KindSystem)
+	}
+
 	// Obtenir le paramètre all (supprimer aussi les images non utilisées)
 	all := c.QueryParam("all") == "true"
 
@@ -788,49 +809,35 @@ func (h *Handler) GetNodeServices(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
 
-	var nodeServices []domain.Service
+	// Un seul appel à TaskList pour toutes les tâches de la node
+	taskFilter := filters.NewArgs(filters.Arg("node", nodeID))
+	tasks, err := h.dockerClient.TaskList(context.Background(), dockerTypes.TaskListOptions{Filters: taskFilter})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
 
-	for _, s := range services {
-		// Récupérer les tâches pour ce service
-		taskFilter := filters.NewArgs()
-		taskFilter.Add("service", s.ID)
-		tasks, err := h.dockerClient.TaskList(context.Background(), dockerTypes.TaskListOptions{Filters: taskFilter})
-		if err != nil {
-			continue // Ignorer les erreurs et passer au service suivant
+	// Regrouper par service les tâches présentes sur cette node
+	hasTaskOnNode := make(map[string]bool)
+	runningTasksOnNode := make(map[string]uint64)
+	for _, task := range tasks {
+		hasTaskOnNode[task.ServiceID] = true
+		if task.Status.State == swarm.TaskStateRunning {
+			runningTasksOnNode[task.ServiceID]++
 		}
+	}
 
-		// Vérifier si ce service a des tâches sur cette node
-		hasTaskOnNode := false
-		runningTasksOnNode := 0
-		for _, task := range tasks {
-			if task.NodeID == nodeID {
-				hasTaskOnNode = true
-				if task.Status.State == swarm.TaskState("running") {
-					runningTasksOnNode++
-				}
-			}
+	var nodeServices []domain.Service
+	for _, s := range services {
+		if !hasTaskOnNode[s.ID] {
+			continue
 		}
-
-		if hasTaskOnNode {
-			// Préparer les données du service
-			svc := domain.Service{
-				ID:           s.ID,
-				Name:         s.Spec.Name,
-				Image:        s.Spec.TaskTemplate.ContainerSpec.Image,
-				DesiredCount: 0,
-				CurrentCount: uint64(runningTasksOnNode), // Nombre de tâches en cours sur cette node
-			}
-
-			// Déterminer le nombre désiré de réplicas
-			if s.Spec.Mode.Replicated != nil && s.Spec.Mode.Replicated.Replicas != nil {
-				svc.DesiredCount = *s.Spec.Mode.Replicated.Replicas
-			} else if s.Spec.Mode.Global != nil {
-				// Pour les services en mode global, chaque node active devrait avoir une tâche
-				svc.DesiredCount = 1
-			}
-
-			nodeServices = append(nodeServices, svc)
+		// Nombre de tâches en cours sur cette node
+		svc := toDomainService(s, runningTasksOnNode[s.ID])
+		if s.Spec.Mode.Global != nil {
+			// Pour les services en mode global, chaque node active devrait avoir une tâche
+			svc.DesiredCount = 1
 		}
+		nodeServices = append(nodeServices, svc)
 	}
 
 	return c.JSON(http.StatusOK, nodeServices)
@@ -942,26 +949,26 @@ func (h *Handler) SwarmLogs(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
 	}
 
-	// Mise à niveau vers WebSocket
-	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	// Filtres et politique de débordement ; par défaut, dernières 50 lignes de chaque service
+	session, err := h.newLogSession(c, true, "50")
 	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Mise à niveau vers WebSocket
+	if err := session.upgrade(c); err != nil {
 		return err
 	}
-	defer ws.Close()
+	defer session.ws.Close()
 
-	// Paramètres de requête pour filtres (search est géré côté client)
+	// Sélection des services
 	stackFilter := c.QueryParam("stack")
 	serviceFilter := c.QueryParam("service")
-	// searchTerm est supprimé - le filtrage de recherche se fait côté client
-
-	// Context avec timeout
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
 
 	// Récupérer tous les services du swarm
-	services, err := h.dockerClient.ServiceList(ctx, dockerTypes.ServiceListOptions{})
+	services, err := h.dockerClient.ServiceList(context.Background(), dockerTypes.ServiceListOptions{})
 	if err != nil {
-		ws.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("Error getting services: %s", err.Error())))
+		session.fail(fmt.Errorf("getting services: %w", err))
 		return nil
 	}
 
@@ -987,146 +994,6 @@ func (h *Handler) SwarmLogs(c echo.Context) error {
 		filteredServices = append(filteredServices, service)
 	}
 
-	// Canal pour les messages WebSocket
-	messages := make(chan string, 100)
-	done := make(chan struct{})
-
-	// Goroutine pour lire les messages WebSocket du client (pour gérer les déconnexions)
-	go func() {
-		defer close(done)
-		for {
-			_, _, err := ws.ReadMessage()
-			if err != nil {
-				return
-			}
-		}
-	}()
-
-	// Goroutine pour chaque service pour streamer les logs
-	for _, service := range filteredServices {
-		go func(svc swarm.Service) {
-			serviceName := svc.Spec.Name
-
-			// Configuration des options de logs
-			opts := container.LogsOptions{
-				ShowStdout: true,
-				ShowStderr: true,
-				Follow:     true,
-				Tail:       "50", // Dernières 50 lignes
-				Timestamps: true,
-			}
-
-			// Obtenir le reader de logs
-			reader, err := h.dockerClient.ServiceLogs(ctx, svc.ID, opts)
-			if err != nil {
-				messages <- fmt.Sprintf("[ERROR] %s: Failed to get logs: %s", serviceName, err.Error())
-				return
-			}
-			defer reader.Close()
-
-			// Buffer pour lire les logs
-			buf := make([]byte, 4096)
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-done:
-					return
-				default:
-					n, err := reader.Read(buf)
-					if err != nil {
-						if err != io.EOF {
-							messages <- fmt.Sprintf("[ERROR] %s: Error reading logs: %s", serviceName, err.Error())
-						}
-						return
-					}
-
-					if n > 0 {
-						// Convertir les données binaires en string
-						logData := string(buf[:n])
-
-						// Diviser par lignes
-						lines := strings.SplitSeq(logData, "\n")
-						for line := range lines {
-							// Ignorer les lignes vides
-							if strings.TrimSpace(line) == "" {
-								continue
-							}
-
-							if len(line) > 8 {
-								line = line[8:]
-							}
-
-							// Le filtrage par terme de recherche est géré côté client
-							// Préfixer avec le nom du service et nettoyer
-							formattedLog := fmt.Sprintf("[%s] %s\n", serviceName, strings.TrimSpace(line))
-
-							select {
-							case messages <- formattedLog:
-							case <-ctx.Done():
-								return
-							case <-done:
-								return
-							default:
-								// Canal plein, ignorer ce message
-							}
-						}
-					}
-				}
-			}
-		}(service)
-	}
-
-	// Goroutine pour envoyer les messages via WebSocket
-	go func() {
-		ticker := time.NewTicker(100 * time.Millisecond) // Batch messages
-		defer ticker.Stop()
-
-		var batch []string
-
-		for {
-			select {
-			case msg := <-messages:
-				batch = append(batch, msg)
-
-				if len(batch) >= 10 {
-					combinedMsg := ""
-					for _, m := range batch {
-						combinedMsg += m
-					}
-
-					cleanMsg := strings.ToValidUTF8(combinedMsg, "")
-					err := ws.WriteMessage(websocket.TextMessage, []byte(cleanMsg))
-					if err != nil {
-						return
-					}
-					batch = nil
-				}
-
-			case <-ticker.C:
-				if len(batch) > 0 {
-					combinedMsg := ""
-					for _, m := range batch {
-						combinedMsg += m
-					}
-
-					cleanMsg := strings.ToValidUTF8(combinedMsg, "")
-					err := ws.WriteMessage(websocket.TextMessage, []byte(cleanMsg))
-					if err != nil {
-						return
-					}
-					batch = nil
-				}
-
-			case <-done:
-				return
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
-	// Attendre la fermeture de la connexion
-	<-done
+	session.run(filteredServices)
 	return nil
 }
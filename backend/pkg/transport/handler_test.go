@@ -0,0 +1,244 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+// newTestServer monte les routes de l'API sur un swarm en mémoire, sans
+// authentification
+func newTestServer(t *testing.T) (*infratest.FakeSwarm, *echo.Echo) {
+	t.Helper()
+	f := infratest.NewFakeSwarm()
+	h := NewHandler(f)
+	e := echo.New()
+	e.GET("/nodes", h.ListNodes)
+	e.GET("/nodes/:id", h.GetNode)
+	e.GET("/nodes/:id/services", h.GetNodeServices)
+	e.POST("/nodes/:id/drain", h.DrainNode)
+	e.POST("/nodes/:id/activate", h.ActivateNode)
+	e.POST("/nodes/:id/promote", h.PromoteNode)
+	e.POST("/nodes/:id/demote", h.DemoteNode)
+	e.GET("/stacks", h.ListStacks)
+	e.GET("/stacks/:name", h.GetStack)
+	e.POST("/stacks/:name/stop", h.StopStack)
+	e.POST("/stacks/:name/start", h.StartStack)
+	e.POST("/services/:id/stop", h.StopService)
+	e.POST("/services/:id/start", h.StartService)
+	e.POST("/services/:id/scale", h.ScaleService)
+	e.GET("/services/:id/tasks", h.ListServiceTasks)
+	return f, e
+}
+
+// do envoie une requête au serveur de test et décode la réponse dans out
+func do(t *testing.T, e *echo.Echo, method, url, body string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if out != nil && rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: invalid response %q: %v", method, url, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func replicated(name string, replicas uint64, labels map[string]string) swarm.ServiceSpec {
+	return swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: name, Labels: labels},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{Image: "nginx:1.27"},
+		},
+		Mode: swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}},
+	}
+}
+
+func TestListNodes(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	f.AddNode("w1", swarm.NodeRoleWorker)
+
+	var nodes []domain.Node
+	if code := do(t, e, http.MethodGet, "/nodes", "", &nodes); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("got %d nodes, want 2", len(nodes))
+	}
+	n := nodes[0]
+	if n.Role != "Manager" || n.CPU != "2.0 cores" || n.CPUCores != 2 || n.MemoryBytes != 4<<30 || n.Memory != "4.0 GB" {
+		t.Errorf("unexpected node %+v", n)
+	}
+}
+
+func TestStopStartServiceRestoresReplicas(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	svc := f.AddService(replicated("web", 3, nil))
+
+	if code := do(t, e, http.MethodPost, "/services/"+svc.ID+"/stop", "", nil); code != http.StatusNoContent {
+		t.Fatalf("stop: status = %d", code)
+	}
+	var started domain.ServiceReplicas
+	if code := do(t, e, http.MethodPost, "/services/"+svc.ID+"/start", "", &started); code != http.StatusOK {
+		t.Fatalf("start: status = %d", code)
+	}
+	if started.Replicas != 3 || !started.Restored {
+		t.Errorf("start = %+v, want 3 restored replicas", started)
+	}
+}
+
+// stackResponse est la réponse de StopStack et StartStack
+type stackResponse struct {
+	Services []domain.ServiceReplicas `json:"services"`
+	Error    string                   `json:"error"`
+}
+
+func (r stackResponse) byName() map[string]domain.ServiceReplicas {
+	result := make(map[string]domain.ServiceReplicas)
+	for _, s := range r.Services {
+		result[s.Name] = s
+	}
+	return result
+}
+
+func TestStopStartStack(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	stack := map[string]string{"com.docker.stack.namespace": "app"}
+	f.AddService(replicated("app_web", 3, stack))
+	// Service laissé volontairement à 0, sans avoir été arrêté par StopStack
+	idle := f.AddService(replicated("app_idle", 0, stack))
+
+	var resp stackResponse
+	if code := do(t, e, http.MethodPost, "/stacks/app/stop", "", &resp); code != http.StatusOK {
+		t.Fatalf("stop: status = %d", code)
+	}
+	if got := resp.byName(); len(got) != 2 || got["app_web"].Replicas != 0 || got["app_web"].Error != "" {
+		t.Errorf("stop = %+v", resp)
+	}
+
+	resp = stackResponse{}
+	if code := do(t, e, http.MethodPost, "/stacks/app/start", "", &resp); code != http.StatusOK {
+		t.Fatalf("start: status = %d", code)
+	}
+	got := resp.byName()
+	if web := got["app_web"]; web.Replicas != 3 || !web.Restored {
+		t.Errorf("start web = %+v, want 3 restored replicas", web)
+	}
+	if got["app_idle"].Replicas != 0 {
+		t.Errorf("start idle = %+v, want it left at 0", got["app_idle"])
+	}
+	svc, _, _ := f.ServiceInspectWithRaw(context.Background(), idle.ID, dockerTypes.ServiceInspectOptions{})
+	if *svc.Spec.Mode.Replicated.Replicas != 0 {
+		t.Errorf("idle service started with %d replicas", *svc.Spec.Mode.Replicated.Replicas)
+	}
+
+	// StartService démarre quand même un service à 0 sans nombre mémorisé
+	var started domain.ServiceReplicas
+	if code := do(t, e, http.MethodPost, "/services/"+idle.ID+"/start", "", &started); code != http.StatusOK || started.Replicas != 1 {
+		t.Errorf("start idle service: status = %d, %+v, want 1 replica", code, started)
+	}
+}
+
+func TestStopStackReportsFailures(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	stack := map[string]string{"com.docker.stack.namespace": "app"}
+	f.AddService(replicated("app_api", 2, stack))
+	f.AddService(replicated("app_web", 3, stack))
+	f.FailOnce("ServiceUpdate", errors.New("update out of sequence"))
+
+	var resp stackResponse
+	if code := do(t, e, http.MethodPost, "/stacks/app/stop", "", &resp); code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", code)
+	}
+	got := resp.byName()
+	// Le premier service est resté en place, le second a quand même été arrêté
+	if api := got["app_api"]; api.Error == "" || api.Replicas != 2 {
+		t.Errorf("api = %+v, want an error and 2 replicas", api)
+	}
+	if web := got["app_web"]; web.Error != "" || web.Replicas != 0 {
+		t.Errorf("web = %+v, want stopped", web)
+	}
+	if resp.Error != "1 of 2 services could not be updated" {
+		t.Errorf("error = %q", resp.Error)
+	}
+}
+
+// seedStacks crée count services répartis sur trois stacks et trois nodes
+func seedStacks(f *infratest.FakeSwarm, count int) swarm.Node {
+	node := f.AddNode("m1", swarm.NodeRoleManager)
+	f.AddNode("w1", swarm.NodeRoleWorker)
+	f.AddNode("w2", swarm.NodeRoleWorker)
+	for i := 0; i < count; i++ {
+		stack := fmt.Sprintf("stack%d", i%3)
+		f.AddService(replicated(fmt.Sprintf("%s_svc%d", stack, i), 2, map[string]string{"com.docker.stack.namespace": stack}))
+	}
+	return node
+}
+
+// Le nombre d'appels à TaskList ne dépend pas du nombre de services
+func TestStackViewsCallTaskListOnce(t *testing.T) {
+	for _, count := range []int{1, 10, 100} {
+		t.Run(fmt.Sprintf("%d services", count), func(t *testing.T) {
+			f, e := newTestServer(t)
+			node := seedStacks(f, count)
+
+			for _, url := range []string{"/stacks", "/stacks/stack0", "/nodes/" + node.ID + "/services"} {
+				f.ResetCalls()
+				if code := do(t, e, http.MethodGet, url, "", nil); code != http.StatusOK {
+					t.Fatalf("%s: status = %d", url, code)
+				}
+				if calls := f.Calls("TaskList"); calls != 1 {
+					t.Errorf("%s: TaskList called %d times, want 1", url, calls)
+				}
+			}
+
+			var stacks []domain.Stack
+			do(t, e, http.MethodGet, "/stacks", "", &stacks)
+			services := 0
+			for _, stack := range stacks {
+				for _, s := range stack.Services {
+					services++
+					if s.CurrentCount != 2 {
+						t.Errorf("%s: %d running, want 2", s.Name, s.CurrentCount)
+					}
+				}
+			}
+			if services != count {
+				t.Errorf("got %d services, want %d", services, count)
+			}
+		})
+	}
+}
+
+func BenchmarkListStacks(b *testing.B) {
+	f := infratest.NewFakeSwarm()
+	seedStacks(f, 300)
+	h := NewHandler(f)
+	e := echo.New()
+	e.GET("/stacks", h.ListStacks)
+
+	f.ResetCalls()
+	for i := 0; i < b.N; i++ {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stacks", nil))
+	}
+	b.ReportMetric(float64(f.Calls("TaskList"))/float64(b.N), "tasklist/op")
+}
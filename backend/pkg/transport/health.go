@@ -0,0 +1,257 @@
+package transport
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+	"github.com/Affell/swarm-manager/backend/pkg/events"
+)
+
+const (
+	// Fenêtre sur laquelle les redémarrages sont comptés
+	defaultHealthWindow = 10 * time.Minute
+	// Redémarrages d'un même slot sur la fenêtre à partir desquels le service
+	// est considéré comme instable
+	defaultRestartThreshold = 3
+)
+
+// ServicesHealth renvoie les services instables ou dégradés, avec leur
+// dernière erreur. window (10m par défaut) et threshold (3 redémarrages d'un
+// même slot par défaut) règlent la détection ; all=true inclut les services sains.
+func (h *Handler) ServicesHealth(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	window := defaultHealthWindow
+	if v := c.QueryParam("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid window"})
+		}
+		window = d
+	}
+	threshold := defaultRestartThreshold
+	if v := c.QueryParam("threshold"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid threshold"})
+		}
+		threshold = n
+	}
+	all := c.QueryParam("all") == "true"
+
+	ctx := c.Request().Context()
+	services, err := h.dockerClient.ServiceList(ctx, dockerTypes.ServiceListOptions{})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	tasks, err := h.listTasks(ctx, nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	health := h.servicesHealth(services, tasks, window, threshold)
+
+	report := domain.HealthReport{Window: window.String(), Threshold: threshold, Services: []domain.ServiceHealth{}}
+	for _, s := range services {
+		if sh := health[s.ID]; all || sh.Status != domain.HealthHealthy {
+			report.Services = append(report.Services, sh)
+		}
+	}
+	sort.SliceStable(report.Services, func(i, j int) bool {
+		a, b := report.Services[i], report.Services[j]
+		if healthRank[a.Status] != healthRank[b.Status] {
+			return healthRank[a.Status] > healthRank[b.Status]
+		}
+		if a.Restarts != b.Restarts {
+			return a.Restarts > b.Restarts
+		}
+		return a.Name < b.Name
+	})
+	return c.JSON(http.StatusOK, report)
+}
+
+// healthRank ordonne les états du plus sain au plus grave
+var healthRank = map[string]int{
+	domain.HealthHealthy:   0,
+	domain.HealthDegraded:  1,
+	domain.HealthFlapping:  2,
+	domain.HealthCrashLoop: 3,
+}
+
+// servicesHealth évalue la santé des services à partir de leurs tâches,
+// historique compris, complétées par les événements de conteneurs conservés
+// par le watcher
+func (h *Handler) servicesHealth(services []swarm.Service, tasks []swarm.Task, window time.Duration, threshold int) map[string]domain.ServiceHealth {
+	byService := make(map[string][]swarm.Task)
+	for _, t := range tasks {
+		byService[t.ServiceID] = append(byService[t.ServiceID], t)
+	}
+
+	now := time.Now()
+	since := now.Add(-window)
+	died := make(map[string][]events.Event)
+	if h.eventWatcher != nil {
+		for _, e := range h.eventWatcher.History(events.HistoryFilter{Types: []string{events.TypeTask}, Since: since}) {
+			if e.Action == "die" {
+				died[e.ServiceID] = append(died[e.ServiceID], e)
+			}
+		}
+	}
+
+	result := make(map[string]domain.ServiceHealth, len(services))
+	for _, s := range services {
+		result[s.ID] = detectServiceHealth(s, byService[s.ID], died[s.ID], since, threshold)
+	}
+	return result
+}
+
+// slotState cumule les redémarrages d'un slot
+type slotState struct {
+	restarts    map[string]bool // IDs des tâches arrêtées sur la fenêtre
+	running     bool
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func (s *slotState) restart(taskID, err string, at time.Time) {
+	s.restarts[taskID] = true
+	if err != "" && !at.Before(s.lastErrorAt) {
+		s.lastError, s.lastErrorAt = err, at
+	}
+}
+
+// detectServiceHealth compte les redémarrages de chaque slot depuis since.
+// Une tâche arrêtée (failed, rejected, ou complete hors job) est un
+// redémarrage. Les événements die ne comptent que pour les tâches déjà
+// sorties de l'historique de TaskList et terminées avec un code non nul : ce
+// sont les seuls qu'ils apportent, et seuls les conteneurs de la node du
+// daemon interrogé y figurent.
+func detectServiceHealth(s swarm.Service, tasks []swarm.Task, died []events.Event, since time.Time, threshold int) domain.ServiceHealth {
+	var running uint64
+	for _, t := range tasks {
+		if t.DesiredState == swarm.TaskStateRunning && t.Status.State == swarm.TaskStateRunning {
+			running++
+		}
+	}
+	svc := toDomainService(s, running)
+	health := domain.ServiceHealth{
+		ID:           s.ID,
+		Name:         s.Spec.Name,
+		Stack:        s.Spec.Labels["com.docker.stack.namespace"],
+		Status:       domain.HealthHealthy,
+		DesiredCount: svc.DesiredCount,
+		CurrentCount: svc.CurrentCount,
+	}
+	// Les tâches des jobs se terminent normalement
+	if s.Spec.Mode.ReplicatedJob != nil || s.Spec.Mode.GlobalJob != nil {
+		return health
+	}
+
+	slots := make(map[string]*slotState)
+	slotOf := func(key string) *slotState {
+		if slots[key] == nil {
+			slots[key] = &slotState{restarts: make(map[string]bool)}
+		}
+		return slots[key]
+	}
+	known := make(map[string]bool, len(tasks))
+	for _, slot := range groupTaskSlots(tasks) {
+		state := slotOf(taskSlotKey(slot[0]))
+		state.running = slot[0].Status.State == swarm.TaskStateRunning
+		for _, t := range slot {
+			known[t.ID] = true
+			if isTaskRestart(t) && !t.Status.Timestamp.Before(since) {
+				state.restart(t.ID, t.Status.Err, t.Status.Timestamp)
+			}
+		}
+	}
+	for _, e := range died {
+		code := e.Attributes["exitCode"]
+		if known[e.TaskID] || code == "" || code == "0" || e.Time.Before(since) {
+			continue
+		}
+		slotOf(eventSlotKey(e)).restart(e.TaskID, "exit code "+code, e.Time)
+	}
+
+	var worst *slotState
+	for key, state := range slots {
+		if len(state.restarts) == 0 {
+			continue
+		}
+		sr := domain.SlotRestarts{Restarts: len(state.restarts), Running: state.running, LastError: state.lastError}
+		if slot, ok := strings.CutPrefix(key, "slot/"); ok {
+			sr.Slot, _ = strconv.Atoi(slot)
+		} else {
+			sr.NodeID = strings.TrimPrefix(key, "node/")
+		}
+		health.Slots = append(health.Slots, sr)
+		health.Restarts += sr.Restarts
+		if state.lastError != "" && (health.LastErrorAt == nil || state.lastErrorAt.After(*health.LastErrorAt)) {
+			at := state.lastErrorAt
+			health.LastError, health.LastErrorAt = state.lastError, &at
+		}
+		if len(state.restarts) >= threshold && (worst == nil || !state.running) {
+			worst = state
+		}
+	}
+	sort.SliceStable(health.Slots, func(i, j int) bool {
+		a, b := health.Slots[i], health.Slots[j]
+		if a.Restarts != b.Restarts {
+			return a.Restarts > b.Restarts
+		}
+		return a.Slot < b.Slot
+	})
+
+	switch {
+	case worst != nil && !worst.running:
+		health.Status = domain.HealthCrashLoop
+	case worst != nil:
+		health.Status = domain.HealthFlapping
+	case health.CurrentCount < health.DesiredCount:
+		health.Status = domain.HealthDegraded
+	}
+	return health
+}
+
+// isTaskRestart indique si la tâche s'est arrêtée sans qu'on le lui demande
+func isTaskRestart(t swarm.Task) bool {
+	switch t.Status.State {
+	case swarm.TaskStateFailed, swarm.TaskStateRejected, swarm.TaskStateComplete:
+		return true
+	}
+	return false
+}
+
+// eventSlotKey retrouve le slot d'un conteneur à partir de son nom
+// (service.slot.tâche pour un service répliqué, service.node.tâche pour un
+// service global), comme taskSlotKey
+func eventSlotKey(e events.Event) string {
+	parts := strings.Split(e.Name, ".")
+	if len(parts) >= 3 {
+		if slot, err := strconv.Atoi(parts[len(parts)-2]); err == nil && slot > 0 {
+			return fmt.Sprintf("slot/%d", slot)
+		}
+	}
+	return "node/" + e.NodeID
+}
+
+// healthByService renvoie l'état de santé de chaque service avec les réglages
+// par défaut
+func (h *Handler) healthByService(services []swarm.Service, tasks []swarm.Task) map[string]string {
+	health := h.servicesHealth(services, tasks, defaultHealthWindow, defaultRestartThreshold)
+	status := make(map[string]string, len(health))
+	for id, sh := range health {
+		status[id] = sh.Status
+	}
+	return status
+}
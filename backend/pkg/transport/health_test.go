@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+// addFailures ajoute au slot 1 du service des tâches arrêtées en erreur
+func addFailures(f *infratest.FakeSwarm, svc swarm.Service, count int) {
+	for i := 0; i < count; i++ {
+		f.AddTask(swarm.Task{
+			ServiceID:    svc.ID,
+			Slot:         1,
+			DesiredState: swarm.TaskStateShutdown,
+			Status: swarm.TaskStatus{
+				Timestamp: time.Now().Add(-time.Duration(i+1) * time.Minute),
+				State:     swarm.TaskStateFailed,
+				Err:       "task: non-zero exit (1)",
+			},
+		})
+	}
+}
+
+func TestServicesHealth(t *testing.T) {
+	f, e := newTestServer(t)
+	h := NewHandler(f)
+	e.GET("/health/services", h.ServicesHealth)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	f.AddService(replicated("ok", 1, nil))
+	flapping := f.AddService(replicated("flapping", 1, nil))
+	addFailures(f, flapping, 3)
+	crashing := f.AddService(replicated("crashing", 1, nil))
+	addFailures(f, crashing, 4)
+	tasks, _ := f.TaskList(context.Background(), dockerTypes.TaskListOptions{})
+	for _, task := range tasks {
+		if task.ServiceID == crashing.ID && task.Status.State == swarm.TaskStateRunning {
+			f.SetTaskState(task.ID, swarm.TaskStateFailed, "task: non-zero exit (1)")
+		}
+	}
+
+	var report domain.HealthReport
+	if code := do(t, e, http.MethodGet, "/health/services", "", &report); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	got := make(map[string]string)
+	for _, s := range report.Services {
+		got[s.Name] = s.Status
+	}
+	want := map[string]string{"crashing": domain.HealthCrashLoop, "flapping": domain.HealthFlapping}
+	if len(got) != len(want) || got["crashing"] != want["crashing"] || got["flapping"] != want["flapping"] {
+		t.Errorf("health = %v, want %v", got, want)
+	}
+	if report.Services[0].Name != "crashing" {
+		t.Errorf("first service = %s, want the crash-looping one", report.Services[0].Name)
+	}
+
+	if code := do(t, e, http.MethodGet, "/health/services?window=nope", "", nil); code != http.StatusBadRequest {
+		t.Errorf("invalid window: status = %d, want 400", code)
+	}
+}
+
+func TestListStacksHealth(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	stack := map[string]string{"com.docker.stack.namespace": "app"}
+	f.AddService(replicated("app_web", 2, stack))
+	worker := f.AddService(replicated("app_worker", 1, stack))
+	addFailures(f, worker, 3)
+
+	f.ResetCalls()
+	var stacks []domain.Stack
+	if code := do(t, e, http.MethodGet, "/stacks", "", &stacks); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	// Compteurs et santé viennent du même appel
+	if calls := f.Calls("TaskList"); calls != 1 {
+		t.Errorf("TaskList called %d times, want 1", calls)
+	}
+	if len(stacks) != 1 {
+		t.Fatalf("got %d stacks, want 1", len(stacks))
+	}
+	for _, s := range stacks[0].Services {
+		want := domain.HealthHealthy
+		if s.Name == "app_worker" {
+			want = domain.HealthFlapping
+		}
+		if s.Health != want || s.CurrentCount != s.DesiredCount {
+			t.Errorf("%s: health %s, %d/%d running, want %s", s.Name, s.Health, s.CurrentCount, s.DesiredCount, want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package transport
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/logs"
+)
+
+const (
+	// Fenêtre téléchargée quand ni since ni tail ne sont précisés
+	defaultLogDownloadWindow = "1h"
+	// Lignes retenues par service pour remettre ses tâches dans l'ordre
+	logDownloadReorderLines = 10000
+)
+
+// Caractères retirés du nom des fichiers téléchargés
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// DownloadServiceLogs renvoie les logs d'un service sur une fenêtre since/until,
+// sans suivre le flux
+func (h *Handler) DownloadServiceLogs(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	svc, _, err := h.dockerClient.ServiceInspectWithRaw(context.Background(), c.Param("id"), dockerTypes.ServiceInspectOptions{})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	return h.downloadLogs(c, svc.Spec.Name, []swarm.Service{svc}, false)
+}
+
+// DownloadStackLogs renvoie les logs de tous les services d'une stack sur une
+// fenêtre since/until, fusionnés par horodatage
+func (h *Handler) DownloadStackLogs(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	name := c.Param("name")
+	services, err := h.dockerClient.ServiceList(context.Background(), dockerTypes.ServiceListOptions{Filters: stackFilter(name)})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if len(services) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "stack " + name + " not found"})
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Spec.Name < services[j].Spec.Name })
+	return h.downloadLogs(c, name, services, true)
+}
+
+// downloadLogs lit les logs des services sans suivi (Follow=false), les
+// fusionne par horodatage et les écrit en texte (?format=text, par défaut) ou
+// en NDJSON (?format=ndjson), compressés avec ?compress=gzip. Les filtres des
+// WebSockets de logs s'appliquent ; sans since ni tail, la dernière heure est renvoyée.
+func (h *Handler) downloadLogs(c echo.Context, name string, services []swarm.Service, withService bool) error {
+	spec := logFilterSpec(c, "")
+	if spec.Since == "" && spec.Tail == "" {
+		spec.Since = defaultLogDownloadWindow
+	}
+	now := time.Now()
+	filter, err := spec.Compile(now)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	format := c.QueryParam("format")
+	contentType, ext := echo.MIMETextPlainCharsetUTF8, ".log"
+	switch format {
+	case "", "text":
+	case "ndjson":
+		contentType, ext = mimeNDJSON, ".ndjson"
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid format (text or ndjson)"})
+	}
+	compress := c.QueryParam("compress")
+	switch compress {
+	case "":
+	case "gzip":
+		contentType, ext = "application/gzip", ext+".gz"
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid compress (gzip)"})
+	}
+
+	// Ouvrir tous les flux avant d'envoyer les en-têtes pour pouvoir signaler une erreur
+	ctx := c.Request().Context()
+	opts := container.LogsOptions{Tail: spec.Tail, Since: dockerSince(filter.Since())}
+	sources := make([]logs.Source, 0, len(services))
+	for _, svc := range services {
+		dec, reader, err := h.openServiceLogs(ctx, svc, opts)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to get logs of " + svc.Spec.Name + ": " + err.Error()})
+		}
+		defer reader.Close()
+		sources = append(sources, logs.Reorder(dec, logDownloadReorderLines))
+	}
+
+	filename := unsafeFilenameChars.ReplaceAllString(name, "_") + "-logs-" + now.UTC().Format("20060102T150405Z") + ext
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Response().WriteHeader(http.StatusOK)
+
+	var out io.Writer = c.Response()
+	if compress == "gzip" {
+		gz := gzip.NewWriter(out)
+		defer gz.Close()
+		out = gz
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+
+	merged := logs.Merge(sources...)
+	for {
+		line, err := merged.Next()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				// Les en-têtes sont partis : l'erreur ne peut plus être renvoyée au client
+				c.Logger().Errorf("log download of %s interrupted: %v", name, err)
+			}
+			return nil
+		}
+		if !filter.Match(line) {
+			continue
+		}
+		msg := logs.LogMessage(line)
+		if format == "ndjson" {
+			err = enc.Encode(msg)
+		} else {
+			_, err = w.WriteString(formatLogText(msg, withService))
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
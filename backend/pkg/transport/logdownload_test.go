@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/compose"
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+func TestDownloadStackLogs(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	h := NewHandler(f)
+	e := echo.New()
+	e.GET("/stacks/:name/logs/download", h.DownloadStackLogs)
+
+	const stack = `app";filename=evil.sh`
+	spec := replicated("app_web", 2, map[string]string{compose.LabelNamespace: stack})
+	spec.TaskTemplate.ContainerSpec.TTY = true
+	svc := f.AddService(spec)
+	// Le daemon entrelace les tâches dans l'ordre d'arrivée
+	f.SetServiceLogs(svc.ID, []byte(strings.Join([]string{
+		"2024-01-01T00:00:01.000000000Z com.docker.swarm.task.id=t1 one",
+		"2024-01-01T00:00:03.000000000Z com.docker.swarm.task.id=t1 three",
+		"2024-01-01T00:00:02.000000000Z com.docker.swarm.task.id=t2 two",
+		"2024-01-01T00:00:04.000000000Z com.docker.swarm.task.id=t2 four",
+	}, "\n")+"\n"))
+
+	req := httptest.NewRequest(http.MethodGet, "/stacks/"+stack+"/logs/download?since=2023-12-31T00:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		messages = append(messages, line[strings.LastIndexByte(line, ' ')+1:])
+	}
+	if got := strings.Join(messages, " "); got != "one two three four" {
+		t.Errorf("messages = %q, want them sorted by timestamp", got)
+	}
+
+	disposition, params, err := mime.ParseMediaType(rec.Header().Get(echo.HeaderContentDisposition))
+	if err != nil || disposition != "attachment" || len(params) != 1 || !strings.HasPrefix(params["filename"], "app_filename_evil.sh-logs-") {
+		t.Errorf("Content-Disposition = %q", rec.Header().Get(echo.HeaderContentDisposition))
+	}
+}
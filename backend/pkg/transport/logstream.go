@@ -0,0 +1,510 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/logs"
+	"github.com/Affell/swarm-manager/backend/pkg/metrics"
+)
+
+const (
+	// Heartbeat pour maintenir les connexions de logs ouvertes
+	logHeartbeatInterval = 30 * time.Second
+	// Regroupement des messages des logs du swarm
+	logBatchInterval = 100 * time.Millisecond
+	logBatchSize     = 10
+	// Tampon par connexion, modifiable avec ?buffer=
+	defaultLogBufferSize = 100
+	maxLogBufferSize     = 10000
+	// Fréquence des messages dropped
+	logDroppedInterval = 5 * time.Second
+)
+
+// Politiques appliquées quand le tampon d'une connexion de logs est plein
+const (
+	// Les lectures attendent le client : rien n'est perdu, mais un client lent
+	// ralentit la lecture des flux
+	backpressureBlock = "block"
+	// Les lignes les plus anciennes du tampon laissent la place aux nouvelles
+	backpressureDropOldest = "drop-oldest"
+	// Les nouvelles lignes sont écartées
+	backpressureDropNewest = "drop-newest"
+)
+
+// logSession diffuse les logs d'un ou plusieurs services sur une WebSocket, au
+// format texte historique ou en JSON si le client a négocié logs.Protocol
+type logSession struct {
+	h  *Handler
+	ws *websocket.Conn
+	// Protocole JSON négocié via Sec-WebSocket-Protocol
+	json bool
+	// Logs du swarm : lignes préfixées par le service, regroupées par lots,
+	// écartées plutôt qu'attendues quand le tampon est plein
+	swarm bool
+	// Politique quand le tampon est plein et taille du tampon
+	policy string
+	buffer int
+	// Filtres appliqués par les goroutines de lecture, modifiables en cours de route
+	filter atomic.Pointer[logs.Filter]
+}
+
+// logStreams est une génération de goroutines de lecture, relancée quand les
+// filtres tail ou since changent
+type logStreams struct {
+	events   chan logs.Message
+	cancel   context.CancelFunc
+	policy   string
+	services []swarm.Service
+	// Lignes écartées depuis le dernier message dropped, par ID de service
+	dropped map[string]*atomic.Uint64
+}
+
+// SetLogBufferSize définit la taille par défaut du tampon des connexions de logs
+func (h *Handler) SetLogBufferSize(size int) {
+	h.logBufferSize = min(max(size, 1), maxLogBufferSize)
+}
+
+// logBackpressure lit ?backpressure= et ?buffer=. Par défaut, les logs d'un
+// service attendent le client et ceux du swarm écartent les nouvelles lignes.
+func (h *Handler) logBackpressure(c echo.Context, swarm bool) (string, int, error) {
+	policy := c.QueryParam("backpressure")
+	switch policy {
+	case "":
+		policy = backpressureBlock
+		if swarm {
+			policy = backpressureDropNewest
+		}
+	case backpressureBlock, backpressureDropOldest, backpressureDropNewest:
+	default:
+		return "", 0, fmt.Errorf("invalid backpressure %q (block, drop-oldest or drop-newest)", policy)
+	}
+
+	size := h.logBufferSize
+	if size == 0 {
+		size = defaultLogBufferSize
+	}
+	if v := c.QueryParam("buffer"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLogBufferSize {
+			return "", 0, fmt.Errorf("invalid buffer %q (1 to %d)", v, maxLogBufferSize)
+		}
+		size = n
+	}
+	return policy, size, nil
+}
+
+// logFilterSpec lit les filtres des paramètres de requête ; tail vaut
+// defaultTail s'il est absent
+func logFilterSpec(c echo.Context, defaultTail string) logs.FilterSpec {
+	spec := logs.FilterSpec{
+		Include: c.QueryParam("include"),
+		Exclude: c.QueryParam("exclude"),
+		Level:   c.QueryParam("level"),
+		Stream:  c.QueryParam("stream"),
+		Since:   c.QueryParam("since"),
+		Until:   c.QueryParam("until"),
+		Tail:    c.QueryParam("tail"),
+	}
+	if spec.Tail == "" {
+		spec.Tail = defaultTail
+	}
+	return spec
+}
+
+// newLogSession valide les paramètres d'une WebSocket de logs : filtres,
+// ?backpressure= et ?buffer=
+func (h *Handler) newLogSession(c echo.Context, swarm bool, defaultTail string) (*logSession, error) {
+	// Filtres appliqués côté serveur (include, exclude, level, stream, since, until, tail)
+	filter, err := logFilterSpec(c, defaultTail).Compile(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	policy, buffer, err := h.logBackpressure(c, swarm)
+	if err != nil {
+		return nil, err
+	}
+	s := &logSession{h: h, swarm: swarm, policy: policy, buffer: buffer}
+	s.filter.Store(filter)
+	return s, nil
+}
+
+// upgrade passe la connexion en WebSocket en acceptant logs.Protocol si le
+// client le propose
+func (s *logSession) upgrade(c echo.Context) error {
+	var header http.Header
+	for _, p := range websocket.Subprotocols(c.Request()) {
+		if p == logs.Protocol {
+			header = http.Header{"Sec-Websocket-Protocol": {logs.Protocol}}
+			break
+		}
+	}
+	ws, err := s.h.upgrader.Upgrade(c.Response(), c.Request(), header)
+	if err != nil {
+		return err
+	}
+	s.ws = ws
+	s.json = ws.Subprotocol() == logs.Protocol
+	return nil
+}
+
+// run suit les logs des services et écrit les messages jusqu'à la fermeture de
+// la connexion par le client. La connexion reste ouverte à la fin des flux.
+func (s *logSession) run(services []swarm.Service) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kind := metrics.LogStreamService
+	if s.swarm {
+		kind = metrics.LogStreamSwarm
+	}
+	defer s.h.metrics.TrackLogStream(kind)()
+
+	// Commandes du client ; le canal est fermé avec la connexion
+	commands := readLogCommands(s.ws, ctx.Done())
+
+	// Les flux sont relancés quand tail ou since changent ; chaque génération
+	// a son propre canal pour ne pas mélanger les anciennes lignes aux nouvelles
+	streams := s.start(ctx, services)
+	defer func() { streams.cancel() }()
+
+	heartbeat := time.NewTicker(logHeartbeatInterval)
+	defer heartbeat.Stop()
+	flush := time.NewTicker(logBatchInterval)
+	defer flush.Stop()
+	dropped := time.NewTicker(logDroppedInterval)
+	defer dropped.Stop()
+
+	var batch []logs.Message
+	for {
+		select {
+		case cmd, ok := <-commands:
+			if !ok {
+				// Client a fermé la connexion
+				return
+			}
+			reply, restart := s.apply(cmd)
+			if restart {
+				streams.cancel()
+				if err := s.write(streams.droppedMessages()); err != nil {
+					return
+				}
+				streams = s.start(ctx, services)
+				batch = batch[:0]
+			}
+			if err := s.write([]logs.Message{reply}); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := s.ws.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+				return
+			}
+		case msg := <-streams.events:
+			batch = append(batch, msg)
+			if s.swarm && len(batch) < logBatchSize {
+				continue
+			}
+			if err := s.write(batch); err != nil {
+				return
+			}
+			batch = batch[:0]
+		case <-flush.C:
+			if len(batch) == 0 {
+				continue
+			}
+			if err := s.write(batch); err != nil {
+				return
+			}
+			batch = batch[:0]
+		case <-dropped.C:
+			if err := s.write(streams.droppedMessages()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// start lance une goroutine de lecture par service avec les filtres courants
+func (s *logSession) start(parent context.Context, services []swarm.Service) *logStreams {
+	ctx, cancel := context.WithCancel(parent)
+	streams := &logStreams{
+		events:   make(chan logs.Message, s.buffer),
+		cancel:   cancel,
+		policy:   s.policy,
+		services: services,
+		dropped:  make(map[string]*atomic.Uint64, len(services)),
+	}
+	for _, svc := range services {
+		streams.dropped[svc.ID] = new(atomic.Uint64)
+	}
+
+	filter := s.filter.Load()
+	opts := container.LogsOptions{Follow: true, Tail: filter.Spec.Tail, Since: dockerSince(filter.Since())}
+	for _, svc := range services {
+		go s.follow(ctx, streams, svc, opts)
+	}
+	return streams
+}
+
+// apply traite une commande du client. Renvoie la réponse à envoyer et s'il
+// faut relancer les flux (tail ou since modifiés).
+func (s *logSession) apply(cmd logs.Command) (logs.Message, bool) {
+	if cmd.Type != logs.TypeFilter {
+		return logs.Message{Type: logs.TypeError, Message: "unknown command " + strconv.Quote(cmd.Type)}, false
+	}
+	filter, err := cmd.FilterSpec.Compile(time.Now())
+	if err != nil {
+		return logs.Message{Type: logs.TypeError, Message: err.Error()}, false
+	}
+	previous := s.filter.Swap(filter)
+	restart := previous.Spec.Tail != filter.Spec.Tail || previous.Spec.Since != filter.Spec.Since
+	return logs.Message{Type: logs.TypeFilter, Filter: &filter.Spec}, restart
+}
+
+// follow diffuse les logs filtrés d'un service puis signale la fin ou l'erreur
+// du flux
+func (s *logSession) follow(ctx context.Context, streams *logStreams, svc swarm.Service, opts container.LogsOptions) {
+	err := s.h.streamServiceLogs(ctx, svc, opts, func(line logs.Line) bool {
+		if !s.filter.Load().Match(line) {
+			return true
+		}
+		return streams.send(ctx, logs.LogMessage(line), false)
+	})
+	if ctx.Err() != nil {
+		// Connexion fermée ou flux relancé
+		return
+	}
+	end := logs.Message{Type: logs.TypeEOF, Service: svc.Spec.Name, ServiceID: svc.ID}
+	if err != nil {
+		end.Type = logs.TypeError
+		end.Message = err.Error()
+	}
+	streams.send(ctx, end, true)
+}
+
+// send place un message dans le tampon de la connexion selon la politique de
+// la connexion ; les messages de contrôle attendent toujours. Renvoie false si
+// le flux est terminé.
+func (st *logStreams) send(ctx context.Context, msg logs.Message, control bool) bool {
+	if control || st.policy == backpressureBlock {
+		select {
+		case st.events <- msg:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	requeued := 0
+	for {
+		select {
+		case st.events <- msg:
+			return true
+		case <-ctx.Done():
+			return false
+		default:
+		}
+		if st.policy == backpressureDropNewest || requeued >= cap(st.events) {
+			// Tampon plein ou rempli de messages de contrôle : la ligne est écartée
+			st.countDropped(msg.ServiceID)
+			return true
+		}
+		// drop-oldest : retirer la plus ancienne ligne puis réessayer
+		select {
+		case old := <-st.events:
+			if old.Type == logs.TypeLog {
+				st.countDropped(old.ServiceID)
+				continue
+			}
+			// Un eof ou une erreur n'est jamais écarté : il repasse en fin de
+			// tampon, après des lignes d'autres services uniquement puisque
+			// c'est le dernier message de son flux
+			requeued++
+			select {
+			case st.events <- old:
+			case <-ctx.Done():
+				return false
+			}
+		default:
+		}
+	}
+}
+
+func (st *logStreams) countDropped(serviceID string) {
+	if counter, ok := st.dropped[serviceID]; ok {
+		counter.Add(1)
+	}
+}
+
+// droppedMessages remet les compteurs à zéro et renvoie un message dropped par
+// service ayant perdu des lignes
+func (st *logStreams) droppedMessages() []logs.Message {
+	var messages []logs.Message
+	for _, svc := range st.services {
+		if n := st.dropped[svc.ID].Swap(0); n > 0 {
+			messages = append(messages, logs.Message{Type: logs.TypeDropped, Service: svc.Spec.Name, ServiceID: svc.ID, Count: n})
+		}
+	}
+	return messages
+}
+
+// write envoie les messages : un par trame en JSON, concaténés en texte
+func (s *logSession) write(batch []logs.Message) error {
+	if s.json {
+		for _, msg := range batch {
+			if err := s.ws.WriteJSON(msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var text strings.Builder
+	for _, msg := range batch {
+		text.WriteString(s.formatText(msg))
+	}
+	if text.Len() == 0 {
+		return nil
+	}
+	return s.ws.WriteMessage(websocket.TextMessage, []byte(text.String()))
+}
+
+// fail signale une erreur empêchant l'ouverture des flux
+func (s *logSession) fail(err error) {
+	s.write([]logs.Message{{Type: logs.TypeError, Message: err.Error()}})
+}
+
+// formatText rend un message au format texte historique : "<horodatage> <message>",
+// préfixé par "[service] " pour les logs du swarm. Les fins de flux et les
+// accusés de filtre n'y ont pas d'équivalent.
+func (s *logSession) formatText(msg logs.Message) string {
+	switch msg.Type {
+	case logs.TypeLog:
+		return formatLogText(msg, s.swarm)
+	case logs.TypeError:
+		switch {
+		case msg.Service == "":
+			return "Error: " + msg.Message + "\n"
+		case s.swarm:
+			return "[ERROR] " + msg.Service + ": Error reading logs: " + msg.Message + "\n"
+		default:
+			return "Error reading logs: " + msg.Message + "\n"
+		}
+	case logs.TypeDropped:
+		if s.swarm {
+			return fmt.Sprintf("[DROPPED] %s: %d log lines dropped\n", msg.Service, msg.Count)
+		}
+		return fmt.Sprintf("Dropped %d log lines\n", msg.Count)
+	}
+	return ""
+}
+
+// openServiceLogs ouvre les logs d'un service (Follow, Tail et Since selon opts)
+// et renvoie un décodeur de lignes complètes portant le service, le flux,
+// l'horodatage et les IDs de tâche et de node. Le flux doit être fermé.
+func (h *Handler) openServiceLogs(ctx context.Context, svc swarm.Service, opts container.LogsOptions) (*logs.Decoder, io.Closer, error) {
+	opts.ShowStdout = true
+	opts.ShowStderr = true
+	opts.Timestamps = true
+	opts.Details = true
+	reader, err := h.dockerClient.ServiceLogs(ctx, svc.ID, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	dec := logs.NewDecoder(reader, logs.DecoderOptions{
+		// Le mode TTY du service détermine le format du flux
+		TTY:        svc.Spec.TaskTemplate.ContainerSpec != nil && svc.Spec.TaskTemplate.ContainerSpec.TTY,
+		Timestamps: opts.Timestamps,
+		Details:    opts.Details,
+		Service:    svc.Spec.Name,
+		ServiceID:  svc.ID,
+	})
+	return dec, reader, nil
+}
+
+// streamServiceLogs lit les logs d'un service et passe chaque ligne complète à
+// emit jusqu'à la fin du flux, l'annulation de ctx ou un retour false d'emit
+func (h *Handler) streamServiceLogs(ctx context.Context, svc swarm.Service, opts container.LogsOptions, emit func(logs.Line) bool) error {
+	dec, reader, err := h.openServiceLogs(ctx, svc, opts)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// Fermer le flux à l'annulation pour débloquer la lecture en cours
+	stop := context.AfterFunc(ctx, func() { reader.Close() })
+	defer stop()
+
+	for {
+		line, err := dec.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if !emit(line) {
+			return nil
+		}
+	}
+}
+
+// formatLogText rend une ligne au format texte : "<horodatage> <message>",
+// préfixé par "[service] " si les logs mêlent plusieurs services
+func formatLogText(msg logs.Message, withService bool) string {
+	text := msg.Message
+	if msg.Timestamp != "" {
+		text = msg.Timestamp + " " + text
+	}
+	if withService {
+		text = "[" + msg.Service + "] " + text
+	}
+	return text + "\n"
+}
+
+// dockerSince formate une date pour LogsOptions.Since (vide si t est zéro)
+func dockerSince(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
+
+// readLogCommands lit les commandes JSON du client jusqu'à la fermeture de la
+// connexion, signalée par la fermeture du canal. Les messages illisibles sont ignorés.
+// La lecture s'arrête aussi quand done est fermé, pour ne pas rester bloquée sur
+// une commande que la session ne lira plus.
+func readLogCommands(ws *websocket.Conn, done <-chan struct{}) <-chan logs.Command {
+	commands := make(chan logs.Command)
+	go func() {
+		defer close(commands)
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var cmd logs.Command
+			if json.Unmarshal(data, &cmd) != nil {
+				continue
+			}
+			select {
+			case commands <- cmd:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return commands
+}
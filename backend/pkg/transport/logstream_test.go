@@ -0,0 +1,235 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+	"github.com/Affell/swarm-manager/backend/pkg/logs"
+)
+
+// Une commande reçue après la fin de la session ne doit pas bloquer la
+// goroutine de lecture
+func TestReadLogCommandsStopsWithTheSession(t *testing.T) {
+	done := make(chan struct{})
+	result := make(chan (<-chan logs.Command), 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		result <- readLogCommands(ws, done)
+	}))
+	defer server.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	commands := <-result
+
+	close(done)
+	if err := client.WriteMessage(websocket.TextMessage, []byte(`{"type":"filter"}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Laisse la goroutine recevoir la commande alors que personne ne lit
+	time.Sleep(100 * time.Millisecond)
+
+	select {
+	case cmd, ok := <-commands:
+		if ok {
+			t.Fatalf("got %+v after the session ended", cmd)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("reader still blocked after the session ended")
+	}
+}
+
+// logServer sert les logs d'un service TTY dont le daemon renvoie deux lignes
+func logServer(t *testing.T) (url, serviceID string) {
+	t.Helper()
+	f := infratest.NewFakeSwarm()
+	h := NewHandler(f)
+	e := echo.New()
+	e.GET("/services/:id/logs", h.ServiceLogs)
+	spec := replicated("web_api", 1, nil)
+	spec.TaskTemplate.ContainerSpec.TTY = true
+	svc := f.AddService(spec)
+	f.SetServiceLogs(svc.ID, []byte(strings.Join([]string{
+		"2024-01-01T00:00:01.5Z com.docker.swarm.task.id=t1,com.docker.swarm.node.id=n1 starting",
+		"2024-01-01T00:00:02Z com.docker.swarm.task.id=t1,com.docker.swarm.node.id=n1 ERROR failed",
+	}, "\n")+"\n"))
+	server := httptest.NewServer(e)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/services/" + svc.ID + "/logs", svc.ID
+}
+
+// readFrames lit n trames texte
+func readFrames(t *testing.T, ws *websocket.Conn, n int) []string {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frames []string
+	for len(frames) < n {
+		kind, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("after %q: %v", frames, err)
+		}
+		if kind == websocket.TextMessage {
+			frames = append(frames, string(data))
+		}
+	}
+	return frames
+}
+
+func TestServiceLogsProtocol(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		subprotocol []string
+		negotiated  string
+		want        []string
+		// Réponses aux commandes filter valide, inconnue et invalide
+		replies []string
+	}{
+		{
+			name:        "json",
+			subprotocol: []string{"other", logs.Protocol},
+			negotiated:  logs.Protocol,
+			want: []string{
+				`{"type":"log","service":"web_api","service_id":"%ID%","task":"t1","node":"n1","stream":"stdout","timestamp":"2024-01-01T00:00:01.500000000Z","message":"starting"}`,
+				`{"type":"log","service":"web_api","service_id":"%ID%","task":"t1","node":"n1","stream":"stdout","timestamp":"2024-01-01T00:00:02.000000000Z","message":"ERROR failed"}`,
+				`{"type":"eof","service":"web_api","service_id":"%ID%"}`,
+			},
+			replies: []string{
+				`{"type":"filter","filter":{"level":"error"}}`,
+				`{"type":"error","message":"unknown command \"pause\""}`,
+				`{"type":"error","message":"invalid include pattern: error parsing regexp: missing closing ): ` + "`(`" + `"}`,
+			},
+		},
+		{
+			// Les clients qui ne négocient pas le protocole gardent le texte ;
+			// la fin de flux et l'accusé de filtre n'y ont pas d'équivalent
+			name:        "text fallback",
+			subprotocol: []string{"other"},
+			want: []string{
+				"2024-01-01T00:00:01.500000000Z starting\n",
+				"2024-01-01T00:00:02.000000000Z ERROR failed\n",
+			},
+			replies: []string{
+				`Error: unknown command "pause"` + "\n",
+				"Error: invalid include pattern: error parsing regexp: missing closing ): `(`\n",
+			},
+		},
+		{
+			name: "no subprotocol",
+			want: []string{
+				"2024-01-01T00:00:01.500000000Z starting\n",
+				"2024-01-01T00:00:02.000000000Z ERROR failed\n",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			url, id := logServer(t)
+			dialer := websocket.Dialer{Subprotocols: tc.subprotocol}
+			ws, _, err := dialer.Dial(url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+			if ws.Subprotocol() != tc.negotiated {
+				t.Errorf("subprotocol = %q, want %q", ws.Subprotocol(), tc.negotiated)
+			}
+
+			// Un message JSON par trame, terminé par un saut de ligne
+			frames := readFrames(t, ws, len(tc.want))
+			for i, want := range tc.want {
+				if tc.negotiated != "" {
+					want += "\n"
+				}
+				if want = strings.ReplaceAll(want, "%ID%", id); frames[i] != want {
+					t.Errorf("frame %d = %s, want %s", i, frames[i], want)
+				}
+			}
+
+			if len(tc.replies) == 0 {
+				return
+			}
+			for _, cmd := range []string{`{"type":"filter","level":"error"}`, `{"type":"pause"}`, `{"type":"filter","include":"("}`} {
+				if err := ws.WriteMessage(websocket.TextMessage, []byte(cmd)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			replies := readFrames(t, ws, len(tc.replies))
+			for i, want := range tc.replies {
+				if tc.negotiated != "" {
+					want += "\n"
+				}
+				if replies[i] != want {
+					t.Errorf("reply %d = %s, want %s", i, replies[i], want)
+				}
+			}
+		})
+	}
+}
+
+// En drop-oldest, un eof en tête du tampon plein n'est jamais écarté : ce sont
+// les lignes suivantes qui le sont
+func TestLogStreamsDropOldestKeepsControlMessages(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		buffer  int
+		want    []string
+		dropped uint64
+	}{
+		// L'eof reste, seule la dernière ligne l'accompagne
+		{name: "lines evicted", buffer: 2, want: []string{"eof api", "line 5"}, dropped: 4},
+		// Tampon rempli par l'eof : les nouvelles lignes sont écartées
+		{name: "only control messages", buffer: 1, want: []string{"eof api"}, dropped: 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			st := &logStreams{
+				events:   make(chan logs.Message, tc.buffer),
+				policy:   backpressureDropOldest,
+				services: []swarm.Service{{ID: "api", Spec: swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "web_api"}}}},
+				dropped:  map[string]*atomic.Uint64{"api": new(atomic.Uint64), "db": new(atomic.Uint64)},
+			}
+			st.send(ctx, logs.Message{Type: logs.TypeEOF, ServiceID: "api"}, true)
+			for i := 1; i <= 5; i++ {
+				if !st.send(ctx, logs.Message{Type: logs.TypeLog, ServiceID: "db", Message: fmt.Sprintf("line %d", i)}, false) {
+					t.Fatal("send stopped")
+				}
+			}
+
+			var got []string
+			for len(st.events) > 0 {
+				msg := <-st.events
+				if msg.Type == logs.TypeLog {
+					got = append(got, msg.Message)
+				} else {
+					got = append(got, msg.Type+" "+msg.ServiceID)
+				}
+			}
+			if strings.Join(got, ", ") != strings.Join(tc.want, ", ") {
+				t.Errorf("queued = %q, want %q", got, tc.want)
+			}
+			if n := st.dropped["db"].Load(); n != tc.dropped {
+				t.Errorf("dropped = %d, want %d", n, tc.dropped)
+			}
+			if n := st.dropped["api"].Load(); n != 0 {
+				t.Errorf("control message counted as dropped: %d", n)
+			}
+		})
+	}
+}
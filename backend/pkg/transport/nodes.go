@@ -0,0 +1,347 @@
+package transport
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+// Tentatives de NodeUpdate quand la node a été modifiée entre la lecture et
+// l'écriture de sa spec
+const nodeUpdateAttempts = 5
+
+// nodeConflictError refuse une modification qui mettrait le swarm en danger
+type nodeConflictError struct{ msg string }
+
+func (e nodeConflictError) Error() string { return e.msg }
+
+// isOutOfSequence reconnaît l'erreur renvoyée par le swarm quand la version
+// de la spec envoyée n'est plus la dernière
+func isOutOfSequence(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "update out of sequence")
+}
+
+// updateNode relit la node, applique mutate à sa spec et l'enregistre, en
+// recommençant tant que la version a changé entre-temps
+func (h *Handler) updateNode(ctx context.Context, id string, mutate func(node swarm.Node, spec *swarm.NodeSpec) error) (swarm.Node, error) {
+	var err error
+	for attempt := 0; attempt < nodeUpdateAttempts; attempt++ {
+		var node swarm.Node
+		node, _, err = h.dockerClient.NodeInspectWithRaw(ctx, id)
+		if err != nil {
+			return swarm.Node{}, err
+		}
+		spec := node.Spec
+		if spec.Labels != nil {
+			spec.Labels = make(map[string]string, len(node.Spec.Labels))
+			for k, v := range node.Spec.Labels {
+				spec.Labels[k] = v
+			}
+		}
+		if err = mutate(node, &spec); err != nil {
+			return swarm.Node{}, err
+		}
+		err = h.dockerClient.NodeUpdate(ctx, node.ID, node.Version, spec)
+		if err == nil {
+			node, _, err = h.dockerClient.NodeInspectWithRaw(ctx, node.ID)
+			return node, err
+		}
+		if !isOutOfSequence(err) {
+			return swarm.Node{}, err
+		}
+	}
+	return swarm.Node{}, fmt.Errorf("node %s kept changing, giving up after %d attempts: %w", id, nodeUpdateAttempts, err)
+}
+
+// nodeError renvoie l'erreur d'une opération sur une node avec le bon statut
+func nodeError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	var conflict nodeConflictError
+	switch {
+	case errdefs.IsNotFound(err):
+		status = http.StatusNotFound
+	case errors.As(err, &conflict), errdefs.IsConflict(err):
+		status = http.StatusConflict
+	}
+	return c.JSON(status, map[string]string{"error": err.Error()})
+}
+
+// toNodeChange résume une node après une modification
+func toNodeChange(n swarm.Node, warnings []string) domain.NodeChange {
+	labels := n.Spec.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return domain.NodeChange{
+		ID:           n.ID,
+		Hostname:     n.Description.Hostname,
+		Role:         string(n.Spec.Role),
+		Availability: string(n.Spec.Availability),
+		Labels:       labels,
+		Warnings:     warnings,
+	}
+}
+
+// GetNode renvoie le détail d'une node : moteur, plateforme, labels, plugins,
+// statut de manager, TLS et capacité brute
+func (h *Handler) GetNode(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+	ctx := c.Request().Context()
+
+	node, _, err := h.dockerClient.NodeInspectWithRaw(ctx, c.Param("id"))
+	if err != nil {
+		return nodeError(c, err)
+	}
+	details := toNodeDetails(node)
+	// La durée de validité des certificats est un réglage du swarm, commun à
+	// toutes les nodes et connu seulement si le daemon interrogé est un manager
+	if info, err := h.dockerClient.Info(ctx); err == nil && info.Swarm.Cluster != nil {
+		if validity := info.Swarm.Cluster.Spec.CAConfig.NodeCertExpiry; validity > 0 {
+			details.TLS.NodeCertLifetime = validity.String()
+		}
+	}
+	return c.JSON(http.StatusOK, details)
+}
+
+func toNodeDetails(n swarm.Node) domain.NodeDetails {
+	d := domain.NodeDetails{
+		Node:          toDomainNode(n),
+		EngineVersion: n.Description.Engine.EngineVersion,
+		OS:            n.Description.Platform.OS,
+		Architecture:  n.Description.Platform.Architecture,
+		NanoCPUs:      n.Description.Resources.NanoCPUs,
+		NodeLabels:    n.Spec.Labels,
+		EngineLabels:  n.Description.Engine.Labels,
+		Plugins:       []domain.NodePlugin{},
+		Message:       n.Status.Message,
+		TLS:           nodeTLS(n.Description.TLSInfo),
+		CreatedAt:     n.CreatedAt,
+		UpdatedAt:     n.UpdatedAt,
+	}
+	if d.NodeLabels == nil {
+		d.NodeLabels = map[string]string{}
+	}
+	if d.EngineLabels == nil {
+		d.EngineLabels = map[string]string{}
+	}
+	for _, r := range n.Description.Resources.GenericResources {
+		if r.DiscreteResourceSpec != nil {
+			if d.GenericResources == nil {
+				d.GenericResources = make(map[string]int64)
+			}
+			d.GenericResources[r.DiscreteResourceSpec.Kind] += r.DiscreteResourceSpec.Value
+		}
+	}
+	for _, p := range n.Description.Engine.Plugins {
+		d.Plugins = append(d.Plugins, domain.NodePlugin{Type: p.Type, Name: p.Name})
+	}
+	sort.Slice(d.Plugins, func(i, j int) bool {
+		if d.Plugins[i].Type != d.Plugins[j].Type {
+			return d.Plugins[i].Type < d.Plugins[j].Type
+		}
+		return d.Plugins[i].Name < d.Plugins[j].Name
+	})
+	if m := n.ManagerStatus; m != nil {
+		d.Manager = &domain.NodeManager{Leader: m.Leader, Reachability: string(m.Reachability), Addr: m.Addr}
+	}
+	return d
+}
+
+// nodeTLS lit l'émetteur du certificat de la node et l'expiration de la CA
+// racine, l'API ne donnant pas celle du certificat de la node ; un champ
+// illisible est laissé vide
+func nodeTLS(info swarm.TLSInfo) domain.NodeTLS {
+	var result domain.NodeTLS
+	var subject pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(info.CertIssuerSubject, &subject); err == nil && len(rest) == 0 {
+		var name pkix.Name
+		name.FillFromRDNSequence(&subject)
+		result.IssuerSubject = name.String()
+	}
+	if block, _ := pem.Decode([]byte(info.TrustRoot)); block != nil {
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			expiry := cert.NotAfter
+			result.RootCANotAfter = &expiry
+		}
+	}
+	return result
+}
+
+// UpdateNodeLabels ajoute et retire des labels de node, utilisés par les
+// contraintes de placement (node.labels.<clé>)
+func (h *Handler) UpdateNodeLabels(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	var req struct {
+		Add    map[string]string `json:"add"`
+		Remove []string          `json:"remove"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "add or remove is required"})
+	}
+	for k := range req.Add {
+		if strings.TrimSpace(k) == "" || strings.ContainsAny(k, "= ") {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid label key %q", k)})
+		}
+		if containsString(req.Remove, k) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("label %q is both added and removed", k)})
+		}
+	}
+
+	node, err := h.updateNode(c.Request().Context(), c.Param("id"), func(_ swarm.Node, spec *swarm.NodeSpec) error {
+		if spec.Labels == nil {
+			spec.Labels = make(map[string]string, len(req.Add))
+		}
+		for k, v := range req.Add {
+			spec.Labels[k] = v
+		}
+		for _, k := range req.Remove {
+			delete(spec.Labels, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return nodeError(c, err)
+	}
+	return c.JSON(http.StatusOK, toNodeChange(node, nil))
+}
+
+// PromoteNode fait d'un worker un manager. La node doit être prête : un
+// manager injoignable compterait dans le quorum sans y participer.
+func (h *Handler) PromoteNode(c echo.Context) error {
+	return h.changeNodeRole(c, swarm.NodeRoleManager)
+}
+
+// DemoteNode fait d'un manager un worker, si les managers joignables restants
+// gardent la majorité
+func (h *Handler) DemoteNode(c echo.Context) error {
+	return h.changeNodeRole(c, swarm.NodeRoleWorker)
+}
+
+func (h *Handler) changeNodeRole(c echo.Context, role swarm.NodeRole) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+	ctx := c.Request().Context()
+
+	var warnings []string
+	node, err := h.updateNode(ctx, c.Param("id"), func(node swarm.Node, spec *swarm.NodeSpec) error {
+		if spec.Role == role {
+			return nodeConflictError{fmt.Sprintf("node %s is already a %s", node.Description.Hostname, role)}
+		}
+		// Le quorum est recalculé à chaque tentative, la liste des managers
+		// ayant pu changer
+		nodes, err := h.dockerClient.NodeList(ctx, dockerTypes.NodeListOptions{})
+		if err != nil {
+			return err
+		}
+		warnings, err = checkQuorum(nodes, node, role)
+		if err != nil {
+			return err
+		}
+		spec.Role = role
+		return nil
+	})
+	if err != nil {
+		return nodeError(c, err)
+	}
+	return c.JSON(http.StatusOK, toNodeChange(node, warnings))
+}
+
+// checkQuorum vérifie que le changement de rôle de target laisse au raft une
+// majorité de managers joignables. Un nombre pair de managers est accepté
+// mais signalé : il n'améliore pas la tolérance aux pannes.
+func checkQuorum(nodes []swarm.Node, target swarm.Node, role swarm.NodeRole) ([]string, error) {
+	managers, reachable := 0, 0
+	for _, n := range nodes {
+		if n.ManagerStatus == nil || n.ID == target.ID {
+			continue
+		}
+		managers++
+		if n.ManagerStatus.Reachability == swarm.ReachabilityReachable {
+			reachable++
+		}
+	}
+
+	if role == swarm.NodeRoleManager {
+		if target.Status.State != swarm.NodeStateReady {
+			return nil, nodeConflictError{fmt.Sprintf("node %s is %s, only a ready node can be promoted", target.Description.Hostname, target.Status.State)}
+		}
+		managers++
+		reachable++
+	} else if managers == 0 {
+		return nil, nodeConflictError{fmt.Sprintf("node %s is the last manager", target.Description.Hostname)}
+	}
+
+	if reachable <= managers/2 {
+		return nil, nodeConflictError{fmt.Sprintf("quorum would be lost: %d of %d managers would be reachable, %d needed", reachable, managers, managers/2+1)}
+	}
+	var warnings []string
+	if managers%2 == 0 {
+		warnings = append(warnings, fmt.Sprintf("the swarm would have %d managers; an odd number tolerates as many failures with one manager less", managers))
+	}
+	return warnings, nil
+}
+
+// PauseNode empêche la planification de nouvelles tâches sur la node, sans
+// arrêter celles qui y tournent
+func (h *Handler) PauseNode(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	node, err := h.updateNode(c.Request().Context(), c.Param("id"), func(_ swarm.Node, spec *swarm.NodeSpec) error {
+		spec.Availability = swarm.NodeAvailabilityPause
+		return nil
+	})
+	if err != nil {
+		return nodeError(c, err)
+	}
+	return c.JSON(http.StatusOK, toNodeChange(node, nil))
+}
+
+// RemoveNode retire du swarm une node arrêtée. Un manager doit d'abord être
+// rétrogradé ; force=true retire aussi une node qui n'est pas down.
+func (h *Handler) RemoveNode(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+	ctx := c.Request().Context()
+	force := c.QueryParam("force") == "true"
+
+	node, _, err := h.dockerClient.NodeInspectWithRaw(ctx, c.Param("id"))
+	if err != nil {
+		return nodeError(c, err)
+	}
+	if node.Spec.Role == swarm.NodeRoleManager {
+		return nodeError(c, nodeConflictError{fmt.Sprintf("node %s is a manager, demote it first", node.Description.Hostname)})
+	}
+	if node.Status.State != swarm.NodeStateDown && !force {
+		return nodeError(c, nodeConflictError{fmt.Sprintf("node %s is %s, only a down node can be removed (force=true to override)", node.Description.Hostname, node.Status.State)})
+	}
+	if err := h.dockerClient.NodeRemove(ctx, node.ID, dockerTypes.NodeRemoveOptions{Force: force}); err != nil {
+		return nodeError(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,247 @@
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+func TestGetNode(t *testing.T) {
+	f, e := newTestServer(t)
+	m1 := f.AddNode("m1", swarm.NodeRoleManager)
+
+	var details domain.NodeDetails
+	if code := do(t, e, http.MethodGet, "/nodes/"+m1.ID, "", &details); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if details.EngineVersion == "" || details.OS != "linux" || details.NanoCPUs != 2e9 || len(details.Plugins) == 0 {
+		t.Errorf("unexpected details %+v", details)
+	}
+	if details.Manager == nil || !details.Manager.Leader {
+		t.Errorf("manager = %+v, want leader", details.Manager)
+	}
+	if code := do(t, e, http.MethodGet, "/nodes/missing", "", nil); code != http.StatusNotFound {
+		t.Errorf("missing node: status = %d, want 404", code)
+	}
+}
+
+func TestNodeTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Date(2043, 1, 2, 3, 4, 5, 0, time.UTC)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "swarm-ca"},
+		NotBefore:    notAfter.AddDate(-20, 0, 0),
+		NotAfter:     notAfter,
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := asn1.Marshal(template.Subject.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tls := nodeTLS(swarm.TLSInfo{
+		TrustRoot:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		CertIssuerSubject: subject,
+	})
+	if tls.IssuerSubject != "CN=swarm-ca" || tls.RootCANotAfter == nil || !tls.RootCANotAfter.Equal(notAfter) {
+		t.Errorf("tls = %+v", tls)
+	}
+	if tls := nodeTLS(swarm.TLSInfo{TrustRoot: "garbage"}); tls.RootCANotAfter != nil || tls.IssuerSubject != "" {
+		t.Errorf("unreadable TLS info = %+v, want empty", tls)
+	}
+}
+
+func TestGetNodeCertLifetime(t *testing.T) {
+	f, e := newTestServer(t)
+	m1 := f.AddNode("m1", swarm.NodeRoleManager)
+	f.SetInfo(system.Info{Swarm: swarm.Info{Cluster: &swarm.ClusterInfo{
+		Spec: swarm.Spec{CAConfig: swarm.CAConfig{NodeCertExpiry: 90 * 24 * time.Hour}},
+	}}})
+
+	var details domain.NodeDetails
+	if code := do(t, e, http.MethodGet, "/nodes/"+m1.ID, "", &details); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if details.TLS.NodeCertLifetime != "2160h0m0s" {
+		t.Errorf("nodeCertLifetime = %q, want 2160h0m0s", details.TLS.NodeCertLifetime)
+	}
+}
+
+func TestDemoteLastManager(t *testing.T) {
+	f, e := newTestServer(t)
+	m1 := f.AddNode("m1", swarm.NodeRoleManager)
+	w1 := f.AddNode("w1", swarm.NodeRoleWorker)
+
+	if code := do(t, e, http.MethodPost, "/nodes/"+m1.ID+"/demote", "", nil); code != http.StatusConflict {
+		t.Errorf("demote last manager: status = %d, want 409", code)
+	}
+	var change domain.NodeChange
+	if code := do(t, e, http.MethodPost, "/nodes/"+w1.ID+"/promote", "", &change); code != http.StatusOK {
+		t.Fatalf("promote: status = %d", code)
+	}
+	if change.Role != string(swarm.NodeRoleManager) || len(change.Warnings) == 0 {
+		t.Errorf("promote = %+v, want a manager with an even manager count warning", change)
+	}
+}
+
+func TestUpdateNodeLabels(t *testing.T) {
+	f, e := newTestServer(t)
+	h := NewHandler(f)
+	e.POST("/nodes/:id/labels", h.UpdateNodeLabels)
+	w1 := f.AddNode("w1", swarm.NodeRoleWorker)
+
+	for _, tc := range []struct {
+		name, body, want string
+	}{
+		{"empty", `{}`, "add or remove is required"},
+		{"key with equals", `{"add": {"zone=a": "b"}}`, "invalid label key"},
+		{"key with space", `{"add": {"my zone": "a"}}`, "invalid label key"},
+		{"blank key", `{"add": {" ": "a"}}`, "invalid label key"},
+		{"added and removed", `{"add": {"zone": "a"}, "remove": ["zone"]}`, "both added and removed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f.ResetCalls()
+			var resp struct {
+				Error string `json:"error"`
+			}
+			if code := do(t, e, http.MethodPost, "/nodes/"+w1.ID+"/labels", tc.body, &resp); code != http.StatusBadRequest || !strings.Contains(resp.Error, tc.want) {
+				t.Errorf("status = %d, error = %q, want 400 %q", code, resp.Error, tc.want)
+			}
+			if calls := f.Calls("NodeUpdate"); calls != 0 {
+				t.Errorf("NodeUpdate called %d times", calls)
+			}
+		})
+	}
+
+	var change domain.NodeChange
+	if code := do(t, e, http.MethodPost, "/nodes/"+w1.ID+"/labels", `{"add": {"zone": "a", "ssd": "true"}}`, &change); code != http.StatusOK {
+		t.Fatalf("add: status = %d", code)
+	}
+	var updated domain.NodeChange
+	if code := do(t, e, http.MethodPost, "/nodes/"+w1.ID+"/labels", `{"add": {"zone": "b"}, "remove": ["ssd", "missing"]}`, &updated); code != http.StatusOK {
+		t.Fatalf("update: status = %d", code)
+	}
+	if len(updated.Labels) != 1 || updated.Labels["zone"] != "b" {
+		t.Errorf("labels = %v, want zone=b", updated.Labels)
+	}
+	if code := do(t, e, http.MethodPost, "/nodes/missing/labels", `{"add": {"zone": "a"}}`, nil); code != http.StatusNotFound {
+		t.Errorf("missing node: status = %d, want 404", code)
+	}
+}
+
+func TestUpdateNodeRetriesOutOfSequence(t *testing.T) {
+	f, e := newTestServer(t)
+	h := NewHandler(f)
+	e.POST("/nodes/:id/labels", h.UpdateNodeLabels)
+	w1 := f.AddNode("w1", swarm.NodeRoleWorker)
+	outOfSequence := errors.New("rpc error: code = Unknown desc = update out of sequence")
+
+	// La node a changé entre la lecture et l'écriture : la spec est relue
+	f.FailOnce("NodeUpdate", outOfSequence)
+	var change domain.NodeChange
+	if code := do(t, e, http.MethodPost, "/nodes/"+w1.ID+"/labels", `{"add": {"zone": "a"}}`, &change); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if change.Labels["zone"] != "a" || f.Calls("NodeUpdate") != 2 || f.Calls("NodeInspectWithRaw") != 3 {
+		t.Errorf("labels = %v, NodeUpdate calls = %d, NodeInspectWithRaw calls = %d, want zone=a after a retry",
+			change.Labels, f.Calls("NodeUpdate"), f.Calls("NodeInspectWithRaw"))
+	}
+
+	// Abandon après nodeUpdateAttempts conflits
+	f.ResetCalls()
+	f.FailOn("NodeUpdate", outOfSequence)
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if code := do(t, e, http.MethodPost, "/nodes/"+w1.ID+"/labels", `{"add": {"zone": "b"}}`, &resp); code != http.StatusInternalServerError || !strings.Contains(resp.Error, "kept changing") {
+		t.Errorf("status = %d, error = %q, want 500 after the retries", code, resp.Error)
+	}
+	if calls := f.Calls("NodeUpdate"); calls != nodeUpdateAttempts {
+		t.Errorf("NodeUpdate called %d times, want %d", calls, nodeUpdateAttempts)
+	}
+
+	// Les autres erreurs ne sont pas retentées
+	f.ResetCalls()
+	f.FailOn("NodeUpdate", errors.New("boom"))
+	if code := do(t, e, http.MethodPost, "/nodes/"+w1.ID+"/labels", `{"add": {"zone": "b"}}`, nil); code != http.StatusInternalServerError || f.Calls("NodeUpdate") != 1 {
+		t.Errorf("status = %d, NodeUpdate calls = %d, want 500 without retry", code, f.Calls("NodeUpdate"))
+	}
+}
+
+func TestPauseNode(t *testing.T) {
+	f, e := newTestServer(t)
+	h := NewHandler(f)
+	e.POST("/nodes/:id/pause", h.PauseNode)
+	w1 := f.AddNode("w1", swarm.NodeRoleWorker)
+
+	var change domain.NodeChange
+	if code := do(t, e, http.MethodPost, "/nodes/"+w1.ID+"/pause", "", &change); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if change.Availability != string(swarm.NodeAvailabilityPause) {
+		t.Errorf("availability = %q, want pause", change.Availability)
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	f, e := newTestServer(t)
+	h := NewHandler(f)
+	e.DELETE("/nodes/:id", h.RemoveNode)
+	m1 := f.AddNode("m1", swarm.NodeRoleManager)
+	m2 := f.AddNode("m2", swarm.NodeRoleManager)
+	f.SetNodeState(m2.ID, swarm.NodeStateDown)
+	ready := f.AddNode("w1", swarm.NodeRoleWorker)
+	down := f.AddNode("w2", swarm.NodeRoleWorker)
+	f.SetNodeState(down.ID, swarm.NodeStateDown)
+
+	for _, tc := range []struct {
+		name, url, want string
+		code            int
+	}{
+		{"manager", "/nodes/" + m1.ID, "demote it first", http.StatusConflict},
+		{"down manager", "/nodes/" + m2.ID + "?force=true", "demote it first", http.StatusConflict},
+		{"ready worker", "/nodes/" + ready.ID, "only a down node can be removed", http.StatusConflict},
+		{"missing node", "/nodes/missing", "", http.StatusNotFound},
+		{"down worker", "/nodes/" + down.ID, "", http.StatusNoContent},
+		{"forced ready worker", "/nodes/" + ready.ID + "?force=true", "", http.StatusNoContent},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var resp struct {
+				Error string `json:"error"`
+			}
+			if code := do(t, e, http.MethodDelete, tc.url, "", &resp); code != tc.code || !strings.Contains(resp.Error, tc.want) {
+				t.Errorf("status = %d, error = %q, want %d %q", code, resp.Error, tc.code, tc.want)
+			}
+		})
+	}
+
+	nodes, _ := f.NodeList(context.Background(), dockerTypes.NodeListOptions{})
+	if len(nodes) != 2 {
+		t.Errorf("got %d nodes, want the two managers", len(nodes))
+	}
+}
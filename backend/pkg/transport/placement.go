@@ -0,0 +1,196 @@
+package transport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// placementState simule l'ordonnanceur du swarm pour savoir où des tâches
+// pourraient être replanifiées : chaque tâche placée réserve ses ressources
+// sur la node choisie pour les suivantes
+type placementState struct {
+	nodes []swarm.Node
+	// Ressources réservées par les tâches en cours, par node
+	cpu    map[string]int64
+	memory map[string]int64
+	// Tâches en cours par node et par service, pour MaxReplicas
+	perService map[string]map[string]int
+}
+
+// newPlacementState relève les réservations des tâches en cours ; les tâches
+// de la node exclude sont ignorées puisqu'elles vont la quitter
+func newPlacementState(nodes []swarm.Node, tasks []swarm.Task, exclude string) *placementState {
+	p := &placementState{
+		nodes:      nodes,
+		cpu:        make(map[string]int64),
+		memory:     make(map[string]int64),
+		perService: make(map[string]map[string]int),
+	}
+	for _, t := range tasks {
+		if t.DesiredState != swarm.TaskStateRunning || t.NodeID == "" || t.NodeID == exclude {
+			continue
+		}
+		p.reserve(t.NodeID, t.ServiceID, t.Spec)
+	}
+	return p
+}
+
+func (p *placementState) reserve(nodeID, serviceID string, spec swarm.TaskSpec) {
+	if r := spec.Resources; r != nil && r.Reservations != nil {
+		p.cpu[nodeID] += r.Reservations.NanoCPUs
+		p.memory[nodeID] += r.Reservations.MemoryBytes
+	}
+	if p.perService[nodeID] == nil {
+		p.perService[nodeID] = make(map[string]int)
+	}
+	p.perService[nodeID][serviceID]++
+}
+
+// place choisit une node pour une tâche du service, hors de exclude, et y
+// réserve ses ressources. Sans node possible, la raison est donnée dans le
+// format de l'ordonnanceur du swarm.
+func (p *placementState) place(svc swarm.Service, exclude string) (swarm.Node, int, error) {
+	spec := svc.Spec.TaskTemplate
+	var candidates []swarm.Node
+	var unavailable, constraints, platform, maxReplicas, resources int
+	for _, n := range p.nodes {
+		switch {
+		case n.ID == exclude || n.Status.State != swarm.NodeStateReady || n.Spec.Availability != swarm.NodeAvailabilityActive:
+			unavailable++
+		case !matchPlacementConstraints(spec.Placement, n):
+			constraints++
+		case !matchPlatform(spec.Placement, n):
+			platform++
+		case spec.Placement != nil && spec.Placement.MaxReplicas > 0 && uint64(p.perService[n.ID][svc.ID]) >= spec.Placement.MaxReplicas:
+			maxReplicas++
+		case !p.fits(n, spec):
+			resources++
+		default:
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 {
+		var reasons []string
+		for _, r := range []struct {
+			count int
+			what  string
+		}{
+			{unavailable, "unavailable or drained"},
+			{constraints, "scheduling constraints not satisfied"},
+			{platform, "unsupported platform"},
+			{maxReplicas, "max replicas per node limit exceeded"},
+			{resources, "insufficient resources"},
+		} {
+			if r.count > 0 {
+				reasons = append(reasons, fmt.Sprintf("%s on %d node%s", r.what, r.count, plural(r.count)))
+			}
+		}
+		return swarm.Node{}, 0, fmt.Errorf("no suitable node (%s)", strings.Join(reasons, "; "))
+	}
+
+	// Comme le swarm, la node la moins chargée en tâches du service est préférée
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return p.perService[candidates[i].ID][svc.ID] < p.perService[candidates[j].ID][svc.ID]
+	})
+	p.reserve(candidates[0].ID, svc.ID, spec)
+	return candidates[0], len(candidates), nil
+}
+
+// fits indique si les ressources libres de la node couvrent les réservations
+func (p *placementState) fits(n swarm.Node, spec swarm.TaskSpec) bool {
+	if spec.Resources == nil || spec.Resources.Reservations == nil {
+		return true
+	}
+	r := spec.Resources.Reservations
+	capacity := n.Description.Resources
+	return p.cpu[n.ID]+r.NanoCPUs <= capacity.NanoCPUs && p.memory[n.ID]+r.MemoryBytes <= capacity.MemoryBytes
+}
+
+// matchPlacementConstraints évalue les contraintes de placement (==, !=) sur
+// les attributs de la node ; une clé inconnue n'est jamais satisfaite
+func matchPlacementConstraints(placement *swarm.Placement, n swarm.Node) bool {
+	if placement == nil {
+		return true
+	}
+	for _, constraint := range placement.Constraints {
+		key, value, equal := strings.Cut(constraint, "==")
+		if !equal {
+			var ok bool
+			if key, value, ok = strings.Cut(constraint, "!="); !ok {
+				return false
+			}
+		}
+		// Les noms des labels gardent leur casse, pas le reste de la clé
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		lower := strings.ToLower(key)
+
+		var actual string
+		found := true
+		switch {
+		case lower == "node.id":
+			actual = n.ID
+		case lower == "node.hostname":
+			actual = n.Description.Hostname
+		case lower == "node.role":
+			actual = string(n.Spec.Role)
+		case lower == "node.platform.os":
+			actual = n.Description.Platform.OS
+		case lower == "node.platform.arch":
+			actual = n.Description.Platform.Architecture
+		case strings.HasPrefix(lower, "node.labels."):
+			actual, found = n.Spec.Labels[key[len("node.labels."):]]
+		case strings.HasPrefix(lower, "engine.labels."):
+			actual, found = n.Description.Engine.Labels[key[len("engine.labels."):]]
+		default:
+			return false
+		}
+		// Un label absent ne vérifie que les contraintes !=
+		if !found {
+			if equal {
+				return false
+			}
+			continue
+		}
+		if strings.EqualFold(actual, value) != equal {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPlatform vérifie l'OS et l'architecture demandés par le service
+func matchPlatform(placement *swarm.Placement, n swarm.Node) bool {
+	if placement == nil || len(placement.Platforms) == 0 {
+		return true
+	}
+	arch := normalizeArch(n.Description.Platform.Architecture)
+	for _, p := range placement.Platforms {
+		if (p.OS == "" || strings.EqualFold(p.OS, n.Description.Platform.OS)) &&
+			(p.Architecture == "" || normalizeArch(p.Architecture) == arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeArch ramène les noms uname des nodes (x86_64, aarch64) aux noms
+// Go des plateformes d'image (amd64, arm64), comme le filtre du scheduler
+func normalizeArch(arch string) string {
+	switch arch = strings.ToLower(arch); arch {
+	case "x86_64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	}
+	return arch
+}
+
+func plural(n int) string {
+	if n > 1 {
+		return "s"
+	}
+	return ""
+}
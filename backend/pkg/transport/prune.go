@@ -0,0 +1,336 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+const (
+	// Binaire de l'image lancée sur chaque node pour le nettoyage
+	pruneJobBinary = "/app/swarm-manager"
+	pruneJobLabel  = "swarm-manager.job"
+	dockerSocket   = "/var/run/docker.sock"
+	// Label posé par swarm sur les conteneurs de ses tâches
+	serviceIDLabel = "com.docker.swarm.service.id"
+
+	defaultPruneTimeout = 5 * time.Minute
+	maxPruneTimeout     = 30 * time.Minute
+	pruneJobPollDelay   = time.Second
+)
+
+// Nom du conteneur courant, remplacé par les tests
+var hostname = os.Hostname
+
+// SetPruneJobImage définit l'image utilisée par les nettoyages à l'échelle du swarm
+func (h *Handler) SetPruneJobImage(image string) {
+	h.pruneMu.Lock()
+	defer h.pruneMu.Unlock()
+	h.pruneJobImage = image
+}
+
+// jobImage renvoie l'image des jobs de nettoyage. Sans PRUNE_JOB_IMAGE, c'est
+// celle du service qui exécute ce backend : swarm l'a épinglée par digest, si
+// bien que chaque node tire la même version dans la variante de son architecture.
+func (h *Handler) jobImage(ctx context.Context) (string, error) {
+	h.pruneMu.Lock()
+	defer h.pruneMu.Unlock()
+	if h.pruneJobImage != "" {
+		return h.pruneJobImage, nil
+	}
+
+	// Dans un conteneur, le hostname est le préfixe de son ID
+	id, err := hostname()
+	if err != nil {
+		return "", err
+	}
+	containers, err := h.dockerClient.ContainerList(ctx, container.ListOptions{Filters: filters.NewArgs(filters.Arg("id", id))})
+	if err != nil {
+		return "", err
+	}
+	if len(containers) != 1 || containers[0].Labels[serviceIDLabel] == "" {
+		return "", errors.New("cannot find the swarm-manager service image: set PRUNE_JOB_IMAGE")
+	}
+	service, _, err := h.dockerClient.ServiceInspectWithRaw(ctx, containers[0].Labels[serviceIDLabel], dockerTypes.ServiceInspectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("cannot inspect the swarm-manager service, set PRUNE_JOB_IMAGE: %w", err)
+	}
+	h.pruneJobImage = service.Spec.TaskTemplate.ContainerSpec.Image
+	return h.pruneJobImage, nil
+}
+
+// pruneCluster lance un job global qui exécute le nettoyage sur chaque node
+// sélectionnée (?node=, ?role=, ?label=) et agrège les rapports par ID de node.
+// L'attente s'arrête si le client se déconnecte.
+func (h *Handler) pruneCluster(c echo.Context, kind string) error {
+	ctx := c.Request().Context()
+	all := c.QueryParam("all") == "true"
+
+	timeout := defaultPruneTimeout
+	if v := c.QueryParam("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid timeout"})
+		}
+		timeout = min(d, maxPruneTimeout)
+	}
+
+	nodes, err := h.dockerClient.NodeList(ctx, dockerTypes.NodeListOptions{})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	selected, err := selectNodes(c, nodes)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if len(selected) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "no node matches the selection"})
+	}
+
+	result := domain.ClusterPruneResult{Kind: kind, Nodes: make(map[string]domain.NodePruneReport)}
+	hostnames := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		hostnames[n.ID] = n.Description.Hostname
+	}
+
+	// Les nodes indisponibles ne recevront pas de tâche : elles sont exclues du job
+	// et signalées en erreur. Swarm ne sait pas exprimer un OU entre contraintes,
+	// on exclut donc une à une les nodes non retenues.
+	targets := make(map[string]bool)
+	var constraints []string
+	for _, n := range nodes {
+		switch {
+		case !selected[n.ID]:
+			constraints = append(constraints, "node.id!="+n.ID)
+		case n.Status.State != swarm.NodeStateReady:
+			constraints = append(constraints, "node.id!="+n.ID)
+			result.Nodes[n.ID] = domain.NodePruneReport{NodeID: n.ID, Hostname: n.Description.Hostname, Error: "node is " + string(n.Status.State)}
+		case n.Spec.Availability != swarm.NodeAvailabilityActive:
+			constraints = append(constraints, "node.id!="+n.ID)
+			result.Nodes[n.ID] = domain.NodePruneReport{NodeID: n.ID, Hostname: n.Description.Hostname, Error: "node availability is " + string(n.Spec.Availability)}
+		default:
+			targets[n.ID] = true
+		}
+	}
+
+	if len(targets) > 0 {
+		reports, err := h.runPruneJob(ctx, kind, all, constraints, targets, timeout)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		for nodeID, report := range reports {
+			report.NodeID = nodeID
+			if report.Hostname == "" {
+				report.Hostname = hostnames[nodeID]
+			}
+			result.Nodes[nodeID] = report
+		}
+	}
+
+	for _, report := range result.Nodes {
+		if report.Error != "" {
+			result.FailedNodes++
+		}
+		result.ContainersDeleted += report.ContainersDeleted
+		result.ImagesDeleted += report.ImagesDeleted
+		result.VolumesDeleted += report.VolumesDeleted
+		result.NetworksDeleted += report.NetworksDeleted
+		result.SpaceReclaimed += report.SpaceReclaimed
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// runPruneJob crée le job global, attend la fin de ses tâches puis lit les
+// rapports JSON écrits sur la sortie standard. Le service est toujours supprimé,
+// même après l'annulation de ctx.
+func (h *Handler) runPruneJob(ctx context.Context, kind string, all bool, constraints []string, targets map[string]bool, timeout time.Duration) (map[string]domain.NodePruneReport, error) {
+	image, err := h.jobImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	command := []string{pruneJobBinary, "-prune-node", kind}
+	if all {
+		command = append(command, "-prune-all")
+	}
+
+	spec := swarm.ServiceSpec{
+		Annotations: swarm.Annotations{
+			Name:   fmt.Sprintf("swarm-manager-prune-%d", time.Now().UnixNano()),
+			Labels: map[string]string{pruneJobLabel: "prune"},
+		},
+		Mode: swarm.ServiceMode{GlobalJob: &swarm.GlobalJob{}},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{
+				Image:   image,
+				Command: command,
+				Mounts: []mount.Mount{{
+					Type:   mount.TypeBind,
+					Source: dockerSocket,
+					Target: dockerSocket,
+				}},
+			},
+			Placement:     &swarm.Placement{Constraints: constraints},
+			RestartPolicy: &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionNone},
+		},
+	}
+
+	created, err := h.dockerClient.ServiceCreate(ctx, spec, dockerTypes.ServiceCreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create prune job: %w", err)
+	}
+	defer h.dockerClient.ServiceRemove(context.WithoutCancel(ctx), created.ID)
+
+	reports := make(map[string]domain.NodePruneReport)
+
+	// Attendre que chaque node ciblée ait une tâche terminée
+	taskFilter := filters.NewArgs(filters.Arg("service", created.ID))
+	deadline := time.Now().Add(timeout)
+	var tasks []swarm.Task
+	for {
+		tasks, err = h.dockerClient.TaskList(ctx, dockerTypes.TaskListOptions{Filters: taskFilter})
+		if err != nil {
+			return nil, err
+		}
+		if jobFinished(tasks, targets) || time.Now().After(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			// Client parti : personne ne lira les rapports
+			return nil, ctx.Err()
+		case <-time.After(min(pruneJobPollDelay, time.Until(deadline))):
+		}
+	}
+
+	logs, err := h.dockerClient.ServiceLogs(ctx, created.ID, container.LogsOptions{ShowStdout: true})
+	if err == nil {
+		var stdout bytes.Buffer
+		stdcopy.StdCopy(&stdout, &bytes.Buffer{}, logs)
+		logs.Close()
+
+		scanner := bufio.NewScanner(&stdout)
+		for scanner.Scan() {
+			var report domain.NodePruneReport
+			line := strings.TrimSpace(scanner.Text())
+			if json.Unmarshal([]byte(line), &report) == nil && report.NodeID != "" {
+				reports[report.NodeID] = report
+			}
+		}
+	}
+
+	// Les nodes sans rapport prennent l'erreur de leur tâche
+	for nodeID := range targets {
+		if _, ok := reports[nodeID]; ok {
+			continue
+		}
+		report := domain.NodePruneReport{NodeID: nodeID, Error: "timed out waiting for the prune task"}
+		for _, t := range tasks {
+			if t.NodeID != nodeID {
+				continue
+			}
+			switch {
+			case t.Status.Err != "":
+				report.Error = t.Status.Err
+			case isTerminalTaskState(t.Status.State):
+				report.Error = "prune task ended without a report (" + string(t.Status.State) + ")"
+			}
+		}
+		reports[nodeID] = report
+	}
+	return reports, nil
+}
+
+// selectNodes renvoie les nodes retenues par ?node= (ID ou hostname), ?role= et
+// ?label= (clé ou clé=valeur). Les critères se cumulent ; sans critère, toutes.
+func selectNodes(c echo.Context, nodes []swarm.Node) (map[string]bool, error) {
+	params := c.QueryParams()
+	var wanted []string
+	for _, v := range params["node"] {
+		for _, n := range strings.Split(v, ",") {
+			if n = strings.TrimSpace(n); n != "" {
+				wanted = append(wanted, n)
+			}
+		}
+	}
+	role := c.QueryParam("role")
+	if role != "" && role != string(swarm.NodeRoleManager) && role != string(swarm.NodeRoleWorker) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+
+	selected := make(map[string]bool)
+	for _, n := range nodes {
+		if len(wanted) > 0 && !containsString(wanted, n.ID) && !containsString(wanted, n.Description.Hostname) {
+			continue
+		}
+		if role != "" && string(n.Spec.Role) != role {
+			continue
+		}
+		if !matchNodeLabels(params["label"], n.Spec.Labels) {
+			continue
+		}
+		selected[n.ID] = true
+	}
+	return selected, nil
+}
+
+func matchNodeLabels(selectors []string, labels map[string]string) bool {
+	for _, selector := range selectors {
+		key, value, hasValue := strings.Cut(selector, "=")
+		actual, ok := labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func jobFinished(tasks []swarm.Task, targets map[string]bool) bool {
+	done := make(map[string]bool)
+	for _, t := range tasks {
+		if isTerminalTaskState(t.Status.State) {
+			done[t.NodeID] = true
+		}
+	}
+	for nodeID := range targets {
+		if !done[nodeID] {
+			return false
+		}
+	}
+	return true
+}
+
+func isTerminalTaskState(state swarm.TaskState) bool {
+	switch state {
+	case swarm.TaskStateComplete, swarm.TaskStateFailed, swarm.TaskStateRejected,
+		swarm.TaskStateShutdown, swarm.TaskStateOrphaned, swarm.TaskStateRemove:
+		return true
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
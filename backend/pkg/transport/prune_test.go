@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+func TestPruneJobImageFollowsTheBackendService(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	h := NewHandler(f)
+	created, err := f.ServiceCreate(context.Background(), swarm.ServiceSpec{
+		Annotations:  swarm.Annotations{Name: "swarm-manager_backend"},
+		TaskTemplate: swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "ghcr.io/affell/swarm-manager:1.4@sha256:0123"}},
+	}, dockerTypes.ServiceCreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.AddContainer(container.Summary{ID: "3f9c2b7a1d4e5f60718293a4", State: "running", Labels: map[string]string{serviceIDLabel: created.ID}})
+	defer func(previous func() (string, error)) { hostname = previous }(hostname)
+
+	hostname = func() (string, error) { return "0a1b2c3d4e5f", nil }
+	if _, err := h.jobImage(context.Background()); err == nil || !strings.Contains(err.Error(), "PRUNE_JOB_IMAGE") {
+		t.Errorf("outside of the service: error = %v, want a hint to set PRUNE_JOB_IMAGE", err)
+	}
+
+	hostname = func() (string, error) { return "3f9c2b7a1d4e", nil }
+	if image, err := h.jobImage(context.Background()); err != nil || image != "ghcr.io/affell/swarm-manager:1.4@sha256:0123" {
+		t.Errorf("image = %q, %v, want the pinned image of the service", image, err)
+	}
+
+	h.SetPruneJobImage("registry.local/swarm-manager:2")
+	if image, _ := h.jobImage(context.Background()); image != "registry.local/swarm-manager:2" {
+		t.Errorf("image = %q, want PRUNE_JOB_IMAGE", image)
+	}
+}
+
+func TestPruneClusterKeysReportsByNodeID(t *testing.T) {
+	f, e := newTestServer(t)
+	h := NewHandler(f)
+	h.SetPruneJobImage("registry.local/swarm-manager:2")
+	e.POST("/prune/images", h.PruneImages)
+
+	// Des nodes réinstallées peuvent partager le même hostname
+	n1 := f.AddNode("node", swarm.NodeRoleManager)
+	n2 := f.AddNode("node", swarm.NodeRoleWorker)
+	down := f.AddNode("node", swarm.NodeRoleWorker)
+	f.SetNodeState(down.ID, swarm.NodeStateDown)
+	f.SetJobRunner(func(_ swarm.TaskSpec, n swarm.Node) ([]byte, error) {
+		out, err := json.Marshal(domain.NodePruneReport{NodeID: n.ID, Hostname: n.Description.Hostname, ImagesDeleted: 2})
+		return append(out, '\n'), err
+	})
+
+	var result domain.ClusterPruneResult
+	if code := do(t, e, http.MethodPost, "/prune/images?scope=cluster", "", &result); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if len(result.Nodes) != 3 || result.ImagesDeleted != 4 || result.FailedNodes != 1 {
+		t.Fatalf("result = %+v, want the three nodes", result)
+	}
+	for _, n := range []swarm.Node{n1, n2, down} {
+		if report := result.Nodes[n.ID]; report.NodeID != n.ID || report.Hostname != "node" {
+			t.Errorf("report of %s = %+v", n.ID, report)
+		}
+	}
+	if report := result.Nodes[down.ID]; report.Error != "node is down" {
+		t.Errorf("down node error = %q", report.Error)
+	}
+}
+
+// pendingJobSwarm simule un job dont les tâches ne démarrent jamais et note si
+// la suppression du service reçoit un contexte annulé
+type pendingJobSwarm struct {
+	*infratest.FakeSwarm
+	removeErr chan error
+}
+
+func (f *pendingJobSwarm) TaskList(context.Context, dockerTypes.TaskListOptions) ([]swarm.Task, error) {
+	return nil, nil
+}
+
+func (f *pendingJobSwarm) ServiceRemove(ctx context.Context, serviceID string) error {
+	f.removeErr <- ctx.Err()
+	return f.FakeSwarm.ServiceRemove(ctx, serviceID)
+}
+
+func TestPruneClusterStopsWhenTheClientLeaves(t *testing.T) {
+	f := infratest.NewFakeSwarm()
+	f.AddNode("n1", swarm.NodeRoleManager)
+	pending := &pendingJobSwarm{FakeSwarm: f, removeErr: make(chan error, 1)}
+	h := NewHandler(pending)
+	h.SetPruneJobImage("registry.local/swarm-manager:2")
+	e := echo.New()
+	e.POST("/prune/images", h.PruneImages)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	req := httptest.NewRequest(http.MethodPost, "/prune/images?scope=cluster&timeout=10h", nil).WithContext(ctx)
+	start := time.Now()
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("handler returned after %s, want it to stop with the client", elapsed)
+	}
+	select {
+	case err := <-pending.removeErr:
+		if err != nil {
+			t.Errorf("job removed with a cancelled context: %v", err)
+		}
+	default:
+		t.Fatal("prune job not removed")
+	}
+	if services, _ := f.ServiceList(context.Background(), dockerTypes.ServiceListOptions{}); len(services) != 0 {
+		t.Errorf("services = %d, want the job removed", len(services))
+	}
+}
+
+func TestPruneClusterTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		timeout string
+		status  int
+	}{
+		{"0s", http.StatusBadRequest},
+		{"-1m", http.StatusBadRequest},
+		{"soon", http.StatusBadRequest},
+		// Les délais trop longs sont ramenés à maxPruneTimeout
+		{"10h", http.StatusOK},
+	} {
+		t.Run(tc.timeout, func(t *testing.T) {
+			f, e := newTestServer(t)
+			h := NewHandler(f)
+			h.SetPruneJobImage("registry.local/swarm-manager:2")
+			e.POST("/prune/images", h.PruneImages)
+			f.AddNode("n1", swarm.NodeRoleManager)
+
+			if code := do(t, e, http.MethodPost, "/prune/images?scope=cluster&timeout="+tc.timeout, "", nil); code != tc.status {
+				t.Errorf("status = %d, want %d", code, tc.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"strconv"
+
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// Label posé sur un service arrêté pour mémoriser son nombre de réplicas
+const previousReplicasLabel = "swarm-manager.previous-replicas"
+
+// Nombre de réplicas utilisé par StartService pour un service arrêté sans
+// label mémorisé ; StartStack laisse ces services à 0
+const defaultStartReplicas uint64 = 1
+
+// replicaCount renvoie le nombre de réplicas d'un service répliqué
+func replicaCount(spec swarm.ServiceSpec) uint64 {
+	if spec.Mode.Replicated == nil || spec.Mode.Replicated.Replicas == nil {
+		return 0
+	}
+	return *spec.Mode.Replicated.Replicas
+}
+
+// stopReplicas passe un service répliqué à 0 réplicas en mémorisant le nombre
+// actuel dans un label. Un service déjà à 0 conserve le label existant.
+// Renvoie false si la spec n'a pas besoin d'être mise à jour.
+func stopReplicas(spec *swarm.ServiceSpec) bool {
+	if spec.Mode.Replicated == nil {
+		return false
+	}
+	current := uint64(0)
+	if spec.Mode.Replicated.Replicas != nil {
+		current = *spec.Mode.Replicated.Replicas
+	}
+	if current == 0 {
+		return false
+	}
+
+	if spec.Labels == nil {
+		spec.Labels = make(map[string]string)
+	}
+	spec.Labels[previousReplicasLabel] = strconv.FormatUint(current, 10)
+	zero := uint64(0)
+	spec.Mode.Replicated.Replicas = &zero
+	return true
+}
+
+// startReplicas restaure le nombre de réplicas mémorisé par stopReplicas et
+// retire le label. Un service à 0 sans label mémorisé passe à fallback, ou
+// reste à 0 si fallback vaut 0. Renvoie le nombre de réplicas appliqué, si la
+// valeur vient du label, et si la spec a été modifiée.
+func startReplicas(spec *swarm.ServiceSpec, fallback uint64) (replicas uint64, restored bool, changed bool) {
+	if spec.Mode.Replicated == nil {
+		return 0, false, false
+	}
+	if spec.Mode.Replicated.Replicas != nil {
+		replicas = *spec.Mode.Replicated.Replicas
+	}
+
+	if value, ok := spec.Labels[previousReplicasLabel]; ok {
+		delete(spec.Labels, previousReplicasLabel)
+		changed = true
+		if previous, err := strconv.ParseUint(value, 10, 64); err == nil && previous > 0 {
+			replicas = previous
+			restored = true
+		}
+	}
+
+	// Service arrêté sans mémoire de son état précédent
+	if replicas == 0 {
+		replicas = fallback
+	}
+	if spec.Mode.Replicated.Replicas == nil || *spec.Mode.Replicated.Replicas != replicas {
+		changed = true
+	}
+	spec.Mode.Replicated.Replicas = &replicas
+	return replicas, restored, changed
+}
+
+// scaleReplicas applique un nombre de réplicas explicite. Passer à 0 mémorise le
+// nombre actuel comme stopReplicas ; un nombre non nul rend le label obsolète.
+// Renvoie le nombre de réplicas précédent et si la spec a été modifiée.
+func scaleReplicas(spec *swarm.ServiceSpec, replicas uint64) (previous uint64, changed bool) {
+	if spec.Mode.Replicated == nil {
+		return 0, false
+	}
+	if spec.Mode.Replicated.Replicas != nil {
+		previous = *spec.Mode.Replicated.Replicas
+	}
+	if replicas == 0 {
+		return previous, stopReplicas(spec)
+	}
+
+	if _, ok := spec.Labels[previousReplicasLabel]; ok {
+		delete(spec.Labels, previousReplicasLabel)
+		changed = true
+	}
+	if previous != replicas {
+		changed = true
+	}
+	spec.Mode.Replicated.Replicas = &replicas
+	return previous, changed
+}
+
+// keepReplicas reporte sur spec, redéployée depuis un fichier compose, l'état
+// posé par stop et scale sur le service en place. Un service arrêté reste
+// arrêté avec son label, qui prend le nombre du fichier s'il en fixe un ; sinon
+// le nombre de réplicas actuel est conservé quand le fichier ne le fixe pas.
+func keepReplicas(current swarm.ServiceSpec, spec *swarm.ServiceSpec, fixed bool) {
+	if current.Mode.Replicated == nil || spec.Mode.Replicated == nil {
+		return
+	}
+	replicas := uint64(0)
+	if current.Mode.Replicated.Replicas != nil {
+		replicas = *current.Mode.Replicated.Replicas
+	}
+
+	if previous, ok := current.Labels[previousReplicasLabel]; ok && replicas == 0 {
+		if fixed {
+			if *spec.Mode.Replicated.Replicas == 0 {
+				return
+			}
+			previous = strconv.FormatUint(*spec.Mode.Replicated.Replicas, 10)
+		}
+		if spec.Labels == nil {
+			spec.Labels = make(map[string]string)
+		}
+		spec.Labels[previousReplicasLabel] = previous
+		spec.Mode.Replicated.Replicas = &replicas
+		return
+	}
+	if !fixed {
+		spec.Mode.Replicated.Replicas = &replicas
+	}
+}
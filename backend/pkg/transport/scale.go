@@ -0,0 +1,303 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+const (
+	defaultScaleTimeout = 2 * time.Minute
+	maxScaleTimeout     = 30 * time.Minute
+	scalePollDelay      = time.Second
+	// Avec Accept: application/x-ndjson, l'attente est diffusée ligne par ligne
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// scaleRequest est le corps de POST /services/:id/scale et /stacks/:name/scale
+type scaleRequest struct {
+	Replicas *uint64           `json:"replicas"`
+	Services map[string]uint64 `json:"services"`
+	Wait     bool              `json:"wait"`
+	Timeout  string            `json:"timeout"`
+}
+
+// scaleProgress est une ligne du flux NDJSON renvoyé pendant l'attente
+type scaleProgress struct {
+	Event     string                `json:"event"` // progress ou done
+	Converged bool                  `json:"converged"`
+	Services  []domain.ServiceScale `json:"services"`
+}
+
+// ScaleService fixe le nombre de réplicas d'un service.
+// Corps : {"replicas": 3, "wait": true, "timeout": "2m"}
+func (h *Handler) ScaleService(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	req, timeout, err := readScaleRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if req.Replicas == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "replicas is required"})
+	}
+
+	ctx := context.Background()
+	svc, _, err := h.dockerClient.ServiceInspectWithRaw(ctx, c.Param("id"), dockerTypes.ServiceInspectOptions{})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if err := checkScalable(svc); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	scale, err := h.applyScale(ctx, svc, *req.Replicas)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return h.respondScale(c, []domain.ServiceScale{scale}, req.Wait, timeout, false)
+}
+
+// ScaleStack fixe le nombre de réplicas de plusieurs services d'une stack.
+// Corps : {"services": {"web": 3, "worker": 1}, "wait": true}. Les services
+// sont désignés par leur nom court ou complet ; rien n'est modifié si l'un
+// d'eux est inconnu ou en mode global. Si la mise à jour d'un service échoue,
+// la réponse 500 donne l'état de chacun.
+func (h *Handler) ScaleStack(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	req, timeout, err := readScaleRequest(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if len(req.Services) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "services is required"})
+	}
+
+	ctx := context.Background()
+	name := c.Param("name")
+	services, err := h.dockerClient.ServiceList(ctx, dockerTypes.ServiceListOptions{Filters: stackFilter(name)})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if len(services) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "stack " + name + " not found"})
+	}
+
+	// Valider toute la demande avant de modifier quoi que ce soit
+	targets := make([]swarm.Service, 0, len(req.Services))
+	replicas := make([]uint64, 0, len(req.Services))
+	keys := make([]string, 0, len(req.Services))
+	for key := range req.Services {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		svc, ok := findStackService(services, name, key)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "service " + key + " is not part of stack " + name})
+		}
+		if err := checkScalable(svc); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		targets = append(targets, svc)
+		replicas = append(replicas, req.Services[key])
+	}
+
+	// Chaque service est modifié même si un autre échoue : la réponse donne
+	// l'état de chacun, sans attendre la convergence en cas d'échec
+	result := make([]domain.ServiceScale, 0, len(targets))
+	failed := 0
+	for i, svc := range targets {
+		// applyScale modifie Mode.Replicated, partagé avec svc.Spec
+		previous := replicaCount(svc.Spec)
+		scale, err := h.applyScale(ctx, svc, replicas[i])
+		if err != nil {
+			failed++
+			scale = domain.ServiceScale{
+				ID:               svc.ID,
+				Name:             svc.Spec.Name,
+				PreviousReplicas: previous,
+				Replicas:         replicas[i],
+				Error:            err.Error(),
+			}
+		}
+		result = append(result, scale)
+	}
+	if failed > 0 {
+		h.refreshScale(ctx, result)
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"stack":    name,
+			"services": result,
+			"error":    fmt.Sprintf("%d of %d services could not be scaled", failed, len(result)),
+		})
+	}
+	return h.respondScale(c, result, req.Wait, timeout, true)
+}
+
+func readScaleRequest(c echo.Context) (scaleRequest, time.Duration, error) {
+	var req scaleRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return req, 0, fmt.Errorf("invalid request body: %w", err)
+	}
+	if c.QueryParam("wait") == "true" {
+		req.Wait = true
+	}
+
+	timeout := defaultScaleTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			return req, 0, errors.New("invalid timeout")
+		}
+		timeout = min(d, maxScaleTimeout)
+	}
+	return req, timeout, nil
+}
+
+// checkScalable refuse les services globaux et les jobs, dont le nombre de
+// tâches ne se règle pas
+func checkScalable(svc swarm.Service) error {
+	switch {
+	case svc.Spec.Mode.Global != nil:
+		return fmt.Errorf("service %s is in global mode and runs one task per node; it cannot be scaled", svc.Spec.Name)
+	case svc.Spec.Mode.Replicated == nil:
+		return fmt.Errorf("service %s is not in replicated mode", svc.Spec.Name)
+	}
+	return nil
+}
+
+func (h *Handler) applyScale(ctx context.Context, svc swarm.Service, replicas uint64) (domain.ServiceScale, error) {
+	spec := svc.Spec
+	previous, changed := scaleReplicas(&spec, replicas)
+	if changed {
+		if _, err := h.dockerClient.ServiceUpdate(ctx, svc.ID, svc.Version, spec, dockerTypes.ServiceUpdateOptions{}); err != nil {
+			return domain.ServiceScale{}, err
+		}
+	}
+	return domain.ServiceScale{
+		ID:               svc.ID,
+		Name:             svc.Spec.Name,
+		PreviousReplicas: previous,
+		Replicas:         replicas,
+	}, nil
+}
+
+// respondScale renvoie l'état des services, après avoir attendu la convergence
+// si wait est demandé. Avec Accept: application/x-ndjson, chaque relevé est
+// envoyé au fil de l'eau puis un dernier objet "done".
+func (h *Handler) respondScale(c echo.Context, scales []domain.ServiceScale, wait bool, timeout time.Duration, stack bool) error {
+	ctx := context.Background()
+	stream := wait && strings.Contains(c.Request().Header.Get(echo.HeaderAccept), mimeNDJSON)
+
+	var enc *json.Encoder
+	if stream {
+		c.Response().Header().Set(echo.HeaderContentType, mimeNDJSON)
+		c.Response().WriteHeader(http.StatusOK)
+		enc = json.NewEncoder(c.Response())
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		converged, err := h.refreshScale(ctx, scales)
+		if err != nil {
+			if stream {
+				return enc.Encode(map[string]string{"event": "error", "error": err.Error()})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		done := !wait || converged || time.Now().After(deadline)
+		if stream {
+			progress := scaleProgress{Event: "progress", Converged: converged, Services: scales}
+			if done {
+				progress.Event = "done"
+			}
+			if err := enc.Encode(progress); err != nil {
+				return nil
+			}
+			c.Response().Flush()
+		}
+		if done {
+			break
+		}
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-time.After(scalePollDelay):
+		}
+	}
+
+	if stream {
+		return nil
+	}
+	if stack {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"stack":    c.Param("name"),
+			"services": scales,
+		})
+	}
+	return c.JSON(http.StatusOK, scales[0])
+}
+
+// refreshScale met à jour le nombre de tâches en cours d'exécution de chaque
+// service avec un seul appel à TaskList
+func (h *Handler) refreshScale(ctx context.Context, scales []domain.ServiceScale) (bool, error) {
+	f := filters.NewArgs(filters.Arg("desired-state", string(swarm.TaskStateRunning)))
+	for _, s := range scales {
+		f.Add("service", s.ID)
+	}
+	tasks, err := h.dockerClient.TaskList(ctx, dockerTypes.TaskListOptions{Filters: f})
+	if err != nil {
+		return false, err
+	}
+
+	running := make(map[string]uint64)
+	pending := make(map[string]bool)
+	for _, t := range tasks {
+		if t.DesiredState != swarm.TaskStateRunning {
+			continue
+		}
+		if t.Status.State == swarm.TaskStateRunning {
+			running[t.ServiceID]++
+		} else {
+			pending[t.ServiceID] = true
+		}
+	}
+
+	all := true
+	for i := range scales {
+		s := &scales[i]
+		s.Running = running[s.ID]
+		s.Converged = s.Running == s.Replicas && !pending[s.ID]
+		all = all && s.Converged
+	}
+	return all, nil
+}
+
+// findStackService retrouve un service de la stack par nom complet ou court
+func findStackService(services []swarm.Service, stack, name string) (swarm.Service, bool) {
+	for _, s := range services {
+		if s.Spec.Name == name || s.Spec.Name == stack+"_"+name || s.ID == name {
+			return s, true
+		}
+	}
+	return swarm.Service{}, false
+}
@@ -0,0 +1,157 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+// scaleStackResponse est la réponse de ScaleStack
+type scaleStackResponse struct {
+	Services []domain.ServiceScale `json:"services"`
+	Error    string                `json:"error"`
+}
+
+func TestScaleServiceWaits(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	f.AddNode("w1", swarm.NodeRoleWorker)
+	svc := f.AddService(replicated("web", 1, nil))
+
+	var scale domain.ServiceScale
+	if code := do(t, e, http.MethodPost, "/services/"+svc.ID+"/scale", `{"replicas": 4, "wait": true, "timeout": "5s"}`, &scale); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if scale.PreviousReplicas != 1 || scale.Replicas != 4 || scale.Running != 4 || !scale.Converged {
+		t.Errorf("scale = %+v", scale)
+	}
+	if code := do(t, e, http.MethodPost, "/services/"+svc.ID+"/scale", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("missing replicas: status = %d, want 400", code)
+	}
+}
+
+func TestScaleStack(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	h := NewHandler(f)
+	e.POST("/stacks/:name/scale", h.ScaleStack)
+	stack := map[string]string{"com.docker.stack.namespace": "app"}
+	f.AddService(replicated("app_web", 1, stack))
+	f.AddService(replicated("app_worker", 2, stack))
+	agent := replicated("app_agent", 0, stack)
+	agent.Mode = swarm.ServiceMode{Global: &swarm.GlobalService{}}
+	f.AddService(agent)
+
+	for _, tc := range []struct {
+		name, body, want string
+		code             int
+	}{
+		{"unknown service", `{"services": {"web": 3, "db": 1}}`, "service db is not part of stack app", http.StatusBadRequest},
+		{"global service", `{"services": {"web": 3, "agent": 2}}`, "global mode", http.StatusBadRequest},
+		{"no services", `{}`, "services is required", http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f.ResetCalls()
+			var resp scaleStackResponse
+			if code := do(t, e, http.MethodPost, "/stacks/app/scale", tc.body, &resp); code != tc.code || !strings.Contains(resp.Error, tc.want) {
+				t.Errorf("status = %d, error = %q, want %d %q", code, resp.Error, tc.code, tc.want)
+			}
+			if calls := f.Calls("ServiceUpdate"); calls != 0 {
+				t.Errorf("%d services updated by an invalid request", calls)
+			}
+		})
+	}
+	if code := do(t, e, http.MethodPost, "/stacks/other/scale", `{"services": {"web": 3}}`, nil); code != http.StatusNotFound {
+		t.Errorf("unknown stack: status = %d, want 404", code)
+	}
+
+	var resp scaleStackResponse
+	if code := do(t, e, http.MethodPost, "/stacks/app/scale", `{"services": {"web": 3, "app_worker": 0}, "wait": true, "timeout": "5s"}`, &resp); code != http.StatusOK {
+		t.Fatalf("status = %d, error = %q", code, resp.Error)
+	}
+	if len(resp.Services) != 2 {
+		t.Fatalf("services = %+v", resp.Services)
+	}
+	for _, s := range resp.Services {
+		want := map[string][2]uint64{"app_web": {1, 3}, "app_worker": {2, 0}}[s.Name]
+		if s.PreviousReplicas != want[0] || s.Replicas != want[1] || s.Running != want[1] || !s.Converged {
+			t.Errorf("%s = %+v, want %d -> %d converged", s.Name, s, want[0], want[1])
+		}
+	}
+}
+
+func TestScaleStackReportsFailures(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	h := NewHandler(f)
+	e.POST("/stacks/:name/scale", h.ScaleStack)
+	stack := map[string]string{"com.docker.stack.namespace": "app"}
+	f.AddService(replicated("app_api", 1, stack))
+	f.AddService(replicated("app_web", 1, stack))
+	f.FailOnce("ServiceUpdate", errors.New("update out of sequence"))
+
+	var resp scaleStackResponse
+	if code := do(t, e, http.MethodPost, "/stacks/app/scale", `{"services": {"api": 2, "web": 3}, "wait": true}`, &resp); code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", code)
+	}
+	if len(resp.Services) != 2 || resp.Error != "1 of 2 services could not be scaled" {
+		t.Fatalf("response = %+v", resp)
+	}
+	// Les services sont traités par nom : api a échoué, web a quand même été modifié
+	api, web := resp.Services[0], resp.Services[1]
+	if api.Name != "app_api" || api.Error == "" || api.PreviousReplicas != 1 || api.Running != 1 {
+		t.Errorf("api = %+v, want an error and 1 running task", api)
+	}
+	if web.Name != "app_web" || web.Error != "" || web.Replicas != 3 || web.Running != 3 {
+		t.Errorf("web = %+v, want 3 replicas", web)
+	}
+}
+
+func TestScaleServiceStreamsProgress(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	spec := replicated("web", 1, nil)
+	// Aucune node ne convient : les nouvelles tâches restent en attente
+	spec.TaskTemplate.Placement = &swarm.Placement{Constraints: []string{"node.labels.zone==a"}}
+	svc := f.AddService(spec)
+
+	req := httptest.NewRequest(http.MethodPost, "/services/"+svc.ID+"/scale", strings.NewReader(`{"replicas": 2, "wait": true, "timeout": "1s"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAccept, mimeNDJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != mimeNDJSON {
+		t.Fatalf("status = %d, content type = %q", rec.Code, rec.Header().Get(echo.HeaderContentType))
+	}
+	var lines []scaleProgress
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var p scaleProgress
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, p)
+	}
+	if len(lines) < 2 {
+		t.Fatalf("got %d lines, want progress then done", len(lines))
+	}
+	for _, p := range lines[:len(lines)-1] {
+		if p.Event != "progress" {
+			t.Errorf("event = %q, want progress", p.Event)
+		}
+	}
+	last := lines[len(lines)-1]
+	if last.Event != "done" || last.Converged || len(last.Services) != 1 || last.Services[0].Replicas != 2 || last.Services[0].Running != 0 {
+		t.Errorf("last = %+v, want done without convergence", last)
+	}
+}
@@ -0,0 +1,552 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/auth"
+	"github.com/Affell/swarm-manager/backend/pkg/compose"
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+// Taille maximale acceptée pour un fichier compose, un .env ou un fichier joint
+const maxStackFileSize = 10 << 20
+
+// stackConflictError refuse un déploiement incompatible avec les objets existants
+type stackConflictError struct{ msg string }
+
+func (e stackConflictError) Error() string { return e.msg }
+
+// Même contrainte que les noms de services swarm, qui sont préfixés par le nom de la stack
+var stackNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// stackUpload contient les fichiers envoyés pour déployer une stack
+type stackUpload struct {
+	name    string
+	compose []byte
+	env     []byte
+	files   map[string][]byte
+}
+
+// DeployStack déploie une nouvelle stack à partir d'un fichier compose v3.
+// Le corps est soit un formulaire multipart (name, compose, env et files pour les
+// secrets/configs), soit le fichier compose brut avec ?name=.
+func (h *Handler) DeployStack(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	upload, err := readStackUpload(c, "")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	existing, err := h.stackServices(context.Background(), upload.name)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if len(existing) > 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "stack " + upload.name + " already exists, use PUT to update it"})
+	}
+
+	return h.applyStack(c, upload, false)
+}
+
+// UpdateStack met à jour une stack existante à partir d'un fichier compose v3.
+// Avec ?prune=true, les services absents du fichier sont supprimés, ce qui
+// exige le rôle admin comme la suppression de la stack.
+func (h *Handler) UpdateStack(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	prune := c.QueryParam("prune") == "true"
+	if prune {
+		if principal := auth.PrincipalFrom(c); principal == nil || !principal.Role.Allows(auth.RoleAdmin) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "role admin required for prune=true"})
+		}
+	}
+
+	upload, err := readStackUpload(c, c.Param("name"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	existing, err := h.stackServices(context.Background(), upload.name)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if len(existing) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "stack " + upload.name + " not found"})
+	}
+
+	return h.applyStack(c, upload, prune)
+}
+
+// RemoveStack supprime les services, réseaux, secrets et configs d'une stack
+func (h *Handler) RemoveStack(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	ctx := context.Background()
+	name := c.Param("name")
+	f := stackFilter(name)
+
+	services, err := h.dockerClient.ServiceList(ctx, dockerTypes.ServiceListOptions{Filters: f})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	networks, err := h.dockerClient.NetworkList(ctx, network.ListOptions{Filters: f})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	secrets, err := h.dockerClient.SecretList(ctx, dockerTypes.SecretListOptions{Filters: f})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	configs, err := h.dockerClient.ConfigList(ctx, dockerTypes.ConfigListOptions{Filters: f})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if len(services)+len(networks)+len(secrets)+len(configs) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "stack " + name + " not found"})
+	}
+
+	removed := map[string][]string{"services": {}, "networks": {}, "secrets": {}, "configs": {}}
+	var errs []string
+
+	// Les services d'abord : les réseaux, secrets et configs ne peuvent pas
+	// être supprimés tant qu'ils sont utilisés
+	for _, s := range services {
+		if err := h.dockerClient.ServiceRemove(ctx, s.ID); err != nil {
+			errs = append(errs, fmt.Sprintf("service %s: %s", s.Spec.Name, err.Error()))
+			continue
+		}
+		removed["services"] = append(removed["services"], s.Spec.Name)
+	}
+	for _, s := range secrets {
+		if err := h.dockerClient.SecretRemove(ctx, s.ID); err != nil {
+			errs = append(errs, fmt.Sprintf("secret %s: %s", s.Spec.Name, err.Error()))
+			continue
+		}
+		removed["secrets"] = append(removed["secrets"], s.Spec.Name)
+	}
+	for _, cfg := range configs {
+		if err := h.dockerClient.ConfigRemove(ctx, cfg.ID); err != nil {
+			errs = append(errs, fmt.Sprintf("config %s: %s", cfg.Spec.Name, err.Error()))
+			continue
+		}
+		removed["configs"] = append(removed["configs"], cfg.Spec.Name)
+	}
+	for _, n := range networks {
+		// Les tâches des services supprimés libèrent leurs endpoints de façon asynchrone
+		var err error
+		for attempt := 0; attempt < 10; attempt++ {
+			if err = h.dockerClient.NetworkRemove(ctx, n.ID); err == nil || !strings.Contains(err.Error(), "active endpoints") {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("network %s: %s", n.Name, err.Error()))
+			continue
+		}
+		removed["networks"] = append(removed["networks"], n.Name)
+	}
+
+	response := map[string]interface{}{
+		"name":    name,
+		"removed": removed,
+	}
+	if len(errs) > 0 {
+		response["errors"] = errs
+		return c.JSON(http.StatusInternalServerError, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// applyStack convertit le fichier compose et crée ou met à jour les objets swarm
+func (h *Handler) applyStack(c echo.Context, upload *stackUpload, prune bool) error {
+	cfg, err := compose.Load(upload.compose, upload.env)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	stack, err := compose.Convert(upload.name, cfg, upload.files)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	// Un operator ne doit pas pouvoir prendre la main sur les hôtes
+	if access := hostAccess(stack, h.allowedBindSources); len(access) > 0 {
+		if principal := auth.PrincipalFrom(c); principal == nil || !principal.Role.Allows(auth.RoleAdmin) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "role admin required for " + strings.Join(access, ", ")})
+		}
+	}
+
+	result, err := h.deployStack(context.Background(), stack, prune)
+	if err != nil {
+		status := http.StatusInternalServerError
+		var conflict stackConflictError
+		if errors.As(err, &conflict) {
+			status = http.StatusConflict
+		}
+		return c.JSON(status, map[string]interface{}{"error": err.Error(), "result": result})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// deployStack reproduit `docker stack deploy` : réseaux, secrets et configs
+// manquants d'abord, puis création ou mise à jour de chaque service.
+func (h *Handler) deployStack(ctx context.Context, stack *compose.Stack, prune bool) (domain.StackDeployResult, error) {
+	result := domain.StackDeployResult{
+		Name:            stack.Namespace,
+		Services:        []domain.StackServiceChange{},
+		NetworksCreated: []string{},
+		SecretsCreated:  []string{},
+		ConfigsCreated:  []string{},
+	}
+	f := stackFilter(stack.Namespace)
+
+	// Secrets et configs sont immuables : si le contenu a changé, l'objet
+	// existant ne peut être ni remplacé ni réutilisé. Tout est vérifié avant
+	// de modifier quoi que ce soit.
+	secrets, err := h.dockerClient.SecretList(ctx, dockerTypes.SecretListOptions{})
+	if err != nil {
+		return result, err
+	}
+	configs, err := h.dockerClient.ConfigList(ctx, dockerTypes.ConfigListOptions{})
+	if err != nil {
+		return result, err
+	}
+	secretIDs := make(map[string]string)
+	for _, existing := range secrets {
+		secretIDs[existing.Spec.Name] = existing.ID
+		for _, spec := range stack.Secrets {
+			if spec.Name == existing.Spec.Name && contentChanged(existing.Spec.Labels, nil, spec.Labels, spec.Data) {
+				return result, immutableError("secret", spec.Name)
+			}
+		}
+	}
+	configIDs := make(map[string]string)
+	for _, existing := range configs {
+		configIDs[existing.Spec.Name] = existing.ID
+		for _, spec := range stack.Configs {
+			if spec.Name == existing.Spec.Name && contentChanged(existing.Spec.Labels, existing.Spec.Data, spec.Labels, spec.Data) {
+				return result, immutableError("config", spec.Name)
+			}
+		}
+	}
+
+	// Réseaux externes : ils doivent exister
+	for _, name := range stack.ExternalNetworks {
+		nf := filters.NewArgs(filters.Arg("name", name))
+		networks, err := h.dockerClient.NetworkList(ctx, network.ListOptions{Filters: nf})
+		if err != nil {
+			return result, err
+		}
+		if !containsNetwork(networks, name) {
+			return result, fmt.Errorf("external network %q not found", name)
+		}
+	}
+
+	// Réseaux de la stack
+	existingNetworks, err := h.dockerClient.NetworkList(ctx, network.ListOptions{Filters: f})
+	if err != nil {
+		return result, err
+	}
+	networkNames := make([]string, 0, len(stack.Networks))
+	for name := range stack.Networks {
+		networkNames = append(networkNames, name)
+	}
+	sort.Strings(networkNames)
+	for _, name := range networkNames {
+		if containsNetwork(existingNetworks, name) {
+			continue
+		}
+		if _, err := h.dockerClient.NetworkCreate(ctx, name, stack.Networks[name]); err != nil {
+			return result, fmt.Errorf("failed to create network %s: %w", name, err)
+		}
+		result.NetworksCreated = append(result.NetworksCreated, name)
+	}
+
+	// Secrets et configs manquants ; ceux qui existent ont le même contenu
+	for _, spec := range stack.Secrets {
+		if _, ok := secretIDs[spec.Name]; ok {
+			continue
+		}
+		resp, err := h.dockerClient.SecretCreate(ctx, spec)
+		if err != nil {
+			return result, fmt.Errorf("failed to create secret %s: %w", spec.Name, err)
+		}
+		secretIDs[spec.Name] = resp.ID
+		result.SecretsCreated = append(result.SecretsCreated, spec.Name)
+	}
+	for _, spec := range stack.Configs {
+		if _, ok := configIDs[spec.Name]; ok {
+			continue
+		}
+		resp, err := h.dockerClient.ConfigCreate(ctx, spec)
+		if err != nil {
+			return result, fmt.Errorf("failed to create config %s: %w", spec.Name, err)
+		}
+		configIDs[spec.Name] = resp.ID
+		result.ConfigsCreated = append(result.ConfigsCreated, spec.Name)
+	}
+
+	// Services
+	existing, err := h.dockerClient.ServiceList(ctx, dockerTypes.ServiceListOptions{Filters: f})
+	if err != nil {
+		return result, err
+	}
+	existingByName := make(map[string]swarm.Service)
+	for _, s := range existing {
+		existingByName[s.Spec.Name] = s
+	}
+
+	deployed := make(map[string]bool)
+	for _, spec := range stack.Services {
+		for _, ref := range spec.TaskTemplate.ContainerSpec.Secrets {
+			if ref.SecretID = secretIDs[ref.SecretName]; ref.SecretID == "" {
+				return result, fmt.Errorf("service %s: secret %q not found", spec.Name, ref.SecretName)
+			}
+		}
+		for _, ref := range spec.TaskTemplate.ContainerSpec.Configs {
+			if ref.ConfigID = configIDs[ref.ConfigName]; ref.ConfigID == "" {
+				return result, fmt.Errorf("service %s: config %q not found", spec.Name, ref.ConfigName)
+			}
+		}
+		deployed[spec.Name] = true
+
+		if current, ok := existingByName[spec.Name]; ok {
+			// Conserver le compteur de force update pour ne pas redémarrer inutilement les tâches
+			spec.TaskTemplate.ForceUpdate = current.Spec.TaskTemplate.ForceUpdate
+			// Ne pas relancer une stack arrêtée ni annuler un scale
+			keepReplicas(current.Spec, &spec, stack.FixedReplicas[spec.Name])
+			if _, err := h.dockerClient.ServiceUpdate(ctx, current.ID, current.Version, spec, dockerTypes.ServiceUpdateOptions{}); err != nil {
+				return result, fmt.Errorf("failed to update service %s: %w", spec.Name, err)
+			}
+			result.Services = append(result.Services, domain.StackServiceChange{ID: current.ID, Name: spec.Name, Action: "updated"})
+			continue
+		}
+
+		resp, err := h.dockerClient.ServiceCreate(ctx, spec, dockerTypes.ServiceCreateOptions{})
+		if err != nil {
+			return result, fmt.Errorf("failed to create service %s: %w", spec.Name, err)
+		}
+		result.Services = append(result.Services, domain.StackServiceChange{ID: resp.ID, Name: spec.Name, Action: "created"})
+	}
+
+	if prune {
+		for _, s := range existing {
+			if deployed[s.Spec.Name] {
+				continue
+			}
+			if err := h.dockerClient.ServiceRemove(ctx, s.ID); err != nil {
+				return result, fmt.Errorf("failed to remove service %s: %w", s.Spec.Name, err)
+			}
+			result.Services = append(result.Services, domain.StackServiceChange{ID: s.ID, Name: s.Spec.Name, Action: "removed"})
+		}
+	}
+
+	return result, nil
+}
+
+// hostAccess liste les options de la stack qui donnent accès aux hôtes ou aux
+// données des autres stacks : bind mounts hors des chemins autorisés, capacités
+// ajoutées, réseau host, et secrets, configs ou volumes nommés hors de l'espace
+// de noms de la stack (externes ou avec un name: explicite, ils sont réutilisés
+// s'ils existent)
+func hostAccess(stack *compose.Stack, allowedBinds []string) []string {
+	var access []string
+	prefix := compose.ScopedName(stack.Namespace, "")
+	for _, spec := range stack.Services {
+		cs := spec.TaskTemplate.ContainerSpec
+		for _, m := range cs.Mounts {
+			if source, ok := bindSource(m); ok {
+				if !bindAllowed(source, allowedBinds) {
+					access = append(access, fmt.Sprintf("service %s: bind mount of %s", spec.Name, source))
+				}
+				continue
+			}
+			if m.Type == mount.TypeVolume && m.Source != "" && !strings.HasPrefix(m.Source, prefix) {
+				access = append(access, fmt.Sprintf("service %s: volume %s outside the stack", spec.Name, m.Source))
+			}
+		}
+		for _, ref := range cs.Secrets {
+			if !strings.HasPrefix(ref.SecretName, prefix) {
+				access = append(access, fmt.Sprintf("service %s: secret %s outside the stack", spec.Name, ref.SecretName))
+			}
+		}
+		for _, ref := range cs.Configs {
+			if !strings.HasPrefix(ref.ConfigName, prefix) {
+				access = append(access, fmt.Sprintf("service %s: config %s outside the stack", spec.Name, ref.ConfigName))
+			}
+		}
+		if len(cs.CapabilityAdd) > 0 {
+			access = append(access, fmt.Sprintf("service %s: cap_add %s", spec.Name, strings.Join(cs.CapabilityAdd, ",")))
+		}
+	}
+	if containsString(stack.ExternalNetworks, "host") {
+		access = append(access, "host network")
+	}
+	return access
+}
+
+// bindSource renvoie le chemin de l'hôte monté par m : bind mount ou volume
+// local déclaré avec l'option o=bind
+func bindSource(m mount.Mount) (string, bool) {
+	if m.Type == mount.TypeBind {
+		return m.Source, true
+	}
+	if m.VolumeOptions == nil || m.VolumeOptions.DriverConfig == nil {
+		return "", false
+	}
+	opts := m.VolumeOptions.DriverConfig.Options
+	for _, o := range strings.Split(opts["o"], ",") {
+		if o == "bind" || o == "rbind" {
+			return opts["device"], true
+		}
+	}
+	return "", false
+}
+
+// bindAllowed indique si source est l'un des chemins autorisés ou l'un de
+// leurs sous-dossiers
+func bindAllowed(source string, allowed []string) bool {
+	source = path.Clean(source)
+	for _, dir := range allowed {
+		dir = path.Clean(dir)
+		if source == dir || strings.HasPrefix(source, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// contentChanged compare le contenu d'un secret ou d'une config existant à
+// celui du fichier compose, par le hash posé au déploiement ou, pour une
+// config sans hash, par son contenu. Un secret créé sans hash (par docker
+// stack deploy par exemple) ne peut pas être comparé et est réutilisé.
+func contentChanged(labels map[string]string, data []byte, wantLabels map[string]string, wantData []byte) bool {
+	if hash, ok := labels[compose.LabelContentHash]; ok {
+		return hash != wantLabels[compose.LabelContentHash]
+	}
+	return data != nil && !bytes.Equal(data, wantData)
+}
+
+func immutableError(kind, name string) error {
+	return stackConflictError{fmt.Sprintf("%s %s already exists with a different content: %ss are immutable, give it a new name (for example name: %s_v2) or remove the stack first", kind, name, kind, name)}
+}
+
+// stackServices renvoie les services portant le label de la stack
+func (h *Handler) stackServices(ctx context.Context, name string) ([]swarm.Service, error) {
+	return h.dockerClient.ServiceList(ctx, dockerTypes.ServiceListOptions{Filters: stackFilter(name)})
+}
+
+func stackFilter(name string) filters.Args {
+	f := filters.NewArgs()
+	f.Add("label", compose.LabelNamespace+"="+name)
+	return f
+}
+
+func containsNetwork(networks []network.Summary, name string) bool {
+	for _, n := range networks {
+		if n.Name == name || n.ID == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readStackUpload lit le fichier compose et ses fichiers annexes depuis la requête.
+// name est imposé par la route pour une mise à jour, sinon il vient du formulaire ou de ?name=.
+func readStackUpload(c echo.Context, name string) (*stackUpload, error) {
+	upload := &stackUpload{name: name, files: make(map[string][]byte)}
+
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, fmt.Errorf("invalid multipart form: %w", err)
+		}
+		if upload.name == "" {
+			upload.name = firstFormValue(form, "name")
+		}
+		if upload.compose, err = formFileOrValue(form, "compose"); err != nil {
+			return nil, err
+		}
+		if upload.env, err = formFileOrValue(form, "env"); err != nil {
+			return nil, err
+		}
+		for _, fh := range form.File["files"] {
+			data, err := readFormFile(fh)
+			if err != nil {
+				return nil, err
+			}
+			upload.files[fh.Filename] = data
+		}
+	} else {
+		if upload.name == "" {
+			upload.name = c.QueryParam("name")
+		}
+		data, err := io.ReadAll(io.LimitReader(c.Request().Body, maxStackFileSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxStackFileSize {
+			return nil, fmt.Errorf("compose file is too large")
+		}
+		upload.compose = data
+	}
+
+	if !stackNamePattern.MatchString(upload.name) {
+		return nil, fmt.Errorf("invalid stack name %q", upload.name)
+	}
+	if len(upload.compose) == 0 {
+		return nil, fmt.Errorf("compose file is required")
+	}
+	return upload, nil
+}
+
+func firstFormValue(form *multipart.Form, key string) string {
+	if values := form.Value[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// formFileOrValue accepte un champ sous forme de fichier joint ou de texte
+func formFileOrValue(form *multipart.Form, key string) ([]byte, error) {
+	if files := form.File[key]; len(files) > 0 {
+		return readFormFile(files[0])
+	}
+	return []byte(firstFormValue(form, key)), nil
+}
+
+func readFormFile(fh *multipart.FileHeader) ([]byte, error) {
+	if fh.Size > maxStackFileSize {
+		return nil, fmt.Errorf("file %s is too large", fh.Filename)
+	}
+	file, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
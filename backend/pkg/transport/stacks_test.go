@@ -0,0 +1,261 @@
+package transport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/auth"
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+const secretStack = `
+services:
+  web:
+    image: nginx:1.27
+    secrets: [db_password]
+    configs: [site]
+secrets:
+  db_password:
+    content: "%SECRET%"
+configs:
+  site:
+    content: "%CONFIG%"
+`
+
+func stackFile(secret, config string) string {
+	return strings.NewReplacer("%SECRET%", secret, "%CONFIG%", config).Replace(secretStack)
+}
+
+func TestDeployStackSecretsAreImmutable(t *testing.T) {
+	f, e := newTestServer(t)
+	h := NewHandler(f)
+	e.POST("/stacks", h.DeployStack)
+	e.PUT("/stacks/:name", h.UpdateStack)
+	f.AddNode("m1", swarm.NodeRoleManager)
+
+	var result domain.StackDeployResult
+	if code := do(t, e, http.MethodPost, "/stacks?name=app", stackFile("s3cret", "v1"), &result); code != http.StatusOK {
+		t.Fatalf("deploy: status = %d", code)
+	}
+	if len(result.SecretsCreated) != 1 || len(result.ConfigsCreated) != 1 {
+		t.Fatalf("deploy = %+v, want a secret and a config created", result)
+	}
+
+	// Même contenu : les objets existants sont réutilisés
+	if code := do(t, e, http.MethodPut, "/stacks/app", stackFile("s3cret", "v1"), &result); code != http.StatusOK {
+		t.Fatalf("redeploy: status = %d", code)
+	}
+	if len(result.SecretsCreated)+len(result.ConfigsCreated) != 0 {
+		t.Errorf("redeploy = %+v, want nothing created", result)
+	}
+
+	for _, tc := range []struct{ name, secret, config, want string }{
+		{"secret changed", "other", "v1", "secret app_db_password"},
+		{"config changed", "s3cret", "v2", "config app_site"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f.ResetCalls()
+			var resp struct {
+				Error string `json:"error"`
+			}
+			if code := do(t, e, http.MethodPut, "/stacks/app", stackFile(tc.secret, tc.config), &resp); code != http.StatusConflict {
+				t.Fatalf("status = %d, want 409", code)
+			}
+			if !strings.Contains(resp.Error, tc.want) || !strings.Contains(resp.Error, "immutable") {
+				t.Errorf("error = %q", resp.Error)
+			}
+			if calls := f.Calls("ServiceUpdate") + f.Calls("NetworkCreate") + f.Calls("SecretCreate") + f.Calls("ConfigCreate"); calls != 0 {
+				t.Errorf("%d objects changed before the conflict was detected", calls)
+			}
+		})
+	}
+
+	secrets, _ := f.SecretList(context.Background(), dockerTypes.SecretListOptions{})
+	if len(secrets) != 1 {
+		t.Errorf("got %d secrets, want 1", len(secrets))
+	}
+}
+
+func TestDeployStackHostAccessRequiresAdmin(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	h := NewHandler(f)
+	h.SetAllowedBindSources([]string{"/srv/data"})
+	var tokens []auth.TokenConfig
+	for _, role := range []auth.Role{auth.RoleOperator, auth.RoleAdmin} {
+		digest := sha256.Sum256([]byte(string(role) + "-token"))
+		tokens = append(tokens, auth.TokenConfig{Name: string(role), TokenSHA256: hex.EncodeToString(digest[:]), Role: role})
+	}
+	a, err := auth.New(&auth.Config{Tokens: tokens})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.POST("/stacks", h.DeployStack, a.Middleware())
+	e.PUT("/stacks/:name", h.UpdateStack, a.Middleware())
+
+	for i, tc := range []struct {
+		name, role, service, want string
+		code                      int
+	}{
+		{"allowed bind", "operator", "volumes: [/srv/data/app:/data]", "", http.StatusOK},
+		{"root bind", "operator", "volumes: [/:/host]", "bind mount of /", http.StatusForbidden},
+		{"docker socket", "operator", "volumes: [/var/run/docker.sock:/var/run/docker.sock]", "bind mount of /var/run/docker.sock", http.StatusForbidden},
+		{"allowed prefix only", "operator", "volumes: [/srv/database:/data]", "bind mount of /srv/database", http.StatusForbidden},
+		{"escaping the allowlist", "operator", "volumes: [/srv/data/../../etc:/etc]", "bind mount of /srv/data/../../etc", http.StatusForbidden},
+		{"cap_add", "operator", "cap_add: [SYS_ADMIN]", "cap_add SYS_ADMIN", http.StatusForbidden},
+		{"admin", "admin", "volumes: [/:/host]", "", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body := "services:\n  web:\n    image: nginx:1.27\n    " + tc.service + "\n"
+			var resp struct {
+				Error string `json:"error"`
+			}
+			code := do(t, e, http.MethodPost, fmt.Sprintf("/stacks?name=app%d&access_token=%s-token", i, tc.role), body, &resp)
+			if code != tc.code || !strings.Contains(resp.Error, tc.want) {
+				t.Errorf("status = %d, error = %q, want %d %q", code, resp.Error, tc.code, tc.want)
+			}
+		})
+	}
+
+	// Secrets, configs et volumes d'autres stacks ne sont lisibles que par un admin
+	for _, name := range []string{"prod_db_password", "own_password"} {
+		if _, err := f.SecretCreate(context.Background(), swarm.SecretSpec{Annotations: swarm.Annotations{Name: name}, Data: []byte("x")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.ConfigCreate(context.Background(), swarm.ConfigSpec{Annotations: swarm.Annotations{Name: "prod_site"}, Data: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, stack, role, service, objects, want string
+		code                                      int
+	}{
+		{"external secret", "ext1", "operator", "secrets: [pw]", "secrets:\n  pw:\n    external: true\n    name: prod_db_password",
+			"service ext1_web: secret prod_db_password outside the stack", http.StatusForbidden},
+		{"secret named after another stack", "ext2", "operator", "secrets: [pw]", "secrets:\n  pw:\n    name: prod_db_password\n    content: guess",
+			"secret prod_db_password outside the stack", http.StatusForbidden},
+		{"external config", "ext3", "operator", "configs: [site]", "configs:\n  site:\n    external: true\n    name: prod_site",
+			"config prod_site outside the stack", http.StatusForbidden},
+		{"external volume", "ext4", "operator", "volumes: [data:/data]", "volumes:\n  data:\n    external: true\n    name: prod_data",
+			"volume prod_data outside the stack", http.StatusForbidden},
+		{"volume named after another stack", "ext5", "operator", "volumes: [data:/data]", "volumes:\n  data:\n    name: prod_data",
+			"volume prod_data outside the stack", http.StatusForbidden},
+		{"external objects of the stack", "own", "operator", "secrets: [pw]\n    volumes: [data:/data]",
+			"secrets:\n  pw:\n    external: true\n    name: own_password\nvolumes:\n  data:\n    external: true\n    name: own_data", "", http.StatusOK},
+		{"stack volume", "ext6", "operator", "volumes: [data:/data]", "volumes:\n  data: {}", "", http.StatusOK},
+		{"admin external secret", "ext7", "admin", "secrets: [pw]", "secrets:\n  pw:\n    external: true\n    name: prod_db_password", "", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body := "services:\n  web:\n    image: nginx:1.27\n    " + tc.service + "\n" + tc.objects + "\n"
+			var resp struct {
+				Error string `json:"error"`
+			}
+			code := do(t, e, http.MethodPost, fmt.Sprintf("/stacks?name=%s&access_token=%s-token", tc.stack, tc.role), body, &resp)
+			if code != tc.code || !strings.Contains(resp.Error, tc.want) {
+				t.Errorf("status = %d, error = %q, want %d %q", code, resp.Error, tc.code, tc.want)
+			}
+		})
+	}
+
+	// Un volume local monté avec o=bind est un bind mount déguisé
+	body := `
+services:
+  web:
+    image: nginx:1.27
+    volumes: [root:/host]
+volumes:
+  root:
+    driver_opts: {type: none, o: bind, device: /}
+`
+	if code := do(t, e, http.MethodPost, "/stacks?name=volume&access_token=operator-token", body, nil); code != http.StatusForbidden {
+		t.Errorf("bind volume: status = %d, want 403", code)
+	}
+
+	// Supprimer les services absents du fichier revient à supprimer la stack
+	body = "services:\n  web:\n    image: nginx:1.27\n"
+	if code := do(t, e, http.MethodPut, "/stacks/app0?prune=true&access_token=operator-token", body, nil); code != http.StatusForbidden {
+		t.Errorf("operator prune: status = %d, want 403", code)
+	}
+	if code := do(t, e, http.MethodPut, "/stacks/app0?access_token=operator-token", body, nil); code != http.StatusOK {
+		t.Errorf("operator update: status = %d, want 200", code)
+	}
+	if code := do(t, e, http.MethodPut, "/stacks/app0?prune=true&access_token=admin-token", body, nil); code != http.StatusOK {
+		t.Errorf("admin prune: status = %d, want 200", code)
+	}
+}
+
+const replicasStack = `
+services:
+  web:
+    image: nginx:1.27
+  api:
+    image: nginx:1.27
+    deploy:
+      replicas: %API%
+`
+
+// stackReplicas renvoie le nombre de réplicas et le label de chaque service de la stack
+func stackReplicas(t *testing.T, f *infratest.FakeSwarm, stack string) map[string]string {
+	t.Helper()
+	services, err := f.ServiceList(context.Background(), dockerTypes.ServiceListOptions{Filters: stackFilter(stack)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]string)
+	for _, s := range services {
+		result[s.Spec.Name] = fmt.Sprintf("%d/%s", *s.Spec.Mode.Replicated.Replicas, s.Spec.Labels[previousReplicasLabel])
+	}
+	return result
+}
+
+func TestUpdateStackKeepsReplicas(t *testing.T) {
+	f, e := newTestServer(t)
+	f.AddNode("m1", swarm.NodeRoleManager)
+	h := NewHandler(f)
+	e.POST("/stacks", h.DeployStack)
+	e.PUT("/stacks/:name", h.UpdateStack)
+	e.POST("/stacks/:name/stop", h.StopStack)
+	e.POST("/stacks/:name/start", h.StartStack)
+	e.POST("/stacks/:name/scale", h.ScaleStack)
+	file := func(api string) string { return strings.Replace(replicasStack, "%API%", api, 1) }
+
+	if code := do(t, e, http.MethodPost, "/stacks?name=app", file("2"), nil); code != http.StatusOK {
+		t.Fatalf("deploy: status = %d", code)
+	}
+	if code := do(t, e, http.MethodPost, "/stacks/app/scale", `{"services": {"web": 3}}`, nil); code != http.StatusOK {
+		t.Fatalf("scale: status = %d", code)
+	}
+	// Le scale est conservé quand le fichier ne fixe pas replicas
+	if code := do(t, e, http.MethodPut, "/stacks/app", file("2"), nil); code != http.StatusOK {
+		t.Fatalf("update: status = %d", code)
+	}
+	if got := stackReplicas(t, f, "app"); got["app_web"] != "3/" || got["app_api"] != "2/" {
+		t.Errorf("after update = %v, want web 3 and api 2", got)
+	}
+
+	// Une stack arrêtée reste arrêtée, et le nombre du fichier est repris au démarrage
+	if code := do(t, e, http.MethodPost, "/stacks/app/stop", "", nil); code != http.StatusOK {
+		t.Fatalf("stop: status = %d", code)
+	}
+	if code := do(t, e, http.MethodPut, "/stacks/app", file("4"), nil); code != http.StatusOK {
+		t.Fatalf("update stopped stack: status = %d", code)
+	}
+	if got := stackReplicas(t, f, "app"); got["app_web"] != "0/3" || got["app_api"] != "0/4" {
+		t.Errorf("after update of the stopped stack = %v, want web 0/3 and api 0/4", got)
+	}
+	if code := do(t, e, http.MethodPost, "/stacks/app/start", "", nil); code != http.StatusOK {
+		t.Fatalf("start: status = %d", code)
+	}
+	if got := stackReplicas(t, f, "app"); got["app_web"] != "3/" || got["app_api"] != "4/" {
+		t.Errorf("after start = %v, want web 3 and api 4", got)
+	}
+}
@@ -0,0 +1,294 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/stats"
+)
+
+const (
+	defaultStatsInterval = 2 * time.Second
+	minStatsInterval     = time.Second
+	// Fréquence de détection des tâches démarrées ou arrêtées
+	statsRefreshInterval = 10 * time.Second
+)
+
+// StatsMessage est envoyé à chaque intervalle sur la WebSocket des stats
+type StatsMessage struct {
+	Type      string            `json:"type"`
+	Time      time.Time         `json:"time"`
+	ServiceID string            `json:"service_id"`
+	Service   string            `json:"service"`
+	Total     stats.Usage       `json:"total"`
+	Nodes     []stats.NodeUsage `json:"nodes"`
+	Tasks     []stats.Sample    `json:"tasks"`
+	// Tâches dont les mesures sont indisponibles (node sans agent, etc.)
+	Errors []TaskStatsError `json:"errors,omitempty"`
+}
+
+// TaskStatsError explique l'absence de mesures pour une tâche
+type TaskStatsError struct {
+	TaskID string `json:"task_id"`
+	NodeID string `json:"node_id"`
+	Error  string `json:"error"`
+}
+
+// SetStatsSource remplace la source des stats, par exemple pour passer par les
+// agents des autres nodes
+func (h *Handler) SetStatsSource(source *stats.Source) {
+	h.stats = source
+}
+
+// ServiceStats diffuse sur une WebSocket la consommation des tâches en cours
+// d'un service : par tâche, par node et au total, toutes les ?interval= (2s
+// par défaut)
+func (h *Handler) ServiceStats(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	interval := defaultStatsInterval
+	if v := c.QueryParam("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < minStatsInterval {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid interval (minimum 1s)"})
+		}
+		interval = d
+	}
+
+	svc, _, err := h.dockerClient.ServiceInspectWithRaw(context.Background(), c.Param("id"), dockerTypes.ServiceInspectOptions{})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	ws, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not upgrade to WebSocket: " + err.Error()})
+	}
+	defer ws.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Canal pour signaler la fermeture de la connexion
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	stream := newStatsStream(h, svc)
+	defer stream.stop()
+	stream.refresh(ctx)
+
+	refresh := time.NewTicker(statsRefreshInterval)
+	defer refresh.Stop()
+	send := time.NewTicker(interval)
+	defer send.Stop()
+	heartbeat := time.NewTicker(logHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-heartbeat.C:
+			if err := ws.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+				return nil
+			}
+		case <-refresh.C:
+			stream.refresh(ctx)
+		case update := <-stream.updates:
+			stream.apply(update)
+		case <-send.C:
+			if err := ws.WriteJSON(stream.message()); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// taskStatsUpdate est une mesure ou la fin du flux d'une tâche
+type taskStatsUpdate struct {
+	task   swarm.Task
+	sample *stats.Sample
+	err    error
+	done   bool
+}
+
+// statsStream suit les flux de mesures des tâches en cours d'un service
+type statsStream struct {
+	h         *Handler
+	svc       swarm.Service
+	updates   chan taskStatsUpdate
+	following map[string]context.CancelFunc
+	latest    map[string]stats.Sample
+	errors    map[string]TaskStatsError
+	hostnames map[string]string
+}
+
+func newStatsStream(h *Handler, svc swarm.Service) *statsStream {
+	return &statsStream{
+		h:         h,
+		svc:       svc,
+		updates:   make(chan taskStatsUpdate, 64),
+		following: make(map[string]context.CancelFunc),
+		latest:    make(map[string]stats.Sample),
+		errors:    make(map[string]TaskStatsError),
+		hostnames: make(map[string]string),
+	}
+}
+
+// refresh démarre le suivi des nouvelles tâches en cours et arrête celui des
+// tâches terminées
+func (s *statsStream) refresh(ctx context.Context) {
+	f := filters.NewArgs(
+		filters.Arg("service", s.svc.ID),
+		filters.Arg("desired-state", string(swarm.TaskStateRunning)),
+	)
+	tasks, err := s.h.dockerClient.TaskList(ctx, dockerTypes.TaskListOptions{Filters: f})
+	if err != nil {
+		// Les tâches connues restent suivies jusqu'au prochain essai
+		return
+	}
+	if nodes, err := s.h.dockerClient.NodeList(ctx, dockerTypes.NodeListOptions{}); err == nil {
+		for _, n := range nodes {
+			s.hostnames[n.ID] = n.Description.Hostname
+		}
+	}
+
+	running := make(map[string]bool)
+	for _, t := range tasks {
+		if t.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+		running[t.ID] = true
+		if _, ok := s.following[t.ID]; ok {
+			continue
+		}
+		taskCtx, cancel := context.WithCancel(ctx)
+		s.following[t.ID] = cancel
+		delete(s.errors, t.ID)
+		go s.follow(taskCtx, t)
+	}
+	for id, cancel := range s.following {
+		if !running[id] {
+			cancel()
+			delete(s.following, id)
+		}
+	}
+	for id := range s.latest {
+		if !running[id] {
+			delete(s.latest, id)
+		}
+	}
+	for id := range s.errors {
+		if !running[id] {
+			delete(s.errors, id)
+		}
+	}
+}
+
+// follow lit les mesures d'une tâche jusqu'à la fin de son flux
+func (s *statsStream) follow(ctx context.Context, task swarm.Task) {
+	emit := func(u taskStatsUpdate) {
+		select {
+		case s.updates <- u:
+		case <-ctx.Done():
+		}
+	}
+
+	body, err := s.h.stats.Open(ctx, task)
+	if err != nil {
+		emit(taskStatsUpdate{task: task, err: err, done: true})
+		return
+	}
+	defer body.Close()
+	stop := context.AfterFunc(ctx, func() { body.Close() })
+	defer stop()
+
+	err = stats.Decode(body, func(sample stats.Sample) bool {
+		emit(taskStatsUpdate{task: task, sample: &sample})
+		return true
+	})
+	if ctx.Err() == nil {
+		emit(taskStatsUpdate{task: task, err: err, done: true})
+	}
+}
+
+func (s *statsStream) apply(u taskStatsUpdate) {
+	if _, ok := s.following[u.task.ID]; !ok {
+		// Tâche arrêtée entre-temps
+		return
+	}
+	if u.sample != nil {
+		sample := *u.sample
+		sample.TaskID = u.task.ID
+		sample.NodeID = u.task.NodeID
+		sample.Slot = u.task.Slot
+		s.latest[u.task.ID] = sample
+	}
+	if u.done {
+		// Le prochain refresh relance le suivi si la tâche tourne toujours ;
+		// d'ici là, la dernière mesure reste affichée
+		s.following[u.task.ID]()
+		delete(s.following, u.task.ID)
+		if u.err != nil {
+			delete(s.latest, u.task.ID)
+			s.errors[u.task.ID] = TaskStatsError{TaskID: u.task.ID, NodeID: u.task.NodeID, Error: u.err.Error()}
+		}
+	}
+}
+
+func (s *statsStream) message() StatsMessage {
+	samples := make([]stats.Sample, 0, len(s.latest))
+	for _, sample := range s.latest {
+		samples = append(samples, sample)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].Slot != samples[j].Slot {
+			return samples[i].Slot < samples[j].Slot
+		}
+		return samples[i].TaskID < samples[j].TaskID
+	})
+	total, nodes := stats.Aggregate(samples, s.hostnames)
+
+	msg := StatsMessage{
+		Type:      "stats",
+		Time:      time.Now().UTC(),
+		ServiceID: s.svc.ID,
+		Service:   s.svc.Spec.Name,
+		Total:     total,
+		Nodes:     nodes,
+		Tasks:     samples,
+	}
+	for _, e := range s.errors {
+		msg.Errors = append(msg.Errors, e)
+	}
+	sort.Slice(msg.Errors, func(i, j int) bool { return msg.Errors[i].TaskID < msg.Errors[j].TaskID })
+	return msg
+}
+
+func (s *statsStream) stop() {
+	for _, cancel := range s.following {
+		cancel()
+	}
+}
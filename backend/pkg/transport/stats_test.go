@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/api/types/system"
+	"github.com/gorilla/websocket"
+
+	"github.com/Affell/swarm-manager/backend/pkg/stats"
+)
+
+func TestServiceStats(t *testing.T) {
+	f, e := newTestServer(t)
+	local := f.AddNode("manager", swarm.NodeRoleManager)
+	remote := f.AddNode("worker-1", swarm.NodeRoleWorker)
+	bare := f.AddNode("worker-2", swarm.NodeRoleWorker)
+	f.SetInfo(system.Info{Swarm: swarm.Info{NodeID: local.ID}})
+
+	// L'agent de worker-1 répond sur 127.0.0.1, l'adresse de sa tâche
+	agent := httptest.NewServer(stats.NewAgent(f, "secret"))
+	defer agent.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(agent.URL, "http://"))
+	agentPort, _ := strconv.Atoi(port)
+	agentService := f.AddService(swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "stats-agent"}, Mode: swarm.ServiceMode{Global: &swarm.GlobalService{}}})
+	f.AddTask(swarm.Task{
+		ServiceID: agentService.ID, NodeID: remote.ID, DesiredState: swarm.TaskStateRunning,
+		Status: swarm.TaskStatus{State: swarm.TaskStateRunning},
+		NetworksAttachments: []swarm.NetworkAttachment{
+			{Network: swarm.Network{Spec: swarm.NetworkSpec{Ingress: true}}, Addresses: []string{"10.0.0.5/24"}},
+			{Addresses: []string{"127.0.0.1/24"}},
+		},
+	})
+
+	svc := f.AddService(swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "web"}})
+	task := func(slot int, node, containerID string, memory uint64) {
+		f.AddTask(swarm.Task{
+			ServiceID: svc.ID, Slot: slot, NodeID: node, DesiredState: swarm.TaskStateRunning,
+			Status: swarm.TaskStatus{State: swarm.TaskStateRunning, ContainerStatus: &swarm.ContainerStatus{ContainerID: containerID}},
+		})
+		f.SetContainerStats(containerID, []container.StatsResponse{{ID: containerID, MemoryStats: container.MemoryStats{Usage: memory, Limit: 1000}}})
+	}
+	task(1, local.ID, "c1", 100)
+	task(2, local.ID, "c2", 200)
+	task(3, remote.ID, "c3", 400)
+	task(4, bare.ID, "c4", 800)
+	// Tâche arrêtée : ignorée
+	f.AddTask(swarm.Task{ServiceID: svc.ID, Slot: 5, NodeID: local.ID, DesiredState: swarm.TaskStateShutdown, Status: swarm.TaskStatus{State: swarm.TaskStateShutdown}})
+
+	h := NewHandler(f)
+	h.SetStatsSource(stats.NewSource(f, stats.AgentOptions{Service: "stats-agent", Port: agentPort, Token: "secret"}))
+	e.GET("/services/:id/stats", h.ServiceStats)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	if code := do(t, e, http.MethodGet, "/services/missing/stats", "", nil); code != http.StatusNotFound {
+		t.Errorf("missing service: status = %d, want 404", code)
+	}
+	if code := do(t, e, http.MethodGet, "/services/"+svc.ID+"/stats?interval=10ms", "", nil); code != http.StatusBadRequest {
+		t.Errorf("short interval: status = %d, want 400", code)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/services/"+svc.ID+"/stats?interval=1s", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg StatsMessage
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Type != "stats" || msg.Service != "web" || len(msg.Tasks) != 3 {
+		t.Fatalf("message = %+v, want the three measured tasks", msg)
+	}
+	for i, want := range []string{"c1", "c2", "c3"} {
+		if msg.Tasks[i].ContainerID != want || msg.Tasks[i].Slot != i+1 {
+			t.Errorf("task %d = %+v, want %s", i, msg.Tasks[i], want)
+		}
+	}
+	if msg.Total.Tasks != 3 || msg.Total.MemoryUsage != 700 {
+		t.Errorf("total = %+v, want 3 tasks and 700 bytes", msg.Total)
+	}
+	nodes := make(map[string]stats.NodeUsage)
+	for _, n := range msg.Nodes {
+		nodes[n.NodeID] = n
+	}
+	if n := nodes[local.ID]; len(nodes) != 2 || n.Tasks != 2 || n.MemoryUsage != 300 || n.Hostname != "manager" {
+		t.Errorf("nodes = %+v, want manager with 2 tasks and 300 bytes", msg.Nodes)
+	}
+	if n := nodes[remote.ID]; n.Tasks != 1 || n.MemoryUsage != 400 || n.Hostname != "worker-1" {
+		t.Errorf("worker-1 = %+v, want the task measured by its agent", n)
+	}
+	if len(msg.Errors) != 1 || msg.Errors[0].NodeID != bare.ID || msg.Errors[0].Error != stats.ErrNoAgent.Error() {
+		t.Errorf("errors = %+v, want the task on worker-2 without an agent", msg.Errors)
+	}
+}
@@ -0,0 +1,228 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+// listTasks renvoie les tâches des services, historique compris, avec un seul
+// appel à TaskList quel que soit le nombre de services. Sans serviceIDs,
+// toutes les tâches du swarm sont renvoyées.
+func (h *Handler) listTasks(ctx context.Context, serviceIDs []string) ([]swarm.Task, error) {
+	f := filters.NewArgs()
+	for _, id := range serviceIDs {
+		f.Add("service", id)
+	}
+	return h.dockerClient.TaskList(ctx, dockerTypes.TaskListOptions{Filters: f})
+}
+
+// runningTasksByService compte les tâches en cours d'exécution de chaque service
+func runningTasksByService(tasks []swarm.Task) map[string]uint64 {
+	counts := make(map[string]uint64)
+	for _, t := range tasks {
+		if t.DesiredState == swarm.TaskStateRunning && t.Status.State == swarm.TaskStateRunning {
+			counts[t.ServiceID]++
+		}
+	}
+	return counts
+}
+
+// serviceIDs renvoie les IDs des services, pour filtrer TaskList
+func serviceIDs(services []swarm.Service) []string {
+	ids := make([]string, len(services))
+	for i, s := range services {
+		ids[i] = s.ID
+	}
+	return ids
+}
+
+// toDomainService construit la vue d'un service à partir de son nombre de
+// tâches en cours. Pour un service global, le nombre désiré est le nombre actuel.
+func toDomainService(s swarm.Service, running uint64) domain.Service {
+	svc := domain.Service{
+		ID:           s.ID,
+		Name:         s.Spec.Name,
+		Image:        containerSpecImage(s.Spec),
+		CurrentCount: running,
+	}
+	if s.Spec.Mode.Replicated != nil && s.Spec.Mode.Replicated.Replicas != nil {
+		svc.DesiredCount = *s.Spec.Mode.Replicated.Replicas
+	} else if s.Spec.Mode.Global != nil {
+		svc.DesiredCount = running
+	}
+	return svc
+}
+
+// ListServiceTasks renvoie toutes les tâches d'un service, y compris celles
+// arrêtées que le swarm garde en historique, regroupées par slot
+func (h *Handler) ListServiceTasks(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+	ctx := c.Request().Context()
+
+	svc, _, err := h.dockerClient.ServiceInspectWithRaw(ctx, c.Param("id"), dockerTypes.ServiceInspectOptions{})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	tasks, err := h.dockerClient.TaskList(ctx, dockerTypes.TaskListOptions{Filters: filters.NewArgs(filters.Arg("service", svc.ID))})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	hostnames, err := h.nodeHostnames(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	result := domain.ServiceTasks{ServiceID: svc.ID, ServiceName: svc.Spec.Name, Slots: []domain.TaskSlot{}}
+	for _, slot := range groupTaskSlots(tasks) {
+		ts := domain.TaskSlot{Slot: slot[0].Slot, Tasks: make([]domain.Task, len(slot))}
+		if slot[0].Slot == 0 {
+			ts.NodeID = slot[0].NodeID
+		}
+		for i, t := range slot {
+			ts.Tasks[i] = toDomainTask(t, svc.Spec.Name, hostnames)
+		}
+		result.Slots = append(result.Slots, ts)
+	}
+	sort.SliceStable(result.Slots, func(i, j int) bool {
+		a, b := result.Slots[i], result.Slots[j]
+		if a.Slot != b.Slot {
+			return a.Slot < b.Slot
+		}
+		return hostnames[a.NodeID] < hostnames[b.NodeID]
+	})
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetTask renvoie une tâche et l'historique des autres tâches de son slot
+func (h *Handler) GetTask(c echo.Context) error {
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+	ctx := c.Request().Context()
+
+	task, _, err := h.dockerClient.TaskInspectWithRaw(ctx, c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+	// Le service a pu être supprimé entre-temps : la tâche reste lisible
+	var serviceName string
+	if svc, _, err := h.dockerClient.ServiceInspectWithRaw(ctx, task.ServiceID, dockerTypes.ServiceInspectOptions{}); err == nil {
+		serviceName = svc.Spec.Name
+	}
+	tasks, err := h.dockerClient.TaskList(ctx, dockerTypes.TaskListOptions{Filters: filters.NewArgs(filters.Arg("service", task.ServiceID))})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	hostnames, err := h.nodeHostnames(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	result := domain.TaskDetails{Task: toDomainTask(task, serviceName, hostnames), History: []domain.Task{}}
+	for _, slot := range groupTaskSlots(tasks) {
+		if taskSlotKey(slot[0]) != taskSlotKey(task) {
+			continue
+		}
+		for _, t := range slot {
+			if t.ID != task.ID {
+				result.History = append(result.History, toDomainTask(t, serviceName, hostnames))
+			}
+		}
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// nodeHostnames associe l'ID de chaque node à son hostname
+func (h *Handler) nodeHostnames(ctx context.Context) (map[string]string, error) {
+	nodes, err := h.dockerClient.NodeList(ctx, dockerTypes.NodeListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	hostnames := make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		hostnames[n.ID] = n.Description.Hostname
+	}
+	return hostnames, nil
+}
+
+// taskSlotKey identifie le réplica d'une tâche : son slot pour un service
+// répliqué, sa node pour un service global
+func taskSlotKey(t swarm.Task) string {
+	if t.Slot > 0 {
+		return "slot/" + strconv.Itoa(t.Slot)
+	}
+	return "node/" + t.NodeID
+}
+
+// groupTaskSlots regroupe les tâches par réplica, des plus récentes aux plus
+// anciennes dans chaque groupe
+func groupTaskSlots(tasks []swarm.Task) [][]swarm.Task {
+	var keys []string
+	bySlot := make(map[string][]swarm.Task)
+	for _, t := range tasks {
+		key := taskSlotKey(t)
+		if _, ok := bySlot[key]; !ok {
+			keys = append(keys, key)
+		}
+		bySlot[key] = append(bySlot[key], t)
+	}
+	slots := make([][]swarm.Task, 0, len(keys))
+	for _, key := range keys {
+		slot := bySlot[key]
+		sort.SliceStable(slot, func(i, j int) bool { return slot[i].CreatedAt.After(slot[j].CreatedAt) })
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// toDomainTask construit la vue d'une tâche ; le code de sortie n'est donné
+// qu'une fois le conteneur arrêté
+func toDomainTask(t swarm.Task, serviceName string, hostnames map[string]string) domain.Task {
+	task := domain.Task{
+		ID:           t.ID,
+		ServiceID:    t.ServiceID,
+		ServiceName:  serviceName,
+		Slot:         t.Slot,
+		NodeID:       t.NodeID,
+		NodeHostname: hostnames[t.NodeID],
+		DesiredState: string(t.DesiredState),
+		CurrentState: string(t.Status.State),
+		Message:      t.Status.Message,
+		Error:        t.Status.Err,
+		CreatedAt:    t.CreatedAt,
+		UpdatedAt:    t.UpdatedAt,
+		StateSince:   t.Status.Timestamp,
+	}
+	if t.Spec.ContainerSpec != nil {
+		task.Image = t.Spec.ContainerSpec.Image
+	}
+	if cs := t.Status.ContainerStatus; cs != nil {
+		task.ContainerID = cs.ContainerID
+		switch t.Status.State {
+		case swarm.TaskStateComplete, swarm.TaskStateFailed, swarm.TaskStateShutdown:
+			exitCode := cs.ExitCode
+			task.ExitCode = &exitCode
+		}
+	}
+	return task
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+	"github.com/Affell/swarm-manager/backend/pkg/infra/infratest"
+)
+
+// seedTaskHistory crée un service de deux réplicas dont le slot 1 a échoué puis
+// été arrêté avant la tâche courante. Renvoie le service et la tâche en échec.
+func seedTaskHistory(f *infratest.FakeSwarm) (swarm.Service, swarm.Task) {
+	node := f.AddNode("m1", swarm.NodeRoleManager)
+	svc := f.AddService(replicated("web", 2, nil))
+	past := func(ago time.Duration, state swarm.TaskState, errMsg string, exitCode int) swarm.Task {
+		created := time.Now().Add(-ago)
+		return f.AddTask(swarm.Task{
+			Meta:         swarm.Meta{CreatedAt: created, UpdatedAt: created},
+			ServiceID:    svc.ID,
+			Slot:         1,
+			NodeID:       node.ID,
+			DesiredState: swarm.TaskStateShutdown,
+			Status: swarm.TaskStatus{
+				Timestamp:       created,
+				State:           state,
+				Err:             errMsg,
+				ContainerStatus: &swarm.ContainerStatus{ContainerID: "c" + string(state), ExitCode: exitCode},
+			},
+		})
+	}
+	// Ajoutées dans le désordre : l'ordre vient des dates de création
+	past(10*time.Minute, swarm.TaskStateShutdown, "", 0)
+	failed := past(5*time.Minute, swarm.TaskStateFailed, "task: non-zero exit (137)", 137)
+	past(20*time.Minute, swarm.TaskStateRejected, "no such image", 0)
+	return svc, failed
+}
+
+func TestListServiceTasks(t *testing.T) {
+	f, e := newTestServer(t)
+	svc, failed := seedTaskHistory(f)
+
+	var tasks domain.ServiceTasks
+	if code := do(t, e, http.MethodGet, "/services/"+svc.ID+"/tasks", "", &tasks); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if len(tasks.Slots) != 2 || tasks.Slots[0].Slot != 1 || tasks.Slots[1].Slot != 2 {
+		t.Fatalf("slots = %+v, want slots 1 and 2", tasks.Slots)
+	}
+	if n := len(tasks.Slots[1].Tasks); n != 1 {
+		t.Errorf("slot 2 has %d tasks, want 1", n)
+	}
+
+	history := tasks.Slots[0].Tasks
+	for i, tc := range []struct {
+		state, err, exitCode string
+	}{
+		{"running", "", ""},
+		{"failed", "task: non-zero exit (137)", "137"},
+		{"shutdown", "", "0"},
+		// Le conteneur d'une tâche rejetée n'a jamais tourné
+		{"rejected", "no such image", ""},
+	} {
+		if i >= len(history) {
+			t.Fatalf("slot 1 has %d tasks, want 4", len(history))
+		}
+		task := history[i]
+		if task.CurrentState != tc.state || task.Error != tc.err || exitCode(task) != tc.exitCode {
+			t.Errorf("task %d = %s %q exit %q, want %s %q exit %q", i, task.CurrentState, task.Error, exitCode(task), tc.state, tc.err, tc.exitCode)
+		}
+		if task.ServiceName != "web" || task.NodeHostname != "m1" {
+			t.Errorf("task %d = %+v", i, task)
+		}
+	}
+	if history[1].ID != failed.ID {
+		t.Errorf("second task = %s, want the failed task %s", history[1].ID, failed.ID)
+	}
+}
+
+func TestGetTask(t *testing.T) {
+	f, e := newTestServer(t)
+	h := NewHandler(f)
+	e.GET("/tasks/:id", h.GetTask)
+	_, failed := seedTaskHistory(f)
+
+	var details domain.TaskDetails
+	if code := do(t, e, http.MethodGet, "/tasks/"+failed.ID, "", &details); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if details.ID != failed.ID || details.ServiceName != "web" || details.Slot != 1 || details.CurrentState != "failed" ||
+		details.Error != "task: non-zero exit (137)" || exitCode(details.Task) != "137" {
+		t.Errorf("task = %+v", details.Task)
+	}
+
+	// Les autres tâches du slot, des plus récentes aux plus anciennes, sans
+	// celles du slot 2
+	var states []string
+	for _, task := range details.History {
+		if task.ID == failed.ID || task.Slot != 1 {
+			t.Errorf("unexpected task in history: %+v", task)
+		}
+		states = append(states, task.CurrentState)
+	}
+	if want := []string{"running", "shutdown", "rejected"}; !slices.Equal(states, want) {
+		t.Errorf("history = %v, want %v", states, want)
+	}
+
+	if code := do(t, e, http.MethodGet, "/tasks/unknown", "", nil); code != http.StatusNotFound {
+		t.Errorf("unknown task: status = %d, want 404", code)
+	}
+}
+
+// exitCode rend le code de sortie d'une tâche, vide s'il n'est pas donné
+func exitCode(task domain.Task) string {
+	if task.ExitCode == nil {
+		return ""
+	}
+	return strconv.Itoa(*task.ExitCode)
+}
@@ -0,0 +1,179 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/distribution/reference"
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+// imageUpdateRequest est le corps de PUT /services/:id/image
+type imageUpdateRequest struct {
+	Image string `json:"image"`
+	// Identifiants du registre ; à défaut, l'en-tête X-Registry-Auth est transmis tel quel
+	RegistryAuth *registry.AuthConfig `json:"registry_auth"`
+	// Épingler l'image sur son digest (true par défaut, comme docker service update)
+	Resolve *bool `json:"resolve"`
+}
+
+// UpdateServiceImage change l'image d'un service et déclenche une mise à jour
+// progressive selon son UpdateConfig. L'image est épinglée sur le digest du
+// registre ; si la résolution échoue, la mise à jour continue avec un avertissement.
+func (h *Handler) UpdateServiceImage(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	var req imageUpdateRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	}
+	named, err := reference.ParseNormalizedNamed(req.Image)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid image reference: " + err.Error()})
+	}
+
+	encodedAuth := c.Request().Header.Get(registry.AuthHeader)
+	if req.RegistryAuth != nil {
+		if encodedAuth, err = registry.EncodeAuthConfig(*req.RegistryAuth); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid registry_auth: " + err.Error()})
+		}
+	}
+
+	ctx := context.Background()
+	svc, _, err := h.dockerClient.ServiceInspectWithRaw(ctx, c.Param("id"), dockerTypes.ServiceInspectOptions{})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if svc.Spec.TaskTemplate.ContainerSpec == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "service " + svc.Spec.Name + " has no container spec"})
+	}
+
+	result := domain.ServiceImageUpdate{
+		ID:            svc.ID,
+		Name:          svc.Spec.Name,
+		PreviousImage: svc.Spec.TaskTemplate.ContainerSpec.Image,
+	}
+
+	// Les références sans tag ni digest visent :latest, comme la CLI Docker
+	named = reference.TagNameOnly(named)
+	image := reference.FamiliarString(named)
+	if canonical, ok := named.(reference.Canonical); ok {
+		result.Digest = canonical.Digest().String()
+	} else if req.Resolve == nil || *req.Resolve {
+		dist, err := h.dockerClient.DistributionInspect(ctx, named.String(), encodedAuth)
+		if err == nil {
+			if pinned, err := reference.WithDigest(named, dist.Descriptor.Digest); err == nil {
+				image = reference.FamiliarString(pinned)
+				result.Digest = dist.Descriptor.Digest.String()
+			}
+		} else {
+			result.Warnings = append(result.Warnings, "image "+image+" could not be accessed on a registry to record its digest: "+err.Error())
+		}
+	}
+	result.Image = image
+
+	spec := svc.Spec
+	spec.TaskTemplate.ContainerSpec.Image = image
+	options := dockerTypes.ServiceUpdateOptions{EncodedRegistryAuth: encodedAuth}
+	if encodedAuth == "" {
+		options.RegistryAuthFrom = dockerTypes.RegistryAuthFromSpec
+	}
+	resp, err := h.dockerClient.ServiceUpdate(ctx, svc.ID, svc.Version, spec, options)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	result.Warnings = append(result.Warnings, resp.Warnings...)
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// RollbackService revient à la spec précédente du service via le rollback
+// côté serveur de Docker (équivalent de docker service rollback)
+func (h *Handler) RollbackService(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	ctx := context.Background()
+	svc, _, err := h.dockerClient.ServiceInspectWithRaw(ctx, c.Param("id"), dockerTypes.ServiceInspectOptions{})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if svc.PreviousSpec == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "service " + svc.Spec.Name + " has no previous spec to roll back to"})
+	}
+
+	resp, err := h.dockerClient.ServiceUpdate(ctx, svc.ID, svc.Version, svc.Spec, dockerTypes.ServiceUpdateOptions{
+		Rollback:         "previous",
+		RegistryAuthFrom: dockerTypes.RegistryAuthFromPreviousSpec,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errdefs.IsInvalidParameter(err) {
+			status = http.StatusConflict
+		}
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"id":       svc.ID,
+		"name":     svc.Spec.Name,
+		"warnings": resp.Warnings,
+	})
+}
+
+// GetServiceUpdateStatus expose l'UpdateStatus du service pour que les
+// pipelines de déploiement puissent suivre une mise à jour ou un rollback
+func (h *Handler) GetServiceUpdateStatus(c echo.Context) error {
+	// Vérifier que le client Docker est initialisé
+	if h == nil || h.dockerClient == nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Docker client not initialized"})
+	}
+
+	svc, _, err := h.dockerClient.ServiceInspectWithRaw(context.Background(), c.Param("id"), dockerTypes.ServiceInspectOptions{})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errdefs.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	result := domain.ServiceUpdateStatus{
+		ID:      svc.ID,
+		Name:    svc.Spec.Name,
+		Version: svc.Version.Index,
+		Image:   containerSpecImage(svc.Spec),
+		State:   "none",
+	}
+	if svc.PreviousSpec != nil {
+		result.PreviousImage = containerSpecImage(*svc.PreviousSpec)
+	}
+	if status := svc.UpdateStatus; status != nil {
+		if status.State != "" {
+			result.State = string(status.State)
+		}
+		result.StartedAt = status.StartedAt
+		result.CompletedAt = status.CompletedAt
+		result.Message = status.Message
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+func containerSpecImage(spec swarm.ServiceSpec) string {
+	if spec.TaskTemplate.ContainerSpec == nil {
+		return ""
+	}
+	return spec.TaskTemplate.ContainerSpec.Image
+}
@@ -0,0 +1,146 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/labstack/echo/v4"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/Affell/swarm-manager/backend/pkg/domain"
+)
+
+func TestUpdateServiceImage(t *testing.T) {
+	pinned := digest.FromString("nginx:1.25")
+	latest := digest.FromString("nginx:latest")
+	given := digest.FromString("given")
+
+	for _, tc := range []struct {
+		name     string
+		body     string
+		header   string
+		status   int
+		image    string
+		digest   string
+		inspects int
+		warning  string
+		authFrom string
+	}{
+		{name: "pinned on the registry digest", body: `{"image": "nginx:1.25"}`, status: http.StatusOK,
+			image: "nginx:1.25@" + pinned.String(), digest: pinned.String(), inspects: 1, authFrom: dockerTypes.RegistryAuthFromSpec},
+		{name: "no tag means latest", body: `{"image": "nginx"}`, status: http.StatusOK,
+			image: "nginx:latest@" + latest.String(), digest: latest.String(), inspects: 1, authFrom: dockerTypes.RegistryAuthFromSpec},
+		{name: "digest already given", body: `{"image": "nginx@` + given.String() + `"}`, status: http.StatusOK,
+			image: "nginx@" + given.String(), digest: given.String(), authFrom: dockerTypes.RegistryAuthFromSpec},
+		{name: "resolve disabled", body: `{"image": "nginx:1.25", "resolve": false}`, status: http.StatusOK,
+			image: "nginx:1.25", authFrom: dockerTypes.RegistryAuthFromSpec},
+		{name: "registry unreachable", body: `{"image": "registry.local/app:2"}`, status: http.StatusOK,
+			image: "registry.local/app:2", inspects: 1, warning: "could not be accessed on a registry", authFrom: dockerTypes.RegistryAuthFromSpec},
+		{name: "registry auth in the body", body: `{"image": "nginx:1.25", "registry_auth": {"username": "u", "password": "p"}}`, status: http.StatusOK,
+			image: "nginx:1.25@" + pinned.String(), digest: pinned.String(), inspects: 1},
+		{name: "registry auth header", body: `{"image": "nginx:1.25"}`, header: "e30=", status: http.StatusOK,
+			image: "nginx:1.25@" + pinned.String(), digest: pinned.String(), inspects: 1},
+		{name: "invalid reference", body: `{"image": "Nginx:1.25"}`, status: http.StatusBadRequest},
+		{name: "invalid body", body: `{"image":`, status: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, e := newTestServer(t)
+			h := NewHandler(f)
+			e.PUT("/services/:id/image", h.UpdateServiceImage)
+			f.SetImageDigest("docker.io/library/nginx:1.25", pinned)
+			f.SetImageDigest("docker.io/library/nginx:latest", latest)
+			spec := replicated("web", 1, nil)
+			spec.TaskTemplate.ContainerSpec.Image = "nginx:1.24"
+			svc := f.AddService(spec)
+
+			req := httptest.NewRequest(http.MethodPut, "/services/"+svc.ID+"/image", strings.NewReader(tc.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tc.header != "" {
+				req.Header.Set(registry.AuthHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			var result domain.ServiceImageUpdate
+			json.Unmarshal(rec.Body.Bytes(), &result)
+			if code := rec.Code; code != tc.status {
+				t.Fatalf("status = %d, want %d", code, tc.status)
+			}
+			if calls := f.Calls("DistributionInspect"); calls != tc.inspects {
+				t.Errorf("DistributionInspect called %d times, want %d", calls, tc.inspects)
+			}
+			if tc.status != http.StatusOK {
+				if calls := f.Calls("ServiceUpdate"); calls != 0 {
+					t.Errorf("ServiceUpdate called %d times", calls)
+				}
+				return
+			}
+
+			if result.Image != tc.image || result.Digest != tc.digest || result.PreviousImage != "nginx:1.24" {
+				t.Errorf("result = %+v, want image %s and digest %q", result, tc.image, tc.digest)
+			}
+			if warnings := strings.Join(result.Warnings, "\n"); !strings.Contains(warnings, tc.warning) || (tc.warning == "" && warnings != "") {
+				t.Errorf("warnings = %q, want %q", warnings, tc.warning)
+			}
+			updated, _, _ := f.ServiceInspectWithRaw(context.Background(), svc.ID, dockerTypes.ServiceInspectOptions{})
+			if image := updated.Spec.TaskTemplate.ContainerSpec.Image; image != tc.image {
+				t.Errorf("service image = %s, want %s", image, tc.image)
+			}
+			options := f.LastServiceUpdateOptions()
+			if options.RegistryAuthFrom != tc.authFrom || (tc.authFrom == "") == (options.EncodedRegistryAuth == "") {
+				t.Errorf("options = %+v, want credentials from %q", options, tc.authFrom)
+			}
+		})
+	}
+}
+
+func TestRollbackService(t *testing.T) {
+	f, e := newTestServer(t)
+	h := NewHandler(f)
+	e.PUT("/services/:id/image", h.UpdateServiceImage)
+	e.POST("/services/:id/rollback", h.RollbackService)
+	e.GET("/services/:id/update", h.GetServiceUpdateStatus)
+	spec := replicated("web", 1, nil)
+	spec.TaskTemplate.ContainerSpec.Image = "nginx:1.24"
+	svc := f.AddService(spec)
+
+	// Sans spec précédente, Docker n'a rien à restaurer
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if code := do(t, e, http.MethodPost, "/services/"+svc.ID+"/rollback", "", &resp); code != http.StatusConflict || !strings.Contains(resp.Error, "no previous spec") {
+		t.Errorf("status = %d, error = %q, want 409", code, resp.Error)
+	}
+	if calls := f.Calls("ServiceUpdate"); calls != 0 {
+		t.Errorf("ServiceUpdate called %d times", calls)
+	}
+	var status domain.ServiceUpdateStatus
+	if code := do(t, e, http.MethodGet, "/services/"+svc.ID+"/update", "", &status); code != http.StatusOK || status.State != "none" || status.PreviousImage != "" {
+		t.Errorf("status = %d, %+v, want no update", code, status)
+	}
+
+	if code := do(t, e, http.MethodPut, "/services/"+svc.ID+"/image", `{"image": "nginx:1.25", "resolve": false}`, nil); code != http.StatusOK {
+		t.Fatalf("update: status = %d", code)
+	}
+	if code := do(t, e, http.MethodPost, "/services/"+svc.ID+"/rollback", "", nil); code != http.StatusAccepted {
+		t.Fatalf("rollback: status = %d", code)
+	}
+	options := f.LastServiceUpdateOptions()
+	if options.Rollback != "previous" || options.RegistryAuthFrom != dockerTypes.RegistryAuthFromPreviousSpec {
+		t.Errorf("options = %+v, want a server-side rollback", options)
+	}
+	if code := do(t, e, http.MethodGet, "/services/"+svc.ID+"/update", "", &status); code != http.StatusOK ||
+		status.Image != "nginx:1.24" || status.PreviousImage != "nginx:1.25" || status.State != string(swarm.UpdateStateRollbackCompleted) {
+		t.Errorf("status = %+v, want the rolled back image", status)
+	}
+
+	if code := do(t, e, http.MethodGet, "/services/missing/update", "", nil); code != http.StatusNotFound {
+		t.Errorf("missing service: status = %d, want 404", code)
+	}
+}
@@ -10,6 +10,8 @@ import SwarmCleanup from "./pages/SwarmCleanup";
 import SwarmLogs from "./pages/SwarmLogs";
 import ServiceDetail from "./pages/ServiceDetail";
 import NotFound from "./pages/NotFound";
+import Login from "./pages/Login";
+import { RequireAuth } from "./components/RequireAuth";
 
 const queryClient = new QueryClient();
 
@@ -20,12 +22,13 @@ const App = () => (
       <Sonner />
       <BrowserRouter>
         <Routes>
-          <Route path="/" element={<Index />} />
-          <Route path="/swarm/nodes" element={<SwarmNodes />} />
-          <Route path="/swarm/stack" element={<SwarmStack />} />
-          <Route path="/swarm/cleanup" element={<SwarmCleanup />} />
-          <Route path="/swarm/logs" element={<SwarmLogs />} />
-          <Route path="/service/:id" element={<ServiceDetail />} />
+          <Route path="/login" element={<Login />} />
+          <Route path="/" element={<RequireAuth><Index /></RequireAuth>} />
+          <Route path="/swarm/nodes" element={<RequireAuth><SwarmNodes /></RequireAuth>} />
+          <Route path="/swarm/stack" element={<RequireAuth><SwarmStack /></RequireAuth>} />
+          <Route path="/swarm/cleanup" element={<RequireAuth><SwarmCleanup /></RequireAuth>} />
+          <Route path="/swarm/logs" element={<RequireAuth><SwarmLogs /></RequireAuth>} />
+          <Route path="/service/:id" element={<RequireAuth><ServiceDetail /></RequireAuth>} />
           {/* ADD ALL CUSTOM ROUTES ABOVE THE CATCH-ALL "*" ROUTE */}
           <Route path="*" element={<NotFound />} />
         </Routes>
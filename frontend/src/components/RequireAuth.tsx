@@ -0,0 +1,45 @@
+import { ReactNode, useEffect, useState } from "react";
+import { Navigate, useLocation, useNavigate } from "react-router-dom";
+import { apiService, UnauthorizedError, UNAUTHORIZED_EVENT } from "@/services/api";
+
+interface RequireAuthProps {
+  children: ReactNode;
+}
+
+// Vérifie la session auprès de /api/auth/me et renvoie vers /login si elle
+// manque ou a expiré ; sans authentification côté backend, laisse tout passer
+export function RequireAuth({ children }: RequireAuthProps) {
+  const location = useLocation();
+  const navigate = useNavigate();
+  const [status, setStatus] = useState<"checking" | "ok" | "unauthorized">("checking");
+
+  useEffect(() => {
+    let cancelled = false;
+    apiService
+      .getCurrentUser()
+      .then(() => !cancelled && setStatus("ok"))
+      .catch((err) => {
+        if (cancelled) return;
+        // Une autre erreur (backend injoignable...) est laissée aux pages
+        setStatus(err instanceof UnauthorizedError ? "unauthorized" : "ok");
+      });
+    return () => {
+      cancelled = true;
+    };
+  }, []);
+
+  useEffect(() => {
+    const onUnauthorized = () =>
+      navigate("/login", { replace: true, state: { from: location.pathname } });
+    window.addEventListener(UNAUTHORIZED_EVENT, onUnauthorized);
+    return () => window.removeEventListener(UNAUTHORIZED_EVENT, onUnauthorized);
+  }, [navigate, location.pathname]);
+
+  if (status === "checking") {
+    return <div className="min-h-screen bg-gray-900" />;
+  }
+  if (status === "unauthorized") {
+    return <Navigate to="/login" replace state={{ from: location.pathname }} />;
+  }
+  return <>{children}</>;
+}
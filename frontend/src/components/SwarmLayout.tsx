@@ -1,10 +1,11 @@
 import { ReactNode } from "react";
-import { Link, useLocation } from "react-router-dom";
+import { Link, useLocation, useNavigate } from "react-router-dom";
 import { cn } from "@/lib/utils";
 import { Button } from "@/components/ui/button";
 import { Badge } from "@/components/ui/badge";
 import { Avatar, AvatarFallback } from "@/components/ui/avatar";
-import { Bell, HelpCircle, User } from "lucide-react";
+import { Bell, HelpCircle, LogOut, User } from "lucide-react";
+import { apiService, getAuthToken } from "@/services/api";
 
 interface SwarmLayoutProps {
   children: ReactNode;
@@ -18,6 +19,12 @@ const navigation = [
 
 export function SwarmLayout({ children }: SwarmLayoutProps) {
   const location = useLocation();
+  const navigate = useNavigate();
+
+  const handleLogout = () => {
+    apiService.logout();
+    navigate("/login");
+  };
 
   return (
     <div className="min-h-screen bg-gray-900 text-white">
@@ -63,6 +70,17 @@ export function SwarmLayout({ children }: SwarmLayoutProps) {
             >
               <HelpCircle className="h-5 w-5" />
             </Button>
+            {getAuthToken() && (
+              <Button
+                variant="ghost"
+                size="icon"
+                className="text-gray-400 hover:text-white"
+                onClick={handleLogout}
+                title="Se déconnecter"
+              >
+                <LogOut className="h-5 w-5" />
+              </Button>
+            )}
             <Avatar className="h-8 w-8">
               <AvatarFallback className="bg-teal-600 text-white">
                 <User className="h-4 w-4" />
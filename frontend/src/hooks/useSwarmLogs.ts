@@ -1,4 +1,4 @@
-import { API_SOCKET_URL } from '@/services/api';
+import { API_SOCKET_URL, withAccessToken } from '@/services/api';
 import { useState, useEffect, useRef, useMemo, useCallback } from 'react';
 
 export interface SwarmLogsOptions {
@@ -55,7 +55,7 @@ export const useSwarmLogs = (options: SwarmLogsOptions = {}) => {
     const wsUrl = `${API_SOCKET_URL}/swarm/logs${queryString ? `?${queryString}` : ''}`;
 
     try {
-      const ws = new WebSocket(wsUrl);
+      const ws = new WebSocket(withAccessToken(wsUrl));
       wsRef.current = ws;
 
       ws.onopen = () => {
@@ -1,6 +1,44 @@
 export const API_BASE_URL = import.meta.env.VITE_API_URL || 'https://swarm.sys.affell.fr/api';
 export const API_SOCKET_URL = API_BASE_URL.replace('http', 'ws');
 
+// Jeton de session conservé entre les rechargements de la page
+const TOKEN_STORAGE_KEY = 'swarm-manager.token';
+
+// Événement émis quand l'API refuse le jeton, pour renvoyer vers la connexion
+export const UNAUTHORIZED_EVENT = 'swarm-manager:unauthorized';
+
+export const getAuthToken = (): string | null => localStorage.getItem(TOKEN_STORAGE_KEY);
+
+export const setAuthToken = (token: string | null) => {
+  if (token) {
+    localStorage.setItem(TOKEN_STORAGE_KEY, token);
+  } else {
+    localStorage.removeItem(TOKEN_STORAGE_KEY);
+  }
+};
+
+// Les navigateurs n'envoient pas de header Authorization lors de l'upgrade
+// WebSocket : le jeton passe par ?access_token=
+export const withAccessToken = (url: string): string => {
+  const token = getAuthToken();
+  if (!token) return url;
+  const separator = url.includes('?') ? '&' : '?';
+  return `${url}${separator}access_token=${encodeURIComponent(token)}`;
+};
+
+export class UnauthorizedError extends Error {
+  constructor(message = 'Authentication required') {
+    super(message);
+    this.name = 'UnauthorizedError';
+  }
+}
+
+export interface AuthUser {
+  name: string;
+  role: 'viewer' | 'operator' | 'admin';
+  method: string;
+}
+
 export interface Node {
   id: string;
   hostname: string;
@@ -9,6 +47,8 @@ export interface Node {
   role: string;
   cpu: string;
   memory: string;
+  cpuCores: number;
+  memoryBytes: number;
   ipAddress: string;
 }
 
@@ -33,14 +73,22 @@ export interface Image {
 
 class ApiService {
   private async fetch(endpoint: string, options?: RequestInit): Promise<any> {
+    const token = getAuthToken();
     const response = await fetch(`${API_BASE_URL}${endpoint}`, {
+      ...options,
       headers: {
         'Content-Type': 'application/json',
+        ...(token ? { Authorization: `Bearer ${token}` } : {}),
         ...options?.headers,
       },
-      ...options,
     });
 
+    if (response.status === 401) {
+      setAuthToken(null);
+      window.dispatchEvent(new Event(UNAUTHORIZED_EVENT));
+      throw new UnauthorizedError();
+    }
+
     if (!response.ok) {
       throw new Error(`API Error: ${response.status} ${response.statusText}`);
     }
@@ -59,6 +107,29 @@ class ApiService {
     return null;
   }
 
+  // Auth API
+  async login(username: string, password: string): Promise<void> {
+    const response = await fetch(`${API_BASE_URL}/auth/login`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ username, password }),
+    });
+    const body = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw new Error(body.error || `API Error: ${response.status} ${response.statusText}`);
+    }
+    setAuthToken(body.token);
+  }
+
+  logout() {
+    setAuthToken(null);
+  }
+
+  // Avec AUTH_DISABLED=true, le backend répond sans jeton
+  async getCurrentUser(): Promise<AuthUser> {
+    return this.fetch('/auth/me');
+  }
+
   // Nodes API
   async getNodes(): Promise<Node[]> {
     return this.fetch('/nodes');
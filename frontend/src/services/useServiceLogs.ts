@@ -1,5 +1,5 @@
 import { useState, useEffect, useRef } from 'react';
-import { API_SOCKET_URL } from './api';
+import { API_SOCKET_URL, withAccessToken } from './api';
 
 export const useServiceLogs = (serviceId: string) => {
   const [logs, setLogs] = useState<string[]>([]);
@@ -21,7 +21,7 @@ export const useServiceLogs = (serviceId: string) => {
       const wsUrl = `${API_SOCKET_URL}/services/${serviceId}/logs`;
 
       try {
-        const ws = new WebSocket(wsUrl);
+        const ws = new WebSocket(withAccessToken(wsUrl));
         wsRef.current = ws;
 
         ws.onopen = () => {